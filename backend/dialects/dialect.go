@@ -14,10 +14,27 @@ type SQLDialect interface {
 	BuildInsertQuery(job models.Job, records []map[string]interface{}) (string, []interface{})
 	BuildSelectQueryByHash(job models.Job, concurrencyIndex, totalConcurrency int, mainTable string) string
 	BuildExplainSelectQueryByHash(job models.Job) string
+	// SupportsHashRead indica se o dialeto gera o EXPLAIN e a leitura particionada por hash
+	SupportsHashRead() bool
 }
 
 type PostgresDialect struct{}
 
+// MySQLDialect reaproveita a contagem e o insert em lote (SQL generico) do Postgres.
+// A leitura particionada por hash depende do Postgres (EXPLAIN JSON, hashtextextended):
+// jobs que leem da origem por ela sao recusados antes da execucao.
+type MySQLDialect struct {
+	PostgresDialect
+}
+
+func (d PostgresDialect) SupportsHashRead() bool {
+	return true
+}
+
+func (d MySQLDialect) SupportsHashRead() bool {
+	return false
+}
+
 func (d PostgresDialect) FetchTotalCount(db *sql.DB, job models.Job) (int, error) {
 	countSQL := fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS count_subquery", job.SelectSQL)
 
@@ -9,6 +9,7 @@ type DialectType string
 
 const (
 	Postgres DialectType = "postgres"
+	MySQL    DialectType = "mysql"
 )
 
 // NewDialect retorna a implementação apropriada do SQLDialect baseado no tipo
@@ -16,6 +17,8 @@ func NewDialect(dbType string) (SQLDialect, error) {
 	switch DialectType(strings.ToLower(dbType)) {
 	case Postgres:
 		return PostgresDialect{}, nil
+	case MySQL:
+		return MySQLDialect{}, nil
 	default:
 		return nil, fmt.Errorf("dialeto desconhecido: %s", dbType)
 	}
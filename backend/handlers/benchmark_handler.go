@@ -196,12 +196,12 @@ func collectDBMetrics(cfg models.DatabaseConfig, probeIterations int, enableWrit
 		return metrics, false
 	}
 
-	db, err := sql.Open(cfg.Type, dsn)
+	db, release, err := sharedDatabase(cfg)
 	if err != nil {
 		metrics.Errors = append(metrics.Errors, fmt.Sprintf("erro ao abrir conexão: %v", err))
 		return metrics, false
 	}
-	defer db.Close()
+	defer release()
 
 	connLatency, err := measureDBPing(db)
 	if err != nil {
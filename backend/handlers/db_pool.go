@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"etl/models"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Pools reutilizaveis (validacao, benchmark) ficam abertos enquanto forem usados.
+const sharedPoolIdleTTL = 10 * time.Minute
+
+type sharedPool struct {
+	db       *sql.DB
+	refs     int // chamadores usando o pool; so pools sem referencia sao fechados
+	lastUsed time.Time
+}
+
+var (
+	sharedPoolsMu sync.Mutex
+	sharedPools   = make(map[string]*sharedPool)
+)
+
+// openDatabase abre um pool dedicado aplicando as configuracoes do banco.
+// Usado pelas execucoes de pipeline, que fecham o pool ao final ou no Stop.
+func openDatabase(cfg models.DatabaseConfig) (*sql.DB, error) {
+	dsn := buildDSN(cfg)
+	if dsn == "" {
+		return nil, fmt.Errorf("tipo de banco nao suportado: %s", cfg.Type)
+	}
+	db, err := sql.Open(cfg.Type, dsn)
+	if err != nil {
+		return nil, err
+	}
+	applyPoolSettings(db, cfg)
+	return db, nil
+}
+
+func applyPoolSettings(db *sql.DB, cfg models.DatabaseConfig) {
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetimeSeconds > 0 {
+		db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeSeconds) * time.Second)
+	}
+}
+
+// sharedDatabase retorna um pool compartilhado para a configuracao informada e a
+// funcao que libera a referencia. O pool nao deve ser fechado pelo chamador; release
+// deve ser chamado quando o uso terminar.
+func sharedDatabase(cfg models.DatabaseConfig) (*sql.DB, func(), error) {
+	key, err := databaseConfigKey(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sharedPoolsMu.Lock()
+	defer sharedPoolsMu.Unlock()
+
+	now := time.Now()
+	for k, pool := range sharedPools {
+		if k != key && pool.refs == 0 && now.Sub(pool.lastUsed) > sharedPoolIdleTTL {
+			_ = pool.db.Close()
+			delete(sharedPools, k)
+		}
+	}
+
+	pool, ok := sharedPools[key]
+	if !ok {
+		db, err := openDatabase(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool = &sharedPool{db: db}
+		sharedPools[key] = pool
+		log.Printf("Pool compartilhado criado para %s/%s (%s)", cfg.Host, cfg.Database, cfg.Type)
+	}
+	pool.refs++
+	pool.lastUsed = now
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			sharedPoolsMu.Lock()
+			pool.refs--
+			pool.lastUsed = time.Now()
+			sharedPoolsMu.Unlock()
+		})
+	}
+	return pool.db, release, nil
+}
+
+func databaseConfigKey(cfg models.DatabaseConfig) (string, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"etl/models"
+	"testing"
+	"time"
+)
+
+func TestSharedDatabaseKeepsReferencedPools(t *testing.T) {
+	cfgA := models.DatabaseConfig{Type: "postgres", Host: "origem", Port: 5432, Database: "a"}
+	cfgB := models.DatabaseConfig{Type: "postgres", Host: "destino", Port: 5432, Database: "b"}
+	keyA, _ := databaseConfigKey(cfgA)
+
+	_, releaseA, err := sharedDatabase(cfgA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	age := func() {
+		sharedPoolsMu.Lock()
+		sharedPools[keyA].lastUsed = time.Now().Add(-2 * sharedPoolIdleTTL)
+		sharedPoolsMu.Unlock()
+	}
+	exists := func() bool {
+		sharedPoolsMu.Lock()
+		defer sharedPoolsMu.Unlock()
+		_, ok := sharedPools[keyA]
+		return ok
+	}
+
+	// Em uso ha mais tempo que o TTL: continua aberto
+	age()
+	_, releaseB, err := sharedDatabase(cfgB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseB()
+	if !exists() {
+		t.Fatalf("pool em uso foi fechado")
+	}
+
+	releaseA()
+	releaseA() // liberar duas vezes nao desconta outra referencia
+	age()
+	_, releaseB, _ = sharedDatabase(cfgB)
+	releaseB()
+	if exists() {
+		t.Errorf("pool ocioso sem referencia nao foi fechado")
+	}
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"etl/dialects"
 	"etl/models"
@@ -9,9 +8,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"etl/jobrunner"
@@ -50,7 +51,7 @@ func RunProject(c *gin.Context) {
 	log.Printf("Dialeto %s criado com sucesso", project.SourceDatabase.Type)
 
 	// Conecta ao banco de dados de origem
-	sourceDB, err := sql.Open(project.SourceDatabase.Type, buildDSN(project.SourceDatabase))
+	sourceDB, err := openDatabase(project.SourceDatabase)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao conectar no banco de origem"})
 		log.Println("Erro ao conectar no banco de origem:", err)
@@ -59,7 +60,7 @@ func RunProject(c *gin.Context) {
 	log.Printf("Conexão com o banco de origem %s estabelecida", project.SourceDatabase.Database)
 
 	// Conecta ao banco de dados de destino
-	destDB, err := sql.Open(project.DestinationDatabase.Type, buildDSN(project.DestinationDatabase))
+	destDB, err := openDatabase(project.DestinationDatabase)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao conectar no banco de destino"})
 		log.Println("Erro ao conectar no banco de destino:", err)
@@ -69,75 +70,33 @@ func RunProject(c *gin.Context) {
 
 	// cria o JobRunner
 	runner := jobrunner.NewJobRunner(sourceDB, destDB, buildDSN(project.SourceDatabase), buildDSN(project.DestinationDatabase), dialect, project.Concurrency, project.ProjectName, projectID)
+	runner.ApplySourceThrottle(project)
+	runner.ApplyJobScheduler(project)
 	jobrunner.SetActiveRunner(runner)
 
 	// Carregar os jobs
-	jobCount := 0
-	for _, jobPath := range project.Jobs {
-
-		// Lê o JSON do job
-		fullPath := filepath.Join("data", "projects", projectID, jobPath)
-		jobBytes, err := os.ReadFile(fullPath)
-		if err != nil {
-			log.Printf("Erro ao ler job %s: %v", jobPath, err)
-			continue
-		}
-
-		// Deserializa o JSON do job
-		var job models.Job
-		if err := json.Unmarshal(jobBytes, &job); err == nil {
-			runner.JobMap[job.ID] = job
-			log.Printf("Job %s carregado do caminho %s", job.ID, fullPath)
-			runner.JobOrder = append(runner.JobOrder, job.ID)
-
-			// Atualizar status de todos os jobs para pendente
-			status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
-				js.Status = "pending"
-				js.StartedAt = nil
-				js.EndedAt = nil
-				js.Processed = 0
-				js.Total = 0
-				js.Progress = 0
-				js.Error = ""
-				status.NotifySubscribers()
-			})
-
-			jobCount++
-		} else {
-			log.Printf("Erro ao interpretar job %s: %v", jobPath, err)
-		}
-	}
-	if jobCount == 0 {
+	runner.JobMap, runner.JobOrder = loadProjectJobs(projectID, project)
+	if len(runner.JobOrder) == 0 {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Nenhum job foi carregado"})
 		log.Println("Nenhum job foi carregado do projeto")
 		return
 	}
-
-	// Carregar conexões
-	for _, conn := range project.Connections {
-		runner.ConnMap[conn.Source] = append(runner.ConnMap[conn.Source], conn.Target)
-		log.Printf("Conexão adicionada: %s -> %s", conn.Source, conn.Target)
-	}
-
-	// Detectar jobs raiz
-	usedTargets := make(map[string]bool)
-	for _, conn := range project.Connections {
-		usedTargets[conn.Target] = true
+	if err := jobrunner.ValidateSourceDialect(dialect, runner.JobMap, runner.JobOrder); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		log.Println("Jobs incompatíveis com o banco de origem:", err)
+		return
 	}
-	log.Printf("Jobs usados como destino: %v", usedTargets)
 
-	var startJobs []string
+	// Atualizar status de todos os jobs para pendente
 	for _, id := range runner.JobOrder {
-		if !usedTargets[id] {
-			startJobs = append(startJobs, id)
-		}
+		resetJobStatus(id)
 	}
 
-	// Fallback: se nenhuma conexão definida, executa todos
-	if len(startJobs) == 0 {
-		log.Println("Nenhum job raiz detectado — executando todos os jobs.")
-		startJobs = append(startJobs, runner.JobOrder...)
-	}
+	// Carregar conexões
+	runner.ConnMap = projectConnMap(project)
+
+	// Detectar jobs raiz (sem conexões, executa todos)
+	startJobs := jobrunner.RootJobIDs(runner.JobOrder, runner.ConnMap)
 
 	if len(startJobs) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Nenhum job para executar"})
@@ -176,7 +135,7 @@ func ResumeJob(c *gin.Context) {
 	}
 	log.Printf("Dialeto %s criado com sucesso", project.SourceDatabase.Type)
 
-	sourceDB, err := sql.Open(project.SourceDatabase.Type, buildDSN(project.SourceDatabase))
+	sourceDB, err := openDatabase(project.SourceDatabase)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao conectar no banco de origem"})
 		log.Println("Erro ao conectar no banco de origem:", err)
@@ -184,7 +143,7 @@ func ResumeJob(c *gin.Context) {
 	}
 	log.Printf("Conex??o com o banco de origem %s estabelecida", project.SourceDatabase.Database)
 
-	destDB, err := sql.Open(project.DestinationDatabase.Type, buildDSN(project.DestinationDatabase))
+	destDB, err := openDatabase(project.DestinationDatabase)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao conectar no banco de destino"})
 		log.Println("Erro ao conectar no banco de destino:", err)
@@ -193,33 +152,22 @@ func ResumeJob(c *gin.Context) {
 	log.Printf("Conex??o com o banco de destino %s estabelecida", project.DestinationDatabase.Database)
 
 	runner := jobrunner.NewJobRunner(sourceDB, destDB, buildDSN(project.SourceDatabase), buildDSN(project.DestinationDatabase), dialect, project.Concurrency, project.ProjectName, projectID)
+	runner.ApplySourceThrottle(project)
+	runner.ApplyJobScheduler(project)
 	jobrunner.SetActiveRunner(runner)
 
 	// Carregar os jobs
-	jobCount := 0
-	for _, jobPath := range project.Jobs {
-		fullPath := filepath.Join("data", "projects", projectID, jobPath)
-		jobBytes, err := os.ReadFile(fullPath)
-		if err != nil {
-			log.Printf("Erro ao ler job %s: %v", jobPath, err)
-			continue
-		}
-
-		var job models.Job
-		if err := json.Unmarshal(jobBytes, &job); err == nil {
-			runner.JobMap[job.ID] = job
-			log.Printf("Job %s carregado do caminho %s", job.ID, fullPath)
-			runner.JobOrder = append(runner.JobOrder, job.ID)
-			jobCount++
-		} else {
-			log.Printf("Erro ao interpretar job %s: %v", jobPath, err)
-		}
-	}
-	if jobCount == 0 {
+	runner.JobMap, runner.JobOrder = loadProjectJobs(projectID, project)
+	if len(runner.JobOrder) == 0 {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Nenhum job foi carregado"})
 		log.Println("Nenhum job foi carregado do projeto")
 		return
 	}
+	if err := jobrunner.ValidateSourceDialect(dialect, runner.JobMap, runner.JobOrder); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		log.Println("Jobs incompatíveis com o banco de origem:", err)
+		return
+	}
 
 	if _, ok := runner.JobMap[jobID]; !ok {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Job n??o encontrado no projeto"})
@@ -227,10 +175,7 @@ func ResumeJob(c *gin.Context) {
 	}
 
 	// Carregar conex??es
-	for _, conn := range project.Connections {
-		runner.ConnMap[conn.Source] = append(runner.ConnMap[conn.Source], conn.Target)
-		log.Printf("Conex??o adicionada: %s -> %s", conn.Source, conn.Target)
-	}
+	runner.ConnMap = projectConnMap(project)
 
 	// Marca apenas o job inicial e seus dependentes como pendentes
 	reachable := collectDownstreamJobs(jobID, runner.ConnMap)
@@ -266,16 +211,7 @@ func ResumeJob(c *gin.Context) {
 	}
 
 	for _, id := range orderedJobIDs(pendingSet, runner.JobOrder) {
-		status.UpdateJobStatus(id, func(js *status.JobStatus) {
-			js.Status = "pending"
-			js.StartedAt = nil
-			js.EndedAt = nil
-			js.Processed = 0
-			js.Total = 0
-			js.Progress = 0
-			js.Error = ""
-			status.NotifySubscribers()
-		})
+		resetJobStatus(id)
 	}
 
 	for _, id := range preloadMemoryJobs {
@@ -290,6 +226,88 @@ func ResumeJob(c *gin.Context) {
 	log.Printf("Retomada do job %s iniciada para o projeto %s (preload memory-select: %v)", jobID, project.ProjectName, preloadMemoryJobs)
 }
 
+// loadProjectJobs le os arquivos de job do projeto na ordem declarada.
+// Jobs ilegiveis sao registrados no log e ignorados.
+func loadProjectJobs(projectID string, project models.Project) (map[string]models.Job, []string) {
+	jobMap := make(map[string]models.Job, len(project.Jobs))
+	jobOrder := make([]string, 0, len(project.Jobs))
+	for _, jobPath := range project.Jobs {
+		fullPath := filepath.Join("data", "projects", projectID, jobPath)
+		jobBytes, err := os.ReadFile(fullPath)
+		if err != nil {
+			log.Printf("Erro ao ler job %s: %v", jobPath, err)
+			continue
+		}
+
+		var job models.Job
+		if err := json.Unmarshal(jobBytes, &job); err != nil {
+			log.Printf("Erro ao interpretar job %s: %v", jobPath, err)
+			continue
+		}
+		jobMap[job.ID] = job
+		jobOrder = append(jobOrder, job.ID)
+		log.Printf("Job %s carregado do caminho %s", job.ID, fullPath)
+	}
+	return jobMap, jobOrder
+}
+
+func projectConnMap(project models.Project) map[string][]string {
+	connMap := make(map[string][]string)
+	for _, conn := range project.Connections {
+		connMap[conn.Source] = append(connMap[conn.Source], conn.Target)
+		log.Printf("Conexão adicionada: %s -> %s", conn.Source, conn.Target)
+	}
+	return connMap
+}
+
+func resetJobStatus(jobID string) {
+	status.UpdateJobStatus(jobID, func(js *status.JobStatus) {
+		js.Status = "pending"
+		js.StartedAt = nil
+		js.EndedAt = nil
+		js.Processed = 0
+		js.Total = 0
+		js.Progress = 0
+		js.Error = ""
+		status.NotifySubscribers()
+	})
+}
+
+// loadSubproject carrega outro projeto para execucao dentro de um job subproject.
+func loadSubproject(projectID string) (*jobrunner.SubprojectDefinition, error) {
+	project, err := loadProjectFile(filepath.Join("data", "projects", projectID, "project.json"))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler project.json do projeto %s: %w", projectID, err)
+	}
+	decryptProjectFields(&project)
+
+	dialect, err := dialects.NewDialect(project.SourceDatabase.Type)
+	if err != nil {
+		return nil, err
+	}
+	jobMap, jobOrder := loadProjectJobs(projectID, project)
+	if len(jobOrder) == 0 {
+		return nil, fmt.Errorf("nenhum job foi carregado do projeto %s", project.ProjectName)
+	}
+	if err := jobrunner.ValidateSourceDialect(dialect, jobMap, jobOrder); err != nil {
+		return nil, fmt.Errorf("projeto %s: %w", project.ProjectName, err)
+	}
+	return &jobrunner.SubprojectDefinition{
+		Project:        project,
+		Dialect:        dialect,
+		SourceDSN:      buildDSN(project.SourceDatabase),
+		DestinationDSN: buildDSN(project.DestinationDatabase),
+		JobMap:         jobMap,
+		JobOrder:       jobOrder,
+		ConnMap:        projectConnMap(project),
+		OpenDatabase:   openDatabase,
+	}, nil
+}
+
+func init() {
+	jobrunner.SetSubprojectLoader(loadSubproject)
+}
+
 func StopProject(c *gin.Context) {
 	projectID := c.Param("id")
 	stopped := jobrunner.StopActiveRunner(projectID, "interrompido via endpoint")
@@ -303,14 +321,39 @@ func StopProject(c *gin.Context) {
 func buildDSN(cfg models.DatabaseConfig) string {
 	switch cfg.Type {
 	case "postgres":
-		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database)
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database)
+		if name := strings.TrimSpace(cfg.ApplicationName); name != "" {
+			dsn += " application_name=" + quotePostgresDSNValue(name)
+		}
+		if cfg.StatementTimeoutMs > 0 {
+			dsn += fmt.Sprintf(" options='-c statement_timeout=%d'", cfg.StatementTimeoutMs)
+		}
+		return dsn
 	case "mysql":
-		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
+		params := url.Values{}
+		if name := strings.TrimSpace(cfg.ApplicationName); name != "" {
+			// connectionAttributes usa ':' e ',' como separadores
+			name = strings.NewReplacer(":", "_", ",", "_").Replace(name)
+			params.Set("connectionAttributes", "program_name:"+name)
+		}
+		if cfg.StatementTimeoutMs > 0 {
+			params.Set("max_execution_time", strconv.Itoa(cfg.StatementTimeoutMs))
+		}
+		if len(params) > 0 {
+			dsn += "?" + params.Encode()
+		}
+		return dsn
 	default:
 		return ""
 	}
 }
 
+func quotePostgresDSNValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + escaped + "'"
+}
+
 func collectDownstreamJobs(startID string, connMap map[string][]string) map[string]struct{} {
 	visited := make(map[string]struct{})
 	stack := []string{startID}
@@ -345,6 +388,13 @@ func collectMapKeysForJobs(jobIDs map[string]struct{}, jobMap map[string]models.
 		for _, key := range mapKeys {
 			keys[key] = struct{}{}
 		}
+		lookupKeys, err := jobrunner.LookupMapKeys(job.Lookups)
+		if err != nil {
+			return nil, fmt.Errorf("job %s (%s): lookup: %w", job.ID, job.JobName, err)
+		}
+		for _, key := range lookupKeys {
+			keys[key] = struct{}{}
+		}
 	}
 	return keys, nil
 }
@@ -1,9 +1,9 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"etl/dialects"
+	"etl/jobrunner"
 	"etl/models"
 	"fmt"
 	"io/ioutil"
@@ -159,19 +159,28 @@ func ValidateJobHandler(c *gin.Context) {
 	req.SelectSQL = substituteValidationVariables(req.SelectSQL, projectVariables)
 	req.InsertSQL = substituteValidationVariables(req.InsertSQL, projectVariables)
 
-	// Conecta ao banco de dados de origem
-	sourceDB, err := sql.Open(project.SourceDatabase.Type, buildDSN(project.SourceDatabase))
+	if err := validateJobExpressions(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ValidateJobResponse{
+			Valid: false, Message: fmt.Sprintf("Erro na expressao: %v", err),
+		})
+		return
+	}
+
+	// Conecta ao banco de dados de origem (pool compartilhado)
+	sourceDB, releaseSource, err := sharedDatabase(project.SourceDatabase)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao conectar no banco de origem"})
 		return
 	}
+	defer releaseSource()
 
-	// Conecta ao banco de dados de destino
-	destDB, err := sql.Open(project.DestinationDatabase.Type, buildDSN(project.DestinationDatabase))
+	// Conecta ao banco de dados de destino (pool compartilhado)
+	destDB, releaseDest, err := sharedDatabase(project.DestinationDatabase)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao conectar no banco de destino"})
 		return
 	}
+	defer releaseDest()
 
 	if req.Limit <= 0 {
 		req.Limit = 10
@@ -206,7 +215,8 @@ func ValidateJobHandler(c *gin.Context) {
 	}
 
 	validationDB := sourceDB
-	if selectOnlyValidation {
+	if selectOnlyValidation && !jobrunner.IsSourceConnection(req.Connection) {
+		// Mesmo banco usado na execucao (resolveExecutionDB): destino, salvo connection=origem
 		validationDB = destDB
 	}
 
@@ -267,10 +277,12 @@ func ValidateJobHandler(c *gin.Context) {
 		return
 	}
 
-	if len(columns) != len(insertCols) {
+	// Colunas dos lookups e calculadas entram no INSERT junto com as do SELECT
+	expectedCols := columnsWithComputed(columnsWithLookups(columns, req.Lookups), req.ComputedColumns)
+	if len(expectedCols) != len(insertCols) {
 		c.JSON(http.StatusBadRequest, models.ValidateJobResponse{
 			Valid:   false,
-			Message: fmt.Sprintf("Número de colunas incompatível. SELECT tem %d, INSERT tem %d", len(columns), len(insertCols)),
+			Message: fmt.Sprintf("Número de colunas incompatível. SELECT tem %d, INSERT tem %d", len(expectedCols), len(insertCols)),
 		})
 
 		return
@@ -332,7 +344,7 @@ func ValidateJobHandler(c *gin.Context) {
 func isSelectOnlyValidation(req models.ValidateJobRequest) bool {
 	jobType := strings.ToLower(strings.TrimSpace(req.Type))
 	mode := strings.ToLower(strings.TrimSpace(req.ValidationMode))
-	return jobType == "memory-select" || mode == "select-only"
+	return jobType == "memory-select" || jobType == "export-file" || mode == "select-only"
 }
 
 func containsMapDirective(sqlText string) bool {
@@ -502,3 +514,59 @@ func extractInsertColumns(sql string) ([]string, error) {
 	println("Colunas extraídas: %v\n", cols)
 	return cols, nil
 }
+
+// validateJobExpressions compila o filtro e as colunas calculadas do job.
+func validateJobExpressions(req models.ValidateJobRequest) error {
+	if strings.TrimSpace(req.Filter) != "" {
+		if err := jobrunner.ValidateExpression(req.Filter); err != nil {
+			return fmt.Errorf("filtro: %v", err)
+		}
+	}
+	for i, col := range req.ComputedColumns {
+		if strings.TrimSpace(col.Name) == "" {
+			return fmt.Errorf("coluna calculada %d sem nome", i+1)
+		}
+		if err := jobrunner.ValidateExpression(col.Expression); err != nil {
+			return fmt.Errorf("coluna calculada '%s': %v", col.Name, err)
+		}
+	}
+	return nil
+}
+
+func columnsWithLookups(columns []string, lookups []models.LookupStep) []string {
+	extra := jobrunner.LookupOutputColumns(lookups)
+	if len(extra) == 0 {
+		return columns
+	}
+	seen := make(map[string]bool, len(columns))
+	out := append([]string{}, columns...)
+	for _, col := range columns {
+		seen[col] = true
+	}
+	for _, col := range extra {
+		if !seen[col] {
+			seen[col] = true
+			out = append(out, col)
+		}
+	}
+	return out
+}
+
+func columnsWithComputed(columns []string, computed []models.ComputedColumn) []string {
+	if len(computed) == 0 {
+		return columns
+	}
+	seen := make(map[string]bool, len(columns))
+	out := append([]string{}, columns...)
+	for _, col := range columns {
+		seen[col] = true
+	}
+	for _, col := range computed {
+		name := strings.TrimSpace(col.Name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"etl/jobrunner"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListMapCache lista os maps de memory-select gravados em cache no projeto
+func ListMapCache(c *gin.Context) {
+	projectID := c.Param("id")
+	if _, err := loadProject(projectID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Projeto não encontrado"})
+		return
+	}
+
+	entries, err := jobrunner.ListMapCache(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Erro ao listar cache: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// InvalidateMapCache remove um map do cache (ou todos, quando a chave não é informada)
+func InvalidateMapCache(c *gin.Context) {
+	projectID := c.Param("id")
+	if _, err := loadProject(projectID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Projeto não encontrado"})
+		return
+	}
+
+	removed, err := jobrunner.InvalidateMapCache(projectID, c.Param("key"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Erro ao invalidar cache: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
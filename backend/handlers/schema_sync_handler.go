@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"etl/jobrunner"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SchemaSyncJob gera o DDL da tabela de destino de um job a partir dos tipos do SelectSQL.
+// Com ?preview=true (ou schemaSync.preview no job) apenas retorna os comandos.
+func SchemaSyncJob(c *gin.Context) {
+	projectID := c.Param("id")
+	jobID := c.Param("jobId")
+
+	project, err := loadProjectFile(filepath.Join("data", "projects", projectID, "project.json"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Projeto não encontrado"})
+		return
+	}
+	decryptProjectFields(&project)
+
+	jobMap, _ := loadProjectJobs(projectID, project)
+	job, ok := jobMap[jobID]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job não encontrado"})
+		return
+	}
+
+	// Job schema-sync aponta o job de carga; os demais usam o proprio SQL
+	preview := strings.EqualFold(c.Query("preview"), "true")
+	var columnTypes map[string]string
+	if job.SchemaSync != nil {
+		preview = preview || job.SchemaSync.Preview
+		columnTypes = job.SchemaSync.ColumnTypes
+		if targetID := strings.TrimSpace(job.SchemaSync.JobID); targetID != "" {
+			target, ok := jobMap[targetID]
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Job %s não encontrado", targetID)})
+				return
+			}
+			job = target
+		}
+	}
+
+	projectVariables := projectVariablesMap(project)
+	job.SelectSQL = substituteValidationVariables(job.SelectSQL, projectVariables)
+	job.InsertSQL = substituteValidationVariables(job.InsertSQL, projectVariables)
+
+	sourceDB, releaseSource, err := sharedDatabase(project.SourceDatabase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao conectar no banco de origem"})
+		return
+	}
+	defer releaseSource()
+	destDB, releaseDest, err := sharedDatabase(project.DestinationDatabase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao conectar no banco de destino"})
+		return
+	}
+	defer releaseDest()
+
+	destType := strings.ToLower(project.DestinationDatabase.Type)
+	plan, err := jobrunner.PlanSchemaSync(c.Request.Context(), sourceDB, destDB, destType, job, columnTypes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Erro ao gerar DDL: %v", err)})
+		return
+	}
+	if !preview {
+		if err := jobrunner.ApplySchemaSync(c.Request.Context(), destDB, destType, plan); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Erro ao aplicar DDL: %v", err), "plan": plan})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, plan)
+}
@@ -0,0 +1,378 @@
+package jobrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"etl/logger"
+	"etl/models"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAPIMaxRetries = 3
+	// Limite de uma pagina da API (a pagina inteira e decodificada em memoria)
+	maxAPIPageBytes = 64 << 20
+	// Paginas detalhadas no log do pipeline por job
+	maxAPIPageLogs = 1000
+)
+
+var linkNextPattern = regexp.MustCompile(`<([^>]+)>\s*;[^,]*rel="?next"?`)
+
+// apiPageLogger recebe o registro de cada pagina buscada.
+type apiPageLogger func(batch logger.BatchLog)
+
+// resolveAPIJobSpec valida a configuracao do job api-extract.
+func resolveAPIJobSpec(job models.Job) (models.APISourceSpec, error) {
+	if job.API == nil || strings.TrimSpace(job.API.URL) == "" {
+		return models.APISourceSpec{}, fmt.Errorf("job api-extract sem url configurada")
+	}
+	if strings.TrimSpace(job.InsertSQL) == "" || len(job.Columns) == 0 {
+		return models.APISourceSpec{}, fmt.Errorf("job api-extract exige InsertSQL e Columns")
+	}
+	spec := *job.API
+	switch strings.ToLower(strings.TrimSpace(spec.Pagination.Type)) {
+	case "", "none", "page", "offset", "link":
+	case "cursor":
+		if strings.TrimSpace(spec.Pagination.CursorPath) == "" {
+			return spec, fmt.Errorf("paginacao cursor exige cursorPath")
+		}
+	default:
+		return spec, fmt.Errorf("tipo de paginacao '%s' desconhecido", spec.Pagination.Type)
+	}
+	for i, col := range spec.Columns {
+		if strings.TrimSpace(col.Name) == "" {
+			return spec, fmt.Errorf("coluna %d do mapeamento sem nome", i+1)
+		}
+		if err := validateImportType(col); err != nil {
+			return spec, err
+		}
+	}
+	return spec, nil
+}
+
+// readAPIPages busca as paginas em sequencia e entrega os registros ao handler.
+// Falhas de requisicao (apos as tentativas) interrompem a leitura; erros de registro vao ao handler.
+func (jr *JobRunner) readAPIPages(ctx context.Context, spec models.APISourceSpec, handle importFileHandler, logPage apiPageLogger) error {
+	rawURL := strings.TrimSpace(jr.SubstituteVariables(spec.URL))
+	baseURL, err := url.Parse(rawURL)
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") {
+		return fmt.Errorf("url invalida: %s", spec.URL)
+	}
+	fields := make([]importField, len(spec.Columns))
+	for i, col := range spec.Columns {
+		fields[i] = importField{column: col, layout: convertDateLayout(col.InputFormat)}
+	}
+
+	pagination := spec.Pagination
+	paging := strings.ToLower(strings.TrimSpace(pagination.Type))
+	param := strings.TrimSpace(pagination.Param)
+	if param == "" {
+		switch paging {
+		case "page", "offset", "cursor":
+			param = paging
+		}
+	}
+	position := pagination.Start
+	if paging == "page" && position <= 0 {
+		position = 1
+	}
+	cursor := ""
+	nextURL := baseURL.String()
+	fetched := 0
+
+	for page := 1; ; page++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if pagination.MaxPages > 0 && page > pagination.MaxPages {
+			log.Printf("api-extract: limite de %d pagina(s) atingido", pagination.MaxPages)
+			return nil
+		}
+
+		pageURL, err := url.Parse(nextURL)
+		if err != nil {
+			return fmt.Errorf("pagina %d: url invalida: %w", page, err)
+		}
+		if paging == "page" || paging == "offset" || (paging == "cursor" && cursor != "") {
+			query := pageURL.Query()
+			switch paging {
+			case "cursor":
+				query.Set(param, cursor)
+			default:
+				query.Set(param, strconv.Itoa(position))
+			}
+			if pagination.SizeParam != "" && pagination.Size > 0 {
+				query.Set(pagination.SizeParam, strconv.Itoa(pagination.Size))
+			}
+			pageURL.RawQuery = query.Encode()
+		} else if paging != "link" && pagination.SizeParam != "" && pagination.Size > 0 {
+			query := pageURL.Query()
+			query.Set(pagination.SizeParam, strconv.Itoa(pagination.Size))
+			pageURL.RawQuery = query.Encode()
+		}
+
+		pageStart := time.Now()
+		body, header, retries, err := jr.fetchAPIPage(ctx, spec, pageURL.String())
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("pagina %d: %w", page, err)
+		}
+
+		var doc interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return fmt.Errorf("pagina %d: resposta nao e json: %v", page, err)
+		}
+		node, ok := lookupJSONPath(doc, spec.RecordsPath)
+		if !ok {
+			return fmt.Errorf("pagina %d: caminho '%s' nao encontrado na resposta", page, spec.RecordsPath)
+		}
+		var records []interface{}
+		switch v := node.(type) {
+		case []interface{}:
+			records = v
+		case nil:
+		default:
+			return fmt.Errorf("pagina %d: '%s' nao e uma lista de registros", page, spec.RecordsPath)
+		}
+
+		if page <= maxAPIPageLogs {
+			batch := logger.BatchLog{
+				Offset:    fetched,
+				Limit:     len(records),
+				Status:    "fetched",
+				Rows:      len(records),
+				Page:      page,
+				StartedAt: pageStart,
+				EndedAt:   time.Now(),
+			}
+			if retries > 0 {
+				batch.Error = fmt.Sprintf("%d nova(s) tentativa(s)", retries)
+			}
+			logPage(batch)
+		}
+		fetched += len(records)
+
+		for i, item := range records {
+			pos := importPosition{page: page, line: i + 1}
+			obj, isObject := item.(map[string]interface{})
+			var rec map[string]interface{}
+			var recErr error
+			if !isObject {
+				rec = map[string]interface{}{}
+				recErr = fmt.Errorf("registro nao e um objeto json")
+			} else {
+				rec, recErr = apiRecord(obj, fields)
+			}
+			if !handle(rec, pos, recErr) {
+				return nil
+			}
+		}
+
+		// Condicoes de parada por tipo de paginacao
+		switch paging {
+		case "page", "offset":
+			if len(records) == 0 || (pagination.Size > 0 && len(records) < pagination.Size) {
+				return nil
+			}
+			if paging == "page" {
+				position++
+			} else {
+				position += len(records)
+			}
+		case "cursor":
+			next, ok := lookupJSONPath(doc, pagination.CursorPath)
+			if !ok || next == nil || len(records) == 0 {
+				return nil
+			}
+			nextCursor := jsonValueString(next)
+			if nextCursor == "" || nextCursor == cursor {
+				return nil
+			}
+			cursor = nextCursor
+		case "link":
+			link := nextLinkURL(header.Get("Link"))
+			if link == "" {
+				return nil
+			}
+			resolved, err := pageURL.Parse(link)
+			if err != nil {
+				return fmt.Errorf("pagina %d: link next invalido: %w", page, err)
+			}
+			nextURL = resolved.String()
+		default:
+			return nil
+		}
+	}
+}
+
+// fetchAPIPage faz a requisicao com novas tentativas em 429/5xx e falhas de rede.
+// Retorna o corpo, os cabecalhos e o numero de novas tentativas feitas.
+func (jr *JobRunner) fetchAPIPage(ctx context.Context, spec models.APISourceSpec, pageURL string) ([]byte, http.Header, int, error) {
+	method := strings.ToUpper(strings.TrimSpace(spec.Method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	body := jr.SubstituteVariables(spec.Body)
+	timeout := defaultHTTPTimeout
+	if spec.TimeoutSeconds > 0 {
+		timeout = time.Duration(spec.TimeoutSeconds) * time.Second
+	}
+	maxRetries := spec.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultAPIMaxRetries
+	}
+
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		respBody, header, statusCode, err := jr.doAPIRequest(ctx, spec, method, pageURL, body, timeout)
+		retryable := false
+		var wait time.Duration
+		switch {
+		case err != nil:
+			lastErr = err
+			retryable = ctx.Err() == nil
+		case statusCode == http.StatusTooManyRequests || statusCode >= 500:
+			lastErr = fmt.Errorf("status %d", statusCode)
+			retryable = true
+			wait = retryAfterDelay(header.Get("Retry-After"))
+		case statusCode < 200 || statusCode >= 300:
+			return nil, header, attempt, fmt.Errorf("status %d nao esperado", statusCode)
+		default:
+			return respBody, header, attempt, nil
+		}
+		if !retryable || attempt >= maxRetries {
+			return nil, header, attempt, lastErr
+		}
+		if wait <= 0 {
+			wait = time.Duration(1<<attempt) * time.Second
+		}
+		log.Printf("api-extract: %v, nova tentativa em %s (%d/%d)", lastErr, wait, attempt+1, maxRetries)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, header, attempt, ctx.Err()
+		}
+	}
+}
+
+func (jr *JobRunner) doAPIRequest(ctx context.Context, spec models.APISourceSpec, method, pageURL, body string, timeout time.Duration) ([]byte, http.Header, int, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var reader io.Reader
+	if body != "" {
+		reader = bytes.NewBufferString(body)
+	}
+	req, err := http.NewRequestWithContext(reqCtx, method, pageURL, reader)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range spec.Headers {
+		req.Header.Set(name, jr.SubstituteVariables(value))
+	}
+	if body != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := jr.httpDoer().Do(req)
+	if err != nil {
+		if reqCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return nil, nil, 0, fmt.Errorf("timeout de %s excedido", timeout)
+		}
+		return nil, nil, 0, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxAPIPageBytes+1))
+	if err != nil {
+		return nil, resp.Header, resp.StatusCode, fmt.Errorf("erro ao ler resposta: %w", err)
+	}
+	if len(respBody) > maxAPIPageBytes {
+		return nil, resp.Header, resp.StatusCode, fmt.Errorf("resposta maior que %d bytes", maxAPIPageBytes)
+	}
+	return respBody, resp.Header, resp.StatusCode, nil
+}
+
+// retryAfterDelay interpreta o cabecalho Retry-After (segundos ou data HTTP).
+func retryAfterDelay(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// nextLinkURL extrai a url rel="next" do cabecalho Link (RFC 8288).
+func nextLinkURL(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		if match := linkNextPattern.FindStringSubmatch(part); match != nil {
+			return strings.TrimSpace(match[1])
+		}
+	}
+	return ""
+}
+
+// apiRecord aplica o mapeamento de colunas (caminhos JSON) ao registro; sem
+// mapeamento o registro e achatado com chaves aninhadas unidas por "_".
+func apiRecord(obj map[string]interface{}, fields []importField) (map[string]interface{}, error) {
+	if len(fields) == 0 {
+		rec := make(map[string]interface{}, len(obj))
+		flattenAPIObject(rec, "", obj)
+		return rec, nil
+	}
+	rec := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		path := field.column.Source
+		if path == "" {
+			path = field.column.Name
+		}
+		raw, _ := lookupJSONPath(obj, path)
+		val := normalizeJSONImportValue(raw)
+		if val == nil {
+			rec[field.column.Name] = nil
+			continue
+		}
+		converted, err := castImportValue(val, field)
+		if err != nil {
+			return rec, err
+		}
+		rec[field.column.Name] = converted
+	}
+	return rec, nil
+}
+
+func flattenAPIObject(rec map[string]interface{}, prefix string, obj map[string]interface{}) {
+	for key, val := range obj {
+		name := key
+		if prefix != "" {
+			name = prefix + "_" + key
+		}
+		if nested, ok := val.(map[string]interface{}); ok {
+			flattenAPIObject(rec, name, nested)
+			continue
+		}
+		rec[name] = normalizeJSONImportValue(val)
+	}
+}
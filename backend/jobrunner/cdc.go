@@ -0,0 +1,501 @@
+package jobrunner
+
+import (
+	"database/sql"
+	"encoding/json"
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Jobs cdc replicam no destino as alteracoes de uma tabela de origem. Cada lote de
+// transacoes e aplicado em uma transacao do destino; so depois do commit a posicao
+// e confirmada na origem e gravada em data/projects/<id>/state/cdc_<jobId>.json.
+
+const defaultCDCBatchSize = 10000
+
+// cdcState e a posicao confirmada de um job cdc.
+type cdcState struct {
+	JobID     string    `json:"job_id"`
+	Slot      string    `json:"slot,omitempty"`
+	LSN       string    `json:"lsn,omitempty"`
+	File      string    `json:"file,omitempty"`     // mysql: arquivo do binlog
+	Position  uint32    `json:"position,omitempty"` // mysql: posicao no arquivo
+	GTIDSet   string    `json:"gtid_set,omitempty"` // mysql: GTIDs aplicados
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// cdcRunResult resume uma execucao do job cdc.
+type cdcRunResult struct {
+	Upserts      int
+	Deletes      int
+	Truncates    int
+	Transactions int
+	Position     string
+}
+
+// cdcChange e uma alteracao da tabela replicada. Kind: I, U, D ou T (truncate).
+type cdcChange struct {
+	Kind byte
+	New  map[string]interface{}
+	Old  map[string]interface{}
+}
+
+// cdcTarget descreve a tabela de destino e as colunas usadas para aplicar as alteracoes.
+type cdcTarget struct {
+	Table   string   // nome ja com aspas
+	Keys    []string // PrimaryKeys do job
+	Columns []string // colunas replicadas (vazio = todas as recebidas)
+	Masker  *rowMasker
+}
+
+func (jr *JobRunner) runCDCJob(jobID string, job models.Job) {
+	log.Printf("Iniciando job cdc: %s", job.JobName)
+
+	jr.WaitGroup.Add(1)
+	go func() {
+		defer jr.WaitGroup.Done()
+		if jr.shouldStop() {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", time.Now())
+			return
+		}
+
+		releaseJobSlot, err := jr.acquireJobSlot(jobID, job)
+		defer releaseJobSlot()
+		if err != nil {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", time.Now())
+			return
+		}
+
+		start := time.Now()
+		logger.AddJob(jr.PipelineLog, logger.JobLog{
+			JobID:       jobID,
+			JobName:     job.JobName,
+			Status:      "running",
+			StopOnError: job.StopOnError,
+			StartedAt:   start,
+			Batches:     make([]logger.BatchLog, 0),
+		})
+		jr.savePipelineLog()
+
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+			js.Name = job.JobName
+			js.Status = "running"
+			js.StartedAt = &start
+			status.NotifySubscribers()
+		})
+
+		var result cdcRunResult
+		sourceType := normalizeDBTypeFromDSN(jr.SourceDSN)
+		switch sourceType {
+		case "postgres":
+			result, err = jr.runPostgresCDC(jobID, job)
+		case "mysql":
+			result, err = jr.runMySQLCDC(jobID, job)
+		default:
+			err = fmt.Errorf("job cdc nao suportado para origem %s", sourceType)
+		}
+		end := time.Now()
+		if jr.shouldStop() {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", end)
+			return
+		}
+		if err != nil {
+			log.Printf("Erro no job cdc %s: %v\n", job.ID, err)
+			status.AppendLog(fmt.Sprintf("%s - Job: %s falhou: %s", jr.PipelineLog.Project, job.JobName, err.Error()))
+			releaseJobSlot()
+			jr.handleExecutionJobError(jobID, job, err)
+			return
+		}
+
+		changes := result.Upserts + result.Deletes
+		log.Printf("Job %s (%s): %d transacao(oes), %d upsert(s), %d delete(s), posicao %s", job.ID, job.JobName, result.Transactions, result.Upserts, result.Deletes, result.Position)
+		jr.recordThrottledTime(jobID, job)
+		jr.recordQueuedTime(jobID)
+		logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+			jl.Status = "done"
+			jl.Processed = changes
+			jl.Total = changes
+			jl.EndedAt = end
+			jl.Result = map[string]interface{}{
+				"transactions": result.Transactions,
+				"upserts":      result.Upserts,
+				"deletes":      result.Deletes,
+				"truncates":    result.Truncates,
+				"position":     result.Position,
+			}
+		})
+		jr.savePipelineLog()
+
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+			js.Status = "done"
+			js.Processed = changes
+			js.Total = changes
+			js.Progress = 100
+			js.EndedAt = &end
+			status.NotifySubscribers()
+		})
+
+		releaseJobSlot()
+		for _, nextID := range jr.ConnMap[jobID] {
+			jr.RunJob(nextID)
+		}
+	}()
+}
+
+// resolveCDCTarget monta a tabela de destino a partir de TargetTable ou do InsertSQL.
+func (jr *JobRunner) resolveCDCTarget(job models.Job, destType string) (cdcTarget, error) {
+	table := strings.TrimSpace(jr.SubstituteVariables(job.CDC.TargetTable))
+	if table == "" {
+		var ok bool
+		table, ok = extractInsertTable(jr.SubstituteVariables(job.InsertSQL))
+		if !ok {
+			return cdcTarget{}, fmt.Errorf("job cdc sem tabela de destino (targetTable ou InsertSQL)")
+		}
+	}
+	if len(job.PrimaryKeys) == 0 {
+		return cdcTarget{}, fmt.Errorf("job cdc requer primaryKeys")
+	}
+	// O cdc aplica as linhas como chegam da origem: so o mascaramento e suportado
+	if len(job.Transforms) > 0 || len(job.Lookups) > 0 || strings.TrimSpace(job.Filter) != "" || len(job.ComputedColumns) > 0 {
+		return cdcTarget{}, fmt.Errorf("job cdc nao suporta transforms, lookups, filter ou computedColumns")
+	}
+	masker, err := compileMasking(job.Masking, jr.variablesSnapshot())
+	if err != nil {
+		return cdcTarget{}, err
+	}
+	for _, rule := range job.Masking {
+		kind := strings.ToLower(strings.TrimSpace(rule.Rule))
+		if kind != "null" && kind != "redact" {
+			continue
+		}
+		// Chave anulada ou tarjada faria linhas distintas colidirem no upsert/delete do destino
+		for _, key := range job.PrimaryKeys {
+			if key == rule.Column {
+				return cdcTarget{}, fmt.Errorf("job cdc: mascaramento '%s' nao pode ser usado na chave %s", kind, key)
+			}
+		}
+	}
+	schema, name := splitSchemaSyncTable(destType, table)
+	return cdcTarget{
+		Table:   quoteSchemaSyncTable(destType, schema, name),
+		Keys:    job.PrimaryKeys,
+		Columns: job.Columns,
+		Masker:  masker,
+	}, nil
+}
+
+// mask aplica o mascaramento do job nas imagens nova e antiga da alteracao. As regras
+// sao deterministicas, entao a chave antiga mascarada encontra a linha gravada no destino.
+func (t cdcTarget) mask(change cdcChange) cdcChange {
+	t.Masker.apply(change.New)
+	t.Masker.apply(change.Old)
+	return change
+}
+
+// recordCDCBatch registra o lote confirmado no log do pipeline com a posicao da origem.
+func (jr *JobRunner) recordCDCBatch(jobID string, job models.Job, offset, rows int, position string, started time.Time) {
+	logger.AddBatch(jr.PipelineLog, jobID, logger.BatchLog{
+		Offset:    offset,
+		Limit:     rows,
+		Rows:      rows,
+		Status:    "done",
+		Position:  position,
+		StartedAt: started,
+		EndedAt:   time.Now(),
+	})
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Processed = offset + rows
+	})
+	jr.savePipelineLog()
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Processed = offset + rows
+		status.NotifySubscribers()
+	})
+	status.AppendLog(fmt.Sprintf("%s - Job: %s aplicou %d alteracao(oes), posicao %s", jr.PipelineLog.Project, job.JobName, rows, position))
+}
+
+// applyCDCChange aplica uma alteracao; update que muda a chave remove a linha antiga.
+func applyCDCChange(applier *cdcApplier, target cdcTarget, change cdcChange) error {
+	switch change.Kind {
+	case 'I':
+		return applier.upsert(change.New)
+	case 'U':
+		// Chave alterada: remove a versao antiga antes de gravar a nova
+		if change.Old != nil && cdcKeyChanged(target.Keys, change.Old, change.New) {
+			if err := applier.delete(change.Old); err != nil {
+				return err
+			}
+		}
+		return applier.upsert(change.New)
+	case 'D':
+		return applier.delete(change.Old)
+	case 'T':
+		return applier.truncate()
+	}
+	return nil
+}
+
+func cdcKeyChanged(keys []string, old, new map[string]interface{}) bool {
+	for _, key := range keys {
+		newValue, ok := new[key]
+		if !ok {
+			continue
+		}
+		if valueToString(old[key]) != valueToString(newValue) {
+			return true
+		}
+	}
+	return false
+}
+
+func cdcStatePath(projectID, jobID string) string {
+	return filepath.Join("data", "projects", projectID, "state", "cdc_"+jobID+".json")
+}
+
+// loadCDCState retorna a posicao gravada (vazia na primeira execucao).
+func loadCDCState(projectID, jobID string) (cdcState, error) {
+	raw, err := os.ReadFile(cdcStatePath(projectID, jobID))
+	if os.IsNotExist(err) {
+		return cdcState{JobID: jobID}, nil
+	}
+	if err != nil {
+		return cdcState{}, err
+	}
+	var state cdcState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return cdcState{}, fmt.Errorf("estado do cdc invalido: %w", err)
+	}
+	return state, nil
+}
+
+func saveCDCState(projectID string, state cdcState) error {
+	state.UpdatedAt = time.Now()
+	raw, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := cdcStatePath(projectID, state.JobID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Grava em arquivo temporario e renomeia para nao deixar estado parcial
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// cdcApplier aplica alteracoes em ordem dentro de uma transacao do destino. Upserts
+// consecutivos com as mesmas colunas sao agrupados e gravados pelo writer do job
+// (Dialect.BuildInsertQuery) com clausula de conflito; deletes descarregam o grupo antes.
+type cdcApplier struct {
+	jr        *JobRunner
+	tx        *sql.Tx
+	destType  string
+	target    cdcTarget
+	batchSize int
+
+	pendingCols []string
+	pending     []map[string]interface{}
+	pendingKeys map[string]int
+
+	upserts   int
+	deletes   int
+	truncates int
+}
+
+func (jr *JobRunner) newCDCApplier(tx *sql.Tx, destType string, target cdcTarget, batchSize int) *cdcApplier {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &cdcApplier{jr: jr, tx: tx, destType: destType, target: target, batchSize: batchSize}
+}
+
+// upsert grava a linha (insert ou update). Colunas ausentes no registro nao sao alteradas.
+func (a *cdcApplier) upsert(record map[string]interface{}) error {
+	cols := a.columnsFor(record)
+	for _, key := range a.target.Keys {
+		if _, ok := record[key]; !ok {
+			return fmt.Errorf("alteracao sem a chave primaria %s", key)
+		}
+	}
+	if !sameColumns(cols, a.pendingCols) || len(a.pending) >= a.batchSize {
+		if err := a.flush(); err != nil {
+			return err
+		}
+		a.pendingCols = cols
+	}
+	row := make(map[string]interface{}, len(cols))
+	for _, col := range cols {
+		row[col] = a.value(record[col])
+	}
+	// A mesma chave duas vezes no mesmo INSERT falha no ON CONFLICT: a ultima versao vence
+	key := a.keyOf(row)
+	if idx, ok := a.pendingKeys[key]; ok {
+		a.pending[idx] = row
+	} else {
+		if a.pendingKeys == nil {
+			a.pendingKeys = make(map[string]int)
+		}
+		a.pendingKeys[key] = len(a.pending)
+		a.pending = append(a.pending, row)
+	}
+	a.upserts++
+	return nil
+}
+
+// delete remove a linha pelas chaves primarias.
+func (a *cdcApplier) delete(key map[string]interface{}) error {
+	if err := a.flush(); err != nil {
+		return err
+	}
+	conds := make([]string, 0, len(a.target.Keys))
+	args := make([]interface{}, 0, len(a.target.Keys))
+	for i, col := range a.target.Keys {
+		value, ok := key[col]
+		if !ok {
+			return fmt.Errorf("delete sem a chave primaria %s", col)
+		}
+		placeholder := "?"
+		if a.destType == "postgres" {
+			placeholder = fmt.Sprintf("$%d", i+1)
+		}
+		conds = append(conds, quoteIdentifier(a.destType, col)+" = "+placeholder)
+		args = append(args, a.value(value))
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", a.target.Table, strings.Join(conds, " AND "))
+	if _, err := a.tx.ExecContext(a.jr.ctx, query, args...); err != nil {
+		return err
+	}
+	a.deletes++
+	return nil
+}
+
+// truncate replica um TRUNCATE da origem removendo todas as linhas do destino.
+func (a *cdcApplier) truncate() error {
+	if err := a.flush(); err != nil {
+		return err
+	}
+	if _, err := a.tx.ExecContext(a.jr.ctx, "DELETE FROM "+a.target.Table); err != nil {
+		return err
+	}
+	a.truncates++
+	return nil
+}
+
+func (a *cdcApplier) flush() error {
+	if len(a.pending) == 0 {
+		return nil
+	}
+	writeJob := models.Job{
+		Columns:    a.pendingCols,
+		InsertSQL:  a.insertPrefix(),
+		PostInsert: a.conflictClause(),
+	}
+	query, args := a.jr.Dialect.BuildInsertQuery(writeJob, a.pending)
+	if _, err := a.tx.ExecContext(a.jr.ctx, query, args...); err != nil {
+		return err
+	}
+	a.pending = a.pending[:0]
+	a.pendingKeys = nil
+	return nil
+}
+
+func (a *cdcApplier) insertPrefix() string {
+	quoted := make([]string, 0, len(a.pendingCols))
+	for _, col := range a.pendingCols {
+		quoted = append(quoted, quoteIdentifier(a.destType, col))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s)", a.target.Table, strings.Join(quoted, ", "))
+}
+
+func (a *cdcApplier) conflictClause() string {
+	isKey := make(map[string]bool, len(a.target.Keys))
+	for _, key := range a.target.Keys {
+		isKey[key] = true
+	}
+	sets := make([]string, 0, len(a.pendingCols))
+	for _, col := range a.pendingCols {
+		if isKey[col] {
+			continue
+		}
+		quoted := quoteIdentifier(a.destType, col)
+		if a.destType == "mysql" {
+			sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", quoted, quoted))
+		} else {
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", quoted, quoted))
+		}
+	}
+	if a.destType == "mysql" {
+		if len(sets) == 0 {
+			first := quoteIdentifier(a.destType, a.target.Keys[0])
+			sets = append(sets, first+" = "+first)
+		}
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	}
+	if len(sets) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", quoteSchemaSyncColumns(a.destType, a.target.Keys))
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", quoteSchemaSyncColumns(a.destType, a.target.Keys), strings.Join(sets, ", "))
+}
+
+// columnsFor retorna as colunas do registro que vao para o destino, em ordem estavel.
+func (a *cdcApplier) columnsFor(record map[string]interface{}) []string {
+	if len(a.target.Columns) > 0 {
+		cols := make([]string, 0, len(a.target.Columns))
+		for _, col := range a.target.Columns {
+			if _, ok := record[col]; ok {
+				cols = append(cols, col)
+			}
+		}
+		return cols
+	}
+	cols := make([]string, 0, len(record))
+	for col := range record {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// value formata datas com fracao de segundo (o writer descarta a fracao de time.Time).
+// No MySQL a data vai em UTC, sem fuso, como DATETIME.
+func (a *cdcApplier) value(v interface{}) interface{} {
+	t, ok := v.(time.Time)
+	if !ok {
+		return v
+	}
+	if a.destType == "mysql" {
+		return t.UTC().Format("2006-01-02 15:04:05.999999")
+	}
+	return t.Format("2006-01-02 15:04:05.999999Z07:00")
+}
+
+func (a *cdcApplier) keyOf(row map[string]interface{}) string {
+	parts := make([]string, 0, len(a.target.Keys))
+	for _, key := range a.target.Keys {
+		parts = append(parts, valueToString(row[key]))
+	}
+	return strings.Join(parts, "\x1f")
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
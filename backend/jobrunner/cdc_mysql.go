@@ -0,0 +1,562 @@
+package jobrunner
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// CDC do MySQL pelo binlog (binlog_format=ROW): uma conexao de replicacao le os
+// eventos a partir da posicao gravada ate o fim do log atual. As transacoes completas
+// sao agrupadas em lotes de BatchSize alteracoes; depois do commit no destino a posicao
+// (arquivo:posicao ou GTID set) e gravada no estado. Se o processo cair entre o commit
+// e a gravacao do estado, o lote e reaplicado, o que e seguro para upserts e deletes.
+
+// mysqlTransaction agrupa as alteracoes de uma transacao do binlog.
+type mysqlTransaction struct {
+	Changes []cdcChange
+}
+
+// mysqlBinlogPosition e o ponto confirmado no binlog.
+type mysqlBinlogPosition struct {
+	File string
+	Pos  uint32
+	GTID mysqlGTIDSet // nil fora do modo GTID
+}
+
+func (p mysqlBinlogPosition) String() string {
+	if p.GTID != nil {
+		return p.GTID.String()
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Pos)
+}
+
+func (jr *JobRunner) runMySQLCDC(jobID string, job models.Job) (cdcRunResult, error) {
+	result := cdcRunResult{}
+	if job.CDC == nil || strings.TrimSpace(job.CDC.SourceTable) == "" {
+		return result, fmt.Errorf("job cdc sem sourceTable")
+	}
+	spec := *job.CDC
+	cfg, err := mysql.ParseDSN(jr.SourceDSN)
+	if err != nil {
+		return result, fmt.Errorf("DSN da origem invalido: %w", err)
+	}
+	sourceSchema, sourceTable := splitSchemaSyncTable("mysql", jr.SubstituteVariables(spec.SourceTable))
+	if sourceSchema == "" {
+		sourceSchema = cfg.DBName
+	}
+	if sourceSchema == "" {
+		return result, fmt.Errorf("job cdc sem banco da tabela de origem (use banco.tabela em sourceTable)")
+	}
+	batchSize := spec.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCDCBatchSize
+	}
+	serverID := spec.ServerID
+	if serverID == 0 {
+		h := fnv.New32a()
+		h.Write([]byte(jr.ProjectID + "/" + job.ID))
+		serverID = 1000000000 + h.Sum32()%1000000000
+	}
+
+	destType := normalizeDBTypeFromDSN(jr.DestinationDSN)
+	target, err := jr.resolveCDCTarget(job, destType)
+	if err != nil {
+		return result, err
+	}
+
+	state, err := loadCDCState(jr.ProjectID, jobID)
+	if err != nil {
+		return result, err
+	}
+	start, ok, err := mysqlStartPosition(state, spec)
+	if err != nil {
+		return result, err
+	}
+	if !ok {
+		// Primeira execucao sem posicao configurada: registra a posicao atual
+		current, err := jr.currentMySQLBinlogPosition(spec.UseGTID)
+		if err != nil {
+			return result, fmt.Errorf("erro ao ler a posicao atual do binlog: %w", err)
+		}
+		if err := saveMySQLCDCState(jr.ProjectID, state, current); err != nil {
+			return result, fmt.Errorf("erro ao gravar posicao do cdc: %w", err)
+		}
+		result.Position = current.String()
+		status.AppendLog(fmt.Sprintf("%s - Job: %s registrou a posicao inicial %s; alteracoes anteriores nao sao replicadas (faca a carga inicial)", jr.PipelineLog.Project, job.JobName, result.Position))
+		return result, nil
+	}
+	result.Position = start.String()
+
+	columns, err := jr.loadMySQLColumns(sourceSchema, sourceTable)
+	if err != nil {
+		return result, err
+	}
+	var checksumAlg string
+	if err := jr.SourceDB.QueryRowContext(jr.ctx, "SELECT @@global.binlog_checksum").Scan(&checksumAlg); err != nil {
+		return result, fmt.Errorf("erro ao ler binlog_checksum: %w", err)
+	}
+	checksum := !strings.EqualFold(checksumAlg, "NONE")
+
+	conn, err := dialMySQLBinlog(jr.ctx, cfg.Net, cfg.Addr, cfg.User, cfg.Passwd)
+	if err != nil {
+		return result, fmt.Errorf("erro ao conectar para replicacao: %w", err)
+	}
+	defer conn.Close()
+	// Stop fecha a conexao para interromper a leitura bloqueada
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-jr.ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	checksumVar := fmt.Sprintf("'%s'", strings.ToUpper(checksumAlg))
+	if err := conn.exec("SET @master_binlog_checksum = " + checksumVar + ", @source_binlog_checksum = " + checksumVar); err != nil {
+		return result, err
+	}
+	if err := conn.startDump(serverID, start.File, start.Pos, start.GTID); err != nil {
+		return result, err
+	}
+
+	stream := &mysqlBinlogStream{
+		jr:        jr,
+		jobID:     jobID,
+		job:       job,
+		schema:    sourceSchema,
+		table:     sourceTable,
+		columns:   columns,
+		tables:    make(map[uint64]mysqlTableMap),
+		state:     state,
+		committed: start,
+		current:   start,
+		destType:  destType,
+		target:    target,
+		batchSize: batchSize,
+		result:    &result,
+	}
+	for {
+		ev, err := conn.readEvent(checksum)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if jr.shouldStop() {
+				return result, nil
+			}
+			return result, fmt.Errorf("erro ao ler o binlog em %s: %w", stream.current.String(), err)
+		}
+		if err := stream.handle(ev); err != nil {
+			return result, err
+		}
+	}
+	if err := stream.flush(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// mysqlStartPosition escolhe o ponto de partida: estado gravado, depois o configurado no job.
+func mysqlStartPosition(state cdcState, spec models.CDCSpec) (mysqlBinlogPosition, bool, error) {
+	useGTID := spec.UseGTID || strings.TrimSpace(spec.GTIDSet) != ""
+	if useGTID {
+		text := state.GTIDSet
+		if text == "" {
+			text = spec.GTIDSet
+		}
+		if strings.TrimSpace(text) == "" {
+			return mysqlBinlogPosition{}, false, nil
+		}
+		set, err := parseMySQLGTIDSet(text)
+		if err != nil {
+			return mysqlBinlogPosition{}, false, err
+		}
+		return mysqlBinlogPosition{File: state.File, Pos: state.Position, GTID: set}, true, nil
+	}
+	if state.File != "" {
+		return mysqlBinlogPosition{File: state.File, Pos: state.Position}, true, nil
+	}
+	if spec.BinlogFile != "" {
+		pos := spec.BinlogPosition
+		if pos < 4 {
+			pos = 4 // depois do cabecalho do arquivo
+		}
+		return mysqlBinlogPosition{File: spec.BinlogFile, Pos: pos}, true, nil
+	}
+	return mysqlBinlogPosition{}, false, nil
+}
+
+func saveMySQLCDCState(projectID string, state cdcState, pos mysqlBinlogPosition) error {
+	state.File = pos.File
+	state.Position = pos.Pos
+	state.GTIDSet = ""
+	if pos.GTID != nil {
+		state.GTIDSet = pos.GTID.String()
+	}
+	return saveCDCState(projectID, state)
+}
+
+// currentMySQLBinlogPosition le a posicao atual (SHOW BINARY LOG STATUS no 8.4+).
+func (jr *JobRunner) currentMySQLBinlogPosition(useGTID bool) (mysqlBinlogPosition, error) {
+	rows, err := jr.SourceDB.QueryContext(jr.ctx, "SHOW MASTER STATUS")
+	if err != nil {
+		var fallbackErr error
+		if rows, fallbackErr = jr.SourceDB.QueryContext(jr.ctx, "SHOW BINARY LOG STATUS"); fallbackErr != nil {
+			return mysqlBinlogPosition{}, err
+		}
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return mysqlBinlogPosition{}, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return mysqlBinlogPosition{}, err
+		}
+		return mysqlBinlogPosition{}, fmt.Errorf("binlog desabilitado na origem")
+	}
+	values := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return mysqlBinlogPosition{}, err
+	}
+	pos := mysqlBinlogPosition{}
+	for i, col := range cols {
+		switch strings.ToLower(col) {
+		case "file":
+			pos.File = values[i].String
+		case "position":
+			var n uint32
+			fmt.Sscan(values[i].String, &n)
+			pos.Pos = n
+		case "executed_gtid_set":
+			if useGTID {
+				if pos.GTID, err = parseMySQLGTIDSet(values[i].String); err != nil {
+					return mysqlBinlogPosition{}, err
+				}
+			}
+		}
+	}
+	if useGTID && pos.GTID == nil {
+		return mysqlBinlogPosition{}, fmt.Errorf("GTID nao disponivel na origem (gtid_mode)")
+	}
+	return pos, nil
+}
+
+// loadMySQLColumns le nomes, tipos, sinal e valores de enum/set na ordem da tabela.
+func (jr *JobRunner) loadMySQLColumns(schema, table string) ([]mysqlColumnInfo, error) {
+	const query = `SELECT column_name, column_type, data_type FROM information_schema.columns
+		WHERE table_schema = ? AND table_name = ? ORDER BY ordinal_position`
+	rows, err := jr.SourceDB.QueryContext(jr.ctx, query, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make([]mysqlColumnInfo, 0)
+	for rows.Next() {
+		var name, columnType, dataType string
+		if err := rows.Scan(&name, &columnType, &dataType); err != nil {
+			return nil, err
+		}
+		col := mysqlColumnInfo{
+			Name:     name,
+			DataType: strings.ToLower(dataType),
+			Unsigned: strings.Contains(strings.ToLower(columnType), "unsigned"),
+		}
+		switch col.DataType {
+		case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+			col.Binary = true
+		case "enum", "set":
+			col.Values = parseMySQLEnumValues(columnType)
+		}
+		columns = append(columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("tabela %s.%s nao encontrada na origem", schema, table)
+	}
+	return columns, nil
+}
+
+// parseMySQLEnumValues extrai os valores de "enum('a','b')" ou "set('a','b')".
+func parseMySQLEnumValues(columnType string) []string {
+	start := strings.Index(columnType, "(")
+	end := strings.LastIndex(columnType, ")")
+	if start < 0 || end <= start {
+		return nil
+	}
+	body := columnType[start+1 : end]
+	values := make([]string, 0)
+	var current strings.Builder
+	inQuote := false
+	for i := 0; i < len(body); i++ {
+		ch := body[i]
+		switch {
+		case ch == '\'' && inQuote && i+1 < len(body) && body[i+1] == '\'':
+			current.WriteByte('\'')
+			i++
+		case ch == '\'':
+			inQuote = !inQuote
+			if !inQuote {
+				values = append(values, current.String())
+				current.Reset()
+			}
+		case inQuote:
+			current.WriteByte(ch)
+		}
+	}
+	return values
+}
+
+// mysqlBinlogStream acompanha os eventos lidos e acumula as transacoes do lote.
+type mysqlBinlogStream struct {
+	jr      *JobRunner
+	jobID   string
+	job     models.Job
+	schema  string
+	table   string
+	columns []mysqlColumnInfo
+	tables  map[uint64]mysqlTableMap // table ids da tabela replicada
+
+	state     cdcState
+	committed mysqlBinlogPosition // fim da ultima transacao lida
+	current   mysqlBinlogPosition // arquivo em leitura
+	saved     bool
+
+	txChanges []cdcChange
+	txGTID    string
+	txGNO     uint64
+	inTx      bool // entre BEGIN e o evento que fecha a transacao
+
+	pending     []mysqlTransaction
+	pendingRows int
+
+	destType  string
+	target    cdcTarget
+	batchSize int
+	result    *cdcRunResult
+}
+
+func (s *mysqlBinlogStream) handle(ev binlogEvent) error {
+	switch ev.Type {
+	case binlogRotateEvent:
+		r := &binlogReader{buf: ev.Body}
+		pos := r.uint64()
+		s.current.File = string(r.rest())
+		s.current.Pos = uint32(pos)
+		if !s.inTx && len(s.txChanges) == 0 && pos > 0 {
+			s.committed.File, s.committed.Pos = s.current.File, s.current.Pos
+			s.saved = false
+		}
+	case binlogGTIDEvent:
+		if len(ev.Body) >= 25 {
+			s.txGTID = formatMySQLUUID(ev.Body[1:17])
+			s.txGNO = binary.LittleEndian.Uint64(ev.Body[17:25])
+		}
+	case binlogQueryEvent:
+		switch mysqlQueryEventKind(parseQueryEventSQL(ev.Body)) {
+		case "BEGIN":
+			s.txChanges = nil
+			s.inTx = true
+		case "ROLLBACK":
+			// Transacao desfeita: nada do grupo e aplicado, mas a posicao avanca
+			s.txChanges = nil
+			return s.commit(ev.LogPos)
+		case "SAVEPOINT":
+			// SAVEPOINT e ROLLBACK TO SAVEPOINT ficam dentro da transacao
+		case "COMMIT":
+			return s.commit(ev.LogPos)
+		default:
+			// Dentro de BEGIN so COMMIT/XID/ROLLBACK fecham o grupo; fora dele e DDL,
+			// que se confirma sozinho
+			if !s.inTx {
+				return s.commit(ev.LogPos)
+			}
+		}
+	case binlogXIDEvent:
+		return s.commit(ev.LogPos)
+	case binlogTableMapEvent:
+		tableID, tm, err := parseTableMapEvent(ev.Body)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(tm.Schema, s.schema) && strings.EqualFold(tm.Table, s.table) {
+			if err := checkMySQLTableMap(tm, s.columns); err != nil {
+				// ALTER TABLE entre a posicao salva e o schema lido no inicio do cdc
+				return fmt.Errorf("schema de %s.%s diverge do TABLE_MAP na posicao %d (refaca a carga inicial): %w",
+					s.schema, s.table, ev.LogPos, err)
+			}
+			s.tables[tableID] = tm
+		} else {
+			delete(s.tables, tableID)
+		}
+	case binlogWriteRowsV1, binlogUpdateRowsV1, binlogDeleteRowsV1, binlogWriteRowsV2, binlogUpdateRowsV2, binlogDeleteRowsV2:
+		return s.handleRows(ev)
+	case binlogTransactionEvent:
+		return fmt.Errorf("binlog_transaction_compression nao suportado pelo cdc")
+	}
+	return nil
+}
+
+func (s *mysqlBinlogStream) handleRows(ev binlogEvent) error {
+	if len(ev.Body) < 6 {
+		return fmt.Errorf("evento de linhas truncado")
+	}
+	tableID := (&binlogReader{buf: ev.Body}).uintN(6)
+	tm, ok := s.tables[tableID]
+	if !ok {
+		return nil
+	}
+	rows, err := parseRowsEvent(ev.Type, ev.Body, tm, s.columns)
+	if err != nil {
+		return fmt.Errorf("erro ao decodificar linhas em %s:%d: %w", s.current.File, ev.LogPos, err)
+	}
+	// Mascara na decodificacao: os valores originais nao ficam no buffer de transacoes
+	for _, row := range rows {
+		switch {
+		case row.Before != nil && row.After != nil:
+			// Com binlog_row_image=MINIMAL a imagem nova pode nao trazer a chave
+			for _, key := range s.target.Keys {
+				if _, ok := row.After[key]; !ok {
+					row.After[key] = row.Before[key]
+				}
+			}
+			s.txChanges = append(s.txChanges, s.target.mask(cdcChange{Kind: 'U', New: row.After, Old: row.Before}))
+		case row.Before != nil:
+			s.txChanges = append(s.txChanges, s.target.mask(cdcChange{Kind: 'D', Old: row.Before}))
+		default:
+			s.txChanges = append(s.txChanges, s.target.mask(cdcChange{Kind: 'I', New: row.After}))
+		}
+	}
+	return nil
+}
+
+// commit fecha a transacao atual na posicao logPos (fim do evento de commit).
+func (s *mysqlBinlogStream) commit(logPos uint32) error {
+	if s.txGTID != "" && s.committed.GTID != nil {
+		s.committed.GTID.add(s.txGTID, s.txGNO)
+	}
+	s.txGTID = ""
+	s.inTx = false
+	s.committed.File = s.current.File
+	if logPos > 0 {
+		s.committed.Pos = logPos
+	}
+	s.saved = false
+	if len(s.txChanges) > 0 {
+		s.pending = append(s.pending, mysqlTransaction{Changes: s.txChanges})
+		s.pendingRows += len(s.txChanges)
+		s.txChanges = nil
+	}
+	if s.pendingRows >= s.batchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush grava as transacoes pendentes em uma transacao do destino e confirma a posicao.
+func (s *mysqlBinlogStream) flush() error {
+	jr := s.jr
+	applied := 0
+	batchStart := time.Now()
+	if len(s.pending) > 0 {
+		tx, err := jr.DestinationDB.BeginTx(jr.ctx, nil)
+		if err != nil {
+			return err
+		}
+		applier := jr.newCDCApplier(tx, s.destType, s.target, s.job.RecordsPerPage)
+		for _, t := range s.pending {
+			for _, change := range t.Changes {
+				if err := applyCDCChange(applier, s.target, change); err != nil {
+					_ = tx.Rollback()
+					return fmt.Errorf("erro ao aplicar alteracao antes de %s: %w", s.committed.String(), err)
+				}
+			}
+		}
+		if err := applier.flush(); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		s.result.Transactions += len(s.pending)
+		s.result.Upserts += applier.upserts
+		s.result.Deletes += applier.deletes
+		applied = applier.upserts + applier.deletes
+		s.pending = nil
+		s.pendingRows = 0
+	}
+	if s.saved {
+		return nil
+	}
+	// Grava a posicao mesmo sem alteracoes da tabela para nao reler o binlog
+	if err := saveMySQLCDCState(jr.ProjectID, s.state, s.committed); err != nil {
+		return fmt.Errorf("erro ao gravar posicao do cdc: %w", err)
+	}
+	s.saved = true
+	s.result.Position = s.committed.String()
+	if applied > 0 {
+		jr.recordCDCBatch(s.jobID, s.job, s.result.Upserts+s.result.Deletes-applied, applied, s.result.Position, batchStart)
+	} else {
+		log.Printf("Job %s (%s): sem alteracoes da tabela, posicao %s", s.job.ID, s.job.JobName, s.result.Position)
+	}
+	return nil
+}
+
+// mysqlQueryEventKind classifica o SQL de um QUERY_EVENT: BEGIN, COMMIT, ROLLBACK,
+// SAVEPOINT (inclui ROLLBACK TO e RELEASE SAVEPOINT) ou vazio para os demais.
+func mysqlQueryEventKind(query string) string {
+	fields := strings.Fields(strings.ToUpper(strings.TrimRight(strings.TrimSpace(query), ";")))
+	if len(fields) == 0 {
+		return ""
+	}
+	switch fields[0] {
+	case "BEGIN", "COMMIT":
+		return fields[0]
+	case "SAVEPOINT":
+		return "SAVEPOINT"
+	case "RELEASE":
+		if len(fields) > 1 && fields[1] == "SAVEPOINT" {
+			return "SAVEPOINT"
+		}
+	case "ROLLBACK":
+		if len(fields) > 1 && fields[1] == "TO" {
+			return "SAVEPOINT"
+		}
+		return "ROLLBACK"
+	}
+	return ""
+}
+
+// parseQueryEventSQL retorna o texto SQL de um QUERY_EVENT.
+func parseQueryEventSQL(body []byte) string {
+	r := &binlogReader{buf: body}
+	r.uint32() // thread id
+	r.uint32() // tempo de execucao
+	schemaLen := int(r.byte())
+	r.uint16() // codigo de erro
+	statusLen := int(r.uint16())
+	r.next(statusLen)
+	r.next(schemaLen + 1)
+	return string(r.rest())
+}
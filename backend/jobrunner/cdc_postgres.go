@@ -0,0 +1,501 @@
+package jobrunner
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CDC do Postgres via replicacao logica: o slot (plugin pgoutput) e lido com
+// pg_logical_slot_peek_binary_changes e so avanca com pg_replication_slot_advance
+// depois que o lote foi gravado no destino. O LSN vai para o estado logo apos o commit
+// no destino: se o processo cair antes do avanco do slot, as transacoes ja gravadas
+// voltam na proxima leitura e sao ignoradas.
+
+var pgSlotNameSanitizer = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// OIDs de tipos usados na conversao dos valores em texto do pgoutput
+const (
+	pgOIDBool        = 16
+	pgOIDBytea       = 17
+	pgOIDInt8        = 20
+	pgOIDInt2        = 21
+	pgOIDInt4        = 23
+	pgOIDFloat4      = 700
+	pgOIDFloat8      = 701
+	pgOIDTimestampTZ = 1184
+)
+
+type pgRelationColumn struct {
+	Name    string
+	TypeOID uint32
+	Key     bool
+}
+
+type pgRelation struct {
+	Namespace string
+	Name      string
+	Columns   []pgRelationColumn
+}
+
+// pgTransaction agrupa as alteracoes de uma transacao; EndLSN e o ponto para avancar o slot.
+type pgTransaction struct {
+	EndLSN  uint64
+	Changes []cdcChange
+}
+
+func (jr *JobRunner) runPostgresCDC(jobID string, job models.Job) (cdcRunResult, error) {
+	result := cdcRunResult{}
+	if job.CDC == nil || strings.TrimSpace(job.CDC.SourceTable) == "" {
+		return result, fmt.Errorf("job cdc sem sourceTable")
+	}
+	spec := *job.CDC
+	sourceSchema, sourceTable := splitSchemaSyncTable("postgres", jr.SubstituteVariables(spec.SourceTable))
+	if sourceSchema == "" {
+		sourceSchema = "public"
+	}
+	slot := strings.TrimSpace(jr.SubstituteVariables(spec.Slot))
+	if slot == "" {
+		slot = "etl_" + strings.Trim(pgSlotNameSanitizer.ReplaceAllString(strings.ToLower(job.ID), "_"), "_")
+	}
+	publication := strings.TrimSpace(jr.SubstituteVariables(spec.Publication))
+	if publication == "" {
+		publication = slot
+	}
+	batchSize := spec.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCDCBatchSize
+	}
+
+	destType := normalizeDBTypeFromDSN(jr.DestinationDSN)
+	target, err := jr.resolveCDCTarget(job, destType)
+	if err != nil {
+		return result, err
+	}
+
+	state, err := loadCDCState(jr.ProjectID, jobID)
+	if err != nil {
+		return result, err
+	}
+	if state.Slot != "" && state.Slot != slot {
+		log.Printf("Job %s (%s): slot alterado de %s para %s, posicao anterior descartada", job.ID, job.JobName, state.Slot, slot)
+		state.LSN = ""
+	}
+	state.Slot = slot
+
+	if err := jr.ensurePgPublication(publication, sourceSchema, sourceTable); err != nil {
+		return result, fmt.Errorf("erro ao preparar publicacao %s: %w", publication, err)
+	}
+	created, err := jr.ensurePgSlot(slot)
+	if err != nil {
+		return result, fmt.Errorf("erro ao preparar slot %s: %w", slot, err)
+	}
+	if created {
+		state.LSN = ""
+		status.AppendLog(fmt.Sprintf("%s - Job: %s criou o slot %s; alteracoes anteriores nao sao replicadas (faca a carga inicial)", jr.PipelineLog.Project, job.JobName, slot))
+	}
+
+	var appliedLSN uint64
+	if state.LSN != "" {
+		if appliedLSN, err = parsePgLSN(state.LSN); err != nil {
+			return result, err
+		}
+	}
+	result.Position = state.LSN
+
+	dec := newPgoutputDecoder(sourceSchema, sourceTable)
+	for !jr.shouldStop() {
+		txs, err := jr.peekPgoutput(slot, publication, batchSize, dec)
+		if err != nil {
+			return result, fmt.Errorf("erro ao ler alteracoes do slot %s: %w", slot, err)
+		}
+		if len(txs) == 0 {
+			break
+		}
+
+		batchStart := time.Now()
+		applied, err := jr.applyPgTransactions(txs, appliedLSN, destType, target, job.RecordsPerPage, &result)
+		if err != nil {
+			return result, err
+		}
+
+		// O estado e gravado antes de avancar o slot: se o avanco nao acontecer, a
+		// proxima leitura traz as mesmas transacoes e elas sao ignoradas pelo LSN
+		endLSN := txs[len(txs)-1].EndLSN
+		appliedLSN = endLSN
+		state.LSN = formatPgLSN(endLSN)
+		if err := saveCDCState(jr.ProjectID, state); err != nil {
+			return result, fmt.Errorf("erro ao gravar posicao do cdc: %w", err)
+		}
+		result.Position = state.LSN
+		if _, err := jr.SourceDB.ExecContext(jr.ctx, "SELECT pg_replication_slot_advance($1, $2::pg_lsn)", slot, state.LSN); err != nil {
+			return result, fmt.Errorf("erro ao avancar slot %s: %w", slot, err)
+		}
+		jr.recordCDCBatch(jobID, job, result.Upserts+result.Deletes-applied, applied, state.LSN, batchStart)
+	}
+	return result, nil
+}
+
+// applyPgTransactions grava as transacoes do lote em uma unica transacao do destino.
+// Transacoes ate appliedLSN ja foram gravadas em execucao anterior e sao ignoradas.
+func (jr *JobRunner) applyPgTransactions(txs []pgTransaction, appliedLSN uint64, destType string, target cdcTarget, batchSize int, result *cdcRunResult) (int, error) {
+	tx, err := jr.DestinationDB.BeginTx(jr.ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	applier := jr.newCDCApplier(tx, destType, target, batchSize)
+	for _, t := range txs {
+		if t.EndLSN <= appliedLSN {
+			continue
+		}
+		for _, change := range t.Changes {
+			if err := applyCDCChange(applier, target, target.mask(change)); err != nil {
+				return 0, fmt.Errorf("erro ao aplicar alteracao na transacao %s: %w", formatPgLSN(t.EndLSN), err)
+			}
+		}
+		result.Transactions++
+	}
+	if err := applier.flush(); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	committed = true
+
+	result.Upserts += applier.upserts
+	result.Deletes += applier.deletes
+	result.Truncates += applier.truncates
+	return applier.upserts + applier.deletes, nil
+}
+
+func (jr *JobRunner) ensurePgPublication(publication, schema, table string) error {
+	qualified := quotePgIdent(schema) + "." + quotePgIdent(table)
+	var exists bool
+	if err := jr.SourceDB.QueryRowContext(jr.ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)", publication).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		_, err := jr.SourceDB.ExecContext(jr.ctx, fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s", quotePgIdent(publication), qualified))
+		return err
+	}
+	var published bool
+	const publishedSQL = "SELECT EXISTS (SELECT 1 FROM pg_publication_tables WHERE pubname = $1 AND schemaname = $2 AND tablename = $3)"
+	if err := jr.SourceDB.QueryRowContext(jr.ctx, publishedSQL, publication, schema, table).Scan(&published); err != nil {
+		return err
+	}
+	if published {
+		return nil
+	}
+	_, err := jr.SourceDB.ExecContext(jr.ctx, fmt.Sprintf("ALTER PUBLICATION %s ADD TABLE %s", quotePgIdent(publication), qualified))
+	return err
+}
+
+// ensurePgSlot cria o slot logico se ainda nao existir. Retorna true quando criado.
+func (jr *JobRunner) ensurePgSlot(slot string) (bool, error) {
+	var plugin string
+	err := jr.SourceDB.QueryRowContext(jr.ctx, "SELECT plugin FROM pg_replication_slots WHERE slot_name = $1", slot).Scan(&plugin)
+	if err == nil {
+		if plugin != "pgoutput" {
+			return false, fmt.Errorf("slot usa o plugin %s (esperado pgoutput)", plugin)
+		}
+		return false, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+	if _, err := jr.SourceDB.ExecContext(jr.ctx, "SELECT pg_create_logical_replication_slot($1, 'pgoutput')", slot); err != nil {
+		return false, err
+	}
+	log.Printf("Slot de replicacao %s criado", slot)
+	return true, nil
+}
+
+// peekPgoutput le ate limit mensagens do slot sem consumi-las e retorna as transacoes
+// completas, com apenas as alteracoes da tabela replicada.
+func (jr *JobRunner) peekPgoutput(slot, publication string, limit int, dec *pgoutputDecoder) ([]pgTransaction, error) {
+	const peekSQL = `SELECT data FROM pg_logical_slot_peek_binary_changes($1, NULL, $2, 'proto_version', '1', 'publication_names', $3)`
+	rows, err := jr.SourceDB.QueryContext(jr.ctx, peekSQL, slot, limit, quotePgIdent(publication))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dec.reset()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		if err := dec.decode(data); err != nil {
+			return nil, err
+		}
+	}
+	return dec.txs, rows.Err()
+}
+
+// pgoutputDecoder monta as transacoes a partir das mensagens pgoutput. As relacoes
+// sao mantidas entre leituras: o servidor so reenvia a definicao quando ela muda.
+type pgoutputDecoder struct {
+	relations map[uint32]pgRelation
+	schema    string
+	table     string
+	current   *pgTransaction
+	txs       []pgTransaction
+}
+
+func newPgoutputDecoder(schema, table string) *pgoutputDecoder {
+	return &pgoutputDecoder{relations: make(map[uint32]pgRelation), schema: schema, table: table}
+}
+
+// reset descarta as transacoes da leitura anterior (o peek recomeca do inicio do slot).
+func (d *pgoutputDecoder) reset() {
+	d.current = nil
+	d.txs = make([]pgTransaction, 0)
+}
+
+func (d *pgoutputDecoder) tracked(rel pgRelation) bool {
+	return rel.Namespace == d.schema && rel.Name == d.table
+}
+
+func (d *pgoutputDecoder) decode(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	r := &pgoutputReader{buf: data, pos: 1}
+	switch data[0] {
+	case 'B':
+		d.current = &pgTransaction{}
+	case 'C':
+		r.byte()   // flags
+		r.uint64() // LSN do commit
+		end := r.uint64()
+		if r.err != nil {
+			return r.err
+		}
+		if d.current != nil {
+			d.current.EndLSN = end
+			d.txs = append(d.txs, *d.current)
+		}
+		d.current = nil
+	case 'R':
+		id, rel := r.relation()
+		if r.err != nil {
+			return r.err
+		}
+		d.relations[id] = rel
+	case 'I', 'U', 'D':
+		change, relID, err := decodePgRowChange(data[0], r, d.relations)
+		if err != nil {
+			return err
+		}
+		if d.current != nil && d.tracked(d.relations[relID]) {
+			d.current.Changes = append(d.current.Changes, change)
+		}
+	case 'T':
+		count := r.uint32()
+		r.byte() // opcoes (CASCADE / RESTART IDENTITY)
+		for i := uint32(0); i < count && r.err == nil; i++ {
+			rel := d.relations[r.uint32()]
+			if d.current != nil && d.tracked(rel) {
+				d.current.Changes = append(d.current.Changes, cdcChange{Kind: 'T'})
+			}
+		}
+		return r.err
+	}
+	// Y (tipo), O (origem) e M (mensagem) nao alteram a tabela
+	return nil
+}
+
+func decodePgRowChange(kind byte, r *pgoutputReader, relations map[uint32]pgRelation) (cdcChange, uint32, error) {
+	relID := r.uint32()
+	rel, ok := relations[relID]
+	if r.err == nil && !ok {
+		return cdcChange{}, relID, fmt.Errorf("relacao %d sem mensagem de definicao", relID)
+	}
+	change := cdcChange{Kind: kind}
+	var err error
+	for r.err == nil && r.pos < len(r.buf) {
+		switch marker := r.byte(); marker {
+		case 'K', 'O':
+			change.Old, err = r.tuple(rel)
+		case 'N':
+			change.New, err = r.tuple(rel)
+		default:
+			err = fmt.Errorf("marcador de tupla desconhecido: %q", marker)
+		}
+		if err != nil {
+			return change, relID, err
+		}
+	}
+	return change, relID, r.err
+}
+
+// pgoutputReader le os campos big-endian das mensagens do protocolo pgoutput.
+type pgoutputReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *pgoutputReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.pos+n > len(r.buf) {
+		r.err = fmt.Errorf("mensagem pgoutput truncada")
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *pgoutputReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i := r.pos; i < len(r.buf); i++ {
+		if r.buf[i] == 0 {
+			s := string(r.buf[r.pos:i])
+			r.pos = i + 1
+			return s
+		}
+	}
+	r.err = fmt.Errorf("texto sem terminador na mensagem pgoutput")
+	return ""
+}
+
+func (r *pgoutputReader) relation() (uint32, pgRelation) {
+	id := r.uint32()
+	rel := pgRelation{Namespace: r.string(), Name: r.string()}
+	r.byte() // replica identity
+	count := int(r.uint16())
+	for i := 0; i < count && r.err == nil; i++ {
+		flags := r.byte()
+		col := pgRelationColumn{Key: flags&1 == 1, Name: r.string(), TypeOID: r.uint32()}
+		r.uint32() // typmod
+		rel.Columns = append(rel.Columns, col)
+	}
+	if rel.Namespace == "" {
+		rel.Namespace = "pg_catalog"
+	}
+	return id, rel
+}
+
+// tuple converte os valores da tupla. Colunas TOAST nao alteradas ('u') ficam fora do
+// mapa para que o upsert preserve o valor atual no destino.
+func (r *pgoutputReader) tuple(rel pgRelation) (map[string]interface{}, error) {
+	count := int(r.uint16())
+	if r.err == nil && count > len(rel.Columns) {
+		return nil, fmt.Errorf("tupla com %d colunas para relacao %s.%s com %d", count, rel.Namespace, rel.Name, len(rel.Columns))
+	}
+	values := make(map[string]interface{}, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		col := rel.Columns[i]
+		switch kind := r.byte(); kind {
+		case 'n':
+			values[col.Name] = nil
+		case 'u':
+		case 't':
+			size := int(r.uint32())
+			raw := r.next(size)
+			if r.err != nil {
+				break
+			}
+			value, err := pgTextValue(col.TypeOID, string(raw))
+			if err != nil {
+				return nil, fmt.Errorf("coluna %s: %w", col.Name, err)
+			}
+			values[col.Name] = value
+		default:
+			return nil, fmt.Errorf("formato de coluna %q nao suportado", kind)
+		}
+	}
+	return values, r.err
+}
+
+// pgTextValue converte o texto do pgoutput para o tipo Go correspondente ao OID.
+// Demais tipos seguem como texto, aceito pelo writer nos dois bancos de destino.
+func pgTextValue(typeOID uint32, raw string) (interface{}, error) {
+	switch typeOID {
+	case pgOIDBool:
+		return raw == "t", nil
+	case pgOIDInt2, pgOIDInt4, pgOIDInt8:
+		return strconv.ParseInt(raw, 10, 64)
+	case pgOIDFloat4, pgOIDFloat8:
+		return strconv.ParseFloat(raw, 64)
+	case pgOIDBytea:
+		return hex.DecodeString(strings.TrimPrefix(raw, `\x`))
+	case pgOIDTimestampTZ:
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999-07", "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999-07:00:00"} {
+			if t, err := time.Parse(layout, raw); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return raw, nil
+}
+
+func parsePgLSN(lsn string) (uint64, error) {
+	parts := strings.SplitN(strings.TrimSpace(lsn), "/", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("LSN invalido: %s", lsn)
+	}
+	hi, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("LSN invalido: %s", lsn)
+	}
+	lo, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("LSN invalido: %s", lsn)
+	}
+	return hi<<32 | lo, nil
+}
+
+func formatPgLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", lsn>>32, uint32(lsn))
+}
@@ -0,0 +1,245 @@
+package jobrunner
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pgoutputMessage monta mensagens pgoutput (protocolo 1) byte a byte.
+type pgoutputMessage []byte
+
+func newPgoutputMessage(kind byte) pgoutputMessage {
+	return pgoutputMessage{kind}
+}
+
+func (m pgoutputMessage) u8(v byte) pgoutputMessage {
+	return append(m, v)
+}
+
+func (m pgoutputMessage) u16(v uint16) pgoutputMessage {
+	return binary.BigEndian.AppendUint16(m, v)
+}
+
+func (m pgoutputMessage) u32(v uint32) pgoutputMessage {
+	return binary.BigEndian.AppendUint32(m, v)
+}
+
+func (m pgoutputMessage) u64(v uint64) pgoutputMessage {
+	return binary.BigEndian.AppendUint64(m, v)
+}
+
+func (m pgoutputMessage) str(s string) pgoutputMessage {
+	return append(append(m, s...), 0)
+}
+
+// tuple recebe um valor por coluna: nil = 'n', "\x00toast" = 'u', demais = 't'.
+func (m pgoutputMessage) tuple(values ...interface{}) pgoutputMessage {
+	m = m.u16(uint16(len(values)))
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			m = m.u8('n')
+		case string:
+			if v == "\x00toast" {
+				m = m.u8('u')
+				continue
+			}
+			m = m.u8('t').u32(uint32(len(v)))
+			m = append(m, v...)
+		}
+	}
+	return m
+}
+
+func pgBegin(xid uint32) []byte {
+	return newPgoutputMessage('B').u64(0x100).u64(0).u32(xid)
+}
+
+func pgCommit(end uint64) []byte {
+	return newPgoutputMessage('C').u8(0).u64(end - 8).u64(end).u64(0)
+}
+
+func pgRelationMessage(id uint32, schema, table string) []byte {
+	return newPgoutputMessage('R').u32(id).str(schema).str(table).u8('d').u16(4).
+		u8(1).str("id").u32(pgOIDInt8).u32(0xFFFFFFFF).
+		u8(0).str("nome").u32(25).u32(0xFFFFFFFF).
+		u8(0).str("ativo").u32(pgOIDBool).u32(0xFFFFFFFF).
+		u8(0).str("criado").u32(pgOIDTimestampTZ).u32(0xFFFFFFFF)
+}
+
+func TestPgoutputRelation(t *testing.T) {
+	r := &pgoutputReader{buf: pgRelationMessage(16390, "", "clientes"), pos: 1}
+	id, rel := r.relation()
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if id != 16390 {
+		t.Errorf("id = %d", id)
+	}
+	want := pgRelation{
+		Namespace: "pg_catalog",
+		Name:      "clientes",
+		Columns: []pgRelationColumn{
+			{Name: "id", TypeOID: pgOIDInt8, Key: true},
+			{Name: "nome", TypeOID: 25},
+			{Name: "ativo", TypeOID: pgOIDBool},
+			{Name: "criado", TypeOID: pgOIDTimestampTZ},
+		},
+	}
+	if !reflect.DeepEqual(rel, want) {
+		t.Errorf("relacao = %+v, esperado %+v", rel, want)
+	}
+}
+
+func TestPgoutputDecoder(t *testing.T) {
+	criado := time.Date(2024, 5, 1, 12, 0, 0, 500000000, time.FixedZone("", -3*3600))
+	messages := [][]byte{
+		pgRelationMessage(1, "public", "clientes"),
+		pgRelationMessage(2, "public", "outra"),
+		pgBegin(10),
+		newPgoutputMessage('I').u32(1).u8('N').tuple("1", "ana", "t", "2024-05-01 12:00:00.5-03"),
+		newPgoutputMessage('I').u32(2).u8('N').tuple("9", "fora", "f", nil),
+		// Update com chave alterada (K) e coluna TOAST sem alteracao
+		newPgoutputMessage('U').u32(1).u8('K').tuple("1", nil, nil, nil).u8('N').tuple("2", "\x00toast", "f", nil),
+		// Update sem chave antiga
+		newPgoutputMessage('U').u32(1).u8('N').tuple("2", "bia", nil, nil),
+		newPgoutputMessage('D').u32(1).u8('K').tuple("2", nil, nil, nil),
+		pgCommit(0x2000),
+		pgBegin(11),
+		newPgoutputMessage('T').u32(2).u8(0).u32(2).u32(1),
+		pgCommit(0x3000),
+		// Transacao incompleta no fim do lote fica de fora
+		pgBegin(12),
+		newPgoutputMessage('I').u32(1).u8('N').tuple("3", "cris", "t", nil),
+	}
+
+	dec := newPgoutputDecoder("public", "clientes")
+	dec.reset()
+	for i, msg := range messages {
+		if err := dec.decode(msg); err != nil {
+			t.Fatalf("mensagem %d: %v", i, err)
+		}
+	}
+
+	want := []pgTransaction{
+		{EndLSN: 0x2000, Changes: []cdcChange{
+			{Kind: 'I', New: map[string]interface{}{"id": int64(1), "nome": "ana", "ativo": true, "criado": criado}},
+			{Kind: 'U',
+				Old: map[string]interface{}{"id": int64(1), "nome": nil, "ativo": nil, "criado": nil},
+				New: map[string]interface{}{"id": int64(2), "ativo": false, "criado": nil}},
+			{Kind: 'U', New: map[string]interface{}{"id": int64(2), "nome": "bia", "ativo": nil, "criado": nil}},
+			{Kind: 'D', Old: map[string]interface{}{"id": int64(2), "nome": nil, "ativo": nil, "criado": nil}},
+		}},
+		{EndLSN: 0x3000, Changes: []cdcChange{{Kind: 'T'}}},
+	}
+	if len(dec.txs) != len(want) {
+		t.Fatalf("%d transacoes, esperado %d: %+v", len(dec.txs), len(want), dec.txs)
+	}
+	for i := range want {
+		got := dec.txs[i]
+		if got.EndLSN != want[i].EndLSN {
+			t.Errorf("tx %d: EndLSN = %X, esperado %X", i, got.EndLSN, want[i].EndLSN)
+		}
+		if len(got.Changes) != len(want[i].Changes) {
+			t.Fatalf("tx %d: %d alteracoes, esperado %d", i, len(got.Changes), len(want[i].Changes))
+		}
+		for j, change := range want[i].Changes {
+			if !cdcChangesEqual(got.Changes[j], change) {
+				t.Errorf("tx %d alteracao %d = %+v, esperado %+v", i, j, got.Changes[j], change)
+			}
+		}
+	}
+
+	// Relacoes continuam conhecidas apos reset: o proximo peek pode trazer so linhas
+	dec.reset()
+	if err := dec.decode(pgBegin(13)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.decode(newPgoutputMessage('D').u32(1).u8('K').tuple("5", nil, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.decode(pgCommit(0x4000)); err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.txs) != 1 || len(dec.txs[0].Changes) != 1 || dec.txs[0].Changes[0].Old["id"] != int64(5) {
+		t.Errorf("transacoes apos reset = %+v", dec.txs)
+	}
+}
+
+func cdcChangesEqual(a, b cdcChange) bool {
+	if a.Kind != b.Kind || len(a.New) != len(b.New) || len(a.Old) != len(b.Old) {
+		return false
+	}
+	for _, pair := range [][2]map[string]interface{}{{a.New, b.New}, {a.Old, b.Old}} {
+		for key, want := range pair[1] {
+			got, ok := pair[0][key]
+			if !ok {
+				return false
+			}
+			if wt, isTime := want.(time.Time); isTime {
+				gt, ok := got.(time.Time)
+				if !ok || !gt.Equal(wt) {
+					return false
+				}
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestPgoutputDecoderErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		msg  []byte
+	}{
+		{"relacao desconhecida", newPgoutputMessage('I').u32(99).u8('N').tuple("1")},
+		{"mensagem truncada", newPgoutputMessage('I').u32(1).u8('N').u16(4).u8('t').u32(10)},
+		{"tupla maior que a relacao", newPgoutputMessage('I').u32(1).u8('N').tuple("1", "a", "t", nil, "x")},
+		{"marcador invalido", newPgoutputMessage('U').u32(1).u8('X')},
+		{"formato binario", newPgoutputMessage('I').u32(1).u8('N').u16(1).u8('b')},
+		{"inteiro invalido", newPgoutputMessage('I').u32(1).u8('N').tuple("abc", nil, nil, nil)},
+		{"commit truncado", newPgoutputMessage('C').u8(0).u64(1)},
+		{"texto sem terminador", append(newPgoutputMessage('R').u32(3), "public"...)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := newPgoutputDecoder("public", "clientes")
+			dec.reset()
+			if err := dec.decode(pgRelationMessage(1, "public", "clientes")); err != nil {
+				t.Fatal(err)
+			}
+			if err := dec.decode(pgBegin(1)); err != nil {
+				t.Fatal(err)
+			}
+			if err := dec.decode(tc.msg); err == nil {
+				t.Errorf("esperado erro")
+			}
+		})
+	}
+}
+
+func TestPgLSN(t *testing.T) {
+	for _, text := range []string{"0/0", "16/B374D848", "FFFFFFFF/FFFFFFFF"} {
+		lsn, err := parsePgLSN(text)
+		if err != nil {
+			t.Fatalf("%s: %v", text, err)
+		}
+		if got := formatPgLSN(lsn); got != text {
+			t.Errorf("formatPgLSN(parsePgLSN(%s)) = %s", text, got)
+		}
+	}
+	if lsn, _ := parsePgLSN("16/B374D848"); lsn != 0x16B374D848 {
+		t.Errorf("LSN = %X", lsn)
+	}
+	for _, text := range []string{"", "16", "G/1", "1/100000000"} {
+		if _, err := parsePgLSN(text); err == nil {
+			t.Errorf("%q: esperado erro", text)
+		}
+	}
+}
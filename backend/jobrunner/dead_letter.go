@@ -0,0 +1,384 @@
+package jobrunner
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"etl/models"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultDeadLetterTable = "etl_dead_letter"
+	isolationSavepoint     = "etl_batch"
+)
+
+// deadLetterEntry representa uma linha rejeitada pelo destino.
+type deadLetterEntry struct {
+	Row      map[string]interface{}
+	SQLState string
+	Error    string
+}
+
+type deadLetterRecord struct {
+	PipelineID string                 `json:"pipeline_id"`
+	JobID      string                 `json:"job_id"`
+	JobName    string                 `json:"job_name"`
+	SQLState   string                 `json:"sqlstate,omitempty"`
+	Error      string                 `json:"error"`
+	Row        map[string]interface{} `json:"row"`
+	RejectedAt time.Time              `json:"rejected_at"`
+}
+
+// deadLetterSink grava as linhas rejeitadas de um job em arquivo JSONL (logs/dead_letter)
+// ou em uma tabela no destino, usando conexao propria (fora da transacao dos writers).
+// Na tabela as linhas entram com run_status "running" e finish grava o resultado do
+// job: "rolled_back" quando a carga foi desfeita e as rejeicoes nao valem mais.
+type deadLetterSink struct {
+	jr       *JobRunner
+	jobID    string
+	job      models.Job
+	target   string
+	table    string
+	path     string
+	budget   int
+	mu       sync.Mutex
+	ready    bool
+	file     *os.File
+	rejected int
+}
+
+func jobToleratesErrors(job models.Job) bool {
+	return strings.EqualFold(strings.TrimSpace(job.ErrorMode), "tolerate")
+}
+
+// newDeadLetterSink retorna nil quando o job nao tolera erros.
+func (jr *JobRunner) newDeadLetterSink(jobID string, job models.Job) *deadLetterSink {
+	if !jobToleratesErrors(job) {
+		return nil
+	}
+	sink := &deadLetterSink{
+		jr:     jr,
+		jobID:  jobID,
+		job:    job,
+		target: "file",
+		budget: job.ErrorBudget,
+	}
+	if strings.EqualFold(strings.TrimSpace(job.DeadLetter), "table") {
+		sink.target = "table"
+		sink.table = strings.TrimSpace(job.DeadLetterTable)
+		if sink.table == "" {
+			sink.table = defaultDeadLetterTable
+		}
+	} else {
+		sink.path = filepath.Join("logs", "dead_letter", fmt.Sprintf("%s_%s.jsonl", jr.PipelineLog.PipelineID, jobID))
+	}
+	return sink
+}
+
+// describe retorna o destino do dead-letter para mensagens de log.
+func (s *deadLetterSink) describe() string {
+	if s.target == "table" {
+		return "tabela " + s.table
+	}
+	return "arquivo " + s.path
+}
+
+// reject grava as linhas e atualiza o contador. Retorna erro quando o limite de erros do job e excedido.
+func (s *deadLetterSink) reject(entries []deadLetterEntry) (int, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.target == "table" {
+		err = s.writeTableLocked(entries)
+	} else {
+		err = s.writeFileLocked(entries)
+	}
+	if err != nil {
+		return s.rejected, fmt.Errorf("erro ao gravar dead-letter (%s): %w", s.describe(), err)
+	}
+
+	s.rejected += len(entries)
+	if s.budget > 0 && s.rejected > s.budget {
+		return s.rejected, fmt.Errorf("limite de erros excedido: %d linha(s) rejeitada(s), limite %d (ultimo erro: %s)", s.rejected, s.budget, entries[len(entries)-1].Error)
+	}
+	return s.rejected, nil
+}
+
+func (s *deadLetterSink) rejectedCount() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rejected
+}
+
+func (s *deadLetterSink) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+}
+
+func (s *deadLetterSink) newRecord(entry deadLetterEntry, now time.Time) deadLetterRecord {
+	return deadLetterRecord{
+		PipelineID: s.jr.PipelineLog.PipelineID,
+		JobID:      s.jobID,
+		JobName:    s.job.JobName,
+		SQLState:   entry.SQLState,
+		Error:      entry.Error,
+		Row:        entry.Row,
+		RejectedAt: now,
+	}
+}
+
+func (s *deadLetterSink) writeFileLocked(entries []deadLetterEntry) error {
+	if s.file == nil {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		s.file = file
+	}
+	now := time.Now()
+	enc := json.NewEncoder(s.file)
+	for _, entry := range entries {
+		if err := enc.Encode(s.newRecord(entry, now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *deadLetterSink) writeTableLocked(entries []deadLetterEntry) error {
+	dbType := normalizeDBTypeFromDSN(s.jr.DestinationDSN)
+	table := quoteQualifiedIdentifier(dbType, s.table)
+	if !s.ready {
+		if _, err := s.jr.DestinationDB.Exec(deadLetterTableDDL(dbType, table)); err != nil {
+			return err
+		}
+		// Tabelas criadas antes do run_status ganham a coluna
+		if _, err := s.jr.DestinationDB.Exec(fmt.Sprintf("SELECT run_status FROM %s WHERE 1 = 0", table)); err != nil {
+			if _, err := s.jr.DestinationDB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN run_status VARCHAR(16)", table)); err != nil {
+				return err
+			}
+		}
+		s.ready = true
+	}
+
+	now := time.Now()
+	placeholders := make([]string, 0, len(entries))
+	args := make([]interface{}, 0, len(entries)*8)
+	for _, entry := range entries {
+		rec := s.newRecord(entry, now)
+		rowJSON, err := json.Marshal(rec.Row)
+		if err != nil {
+			return err
+		}
+		group := make([]string, 8)
+		for i := range group {
+			group[i] = sqlPlaceholder(dbType, len(args)+i+1)
+		}
+		placeholders = append(placeholders, "("+strings.Join(group, ", ")+")")
+		args = append(args, rec.PipelineID, rec.JobID, rec.JobName, rec.SQLState, rec.Error, string(rowJSON), now, "running")
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (pipeline_id, job_id, job_name, sqlstate, error_message, row_data, rejected_at, run_status) VALUES %s",
+		table, strings.Join(placeholders, ", "))
+	_, err := s.jr.DestinationDB.Exec(insertSQL, args...)
+	return err
+}
+
+// finish grava o resultado do job (done ou rolled_back) nas linhas da tabela.
+func (s *deadLetterSink) finish(runStatus string) error {
+	if s == nil || s.target != "table" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ready {
+		return nil
+	}
+	dbType := normalizeDBTypeFromDSN(s.jr.DestinationDSN)
+	query := fmt.Sprintf("UPDATE %s SET run_status = %s WHERE pipeline_id = %s AND job_id = %s",
+		quoteQualifiedIdentifier(dbType, s.table), sqlPlaceholder(dbType, 1), sqlPlaceholder(dbType, 2), sqlPlaceholder(dbType, 3))
+	_, err := s.jr.DestinationDB.Exec(query, runStatus, s.jr.PipelineLog.PipelineID, s.jobID)
+	return err
+}
+
+func deadLetterTableDDL(dbType, table string) string {
+	if dbType == "mysql" {
+		return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	pipeline_id VARCHAR(255) NOT NULL,
+	job_id VARCHAR(255) NOT NULL,
+	job_name VARCHAR(255),
+	sqlstate VARCHAR(16),
+	error_message TEXT,
+	row_data LONGTEXT,
+	rejected_at DATETIME NOT NULL,
+	run_status VARCHAR(16)
+)`, table)
+	}
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGSERIAL PRIMARY KEY,
+	pipeline_id VARCHAR(255) NOT NULL,
+	job_id VARCHAR(255) NOT NULL,
+	job_name VARCHAR(255),
+	sqlstate VARCHAR(16),
+	error_message TEXT,
+	row_data TEXT,
+	rejected_at TIMESTAMP NOT NULL,
+	run_status VARCHAR(16)
+)`, table)
+}
+
+// quoteQualifiedIdentifier aplica quoteIdentifier em cada parte de schema.tabela.
+func quoteQualifiedIdentifier(dbType, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(dbType, strings.Trim(strings.TrimSpace(part), "\"`"))
+	}
+	return strings.Join(parts, ".")
+}
+
+func sqlPlaceholder(dbType string, n int) string {
+	if dbType == "mysql" {
+		return "?"
+	}
+	return "$" + strconv.Itoa(n)
+}
+
+// sqlStateFromError extrai o SQLSTATE (Postgres) ou o numero do erro (MySQL).
+func sqlStateFromError(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		if myErr.SQLState != [5]byte{} {
+			return string(myErr.SQLState[:])
+		}
+		return strconv.Itoa(int(myErr.Number))
+	}
+	return ""
+}
+
+// MySQL sem SQLSTATE de classe 22/23 para erros de valor da linha
+var mysqlRowLevelErrors = map[uint16]bool{
+	1264: true, // valor fora do intervalo
+	1265: true, // dado truncado
+	1292: true, // valor de data/numero incorreto
+	1364: true, // coluna sem valor padrao
+	1366: true, // valor incorreto para a coluna
+	1406: true, // dado longo demais
+	1411: true, // valor incorreto para funcao
+	1690: true, // valor fora do intervalo
+	3819: true, // check constraint
+	4025: true, // check constraint (MariaDB)
+}
+
+// isRowLevelError diz se o erro e causado pelos valores de alguma linha (dados invalidos,
+// chave duplicada, FK, NOT NULL). Permissao, coluna inexistente, timeout e conexao
+// perdida falham todas as linhas e nao devem ir para o dead-letter.
+func isRowLevelError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		class := string(pqErr.Code.Class())
+		return class == "22" || class == "23"
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		class := string(myErr.SQLState[:2])
+		return class == "22" || class == "23" || mysqlRowLevelErrors[myErr.Number]
+	}
+	return false
+}
+
+// deadLetterRow copia a linha para um formato serializavel antes de devolver o map ao pool.
+func deadLetterRow(rec map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(rec))
+	for k, v := range rec {
+		switch val := v.(type) {
+		case []byte:
+			out[k] = string(val)
+		case time.Time:
+			out[k] = val.Format(time.RFC3339Nano)
+		default:
+			out[k] = val
+		}
+	}
+	return out
+}
+
+// insertIsolatingRows insere o lote dentro de um SAVEPOINT. Se o lote falhar por erro
+// de linha, ele e dividido ao meio recursivamente ate isolar as linhas rejeitadas pelo
+// destino; as demais linhas permanecem na transacao do writer. Outros erros falham o lote.
+func (jr *JobRunner) insertIsolatingRows(tx *sql.Tx, job models.Job, rows []map[string]interface{}) (int, []deadLetterEntry, error) {
+	if len(rows) == 0 {
+		return 0, nil, nil
+	}
+	if _, err := tx.Exec("SAVEPOINT " + isolationSavepoint); err != nil {
+		return 0, nil, err
+	}
+
+	insertSQL, args := jr.Dialect.BuildInsertQuery(job, rows)
+	_, execErr := tx.Exec(insertSQL, args...)
+	if execErr == nil {
+		if _, err := tx.Exec("RELEASE SAVEPOINT " + isolationSavepoint); err != nil {
+			return 0, nil, err
+		}
+		return len(rows), nil, nil
+	}
+
+	if _, err := tx.Exec("ROLLBACK TO SAVEPOINT " + isolationSavepoint); err != nil {
+		return 0, nil, fmt.Errorf("%v (rollback do savepoint falhou: %v)", execErr, err)
+	}
+	if _, err := tx.Exec("RELEASE SAVEPOINT " + isolationSavepoint); err != nil {
+		return 0, nil, err
+	}
+	if !isRowLevelError(execErr) {
+		return 0, nil, execErr
+	}
+
+	if len(rows) == 1 {
+		return 0, []deadLetterEntry{{
+			Row:      deadLetterRow(rows[0]),
+			SQLState: sqlStateFromError(execErr),
+			Error:    execErr.Error(),
+		}}, nil
+	}
+
+	mid := len(rows) / 2
+	insertedLeft, rejectedLeft, err := jr.insertIsolatingRows(tx, job, rows[:mid])
+	if err != nil {
+		return 0, nil, err
+	}
+	insertedRight, rejectedRight, err := jr.insertIsolatingRows(tx, job, rows[mid:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return insertedLeft + insertedRight, append(rejectedLeft, rejectedRight...), nil
+}
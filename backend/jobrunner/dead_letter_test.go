@@ -0,0 +1,47 @@
+package jobrunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsRowLevelError(t *testing.T) {
+	mysqlErr := func(number uint16, state string) error {
+		e := &mysql.MySQLError{Number: number}
+		copy(e.SQLState[:], state)
+		return e
+	}
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"pg chave duplicada", &pq.Error{Code: "23505"}, true},
+		{"pg not null", &pq.Error{Code: "23502"}, true},
+		{"pg valor invalido", &pq.Error{Code: "22P02"}, true},
+		{"pg texto longo", fmt.Errorf("lote: %w", &pq.Error{Code: "22001"}), true},
+		{"pg permissao", &pq.Error{Code: "42501"}, false},
+		{"pg coluna inexistente", &pq.Error{Code: "42703"}, false},
+		{"pg statement_timeout", &pq.Error{Code: "57014"}, false},
+		{"pg conexao", &pq.Error{Code: "08006"}, false},
+		{"mysql duplicada", mysqlErr(1062, "23000"), true},
+		{"mysql fk", mysqlErr(1452, "23000"), true},
+		{"mysql valor incorreto", mysqlErr(1366, "HY000"), true},
+		{"mysql dado longo", mysqlErr(1406, "22001"), true},
+		{"mysql permissao", mysqlErr(1142, "42000"), false},
+		{"mysql coluna inexistente", mysqlErr(1054, "42S22"), false},
+		{"mysql timeout", mysqlErr(3024, "HY000"), false},
+		{"conexao perdida", errors.New("driver: bad connection"), false},
+		{"contexto", context.DeadlineExceeded, false},
+	}
+	for _, tc := range cases {
+		if got := isRowLevelError(tc.err); got != tc.want {
+			t.Errorf("%s: isRowLevelError = %v, esperado %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package jobrunner
+
+import (
+	"bytes"
+	"database/sql"
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Jobs delete-sync leem as chaves ordenadas da origem e do destino em paralelo e
+// comparam as duas listas em Go (merge), sem carregar nenhuma delas em memoria. Chaves
+// que so existem no destino sao apagadas, ou marcadas em SoftDeleteColumn, em lotes.
+
+const defaultDeleteSyncBatch = 1000
+
+// Modos de comparacao das chaves: a ordenacao pedida ao banco precisa ser a mesma do Go
+const (
+	deleteSyncCompareNumber = "number"
+	deleteSyncCompareTime   = "time"
+	deleteSyncCompareText   = "text"
+)
+
+type deleteSyncResult struct {
+	SourceKeys      int
+	DestinationKeys int
+	Deleted         int
+	SoftDeleted     int
+}
+
+func (jr *JobRunner) runDeleteSyncJob(jobID string, job models.Job) {
+	log.Printf("Iniciando job delete-sync: %s", job.JobName)
+
+	jr.WaitGroup.Add(1)
+	go func() {
+		defer jr.WaitGroup.Done()
+		if jr.shouldStop() {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", time.Now())
+			return
+		}
+
+		releaseJobSlot, err := jr.acquireJobSlot(jobID, job)
+		defer releaseJobSlot()
+		if err != nil {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", time.Now())
+			return
+		}
+
+		start := time.Now()
+		logger.AddJob(jr.PipelineLog, logger.JobLog{
+			JobID:       jobID,
+			JobName:     job.JobName,
+			Status:      "running",
+			StopOnError: job.StopOnError,
+			StartedAt:   start,
+			Batches:     make([]logger.BatchLog, 0),
+		})
+		jr.savePipelineLog()
+
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+			js.Name = job.JobName
+			js.Status = "running"
+			js.StartedAt = &start
+			status.NotifySubscribers()
+		})
+
+		result, err := jr.deleteSync(jobID, job)
+		end := time.Now()
+		removed := result.Deleted + result.SoftDeleted
+		logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+			jl.Processed = removed
+			jl.Total = result.DestinationKeys
+			jl.Result = map[string]interface{}{
+				"sourceKeys":      result.SourceKeys,
+				"destinationKeys": result.DestinationKeys,
+				"deleted":         result.Deleted,
+				"softDeleted":     result.SoftDeleted,
+			}
+		})
+		if jr.shouldStop() {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", end)
+			return
+		}
+		if err != nil {
+			log.Printf("Erro no job delete-sync %s: %v\n", job.ID, err)
+			status.AppendLog(fmt.Sprintf("%s - Job: %s falhou: %s", jr.PipelineLog.Project, job.JobName, err.Error()))
+			releaseJobSlot()
+			jr.handleExecutionJobError(jobID, job, err)
+			return
+		}
+
+		log.Printf("Job %s (%s): %d chave(s) na origem, %d no destino, %d apagada(s), %d marcada(s)", job.ID, job.JobName, result.SourceKeys, result.DestinationKeys, result.Deleted, result.SoftDeleted)
+		status.AppendLog(fmt.Sprintf("%s - Job: %s removeu %d linha(s) sem correspondencia na origem", jr.PipelineLog.Project, job.JobName, removed))
+		jr.recordThrottledTime(jobID, job)
+		jr.recordQueuedTime(jobID)
+		logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+			jl.Status = "done"
+			jl.EndedAt = end
+		})
+		jr.savePipelineLog()
+
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+			js.Status = "done"
+			js.Processed = removed
+			js.Total = result.DestinationKeys
+			js.Progress = 100
+			js.EndedAt = &end
+			status.NotifySubscribers()
+		})
+
+		releaseJobSlot()
+		for _, nextID := range jr.ConnMap[jobID] {
+			jr.RunJob(nextID)
+		}
+	}()
+}
+
+func (jr *JobRunner) deleteSync(jobID string, job models.Job) (deleteSyncResult, error) {
+	result := deleteSyncResult{}
+	spec := models.DeleteSyncSpec{}
+	if job.DeleteSync != nil {
+		spec = *job.DeleteSync
+	}
+	sourceSQL := spec.SourceSQL
+	if strings.TrimSpace(sourceSQL) == "" {
+		sourceSQL = job.SelectSQL
+	}
+	sourceSQL = trimReconcileSQL(jr.SubstituteVariables(sourceSQL))
+	if sourceSQL == "" {
+		return result, fmt.Errorf("job delete-sync sem consulta de origem")
+	}
+	keys := spec.KeyColumns
+	if len(keys) == 0 {
+		keys = job.PrimaryKeys
+	}
+	if len(keys) == 0 {
+		return result, fmt.Errorf("job delete-sync requer keyColumns ou primaryKeys")
+	}
+	table := strings.TrimSpace(jr.SubstituteVariables(spec.TargetTable))
+	if table == "" {
+		var ok bool
+		if table, ok = extractInsertTable(jr.SubstituteVariables(job.InsertSQL)); !ok {
+			return result, fmt.Errorf("job delete-sync sem tabela de destino (targetTable ou InsertSQL)")
+		}
+	}
+	batchSize := spec.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultDeleteSyncBatch
+	}
+
+	sourceType := normalizeDBTypeFromDSN(jr.SourceDSN)
+	destType := normalizeDBTypeFromDSN(jr.DestinationDSN)
+	schema, name := splitSchemaSyncTable(destType, table)
+	quotedTable := quoteSchemaSyncTable(destType, schema, name)
+
+	destFilter := ""
+	softValue := strings.TrimSpace(spec.SoftDeleteValue)
+	if softValue == "" {
+		softValue = "TRUE"
+	}
+	if col := strings.TrimSpace(spec.SoftDeleteColumn); col != "" {
+		// Linhas ja marcadas nao entram na comparacao. Marca booleana: ativa quando nula
+		// ou diferente de TRUE; demais marcas (ex: data da exclusao): ativa quando nula.
+		quoted := quoteIdentifier(destType, col)
+		destFilter = fmt.Sprintf(" WHERE %s IS NULL", quoted)
+		if strings.EqualFold(softValue, "TRUE") {
+			destFilter = fmt.Sprintf(" WHERE (%s IS NULL OR %s <> TRUE)", quoted, quoted)
+		}
+	}
+	destKeysSQL := fmt.Sprintf("SELECT %s FROM %s%s", quoteSchemaSyncColumns(destType, keys), quotedTable, destFilter)
+	sourceKeysSQL := fmt.Sprintf("SELECT %s FROM (%s) ds", quoteSchemaSyncColumns(sourceType, keys), sourceSQL)
+
+	// A vaga de query da origem fica reservada ate o fim da leitura das chaves
+	releaseSlot, waited, err := jr.acquireSourceSlot(jr.ctx)
+	jr.addThrottled(jobID, waited)
+	if err != nil {
+		return result, err
+	}
+	defer releaseSlot()
+
+	modes, err := jr.deleteSyncCompareModes(keys, sourceType, sourceKeysSQL, destType, destKeysSQL)
+	if err != nil {
+		return result, err
+	}
+
+	sourceRows, err := jr.SourceDB.QueryContext(jr.ctx, sourceKeysSQL+deleteSyncOrderBy(sourceType, keys, modes))
+	if err != nil {
+		return result, fmt.Errorf("origem: %w", err)
+	}
+	defer sourceRows.Close()
+	source := newDeleteSyncCursor("origem", sourceRows, modes)
+	jobLimiter := newRowRateLimiter(job.MaxRowsPerSecond)
+	source.throttleEvery = batchSize
+	source.throttle = func(rows int) error {
+		waited, err := jr.waitSourceRows(jr.ctx, jobLimiter, rows)
+		jr.addThrottled(jobID, waited)
+		return err
+	}
+
+	// A origem vazia costuma ser falha de extracao: so apaga tudo se permitido
+	sourceKey, sourceOK, err := source.next()
+	if err != nil {
+		return result, err
+	}
+	if !sourceOK && !spec.AllowEmptySource {
+		return result, fmt.Errorf("origem sem chaves; use allowEmptySource para remover todas as linhas do destino")
+	}
+
+	destRows, err := jr.DestinationDB.QueryContext(jr.ctx, destKeysSQL+deleteSyncOrderBy(destType, keys, modes))
+	if err != nil {
+		return result, fmt.Errorf("destino: %w", err)
+	}
+	defer destRows.Close()
+	dest := newDeleteSyncCursor("destino", destRows, modes)
+
+	remover := &deleteSyncRemover{
+		jr:         jr,
+		jobID:      jobID,
+		job:        job,
+		destType:   destType,
+		table:      quotedTable,
+		keys:       keys,
+		softColumn: strings.TrimSpace(spec.SoftDeleteColumn),
+		softValue:  softValue,
+		batchSize:  batchSize,
+		result:     &result,
+	}
+	for {
+		if jr.shouldStop() {
+			return result, nil
+		}
+		destKey, destOK, err := dest.next()
+		if err != nil {
+			return result, err
+		}
+		if !destOK {
+			break
+		}
+		for sourceOK && compareDeleteSyncKeys(sourceKey, destKey, modes) < 0 {
+			if sourceKey, sourceOK, err = source.next(); err != nil {
+				return result, err
+			}
+		}
+		if sourceOK && compareDeleteSyncKeys(sourceKey, destKey, modes) == 0 {
+			continue
+		}
+		if err := remover.add(destKey); err != nil {
+			return result, err
+		}
+	}
+	if err := remover.flush(); err != nil {
+		return result, err
+	}
+	// Termina a leitura da origem so para informar o total de chaves
+	for sourceOK {
+		if _, sourceOK, err = source.next(); err != nil {
+			return result, err
+		}
+	}
+	result.SourceKeys = source.count
+	result.DestinationKeys = dest.count
+	return result, nil
+}
+
+// deleteSyncCompareModes define como cada chave e comparada a partir dos tipos das duas
+// consultas; os dois lados precisam cair na mesma familia.
+func (jr *JobRunner) deleteSyncCompareModes(keys []string, sourceType, sourceSQL, destType, destSQL string) ([]string, error) {
+	sourceTypes, err := querySchemaColumnTypes(jr.ctx, jr.SourceDB, sourceSQL)
+	if err != nil {
+		return nil, fmt.Errorf("origem: %w", err)
+	}
+	destTypes, err := querySchemaColumnTypes(jr.ctx, jr.DestinationDB, destSQL)
+	if err != nil {
+		return nil, fmt.Errorf("destino: %w", err)
+	}
+	if len(sourceTypes) != len(keys) || len(destTypes) != len(keys) {
+		return nil, fmt.Errorf("consultas de chaves com quantidade de colunas inesperada")
+	}
+	modes := make([]string, len(keys))
+	for i, key := range keys {
+		sourceMode := deleteSyncCompareMode(sourceTypes[i].DatabaseTypeName())
+		destMode := deleteSyncCompareMode(destTypes[i].DatabaseTypeName())
+		if sourceMode != destMode {
+			return nil, fmt.Errorf("chave %s com tipos incompativeis: %s na origem e %s no destino", key, sourceTypes[i].DatabaseTypeName(), destTypes[i].DatabaseTypeName())
+		}
+		modes[i] = sourceMode
+	}
+	return modes, nil
+}
+
+func deleteSyncCompareMode(typeName string) string {
+	switch schemaTypeFamily(typeName) {
+	case "integer", "numeric", "float":
+		return deleteSyncCompareNumber
+	case "timestamp", "date":
+		return deleteSyncCompareTime
+	default:
+		return deleteSyncCompareText
+	}
+}
+
+// deleteSyncOrderBy ordena texto por bytes (colacao C / binaria), como a comparacao em Go.
+func deleteSyncOrderBy(dbType string, keys, modes []string) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		quoted := quoteIdentifier(dbType, key)
+		switch {
+		case modes[i] != deleteSyncCompareText:
+			parts[i] = quoted
+		case dbType == "mysql":
+			parts[i] = fmt.Sprintf("CAST(%s AS BINARY)", quoted)
+		default:
+			parts[i] = fmt.Sprintf("%s::text COLLATE \"C\"", quoted)
+		}
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// deleteSyncCursor le as chaves de um lado e garante que chegam em ordem.
+type deleteSyncCursor struct {
+	side  string
+	rows  *sql.Rows
+	modes []string
+	prev  []interface{}
+	count int
+	// throttle recebe a quantidade de chaves lidas a cada throttleEvery chaves
+	throttle      func(rows int) error
+	throttleEvery int
+	unthrottled   int
+}
+
+func newDeleteSyncCursor(side string, rows *sql.Rows, modes []string) *deleteSyncCursor {
+	return &deleteSyncCursor{side: side, rows: rows, modes: modes}
+}
+
+func (c *deleteSyncCursor) next() ([]interface{}, bool, error) {
+	if !c.rows.Next() {
+		if err := c.rows.Err(); err != nil {
+			return nil, false, fmt.Errorf("%s: %w", c.side, err)
+		}
+		return nil, false, nil
+	}
+	key := make([]interface{}, len(c.modes))
+	pointers := make([]interface{}, len(key))
+	for i := range key {
+		pointers[i] = &key[i]
+	}
+	if err := c.rows.Scan(pointers...); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", c.side, err)
+	}
+	for i, value := range key {
+		if value == nil {
+			return nil, false, fmt.Errorf("%s: chave %d nula", c.side, i+1)
+		}
+	}
+	// Ordem diferente da esperada faria o merge apagar linhas validas
+	if c.prev != nil && compareDeleteSyncKeys(c.prev, key, c.modes) > 0 {
+		return nil, false, fmt.Errorf("%s: chaves fora de ordem (%s depois de %s)", c.side, formatDeleteSyncKey(key), formatDeleteSyncKey(c.prev))
+	}
+	c.prev = key
+	c.count++
+	c.unthrottled++
+	if c.throttle != nil && c.unthrottled >= c.throttleEvery {
+		rows := c.unthrottled
+		c.unthrottled = 0
+		if err := c.throttle(rows); err != nil {
+			return nil, false, err
+		}
+	}
+	return key, true, nil
+}
+
+func compareDeleteSyncKeys(a, b []interface{}, modes []string) int {
+	for i, mode := range modes {
+		var cmp int
+		switch mode {
+		case deleteSyncCompareNumber:
+			x, okX := new(big.Rat).SetString(valueToString(a[i]))
+			y, okY := new(big.Rat).SetString(valueToString(b[i]))
+			if okX && okY {
+				cmp = x.Cmp(y)
+				break
+			}
+			cmp = strings.Compare(valueToString(a[i]), valueToString(b[i]))
+		case deleteSyncCompareTime:
+			cmp = strings.Compare(deleteSyncTimeValue(a[i]), deleteSyncTimeValue(b[i]))
+		default:
+			cmp = bytes.Compare([]byte(valueToString(a[i])), []byte(valueToString(b[i])))
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// deleteSyncTimeValue normaliza datas dos dois bancos (time.Time ou texto) para comparar.
+func deleteSyncTimeValue(val interface{}) string {
+	if t, ok := val.(time.Time); ok {
+		return t.UTC().Format("2006-01-02 15:04:05.999999")
+	}
+	text := strings.TrimSpace(valueToString(val))
+	for _, layout := range []string{"2006-01-02 15:04:05.999999", time.RFC3339Nano, "2006-01-02T15:04:05.999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.UTC().Format("2006-01-02 15:04:05.999999")
+		}
+	}
+	return text
+}
+
+// buildKeyInClause monta "(k1, k2) IN ((?, ?), ...)" com parametros; args iniciais
+// (ex: valores de um SET) ocupam os primeiros placeholders do Postgres.
+func buildKeyInClause(dbType string, keys []string, tuples [][]interface{}, args []interface{}) (string, []interface{}) {
+	items := make([]string, 0, len(tuples))
+	for _, key := range tuples {
+		placeholders := make([]string, len(key))
+		for i, value := range key {
+			args = append(args, value)
+			placeholders[i] = "?"
+			if dbType == "postgres" {
+				placeholders[i] = fmt.Sprintf("$%d", len(args))
+			}
+		}
+		item := strings.Join(placeholders, ", ")
+		if len(key) > 1 {
+			item = "(" + item + ")"
+		}
+		items = append(items, item)
+	}
+	target := quoteSchemaSyncColumns(dbType, keys)
+	if len(keys) > 1 {
+		target = "(" + target + ")"
+	}
+	return fmt.Sprintf("%s IN (%s)", target, strings.Join(items, ", ")), args
+}
+
+func formatDeleteSyncKey(key []interface{}) string {
+	parts := make([]string, len(key))
+	for i, value := range key {
+		parts[i] = valueToString(value)
+	}
+	return strings.Join(parts, "|")
+}
+
+// deleteSyncRemover acumula as chaves sobrando no destino e apaga (ou marca) em lotes.
+type deleteSyncRemover struct {
+	jr         *JobRunner
+	jobID      string
+	job        models.Job
+	destType   string
+	table      string
+	keys       []string
+	softColumn string
+	softValue  string
+	batchSize  int
+	pending    [][]interface{}
+	result     *deleteSyncResult
+}
+
+func (r *deleteSyncRemover) add(key []interface{}) error {
+	r.pending = append(r.pending, key)
+	if len(r.pending) >= r.batchSize {
+		return r.flush()
+	}
+	return nil
+}
+
+func (r *deleteSyncRemover) flush() error {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	batchStart := time.Now()
+	where, args := buildKeyInClause(r.destType, r.keys, r.pending, nil)
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", r.table, where)
+	if r.softColumn != "" {
+		query = fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s", r.table, quoteIdentifier(r.destType, r.softColumn), r.softValue, where)
+	}
+	res, err := r.jr.DestinationDB.ExecContext(r.jr.ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("erro ao remover chaves do destino: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		affected = int64(len(r.pending))
+	}
+
+	offset := r.result.Deleted + r.result.SoftDeleted
+	if r.softColumn != "" {
+		r.result.SoftDeleted += int(affected)
+	} else {
+		r.result.Deleted += int(affected)
+	}
+	logger.AddBatch(r.jr.PipelineLog, r.jobID, logger.BatchLog{
+		Offset:    offset,
+		Limit:     len(r.pending),
+		Rows:      int(affected),
+		Status:    "done",
+		StartedAt: batchStart,
+		EndedAt:   time.Now(),
+	})
+	r.jr.savePipelineLog()
+	status.UpdateJobStatus(r.jr.statusKey(r.job.ID), func(js *status.JobStatus) {
+		js.Processed = offset + int(affected)
+		status.NotifySubscribers()
+	})
+	r.pending = r.pending[:0]
+	return nil
+}
@@ -0,0 +1,1179 @@
+package jobrunner
+
+import (
+	"database/sql"
+	"etl/models"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Linguagem de expressoes usada em filtros e colunas calculadas dos jobs.
+// Exemplos:
+//
+//	amount * 1.1
+//	status in ('A','B') && created_at > var("data_inicio")
+//	coalesce(nome, 'sem nome') + ' - ' + upper(uf)
+//
+// Operadores: || && ! (ou and/or/not), == = != <> < <= > >=, in, not in,
+// is null, is not null, + - * / %. Strings entre aspas simples ou duplas.
+//
+// + soma apenas numeros (colunas de tipo numerico e literais) e concatena quando um
+// dos lados e texto: colunas texto como CEP ou telefone nunca viram numero. Use
+// number(x) para somar texto numerico. DECIMAL/NUMERIC sao calculados com big.Rat.
+
+type exprTokenKind int
+
+const (
+	tokEOF exprTokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	pos  int
+}
+
+func tokenizeExpression(src string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0)
+	runes := []rune(src)
+	i := 0
+	for i < len(runes) {
+		ch := runes[i]
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case unicode.IsDigit(ch) || (ch == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: string(runes[start:i]), pos: start})
+		case ch == '\'' || ch == '"':
+			start := i
+			quote := ch
+			i++
+			var b strings.Builder
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					b.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == quote {
+					// aspas duplicadas ('') representam a propria aspa, como no SQL
+					if i+1 < len(runes) && runes[i+1] == quote {
+						b.WriteRune(quote)
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				b.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("string nao fechada na posicao %d", start+1)
+			}
+			tokens = append(tokens, exprToken{kind: tokString, text: b.String(), pos: start})
+		case ch == '_' || unicode.IsLetter(ch):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: string(runes[start:i]), pos: start})
+		case ch == '(':
+			tokens = append(tokens, exprToken{kind: tokLParen, text: "(", pos: i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, exprToken{kind: tokRParen, text: ")", pos: i})
+			i++
+		case ch == ',':
+			tokens = append(tokens, exprToken{kind: tokComma, text: ",", pos: i})
+			i++
+		default:
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				switch two {
+				case "==", "!=", "<>", "<=", ">=", "&&", "||":
+					tokens = append(tokens, exprToken{kind: tokOp, text: two, pos: i})
+					i += 2
+					continue
+				}
+			}
+			switch ch {
+			case '+', '-', '*', '/', '%', '<', '>', '=', '!':
+				tokens = append(tokens, exprToken{kind: tokOp, text: string(ch), pos: i})
+				i++
+			default:
+				return nil, fmt.Errorf("caractere inesperado '%c' na posicao %d", ch, i+1)
+			}
+		}
+	}
+	tokens = append(tokens, exprToken{kind: tokEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// exprEnv e o contexto de avaliacao: a linha atual e as variaveis do projeto.
+type exprEnv struct {
+	row   map[string]interface{}
+	vars  map[string]string
+	kinds map[string]string // tipo de cada coluna (exportKindFromDBType), quando conhecido
+}
+
+type exprNode interface {
+	eval(env *exprEnv) (interface{}, error)
+}
+
+type compiledExpression struct {
+	src  string
+	root exprNode
+}
+
+func (e *compiledExpression) eval(row map[string]interface{}, vars map[string]string) (interface{}, error) {
+	return e.root.eval(&exprEnv{row: row, vars: vars})
+}
+
+func (e *compiledExpression) evalWithKinds(row map[string]interface{}, vars, kinds map[string]string) (interface{}, error) {
+	return e.root.eval(&exprEnv{row: row, vars: vars, kinds: kinds})
+}
+
+// compileExpression faz o parse da expressao uma unica vez.
+func compileExpression(src string) (*compiledExpression, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("expressao vazia")
+	}
+	tokens, err := tokenizeExpression(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("token inesperado '%s' na posicao %d", tok.text, tok.pos+1)
+	}
+	return &compiledExpression{src: src, root: root}, nil
+}
+
+// ValidateExpression verifica a sintaxe de uma expressao de filtro ou coluna calculada.
+func ValidateExpression(src string) error {
+	_, err := compileExpression(src)
+	return err
+}
+
+// Precedencias (binding power) dos operadores infixos
+const (
+	bpOr      = 1
+	bpAnd     = 2
+	bpNot     = 3
+	bpCompare = 4
+	bpAdd     = 5
+	bpMul     = 6
+	bpUnary   = 7
+)
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func isKeyword(tok exprToken, word string) bool {
+	return tok.kind == tokIdent && strings.EqualFold(tok.text, word)
+}
+
+// infixOperator normaliza o operador na posicao atual e retorna sua precedencia.
+func (p *exprParser) infixOperator() (string, int) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokOp:
+		switch tok.text {
+		case "||":
+			return "||", bpOr
+		case "&&":
+			return "&&", bpAnd
+		case "==", "=":
+			return "==", bpCompare
+		case "!=", "<>":
+			return "!=", bpCompare
+		case "<", "<=", ">", ">=":
+			return tok.text, bpCompare
+		case "+", "-":
+			return tok.text, bpAdd
+		case "*", "/", "%":
+			return tok.text, bpMul
+		}
+	case isKeyword(tok, "or"):
+		return "||", bpOr
+	case isKeyword(tok, "and"):
+		return "&&", bpAnd
+	case isKeyword(tok, "in"):
+		return "in", bpCompare
+	case isKeyword(tok, "is"):
+		return "is", bpCompare
+	case isKeyword(tok, "not") && p.pos+1 < len(p.tokens) && isKeyword(p.tokens[p.pos+1], "in"):
+		return "not in", bpCompare
+	}
+	return "", 0
+}
+
+func (p *exprParser) parse(minBP int) (exprNode, error) {
+	left, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, bp := p.infixOperator()
+		if bp == 0 || bp <= minBP {
+			return left, nil
+		}
+		p.next()
+		switch op {
+		case "in", "not in":
+			if op == "not in" {
+				p.next()
+			}
+			items, err := p.parseList()
+			if err != nil {
+				return nil, err
+			}
+			left = &inNode{value: left, items: items, negate: op == "not in"}
+		case "is":
+			negate := false
+			if isKeyword(p.peek(), "not") {
+				p.next()
+				negate = true
+			}
+			if !isKeyword(p.peek(), "null") {
+				return nil, fmt.Errorf("esperado null apos is na posicao %d", p.peek().pos+1)
+			}
+			p.next()
+			left = &isNullNode{value: left, negate: negate}
+		default:
+			right, err := p.parse(bp)
+			if err != nil {
+				return nil, err
+			}
+			left = &binaryNode{op: op, left: left, right: right}
+		}
+	}
+}
+
+func (p *exprParser) parseList() ([]exprNode, error) {
+	if tok := p.next(); tok.kind != tokLParen {
+		return nil, fmt.Errorf("esperado '(' apos in na posicao %d", tok.pos+1)
+	}
+	items := make([]exprNode, 0)
+	if p.peek().kind == tokRParen {
+		p.next()
+		return items, nil
+	}
+	for {
+		item, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		tok := p.next()
+		if tok.kind == tokRParen {
+			return items, nil
+		}
+		if tok.kind != tokComma {
+			return nil, fmt.Errorf("esperado ',' ou ')' na posicao %d", tok.pos+1)
+		}
+	}
+}
+
+func (p *exprParser) parsePrefix() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		if !strings.ContainsAny(tok.text, ".eE") {
+			if n, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+				return &literalNode{value: n}, nil
+			}
+		}
+		// Literais decimais sao exatos: 0.1 nao vira 0.1000000000000000055
+		r, ok := parseDecimal(tok.text)
+		if !ok {
+			return nil, fmt.Errorf("numero invalido '%s' na posicao %d", tok.text, tok.pos+1)
+		}
+		return &literalNode{value: r}, nil
+	case tokString:
+		return &literalNode{value: tok.text}, nil
+	case tokLParen:
+		inner, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("esperado ')' na posicao %d", closing.pos+1)
+		}
+		return inner, nil
+	case tokOp:
+		switch tok.text {
+		case "-":
+			operand, err := p.parse(bpUnary)
+			if err != nil {
+				return nil, err
+			}
+			return &unaryNode{op: "-", operand: operand}, nil
+		case "!":
+			operand, err := p.parse(bpNot)
+			if err != nil {
+				return nil, err
+			}
+			return &unaryNode{op: "!", operand: operand}, nil
+		}
+	case tokIdent:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		case "not":
+			operand, err := p.parse(bpNot)
+			if err != nil {
+				return nil, err
+			}
+			return &unaryNode{op: "!", operand: operand}, nil
+		}
+		if p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		return &columnNode{name: tok.text}, nil
+	case tokEOF:
+		return nil, fmt.Errorf("expressao incompleta")
+	}
+	return nil, fmt.Errorf("token inesperado '%s' na posicao %d", tok.text, tok.pos+1)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, ok := exprFunctions[strings.ToLower(name.text)]
+	if !ok {
+		return nil, fmt.Errorf("funcao desconhecida '%s' na posicao %d", name.text, name.pos+1)
+	}
+	args, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("funcao %s recebeu %d argumento(s)", strings.ToLower(name.text), len(args))
+	}
+	return &callNode{name: strings.ToLower(name.text), fn: fn, args: args}, nil
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(env *exprEnv) (interface{}, error) {
+	return n.value, nil
+}
+
+type columnNode struct {
+	name string
+}
+
+func (n *columnNode) eval(env *exprEnv) (interface{}, error) {
+	if val, ok := env.row[n.name]; ok {
+		return exprColumnValue(val, env.kinds[n.name]), nil
+	}
+	for col, val := range env.row {
+		if strings.EqualFold(col, n.name) {
+			return exprColumnValue(val, env.kinds[col]), nil
+		}
+	}
+	return nil, fmt.Errorf("coluna '%s' nao encontrada", n.name)
+}
+
+// exprColumnValue converte o valor da coluna pelo tipo informado pelo driver: so
+// colunas numericas viram numero (NUMERIC chega como texto e vira big.Rat exato).
+func exprColumnValue(val interface{}, kind string) interface{} {
+	val = normalizeExprValue(val)
+	text, isText := val.(string)
+	if !isText {
+		return val
+	}
+	switch kind {
+	case "int":
+		if i, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64); err == nil {
+			return i
+		}
+		if r, ok := parseDecimal(text); ok {
+			return r
+		}
+	case "decimal":
+		if r, ok := parseDecimal(text); ok {
+			return r
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err == nil {
+			return f
+		}
+	}
+	return val
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) eval(env *exprEnv) (interface{}, error) {
+	val, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		if val == nil {
+			return nil, nil
+		}
+		return !exprTruthy(val), nil
+	}
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		return -v, nil
+	case float64:
+		return -v, nil
+	}
+	r, ok := exprToRat(val)
+	if !ok {
+		return nil, fmt.Errorf("operador - invalido para %s", exprTypeName(val))
+	}
+	return r.Neg(r), nil
+}
+
+type binaryNode struct {
+	op    string
+	left  exprNode
+	right exprNode
+}
+
+func (n *binaryNode) eval(env *exprEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	// Curto-circuito
+	switch n.op {
+	case "&&":
+		if left != nil && !exprTruthy(left) {
+			return false, nil
+		}
+	case "||":
+		if left != nil && exprTruthy(left) {
+			return true, nil
+		}
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "&&":
+		return left != nil && right != nil && exprTruthy(right), nil
+	case "||":
+		return right != nil && exprTruthy(right), nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		if left == nil || right == nil {
+			switch n.op {
+			case "==":
+				return left == nil && right == nil, nil
+			case "!=":
+				return (left == nil) != (right == nil), nil
+			}
+			return false, nil
+		}
+		cmp, err := exprCompare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "==":
+			return cmp == 0, nil
+		case "!=":
+			return cmp != 0, nil
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		default:
+			return cmp >= 0, nil
+		}
+	}
+	return exprArithmetic(n.op, left, right)
+}
+
+type inNode struct {
+	value  exprNode
+	items  []exprNode
+	negate bool
+}
+
+func (n *inNode) eval(env *exprEnv) (interface{}, error) {
+	val, err := n.value.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		return false, nil
+	}
+	for _, item := range n.items {
+		candidate, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if candidate == nil {
+			continue
+		}
+		if cmp, err := exprCompare(val, candidate); err == nil && cmp == 0 {
+			return !n.negate, nil
+		}
+	}
+	return n.negate, nil
+}
+
+type isNullNode struct {
+	value  exprNode
+	negate bool
+}
+
+func (n *isNullNode) eval(env *exprEnv) (interface{}, error) {
+	val, err := n.value.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return (val == nil) != n.negate, nil
+}
+
+type callNode struct {
+	name string
+	fn   exprFunction
+	args []exprNode
+}
+
+func (n *callNode) eval(env *exprEnv) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		val, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+	val, err := n.fn.call(env, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", n.name, err)
+	}
+	return val, nil
+}
+
+type exprFunction struct {
+	minArgs int
+	maxArgs int // -1 = sem limite
+	call    func(env *exprEnv, args []interface{}) (interface{}, error)
+}
+
+var exprFunctions = map[string]exprFunction{
+	"var": {1, 1, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		val, ok := env.vars[exprToString(args[0])]
+		if !ok {
+			return nil, nil
+		}
+		return val, nil
+	}},
+	"upper": {1, 1, stringFunc(strings.ToUpper)},
+	"lower": {1, 1, stringFunc(strings.ToLower)},
+	"trim":  {1, 1, stringFunc(strings.TrimSpace)},
+	"len": {1, 1, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return int64(len([]rune(exprToString(args[0])))), nil
+	}},
+	"concat": {1, -1, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		var b strings.Builder
+		for _, arg := range args {
+			if arg != nil {
+				b.WriteString(exprToString(arg))
+			}
+		}
+		return b.String(), nil
+	}},
+	"coalesce": {1, -1, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	}},
+	"if": {3, 3, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		if args[0] != nil && exprTruthy(args[0]) {
+			return args[1], nil
+		}
+		return args[2], nil
+	}},
+	"substr": {2, 3, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		runes := []rune(exprToString(args[0]))
+		start, ok := exprToFloat(args[1])
+		if !ok {
+			return nil, fmt.Errorf("posicao invalida")
+		}
+		// Posicao inicial comeca em 1, como no SQL
+		from := int(start) - 1
+		if from < 0 {
+			from = 0
+		}
+		if from > len(runes) {
+			from = len(runes)
+		}
+		to := len(runes)
+		if len(args) == 3 {
+			length, ok := exprToFloat(args[2])
+			if !ok {
+				return nil, fmt.Errorf("tamanho invalido")
+			}
+			if from+int(length) < to {
+				to = from + int(length)
+			}
+		}
+		return string(runes[from:to]), nil
+	}},
+	"contains":   {2, 2, stringPredicate(strings.Contains)},
+	"startswith": {2, 2, stringPredicate(strings.HasPrefix)},
+	"endswith":   {2, 2, stringPredicate(strings.HasSuffix)},
+	"abs": {1, 1, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		switch v := normalizeExprValue(args[0]).(type) {
+		case nil:
+			return nil, nil
+		case int64:
+			if v < 0 {
+				return -v, nil
+			}
+			return v, nil
+		case float64:
+			return math.Abs(v), nil
+		}
+		r, ok := exprToRat(args[0])
+		if !ok {
+			return nil, fmt.Errorf("valor nao numerico")
+		}
+		return r.Abs(r), nil
+	}},
+	"round": {1, 2, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		places := 0.0
+		if len(args) == 2 {
+			places, _ = exprToFloat(args[1])
+		}
+		if f, isFloat := normalizeExprValue(args[0]).(float64); isFloat {
+			pow := math.Pow(10, places)
+			return math.Round(f*pow) / pow, nil
+		}
+		r, ok := exprToRat(args[0])
+		if !ok {
+			return nil, fmt.Errorf("valor nao numerico")
+		}
+		return roundRat(r, int(places)), nil
+	}},
+	"number": {1, 1, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		switch v := normalizeExprValue(args[0]).(type) {
+		case nil, int64, float64, *big.Rat:
+			return v, nil
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return i, nil
+			}
+			if r, ok := parseDecimal(v); ok {
+				return r, nil
+			}
+		}
+		return nil, fmt.Errorf("valor nao numerico")
+	}},
+	"now": {0, 0, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return time.Now(), nil
+	}},
+	"date": {1, 2, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		layout := ""
+		if len(args) == 2 {
+			layout = convertDateLayout(exprToString(args[1]))
+		}
+		return parseDateValue(args[0], layout)
+	}},
+	"format_date": {2, 2, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		t, err := parseDateValue(args[0], "")
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(convertDateLayout(exprToString(args[1]))), nil
+	}},
+}
+
+func stringFunc(fn func(string) string) func(env *exprEnv, args []interface{}) (interface{}, error) {
+	return func(env *exprEnv, args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return fn(exprToString(args[0])), nil
+	}
+}
+
+func stringPredicate(fn func(string, string) bool) func(env *exprEnv, args []interface{}) (interface{}, error) {
+	return func(env *exprEnv, args []interface{}) (interface{}, error) {
+		if args[0] == nil || args[1] == nil {
+			return false, nil
+		}
+		return fn(exprToString(args[0]), exprToString(args[1])), nil
+	}
+}
+
+// roundRat arredonda para places casas, metade para longe do zero (como o ROUND do SQL).
+func roundRat(r *big.Rat, places int) *big.Rat {
+	pow := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(places))), nil))
+	scaled := new(big.Rat).Set(r)
+	if places >= 0 {
+		scaled.Mul(scaled, pow)
+	} else {
+		scaled.Quo(scaled, pow)
+	}
+	half := big.NewRat(1, 2)
+	if scaled.Sign() < 0 {
+		half.Neg(half)
+	}
+	scaled.Add(scaled, half)
+	// Quo do big.Int trunca em direcao ao zero
+	out := new(big.Rat).SetInt(new(big.Int).Quo(scaled.Num(), scaled.Denom()))
+	if places >= 0 {
+		return out.Quo(out, pow)
+	}
+	return out.Mul(out, pow)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// normalizeExprValue converte os tipos vindos do driver para os tipos da linguagem
+// (int64, float64, string, bool, time.Time ou nil).
+func normalizeExprValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case []byte:
+		return string(v)
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	return val
+}
+
+// exprTypeName descreve o tipo do valor nas mensagens de erro; o valor em si nao
+// aparece porque a coluna pode ter regra de mascaramento.
+func exprTypeName(val interface{}) string {
+	switch normalizeExprValue(val).(type) {
+	case nil:
+		return "nulo"
+	case bool:
+		return "booleano"
+	case string:
+		return "texto"
+	case time.Time:
+		return "data"
+	case int64, float64, *big.Rat:
+		return "numero"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+func exprToString(val interface{}) string {
+	if r, ok := val.(*big.Rat); ok {
+		return formatDecimal(r)
+	}
+	return valueToString(normalizeExprValue(val))
+}
+
+func exprToFloat(val interface{}) (float64, bool) {
+	switch v := normalizeExprValue(val).(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func exprTruthy(val interface{}) bool {
+	switch v := normalizeExprValue(val).(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case *big.Rat:
+		return v.Sign() != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// exprToRat converte inteiros, decimais, booleanos e texto numerico para big.Rat
+// (sempre uma copia). float64 fica de fora: o valor binario nao e o decimal digitado.
+func exprToRat(val interface{}) (*big.Rat, bool) {
+	switch v := normalizeExprValue(val).(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case *big.Rat:
+		return new(big.Rat).Set(v), true
+	case bool:
+		if v {
+			return big.NewRat(1, 1), true
+		}
+		return new(big.Rat), true
+	case string:
+		return parseDecimal(v)
+	}
+	return nil, false
+}
+
+// exprCompare compara dois valores nao nulos. Datas comparadas com strings
+// convertem a string para data; numeros comparados com strings numericas convertem para numero.
+func exprCompare(left, right interface{}) (int, error) {
+	left = normalizeExprValue(left)
+	right = normalizeExprValue(right)
+
+	lt, lIsTime := left.(time.Time)
+	rt, rIsTime := right.(time.Time)
+	if lIsTime || rIsTime {
+		var err error
+		if !lIsTime {
+			if lt, err = parseDateValue(left, ""); err != nil {
+				return 0, err
+			}
+		}
+		if !rIsTime {
+			if rt, err = parseDateValue(right, ""); err != nil {
+				return 0, err
+			}
+		}
+		switch {
+		case lt.Before(rt):
+			return -1, nil
+		case lt.After(rt):
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	if lb, ok := left.(bool); ok {
+		if rb, ok := right.(bool); ok {
+			switch {
+			case lb == rb:
+				return 0, nil
+			case !lb:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	_, lIsString := left.(string)
+	_, rIsString := right.(string)
+	if !(lIsString && rIsString) {
+		_, lIsFloat := left.(float64)
+		_, rIsFloat := right.(float64)
+		if lIsFloat || rIsFloat {
+			lf, lok := exprToFloat(left)
+			rf, rok := exprToFloat(right)
+			if lok && rok {
+				switch {
+				case lf < rf:
+					return -1, nil
+				case lf > rf:
+					return 1, nil
+				}
+				return 0, nil
+			}
+		} else if lr, lok := exprToRat(left); lok {
+			if rr, rok := exprToRat(right); rok {
+				return lr.Cmp(rr), nil
+			}
+		}
+	}
+
+	return strings.Compare(exprToString(left), exprToString(right)), nil
+}
+
+func exprArithmetic(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	left = normalizeExprValue(left)
+	right = normalizeExprValue(right)
+
+	if op == "+" {
+		// Texto concatena mesmo quando parece numero ('01310' + '100' = '01310100');
+		// numeros das colunas ja chegam tipados por exprColumnValue
+		_, lIsString := left.(string)
+		_, rIsString := right.(string)
+		if lIsString || rIsString {
+			return exprToString(left) + exprToString(right), nil
+		}
+	}
+
+	li, lInt := left.(int64)
+	ri, rInt := right.(int64)
+	if lInt && rInt && op != "/" {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("divisao por zero")
+			}
+			return li % ri, nil
+		}
+	}
+
+	_, lFloat := left.(float64)
+	_, rFloat := right.(float64)
+	if !lFloat && !rFloat {
+		// Inteiros, decimais e texto numerico: conta exata
+		lr, lok := exprToRat(left)
+		rr, rok := exprToRat(right)
+		if !lok || !rok {
+			return nil, fmt.Errorf("operador %s invalido para %s e %s", op, exprTypeName(left), exprTypeName(right))
+		}
+		switch op {
+		case "+":
+			return lr.Add(lr, rr), nil
+		case "-":
+			return lr.Sub(lr, rr), nil
+		case "*":
+			return lr.Mul(lr, rr), nil
+		case "/", "%":
+			if rr.Sign() == 0 {
+				return nil, fmt.Errorf("divisao por zero")
+			}
+			quo := new(big.Rat).Quo(lr, rr)
+			if op == "/" {
+				return quo, nil
+			}
+			// Resto com o sinal do dividendo, como o % do SQL
+			trunc := new(big.Rat).SetInt(new(big.Int).Quo(quo.Num(), quo.Denom()))
+			return lr.Sub(lr, trunc.Mul(trunc, rr)), nil
+		}
+		return nil, fmt.Errorf("operador %s desconhecido", op)
+	}
+
+	lf, lok := exprToFloat(left)
+	rf, rok := exprToFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operador %s invalido para %s e %s", op, exprTypeName(left), exprTypeName(right))
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("divisao por zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("divisao por zero")
+		}
+		return math.Mod(lf, rf), nil
+	}
+	return nil, fmt.Errorf("operador %s desconhecido", op)
+}
+
+// exprResultValue converte o resultado para um valor aceito pelos drivers: big.Rat
+// vira texto decimal (sem arredondar para float64).
+func exprResultValue(val interface{}) interface{} {
+	if r, ok := val.(*big.Rat); ok {
+		return formatDecimal(r)
+	}
+	return val
+}
+
+// rowExpressions guarda o filtro e as colunas calculadas do job, compilados uma vez.
+type rowExpressions struct {
+	filter   *compiledExpression
+	computed []computedColumn
+	vars     map[string]string
+	kinds    map[string]string
+}
+
+type computedColumn struct {
+	name string
+	expr *compiledExpression
+}
+
+func compileRowExpressions(filter string, columns []models.ComputedColumn, vars map[string]string) (*rowExpressions, error) {
+	if strings.TrimSpace(filter) == "" && len(columns) == 0 {
+		return nil, nil
+	}
+	out := &rowExpressions{vars: vars}
+	for i, col := range columns {
+		name := strings.TrimSpace(col.Name)
+		if name == "" {
+			return nil, fmt.Errorf("coluna calculada %d: informe o nome", i+1)
+		}
+		expr, err := compileExpression(col.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("coluna calculada '%s': %v", name, err)
+		}
+		out.computed = append(out.computed, computedColumn{name: name, expr: expr})
+	}
+	if strings.TrimSpace(filter) != "" {
+		expr, err := compileExpression(filter)
+		if err != nil {
+			return nil, fmt.Errorf("filtro: %v", err)
+		}
+		out.filter = expr
+	}
+	return out, nil
+}
+
+// withColumnTypes devolve uma copia que conhece o tipo das colunas lidas, para
+// numeros vindos como texto do driver (NUMERIC) serem tratados como numero.
+func (r *rowExpressions) withColumnTypes(cols []string, colTypes []*sql.ColumnType) *rowExpressions {
+	if r == nil || len(cols) != len(colTypes) {
+		return r
+	}
+	out := *r
+	out.kinds = make(map[string]string, len(cols))
+	for i, col := range cols {
+		out.kinds[col] = exportKindFromDBType(colTypes[i].DatabaseTypeName())
+	}
+	return &out
+}
+
+// apply calcula as colunas e avalia o filtro. Retorna false quando a linha deve ser descartada.
+func (r *rowExpressions) apply(rec map[string]interface{}) (bool, error) {
+	if r == nil {
+		return true, nil
+	}
+	// Resultados ficam como big.Rat ate o fim para o filtro e as colunas seguintes
+	// continuarem exatos; so depois viram texto decimal
+	defer func() {
+		for _, col := range r.computed {
+			if val, ok := rec[col.name]; ok {
+				rec[col.name] = exprResultValue(val)
+			}
+		}
+	}()
+	for _, col := range r.computed {
+		val, err := col.expr.evalWithKinds(rec, r.vars, r.kinds)
+		if err != nil {
+			return false, fmt.Errorf("coluna calculada '%s': %w", col.name, err)
+		}
+		rec[col.name] = val
+	}
+	if r.filter == nil {
+		return true, nil
+	}
+	val, err := r.filter.evalWithKinds(rec, r.vars, r.kinds)
+	if err != nil {
+		return false, fmt.Errorf("filtro: %w", err)
+	}
+	return exprTruthy(val), nil
+}
@@ -0,0 +1,212 @@
+package jobrunner
+
+import (
+	"etl/models"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func evalTestExpression(t *testing.T, src string, row map[string]interface{}, kinds map[string]string) (interface{}, error) {
+	t.Helper()
+	expr, err := compileExpression(src)
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return expr.evalWithKinds(row, map[string]string{"data_inicio": "2024-01-01", "limite": "10"}, kinds)
+}
+
+func TestExpressionEval(t *testing.T) {
+	row := map[string]interface{}{
+		"cep_a":    []byte("01310"),
+		"cep_b":    "100",
+		"qtd":      int64(3),
+		"preco":    []byte("19.90"),
+		"taxa":     0.5,
+		"nome":     "Ana",
+		"uf":       "sp",
+		"vazio":    nil,
+		"ativo":    true,
+		"criado":   time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC),
+		"grande":   []byte("12345678901234567890.12"),
+		"contador": int32(7),
+	}
+	kinds := map[string]string{"preco": "decimal", "grande": "decimal", "cep_a": "string", "cep_b": "string"}
+	rat := func(s string) *big.Rat {
+		r, _ := new(big.Rat).SetString(s)
+		return r
+	}
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		// + em texto concatena, mesmo quando o texto parece numero
+		{"cep_a + cep_b", "01310100"},
+		{"'1' + '2'", "12"},
+		{"nome + ' - ' + upper(uf)", "Ana - SP"},
+		{"cep_b + 1", "1001"},
+		{"number(cep_b) + 1", int64(101)},
+		{"number('1.5') + 1", rat("2.5")},
+		{"concat(cep_a, '-', qtd)", "01310-3"},
+		// Numeros
+		{"1 + 2 * 3", int64(7)},
+		{"(1 + 2) * 3", int64(9)},
+		{"10 - 4 - 3", int64(3)},
+		{"7 % 3", int64(1)},
+		{"-7 % 3", int64(-1)},
+		{"7 / 2", rat("7/2")},
+		{"qtd + contador", int64(10)},
+		{"qtd * taxa", 1.5},
+		{"taxa + 0.25", 0.75},
+		{"-qtd", int64(-3)},
+		// Decimais exatos (NUMERIC chega como texto do driver)
+		{"preco * qtd", rat("59.7")},
+		{"preco + 0.1", rat("20")},
+		{"grande + 1", rat("12345678901234567891.12")},
+		{"-preco", rat("-19.9")},
+		{"round(preco / 3, 2)", rat("6.63")},
+		{"round(-2.5)", rat("-3")},
+		{"abs(-preco)", rat("19.9")},
+		{"preco > 19.8999", true},
+		{"preco == 19.9", true},
+		// Nulos
+		{"vazio + 1", nil},
+		{"nome + vazio", nil},
+		{"vazio == null", true},
+		{"vazio != 1", true},
+		{"vazio > 1", false},
+		{"vazio is null", true},
+		{"nome is not null", true},
+		{"coalesce(vazio, nome)", "Ana"},
+		{"!vazio", nil},
+		// Logica e precedencia
+		{"true || false && false", true},
+		{"not ativo or qtd > 2", true},
+		{"qtd > 2 and qtd < 3", false},
+		{"1 + 1 == 2 && 'a' < 'b'", true},
+		{"if(qtd >= 3, 'alto', 'baixo')", "alto"},
+		// in
+		{"uf in ('sp', 'rj')", true},
+		{"uf not in ('sp', 'rj')", false},
+		{"qtd in (1, 2, 3)", true},
+		{"preco in (19.9, 1)", true},
+		{"vazio in (1, null)", false},
+		// var() e datas
+		{"var('limite') + 1", "101"},
+		{"number(var('limite')) + 1", int64(11)},
+		{"var('inexistente')", nil},
+		{"criado > var('data_inicio')", true},
+		{"format_date(criado, 'YYYY-MM-DD')", "2024-03-10"},
+		// Funcoes de texto
+		{"len(nome)", int64(3)},
+		{"substr('abcdef', 2, 3)", "bcd"},
+		{"startswith(nome, 'A') && endswith(nome, 'a') && contains(nome, 'n')", true},
+		{"trim('  x ') + lower('Y')", "xy"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.src, func(t *testing.T) {
+			got, err := evalTestExpression(t, tc.src, row, kinds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, ok := tc.want.(*big.Rat); ok {
+				if r, isRat := got.(*big.Rat); !isRat || r.Cmp(want) != 0 {
+					t.Errorf("= %#v, esperado %s", got, want.RatString())
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("= %#v, esperado %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExpressionEvalErrors(t *testing.T) {
+	row := map[string]interface{}{"nome": "Ana", "qtd": int64(3)}
+	for _, src := range []string{
+		"qtd / 0",
+		"qtd % 0",
+		"1.5 / 0",
+		"nome * 2",
+		"-nome",
+		"number(nome)",
+		"inexistente + 1",
+		"abs(nome)",
+	} {
+		_, err := evalTestExpression(t, src, row, nil)
+		if err == nil {
+			t.Errorf("%s: esperado erro", src)
+			continue
+		}
+		// Valores da linha nao aparecem no erro (a coluna pode ser mascarada)
+		if strings.Contains(err.Error(), "Ana") {
+			t.Errorf("%s: erro cita o valor: %v", src, err)
+		}
+	}
+}
+
+func TestValidateExpression(t *testing.T) {
+	valid := []string{
+		"a + b",
+		"status in ('A','B') && created_at > var(\"data_inicio\")",
+		"coalesce(nome, 'sem nome') + ' - ' + upper(uf)",
+		"x is not null and not (y <> 2)",
+		"round(valor, 2) >= 10.5",
+	}
+	for _, src := range valid {
+		if err := ValidateExpression(src); err != nil {
+			t.Errorf("%s: %v", src, err)
+		}
+	}
+	invalid := []string{
+		"",
+		"   ",
+		"a +",
+		"(a + b",
+		"a b",
+		"'sem fim",
+		"funcao_x(1)",
+		"upper()",
+		"if(1, 2)",
+		"a in 1",
+		"a is 1",
+		"1 @ 2",
+	}
+	for _, src := range invalid {
+		if err := ValidateExpression(src); err == nil {
+			t.Errorf("%q: esperado erro", src)
+		}
+	}
+}
+
+func TestRowExpressionsApply(t *testing.T) {
+	exprs, err := compileRowExpressions("total > 50", []models.ComputedColumn{
+		{Name: "total", Expression: "preco * qtd"},
+		{Name: "rotulo", Expression: "cep + '-' + total"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exprs.kinds = map[string]string{"preco": "decimal", "qtd": "int", "cep": "string"}
+
+	rec := map[string]interface{}{"preco": []byte("19.90"), "qtd": []byte("3"), "cep": []byte("01310")}
+	keep, err := exprs.apply(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keep {
+		t.Errorf("linha descartada pelo filtro")
+	}
+	if rec["total"] != "59.7" || rec["rotulo"] != "01310-59.7" {
+		t.Errorf("colunas calculadas = %#v, %#v", rec["total"], rec["rotulo"])
+	}
+
+	rec = map[string]interface{}{"preco": []byte("1.00"), "qtd": []byte("3"), "cep": "x"}
+	if keep, err := exprs.apply(rec); err != nil || keep {
+		t.Errorf("keep = %v, err = %v; esperado descarte", keep, err)
+	}
+}
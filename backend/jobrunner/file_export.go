@@ -0,0 +1,476 @@
+package jobrunner
+
+import (
+	"context"
+	"database/sql"
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultExportBatchSize = 1000
+
+// runExportFileJob grava o resultado do select em arquivo (csv, jsonl ou parquet).
+// Usa os mesmos leitores paralelos por hash do job insert quando le da origem;
+// um unico writer consome os lotes e grava no arquivo com rotacao.
+func (jr *JobRunner) runExportFileJob(jobID string, job models.Job) {
+	log.Printf("Iniciando job de exportacao para arquivo: %s", job.JobName)
+
+	jr.WaitGroup.Add(1)
+	go func() {
+		defer jr.WaitGroup.Done()
+		if jr.shouldStop() {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", time.Now())
+			return
+		}
+
+		releaseJobSlot, err := jr.acquireJobSlot(jobID, job)
+		defer releaseJobSlot()
+		if err != nil {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", time.Now())
+			return
+		}
+
+		start := time.Now()
+		logger.AddJob(jr.PipelineLog, logger.JobLog{
+			JobID:       jobID,
+			JobName:     job.JobName,
+			Status:      "running",
+			StopOnError: job.StopOnError,
+			StartedAt:   start,
+			Batches:     make([]logger.BatchLog, 0),
+		})
+		jr.savePipelineLog()
+
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+			js.Name = job.JobName
+			js.Status = "running"
+			js.StartedAt = &start
+			status.NotifySubscribers()
+		})
+
+		files, err := jr.exportFile(jobID, job)
+		end := time.Now()
+		if err != nil {
+			log.Printf("Erro no job de exportacao %s: %v", job.ID, err)
+			status.AppendLog(fmt.Sprintf("%s - Job: %s falhou: %s", jr.PipelineLog.Project, job.JobName, err.Error()))
+			jr.markJobFinalStatus(jobID, job, "error", err.Error(), end)
+			if job.StopOnError {
+				jr.PipelineLog.Status = "error"
+				jr.PipelineLog.EndedAt = end
+				jr.savePipelineLog()
+				jr.updateProjectStatus("error")
+				return
+			}
+		} else if jr.shouldStop() {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", end)
+			return
+		} else {
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				jl.Files = files
+			})
+			status.AppendLog(fmt.Sprintf("%s - Job: %s gerou %d arquivo(s) em output/", jr.PipelineLog.Project, job.JobName, len(files)))
+			jr.markJobFinalStatus(jobID, job, "done", "", end)
+		}
+
+		releaseJobSlot()
+		for _, nextID := range jr.ConnMap[jobID] {
+			jr.RunJob(nextID)
+		}
+	}()
+}
+
+// exportFile executa a leitura e a gravacao. Em caso de erro os arquivos parciais sao removidos.
+func (jr *JobRunner) exportFile(jobID string, job models.Job) ([]string, error) {
+	if job.File == nil {
+		return nil, fmt.Errorf("job export-file sem configuracao de arquivo")
+	}
+	spec := *job.File
+	spec.Path = jr.SubstituteVariables(spec.Path)
+	exporter, err := newFileExporter(jr.ProjectID, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	job.SelectSQL = jr.SubstituteVariables(job.SelectSQL)
+	resolvedSelectSQL, mapDirectives, err := extractMapDirectives(job.SelectSQL)
+	if err != nil {
+		return nil, err
+	}
+	job.SelectSQL = resolvedSelectSQL
+
+	rowTransforms, err := compileRowPipeline(job.Transforms, jr.SubstituteVariables)
+	if err != nil {
+		return nil, err
+	}
+	rowMasker, err := compileMasking(job.Masking, jr.variablesSnapshot())
+	if err != nil {
+		return nil, err
+	}
+	rowExprs, err := compileRowExpressions(job.Filter, job.ComputedColumns, jr.variablesSnapshot())
+	if err != nil {
+		return nil, err
+	}
+	rowLookups, err := jr.compileLookups(job.Lookups, rowMasker)
+	if err != nil {
+		return nil, err
+	}
+
+	readDB, dbType := jr.resolveExecutionDB(job)
+	fromSource := readDB == jr.SourceDB
+
+	// Total (apenas leitura da origem sem Map; o contador usa o banco de origem)
+	total := -1
+	if jr.preCount && fromSource && len(mapDirectives) == 0 {
+		total, err = jr.awaitCount(jr.requestCount(jobID, job))
+		if err != nil {
+			return nil, err
+		}
+		logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+			jl.Total = total
+		})
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+			js.Total = total
+			status.NotifySubscribers()
+		})
+	}
+
+	batchSize := job.RecordsPerPage
+	if batchSize <= 0 {
+		batchSize = defaultExportBatchSize
+	}
+	concurrency := jr.Concurrency
+	if job.MaxSourceQueries > 0 && concurrency > job.MaxSourceQueries {
+		concurrency = job.MaxSourceQueries
+	}
+	if !fromSource || (total >= 0 && total <= batchSize) || concurrency < 1 {
+		concurrency = 1
+	}
+	status.AddWorkerTotals(concurrency, 1)
+	defer status.AddWorkerTotals(-concurrency, -1)
+
+	jobCtx, jobCancel := context.WithCancel(jr.ctx)
+	defer jobCancel()
+	jobLimiter := newRowRateLimiter(job.MaxRowsPerSecond)
+
+	// Primeiro erro vence; lido apenas depois que leitores e writer terminam
+	var jobErr error
+	var jobErrOnce sync.Once
+	setJobError := func(err error) {
+		if err == nil {
+			return
+		}
+		jobErrOnce.Do(func() {
+			jobErr = err
+			jobCancel()
+		})
+	}
+
+	hashKeyExpr := ""
+	if concurrency > 1 {
+		releaseExplain, waited, err := jr.acquireSourceSlot(jobCtx)
+		jr.addThrottled(jobID, waited)
+		if err != nil {
+			return nil, err
+		}
+		if len(mapDirectives) > 0 {
+			hashKeyExpr, err = jr.getHashKeyExprFromExplainWithMapDirectives(job, mapDirectives, jobCtx)
+		} else {
+			hashKeyExpr, err = jr.getHashKeyExprFromExplain(job)
+		}
+		releaseExplain()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var filtered int64
+	var columnsOnce sync.Once
+	batchChan := make(chan []map[string]interface{}, concurrency*5)
+
+	// Writer unico: a ordem entre buckets nao e garantida
+	var processed int64
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		status.AddWorkerActive(0, 1)
+		defer status.AddWorkerActive(0, -1)
+		for batch := range batchChan {
+			if jobCtx.Err() != nil {
+				jr.releaseBatchRecordMaps(batch)
+				continue
+			}
+			values := make([]interface{}, len(exporter.columns))
+			written := 0
+			for _, rec := range batch {
+				for i, col := range exporter.columns {
+					values[i] = rec[col.name]
+				}
+				if err := exporter.write(values); err != nil {
+					setJobError(err)
+					break
+				}
+				written++
+			}
+			jr.releaseBatchRecordMaps(batch)
+			done := atomic.AddInt64(&processed, int64(written))
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				jl.Processed = int(done)
+			})
+			jr.savePipelineLog()
+			status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+				js.Processed = int(done)
+				if total > 0 {
+					js.Progress = float64(done) / float64(total) * 100
+				}
+				status.NotifySubscribers()
+			})
+		}
+	}()
+
+	var readersWG sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		readersWG.Add(1)
+		go func(workerID int) {
+			defer readersWG.Done()
+			status.AddWorkerActive(1, 0)
+			defer status.AddWorkerActive(-1, 0)
+
+			query := strings.TrimSpace(job.SelectSQL)
+			if concurrency > 1 {
+				query = jr.Dialect.BuildSelectQueryByHash(job, workerID, concurrency, hashKeyExpr)
+			}
+			query, exec, releaseMaps, err := jr.prepareMapSQL(jobCtx, readDB, nil, dbType, query, mapDirectives)
+			if err != nil {
+				setJobError(err)
+				return
+			}
+			defer releaseMaps()
+
+			if fromSource {
+				releaseSlot, waited, err := jr.acquireSourceSlot(jobCtx)
+				jr.addThrottled(jobID, waited)
+				if err != nil {
+					return
+				}
+				defer releaseSlot()
+			}
+
+			rows, err := exec.QueryContext(jobCtx, query)
+			if err != nil {
+				setJobError(err)
+				return
+			}
+			defer rows.Close()
+
+			cols, err := rows.Columns()
+			if err != nil {
+				setJobError(err)
+				return
+			}
+			colTypes, err := rows.ColumnTypes()
+			if err != nil {
+				setJobError(err)
+				return
+			}
+			columnsOnce.Do(func() {
+				exporter.setColumns(jr.exportColumnsFor(job, cols, colTypes))
+			})
+			dbTypes := make([]string, len(colTypes))
+			for i, ct := range colTypes {
+				dbTypes[i] = ct.DatabaseTypeName()
+			}
+			workerExprs := rowExprs.withColumnTypes(cols, colTypes)
+
+			buffer := make([]map[string]interface{}, 0, batchSize)
+			values := make([]interface{}, len(cols))
+			ptrs := make([]interface{}, len(cols))
+			for i := range cols {
+				ptrs[i] = &values[i]
+			}
+			send := func() bool {
+				waited, err := jr.waitSourceRows(jobCtx, jobLimiter, len(buffer))
+				jr.addThrottled(jobID, waited)
+				if err != nil {
+					return false
+				}
+				select {
+				case batchChan <- buffer:
+				case <-jobCtx.Done():
+					return false
+				}
+				buffer = make([]map[string]interface{}, 0, batchSize)
+				return true
+			}
+
+			for rows.Next() {
+				if jr.shouldStop() || jobCtx.Err() != nil {
+					return
+				}
+				if err := rows.Scan(ptrs...); err != nil {
+					setJobError(err)
+					return
+				}
+				rec := jr.acquireRecordMap()
+				for i, col := range cols {
+					rec[col] = exportScannedValue(values[i], dbTypes[i])
+				}
+				err := rowTransforms.apply(rec)
+				if err == nil {
+					err = rowLookups.apply(rec)
+				}
+				keep := true
+				if err == nil {
+					keep, err = workerExprs.apply(rec)
+				}
+				if err != nil {
+					jr.releaseRecordMap(rec)
+					setJobError(err)
+					return
+				}
+				if !keep {
+					atomic.AddInt64(&filtered, 1)
+					jr.releaseRecordMap(rec)
+					continue
+				}
+				rowMasker.apply(rec)
+				buffer = append(buffer, rec)
+				if len(buffer) == batchSize && !send() {
+					return
+				}
+			}
+			if len(buffer) > 0 && !send() {
+				return
+			}
+			if err := rows.Err(); err != nil {
+				setJobError(err)
+			}
+		}(w)
+	}
+
+	readersWG.Wait()
+	close(batchChan)
+	<-writerDone
+
+	if filteredRows := int(atomic.LoadInt64(&filtered)); filteredRows > 0 {
+		logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+			jl.Filtered = filteredRows
+		})
+	}
+	if misses := rowLookups.missCount(); misses > 0 {
+		logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+			jl.LookupMisses = misses
+		})
+	}
+
+	if jobErr != nil {
+		exporter.abort()
+		return nil, jobErr
+	}
+	if jr.shouldStop() || jr.ctx.Err() != nil {
+		exporter.abort()
+		return nil, fmt.Errorf("pipeline interrompida")
+	}
+	files, err := exporter.finish()
+	if err != nil {
+		exporter.abort()
+		return nil, err
+	}
+	log.Printf("Job %s (%s): %d linha(s) exportada(s) em %d arquivo(s)", job.ID, job.JobName, exporter.rows, len(files))
+	return files, nil
+}
+
+// exportScannedValue normaliza o valor lido; numericos de precisao arbitraria ficam como texto.
+func exportScannedValue(value interface{}, dbTypeName string) interface{} {
+	if raw, ok := value.([]byte); ok && exportKindFromDBType(dbTypeName) == "decimal" {
+		return string(raw)
+	}
+	return convertScannedValue(value, dbTypeName)
+}
+
+// exportColumnsFor define as colunas do arquivo: job.Columns quando informado; senao
+// as colunas do select com renomeacoes e as colunas geradas pelas transformacoes,
+// lookups e colunas calculadas.
+func (jr *JobRunner) exportColumnsFor(job models.Job, cols []string, colTypes []*sql.ColumnType) []exportColumn {
+	kinds := make(map[string]string, len(cols))
+	order := make([]string, 0, len(cols))
+	add := func(name, kind string) {
+		if _, exists := kinds[name]; !exists {
+			order = append(order, name)
+		}
+		kinds[name] = kind
+	}
+	for i, col := range cols {
+		add(col, exportKindFromDBType(colTypes[i].DatabaseTypeName()))
+	}
+
+	for _, step := range job.Transforms {
+		target := strings.TrimSpace(step.Target)
+		if target == "" {
+			target = step.Column
+		}
+		switch strings.ToLower(strings.TrimSpace(step.Type)) {
+		case "rename":
+			kind := kinds[step.Column]
+			for i, name := range order {
+				if name == step.Column {
+					order = append(order[:i], order[i+1:]...)
+					break
+				}
+			}
+			delete(kinds, step.Column)
+			add(target, kind)
+		case "cast":
+			switch strings.ToLower(step.To) {
+			case "int", "integer", "bigint":
+				add(step.Column, "int")
+			case "float", "decimal", "numeric":
+				add(step.Column, "float")
+			case "bool", "boolean":
+				add(step.Column, "bool")
+			case "date":
+				add(step.Column, "date")
+			case "datetime", "timestamp":
+				add(step.Column, "timestamp")
+			default:
+				add(step.Column, "string")
+			}
+		case "concat", "compute", "date-format":
+			add(target, "string")
+		case "default":
+			if _, exists := kinds[step.Column]; !exists {
+				add(step.Column, "string")
+			}
+		}
+	}
+
+	for _, step := range job.Lookups {
+		mapKey, _ := normalizeMemoryMapKey(step.Map)
+		dataset, _ := jr.getMemoryMap(mapKey)
+		for _, col := range step.Columns {
+			add(step.Prefix+col, exportKindFromDBType(dataset.ColumnDBTypes[col]))
+		}
+	}
+	for _, computed := range job.ComputedColumns {
+		add(strings.TrimSpace(computed.Name), "string")
+	}
+
+	if len(job.Columns) > 0 {
+		order = job.Columns
+	}
+	columns := make([]exportColumn, len(order))
+	for i, name := range order {
+		kind := kinds[name]
+		if kind == "" {
+			kind = "string"
+		}
+		columns[i] = exportColumn{name: name, kind: kind}
+	}
+	return columns
+}
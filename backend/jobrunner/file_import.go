@@ -0,0 +1,437 @@
+package jobrunner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"etl/models"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultImportBatchSize = 1000
+	// Linhas rejeitadas detalhadas no log do pipeline por job (as demais ficam so no dead-letter)
+	maxImportLineLogs = 200
+)
+
+// importPosition identifica a origem de uma linha importada (para o BatchLog).
+// api-extract usa page e line como numero do registro na pagina.
+type importPosition struct {
+	file string
+	page int
+	line int
+}
+
+func (p importPosition) String() string {
+	if p.page > 0 {
+		return fmt.Sprintf("pagina %d, registro %d", p.page, p.line)
+	}
+	return fmt.Sprintf("%s:%d", p.file, p.line)
+}
+
+// importFileHandler recebe cada linha lida. lineErr preenchido indica linha invalida
+// (rec traz o que foi possivel ler). Retorna false para interromper a leitura.
+type importFileHandler func(rec map[string]interface{}, pos importPosition, lineErr error) bool
+
+// ProjectInputDir e o diretorio dos arquivos lidos pelos jobs import-file.
+func ProjectInputDir(projectID string) string {
+	return filepath.Join("data", "projects", projectID, "input")
+}
+
+// resolveImportFiles expande o caminho (ou glob) do job dentro de input/.
+func resolveImportFiles(projectID, pattern string) ([]string, error) {
+	fullPattern, err := resolveProjectFilePath(ProjectInputDir(projectID), pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(fullPattern)
+	if err != nil {
+		return nil, fmt.Errorf("padrao de arquivo invalido '%s': %w", pattern, err)
+	}
+	files := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("nenhum arquivo encontrado para '%s' em input/", pattern)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// readImportFiles le os arquivos em sequencia e entrega as linhas ao handler.
+// Erros de arquivo (abertura, cabecalho) interrompem a leitura; erros de linha vao ao handler.
+func readImportFiles(ctx context.Context, projectID string, spec models.FileSpec, files []string, fallbackColumns []string, handle importFileHandler) error {
+	format, err := normalizeFileFormat(spec)
+	if err != nil {
+		return err
+	}
+	if format == "parquet" {
+		return fmt.Errorf("importacao de parquet nao suportada (use csv ou jsonl)")
+	}
+	latin1, err := normalizeFileEncoding(spec.Encoding)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		if ctx.Err() != nil {
+			return nil
+		}
+		name, err := filepath.Rel(ProjectInputDir(projectID), path)
+		if err != nil {
+			name = path
+		}
+		name = filepath.ToSlash(name)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		var reader io.Reader = bufio.NewReaderSize(f, 256*1024)
+		if latin1 {
+			reader = &latin1Reader{src: reader}
+		}
+		var keepGoing bool
+		if format == "jsonl" {
+			keepGoing, err = readJSONLFile(ctx, reader, name, spec, handle)
+		} else {
+			keepGoing, err = readCSVFile(ctx, reader, name, spec, fallbackColumns, handle)
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("arquivo %s: %w", name, err)
+		}
+		if !keepGoing {
+			return nil
+		}
+	}
+	return nil
+}
+
+type importField struct {
+	column models.FileColumn
+	index  int
+	layout string
+}
+
+func readCSVFile(ctx context.Context, reader io.Reader, name string, spec models.FileSpec, fallbackColumns []string, handle importFileHandler) (bool, error) {
+	delimiter := csvDelimiter(spec)
+	comma, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) {
+		return false, fmt.Errorf("delimitador '%s' deve ter um unico caractere na importacao", delimiter)
+	}
+	if spec.Quote != "" && spec.Quote != `"` {
+		return false, fmt.Errorf("importacao de csv aceita apenas aspas duplas")
+	}
+
+	r := csv.NewReader(reader)
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	r.LazyQuotes = strings.EqualFold(spec.QuoteMode, "none")
+
+	var header []string
+	if !spec.NoHeader {
+		record, err := r.Read()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("cabecalho: %w", err)
+		}
+		header = make([]string, len(record))
+		for i, col := range record {
+			col = strings.TrimSpace(col)
+			if i == 0 {
+				col = strings.TrimPrefix(col, "\ufeff")
+			}
+			header[i] = col
+		}
+	}
+
+	fields, err := csvImportFields(spec.Columns, header, fallbackColumns)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		record, err := r.Read()
+		if err == io.EOF {
+			return true, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if !handle(map[string]interface{}{}, importPosition{file: name, line: parseErr.Line}, parseErr.Err) {
+				return false, nil
+			}
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		line, _ := r.FieldPos(0)
+
+		rec := make(map[string]interface{}, len(fields))
+		var lineErr error
+		if len(record) < len(fields) && header == nil {
+			lineErr = fmt.Errorf("esperado %d campo(s), encontrado %d", len(fields), len(record))
+		}
+		for _, field := range fields {
+			if lineErr != nil {
+				break
+			}
+			if field.index >= len(record) {
+				lineErr = fmt.Errorf("campo '%s' ausente (linha com %d campo(s))", field.column.Name, len(record))
+				break
+			}
+			raw := record[field.index]
+			if raw == spec.NullValue {
+				rec[field.column.Name] = nil
+				continue
+			}
+			// Em caso de erro a linha segue com o texto original (dead-letter)
+			val, err := castImportValue(raw, field)
+			if err != nil {
+				rec[field.column.Name] = raw
+				lineErr = err
+				break
+			}
+			rec[field.column.Name] = val
+		}
+		if !handle(rec, importPosition{file: name, line: line}, lineErr) {
+			return false, nil
+		}
+	}
+}
+
+// csvImportFields associa as colunas declaradas aos indices do arquivo: pelo cabecalho
+// quando existir, senao pela posicao (schema do job ou job.Columns).
+func csvImportFields(columns []models.FileColumn, header, fallbackColumns []string) ([]importField, error) {
+	if len(columns) == 0 {
+		names := header
+		if names == nil {
+			names = fallbackColumns
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("arquivo sem cabecalho: informe as colunas no schema do arquivo ou no job")
+		}
+		for _, name := range names {
+			columns = append(columns, models.FileColumn{Name: name})
+		}
+	}
+
+	positions := make(map[string]int, len(header))
+	for i, col := range header {
+		positions[strings.ToLower(col)] = i
+	}
+	fields := make([]importField, len(columns))
+	for i, col := range columns {
+		if strings.TrimSpace(col.Name) == "" {
+			return nil, fmt.Errorf("coluna %d do schema sem nome", i+1)
+		}
+		if err := validateImportType(col); err != nil {
+			return nil, err
+		}
+		index := i
+		if header != nil {
+			source := col.Source
+			if source == "" {
+				source = col.Name
+			}
+			pos, ok := positions[strings.ToLower(source)]
+			if !ok {
+				return nil, fmt.Errorf("coluna '%s' nao encontrada no cabecalho", source)
+			}
+			index = pos
+		}
+		fields[i] = importField{column: col, index: index, layout: convertDateLayout(col.InputFormat)}
+	}
+	return fields, nil
+}
+
+func readJSONLFile(ctx context.Context, reader io.Reader, name string, spec models.FileSpec, handle importFileHandler) (bool, error) {
+	fields := make([]importField, len(spec.Columns))
+	for i, col := range spec.Columns {
+		if strings.TrimSpace(col.Name) == "" {
+			return false, fmt.Errorf("coluna %d do schema sem nome", i+1)
+		}
+		if err := validateImportType(col); err != nil {
+			return false, err
+		}
+		fields[i] = importField{column: col, layout: convertDateLayout(col.InputFormat)}
+	}
+
+	br := bufio.NewReaderSize(reader, 256*1024)
+	line := 0
+	for {
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		raw, err := br.ReadBytes('\n')
+		if len(raw) == 0 && err == io.EOF {
+			return true, nil
+		}
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		line++
+		pos := importPosition{file: name, line: line}
+		raw = bytes.TrimSpace(raw)
+		if line == 1 {
+			raw = bytes.TrimPrefix(raw, []byte("\ufeff"))
+		}
+		if len(raw) == 0 {
+			if err == io.EOF {
+				return true, nil
+			}
+			continue
+		}
+
+		var obj map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if decodeErr := decoder.Decode(&obj); decodeErr != nil {
+			if !handle(map[string]interface{}{}, pos, fmt.Errorf("json invalido: %v", decodeErr)) {
+				return false, nil
+			}
+		} else {
+			rec, lineErr := jsonImportRecord(obj, fields)
+			if !handle(rec, pos, lineErr) {
+				return false, nil
+			}
+		}
+		if err == io.EOF {
+			return true, nil
+		}
+	}
+}
+
+func jsonImportRecord(obj map[string]interface{}, fields []importField) (map[string]interface{}, error) {
+	if len(fields) == 0 {
+		rec := make(map[string]interface{}, len(obj))
+		for key, val := range obj {
+			rec[key] = normalizeJSONImportValue(val)
+		}
+		return rec, nil
+	}
+	rec := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		source := field.column.Source
+		if source == "" {
+			source = field.column.Name
+		}
+		val := normalizeJSONImportValue(obj[source])
+		if val == nil {
+			rec[field.column.Name] = nil
+			continue
+		}
+		converted, err := castImportValue(val, field)
+		if err != nil {
+			return rec, err
+		}
+		rec[field.column.Name] = converted
+	}
+	return rec, nil
+}
+
+// normalizeJSONImportValue converte numeros para int64/float64 e objetos/listas para texto JSON.
+func normalizeJSONImportValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(encoded)
+	}
+	return val
+}
+
+func validateImportType(col models.FileColumn) error {
+	switch strings.ToLower(strings.TrimSpace(col.Type)) {
+	case "", "string", "text", "int", "integer", "bigint", "float", "decimal", "numeric", "bool", "boolean", "date", "datetime", "timestamp":
+		return nil
+	default:
+		return fmt.Errorf("coluna '%s': tipo '%s' nao suportado", col.Name, col.Type)
+	}
+}
+
+func castImportValue(val interface{}, field importField) (interface{}, error) {
+	kind := strings.ToLower(strings.TrimSpace(field.column.Type))
+	if kind == "" {
+		return val, nil
+	}
+	converted, err := castValue(val, kind, field.layout)
+	if err != nil {
+		return nil, fmt.Errorf("coluna '%s': %w", field.column.Name, err)
+	}
+	return converted, nil
+}
+
+// latin1Reader converte ISO-8859-1 para UTF-8 durante a leitura.
+type latin1Reader struct {
+	src     io.Reader
+	pending []byte
+	buf     []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	if len(l.pending) == 0 {
+		if l.buf == nil {
+			l.buf = make([]byte, 32*1024)
+		}
+		n, err := l.src.Read(l.buf)
+		if n == 0 {
+			return 0, err
+		}
+		out := make([]byte, 0, n*2)
+		for _, b := range l.buf[:n] {
+			if b < utf8.RuneSelf {
+				out = append(out, b)
+				continue
+			}
+			out = utf8.AppendRune(out, rune(b))
+		}
+		l.pending = out
+	}
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// resolveImportJobFiles valida a configuracao do job import-file e lista os arquivos.
+func (jr *JobRunner) resolveImportJobFiles(job models.Job) ([]string, error) {
+	if job.File == nil {
+		return nil, fmt.Errorf("job import-file sem configuracao de arquivo")
+	}
+	if strings.TrimSpace(job.InsertSQL) == "" || len(job.Columns) == 0 {
+		return nil, fmt.Errorf("job import-file exige InsertSQL e Columns")
+	}
+	return resolveImportFiles(jr.ProjectID, jr.SubstituteVariables(job.File.Path))
+}
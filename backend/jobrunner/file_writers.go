@@ -0,0 +1,473 @@
+package jobrunner
+
+import (
+	"bufio"
+	"encoding/json"
+	"etl/models"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportColumn e uma coluna do arquivo gerado. kind guia a formatacao e o tipo
+// fisico no parquet: int, float, decimal, bool, date, timestamp ou string.
+type exportColumn struct {
+	name string
+	kind string
+}
+
+// fileRowWriter grava linhas ja ordenadas pelas colunas do arquivo.
+type fileRowWriter interface {
+	writeRow(values []interface{}) error
+	size() int64
+	close() error
+}
+
+// ProjectOutputDir e o diretorio dos arquivos gerados pelo projeto.
+func ProjectOutputDir(projectID string) string {
+	return filepath.Join("data", "projects", projectID, "output")
+}
+
+// resolveProjectFilePath garante que o caminho informado no job fique dentro de baseDir.
+func resolveProjectFilePath(baseDir, rel string) (string, error) {
+	rel = strings.TrimSpace(rel)
+	if rel == "" {
+		return "", fmt.Errorf("informe o caminho do arquivo")
+	}
+	if filepath.IsAbs(rel) || strings.HasPrefix(rel, "/") || strings.HasPrefix(rel, "\\") {
+		return "", fmt.Errorf("caminho '%s' deve ser relativo ao diretorio do projeto", rel)
+	}
+	cleaned := filepath.Clean(filepath.FromSlash(rel))
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("caminho '%s' sai do diretorio do projeto", rel)
+	}
+	return filepath.Join(baseDir, cleaned), nil
+}
+
+func normalizeFileFormat(spec models.FileSpec) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(spec.Format))
+	switch format {
+	case "", "csv":
+		return "csv", nil
+	case "jsonl", "json-lines", "ndjson":
+		return "jsonl", nil
+	case "parquet":
+		return "parquet", nil
+	default:
+		return "", fmt.Errorf("formato de arquivo '%s' nao suportado (use csv, jsonl ou parquet)", spec.Format)
+	}
+}
+
+func normalizeFileEncoding(encoding string) (bool, error) {
+	switch strings.ToLower(strings.ReplaceAll(strings.TrimSpace(encoding), "_", "-")) {
+	case "", "utf-8", "utf8":
+		return false, nil
+	case "latin1", "latin-1", "iso-8859-1", "iso8859-1":
+		return true, nil
+	default:
+		return false, fmt.Errorf("encoding '%s' nao suportado (use utf-8 ou latin1)", encoding)
+	}
+}
+
+func csvDelimiter(spec models.FileSpec) string {
+	switch strings.ToLower(spec.Delimiter) {
+	case "":
+		return ","
+	case "tab", "\\t":
+		return "\t"
+	default:
+		return spec.Delimiter
+	}
+}
+
+// encodeLatin1 converte texto UTF-8 para ISO-8859-1; caracteres fora da tabela viram '?'.
+func encodeLatin1(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			out = append(out, '?')
+			continue
+		}
+		out = append(out, byte(r))
+	}
+	return out
+}
+
+// -------------------- CSV --------------------
+
+type csvFileWriter struct {
+	file      *os.File
+	w         *bufio.Writer
+	columns   []exportColumn
+	delimiter string
+	quote     string
+	quoteMode string
+	nullValue string
+	dateFmt   string
+	latin1    bool
+	written   int64
+}
+
+func newCSVFileWriter(path string, columns []exportColumn, spec models.FileSpec) (*csvFileWriter, error) {
+	latin1, err := normalizeFileEncoding(spec.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	quoteMode := strings.ToLower(strings.TrimSpace(spec.QuoteMode))
+	switch quoteMode {
+	case "":
+		quoteMode = "minimal"
+	case "minimal", "all", "none":
+	default:
+		return nil, fmt.Errorf("quoteMode '%s' invalido (use minimal, all ou none)", spec.QuoteMode)
+	}
+	quote := spec.Quote
+	if quote == "" {
+		quote = `"`
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	cw := &csvFileWriter{
+		file:      f,
+		w:         bufio.NewWriterSize(f, 256*1024),
+		columns:   columns,
+		delimiter: csvDelimiter(spec),
+		quote:     quote,
+		quoteMode: quoteMode,
+		nullValue: spec.NullValue,
+		dateFmt:   convertDateLayout(spec.DateFormat),
+		latin1:    latin1,
+	}
+	if !spec.NoHeader {
+		header := make([]string, len(columns))
+		for i, col := range columns {
+			header[i] = cw.quoteField(col.name)
+		}
+		if err := cw.writeLine(header); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return cw, nil
+}
+
+func (cw *csvFileWriter) writeRow(values []interface{}) error {
+	fields := make([]string, len(values))
+	for i, val := range values {
+		if val == nil {
+			fields[i] = cw.nullValue
+			continue
+		}
+		fields[i] = cw.quoteField(formatFileValue(val, cw.columns[i].kind, cw.dateFmt))
+	}
+	return cw.writeLine(fields)
+}
+
+func (cw *csvFileWriter) quoteField(field string) string {
+	switch cw.quoteMode {
+	case "none":
+		return field
+	case "minimal":
+		if !strings.Contains(field, cw.delimiter) && !strings.Contains(field, cw.quote) && !strings.ContainsAny(field, "\r\n") {
+			return field
+		}
+	}
+	return cw.quote + strings.ReplaceAll(field, cw.quote, cw.quote+cw.quote) + cw.quote
+}
+
+func (cw *csvFileWriter) writeLine(fields []string) error {
+	line := strings.Join(fields, cw.delimiter) + "\n"
+	var n int
+	var err error
+	if cw.latin1 {
+		n, err = cw.w.Write(encodeLatin1(line))
+	} else {
+		n, err = cw.w.WriteString(line)
+	}
+	cw.written += int64(n)
+	return err
+}
+
+func (cw *csvFileWriter) size() int64 {
+	return cw.written
+}
+
+func (cw *csvFileWriter) close() error {
+	if err := cw.w.Flush(); err != nil {
+		cw.file.Close()
+		return err
+	}
+	return cw.file.Close()
+}
+
+// -------------------- JSON Lines --------------------
+
+type jsonlFileWriter struct {
+	file    *os.File
+	w       *bufio.Writer
+	columns []exportColumn
+	keys    [][]byte
+	dateFmt string
+	latin1  bool
+	written int64
+}
+
+func newJSONLFileWriter(path string, columns []exportColumn, spec models.FileSpec) (*jsonlFileWriter, error) {
+	latin1, err := normalizeFileEncoding(spec.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, len(columns))
+	for i, col := range columns {
+		key, err := json.Marshal(col.name)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlFileWriter{
+		file:    f,
+		w:       bufio.NewWriterSize(f, 256*1024),
+		columns: columns,
+		keys:    keys,
+		dateFmt: convertDateLayout(spec.DateFormat),
+		latin1:  latin1,
+	}, nil
+}
+
+// writeRow monta o objeto na ordem das colunas (json.Marshal de map ordenaria as chaves).
+func (jw *jsonlFileWriter) writeRow(values []interface{}) error {
+	line := make([]byte, 0, 64*len(values))
+	line = append(line, '{')
+	for i, val := range values {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = append(line, jw.keys[i]...)
+		line = append(line, ':')
+		encoded, err := json.Marshal(jsonFileValue(val, jw.columns[i].kind, jw.dateFmt))
+		if err != nil {
+			return fmt.Errorf("coluna '%s': %w", jw.columns[i].name, err)
+		}
+		line = append(line, encoded...)
+	}
+	line = append(line, '}', '\n')
+	if jw.latin1 {
+		line = encodeLatin1(string(line))
+	}
+	n, err := jw.w.Write(line)
+	jw.written += int64(n)
+	return err
+}
+
+func (jw *jsonlFileWriter) size() int64 {
+	return jw.written
+}
+
+func (jw *jsonlFileWriter) close() error {
+	if err := jw.w.Flush(); err != nil {
+		jw.file.Close()
+		return err
+	}
+	return jw.file.Close()
+}
+
+// formatFileValue converte o valor em texto para o CSV.
+func formatFileValue(val interface{}, kind, dateFmt string) string {
+	switch v := val.(type) {
+	case time.Time:
+		if dateFmt != "" {
+			return v.Format(dateFmt)
+		}
+		if kind == "date" {
+			return v.Format("2006-01-02")
+		}
+		return valueToString(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return valueToString(val)
+}
+
+func jsonFileValue(val interface{}, kind, dateFmt string) interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return string(v)
+	case time.Time:
+		if dateFmt != "" {
+			return v.Format(dateFmt)
+		}
+		if kind == "date" {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339Nano)
+	case string:
+		// Numericos de precisao arbitraria chegam como texto: grava como numero JSON
+		if kind == "decimal" {
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				return json.Number(v)
+			}
+		}
+		return v
+	}
+	return val
+}
+
+// -------------------- Rotacao --------------------
+
+// fileExporter grava as linhas em um ou mais arquivos, rotacionando por linhas ou bytes.
+// Os arquivos sao gravados com sufixo .partial e renomeados apenas em finish.
+type fileExporter struct {
+	spec      models.FileSpec
+	format    string
+	outputDir string
+	basePath  string
+	ext       string
+	rotate    bool
+	columns   []exportColumn
+	current   fileRowWriter
+	partRows  int
+	part      int
+	rows      int64
+	files     []string
+}
+
+func newFileExporter(projectID string, spec models.FileSpec) (*fileExporter, error) {
+	format, err := normalizeFileFormat(spec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := normalizeFileEncoding(spec.Encoding); err != nil {
+		return nil, err
+	}
+	outputDir := ProjectOutputDir(projectID)
+	fullPath, err := resolveProjectFilePath(outputDir, spec.Path)
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(fullPath)
+	if ext == "" {
+		ext = "." + format
+		fullPath += ext
+	}
+	return &fileExporter{
+		spec:      spec,
+		format:    format,
+		outputDir: outputDir,
+		basePath:  strings.TrimSuffix(fullPath, ext),
+		ext:       ext,
+		rotate:    spec.MaxRowsPerFile > 0 || spec.MaxBytesPerFile > 0,
+	}, nil
+}
+
+func (fe *fileExporter) setColumns(columns []exportColumn) {
+	fe.columns = columns
+}
+
+func (fe *fileExporter) partPath(part int) string {
+	if !fe.rotate {
+		return fe.basePath + fe.ext
+	}
+	return fmt.Sprintf("%s_%04d%s", fe.basePath, part, fe.ext)
+}
+
+func (fe *fileExporter) open() error {
+	fe.part++
+	path := fe.partPath(fe.part)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	partial := path + ".partial"
+	var (
+		w   fileRowWriter
+		err error
+	)
+	switch fe.format {
+	case "jsonl":
+		w, err = newJSONLFileWriter(partial, fe.columns, fe.spec)
+	case "parquet":
+		w, err = newParquetFileWriter(partial, fe.columns)
+	default:
+		w, err = newCSVFileWriter(partial, fe.columns, fe.spec)
+	}
+	if err != nil {
+		return err
+	}
+	fe.current = w
+	fe.partRows = 0
+	fe.files = append(fe.files, path)
+	return nil
+}
+
+func (fe *fileExporter) write(values []interface{}) error {
+	if fe.current == nil {
+		if err := fe.open(); err != nil {
+			return err
+		}
+	}
+	if err := fe.current.writeRow(values); err != nil {
+		return err
+	}
+	fe.partRows++
+	fe.rows++
+	if (fe.spec.MaxRowsPerFile > 0 && fe.partRows >= fe.spec.MaxRowsPerFile) ||
+		(fe.spec.MaxBytesPerFile > 0 && fe.current.size() >= fe.spec.MaxBytesPerFile) {
+		err := fe.current.close()
+		fe.current = nil
+		return err
+	}
+	return nil
+}
+
+// finish fecha o arquivo atual e publica os arquivos gerados. Sem linhas, gera
+// um arquivo vazio (apenas cabecalho/schema). Retorna os caminhos relativos a output/.
+func (fe *fileExporter) finish() ([]string, error) {
+	if len(fe.files) == 0 {
+		if err := fe.open(); err != nil {
+			return nil, err
+		}
+	}
+	if fe.current != nil {
+		err := fe.current.close()
+		fe.current = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+	published := make([]string, 0, len(fe.files))
+	for _, path := range fe.files {
+		if err := os.Rename(path+".partial", path); err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(fe.outputDir, path)
+		if err != nil {
+			rel = path
+		}
+		published = append(published, filepath.ToSlash(rel))
+	}
+	return published, nil
+}
+
+// abort descarta os arquivos parciais.
+func (fe *fileExporter) abort() {
+	if fe.current != nil {
+		_ = fe.current.close()
+		fe.current = nil
+	}
+	for _, path := range fe.files {
+		_ = os.Remove(path + ".partial")
+	}
+	fe.files = nil
+}
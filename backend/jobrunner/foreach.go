@@ -0,0 +1,321 @@
+package jobrunner
+
+import (
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultForeachParallel = 4
+
+// runForeachJob executa o sub-grafo do job uma vez por linha do SelectSQL. Cada
+// iteracao roda em um runner filho com as colunas da linha como variaveis e os
+// pools do pipeline; os filhos do foreach fora do sub-grafo rodam uma vez ao final.
+func (jr *JobRunner) runForeachJob(jobID string, job models.Job) {
+	log.Printf("Executando job foreach: %s\n", job.JobName)
+	start := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", start)
+		return
+	}
+
+	logger.AddJob(jr.PipelineLog, logger.JobLog{
+		JobID:       jobID,
+		JobName:     job.JobName,
+		Status:      "running",
+		StopOnError: job.StopOnError,
+		StartedAt:   start,
+		Batches:     make([]logger.BatchLog, 0),
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Name = job.JobName
+		js.Status = "running"
+		js.StartedAt = &start
+		status.NotifySubscribers()
+	})
+
+	spec := models.ForeachSpec{}
+	if job.Foreach != nil {
+		spec = *job.Foreach
+	}
+	bodyStarts := spec.Body
+	if len(bodyStarts) == 0 {
+		bodyStarts = jr.ConnMap[jobID]
+	}
+	body, err := jr.foreachBody(jobID, bodyStarts)
+	if err != nil {
+		jr.failForeachJob(jobID, job, body, err)
+		return
+	}
+
+	rows, err := jr.foreachRows(job, spec.VariablePrefix)
+	if err != nil {
+		log.Printf("Erro na consulta do job foreach %s: %v\n", job.ID, err)
+		jr.failForeachJob(jobID, job, body, err)
+		return
+	}
+	log.Printf("Job %s (%s): %d iteracao(oes) sobre %d job(s)", job.ID, job.JobName, len(rows), len(body))
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Total = len(rows)
+	})
+	jr.savePipelineLog()
+
+	parallel := 1
+	if strings.EqualFold(strings.TrimSpace(spec.Mode), "parallel") {
+		parallel = spec.MaxParallel
+		if parallel <= 0 {
+			parallel = defaultForeachParallel
+		}
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		completed int
+		failures  []string
+	)
+	slots := make(chan struct{}, parallel)
+	for i, vars := range rows {
+		if jr.shouldStop() {
+			break
+		}
+		mu.Lock()
+		halt := len(failures) > 0 && !spec.ContinueOnError
+		mu.Unlock()
+		if halt {
+			break
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(iteration int, vars map[string]string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			child := jr.newIterationRunner(job, iteration, vars, body)
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				jl.Iterations = append(jl.Iterations, child.PipelineLog)
+			})
+			status.AppendLog(fmt.Sprintf("%s - Job: %s iteracao %d de %d", jr.PipelineLog.Project, job.JobName, iteration, len(rows)))
+
+			child.runNested(bodyStarts)
+			failed := logger.FailedJobNames(child.PipelineLog)
+			iterStatus := "done"
+			if jr.shouldStop() {
+				iterStatus = "stopped"
+			} else if len(failed) > 0 || child.PipelineLog.Status == "error" {
+				iterStatus = "error"
+			}
+			end := time.Now()
+
+			mu.Lock()
+			completed++
+			processed := completed
+			if iterStatus == "error" {
+				failures = append(failures, fmt.Sprintf("iteracao %d (%s)", iteration, strings.Join(failed, ", ")))
+			}
+			mu.Unlock()
+
+			// O log da iteracao e lido pelo pai ao salvar: alteracoes ficam sob o lock do logger
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				child.PipelineLog.Status = iterStatus
+				child.PipelineLog.EndedAt = end
+				jl.Processed = processed
+			})
+			jr.savePipelineLog()
+			status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+				js.Processed = processed
+				js.Total = len(rows)
+				if len(rows) > 0 {
+					js.Progress = float64(processed) * 100 / float64(len(rows))
+				}
+				status.NotifySubscribers()
+			})
+		}(i+1, vars)
+	}
+	wg.Wait()
+
+	end := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", end)
+		return
+	}
+	if len(failures) > 0 {
+		err := fmt.Errorf("%d iteracao(oes) com erro: %s", len(failures), strings.Join(failures, "; "))
+		log.Printf("Erro no job foreach %s: %v\n", job.ID, err)
+		jr.failForeachJob(jobID, job, body, err)
+		return
+	}
+
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Status = "done"
+		jl.EndedAt = end
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Status = "done"
+		js.Progress = 100
+		js.EndedAt = &end
+		status.NotifySubscribers()
+	})
+	jr.markForeachBody(body, "done", "", end)
+	jr.runForeachSuccessors(jobID, body)
+}
+
+// markForeachBody finaliza o status dos jobs do sub-grafo no projeto: durante a
+// execucao o progresso de cada iteracao fica nas chaves foreach#n/id.
+func (jr *JobRunner) markForeachBody(body map[string]struct{}, statusStr, errMsg string, end time.Time) {
+	for id := range body {
+		status.UpdateJobStatus(jr.statusKey(id), func(js *status.JobStatus) {
+			js.Status = statusStr
+			js.Error = errMsg
+			js.EndedAt = &end
+			if statusStr == "done" {
+				js.Progress = 100
+			}
+		})
+	}
+	status.NotifySubscribers()
+}
+
+// foreachBody retorna os jobs alcancaveis a partir do inicio do sub-grafo.
+func (jr *JobRunner) foreachBody(jobID string, starts []string) (map[string]struct{}, error) {
+	body := make(map[string]struct{})
+	if len(starts) == 0 {
+		return body, fmt.Errorf("job foreach sem sub-grafo: conecte jobs ao foreach ou informe body")
+	}
+	queue := append([]string(nil), starts...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if _, seen := body[id]; seen {
+			continue
+		}
+		if id == jobID {
+			return body, fmt.Errorf("sub-grafo do foreach volta para o proprio job")
+		}
+		if _, ok := jr.JobMap[id]; !ok {
+			return body, fmt.Errorf("job %s do sub-grafo nao encontrado", id)
+		}
+		body[id] = struct{}{}
+		queue = append(queue, jr.ConnMap[id]...)
+	}
+	return body, nil
+}
+
+// foreachRows executa o SelectSQL e converte cada linha em variaveis.
+func (jr *JobRunner) foreachRows(job models.Job, prefix string) ([]map[string]string, error) {
+	query := strings.TrimSpace(jr.SubstituteVariables(job.SelectSQL))
+	if query == "" {
+		return nil, fmt.Errorf("job foreach sem SelectSQL")
+	}
+	db, _ := jr.resolveExecutionDB(job)
+	rows, err := db.QueryContext(jr.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]map[string]string, 0)
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		vars := make(map[string]string, len(columns))
+		for i, col := range columns {
+			vars[prefix+col] = variableValueString(values[i])
+		}
+		result = append(result, vars)
+	}
+	return result, rows.Err()
+}
+
+// newIterationRunner cria o runner de uma iteracao: mesmo projeto, pools, limites
+// e maps em memoria do pai, com as variaveis da linha sobrepostas.
+func (jr *JobRunner) newIterationRunner(job models.Job, iteration int, vars map[string]string, body map[string]struct{}) *JobRunner {
+	name := fmt.Sprintf("%s #%d", job.JobName, iteration)
+	child := newJobRunner(jr.ctx, jr.SourceDB, jr.DestinationDB, jr.SourceDSN, jr.DestinationDSN, jr.Dialect, jr.Concurrency, name, jr.ProjectID)
+	child.parent = jr
+	child.projectChain = jr.projectChain
+	// Iteracoes paralelas executam os mesmos ids: o status de cada uma fica em foreach#n/id
+	child.statusPrefix = fmt.Sprintf("%s#%d/", jr.statusKey(job.ID), iteration)
+	child.sharedSourceDB = true
+	child.sharedDestDB = true
+	child.httpClient = jr.httpClient
+	child.rowLimiter = jr.rowLimiter
+	child.Semaphore = jr.Semaphore
+	child.countWorkers = jr.countWorkers
+	child.scheduler = jr.scheduler
+
+	for _, id := range jr.JobOrder {
+		if _, ok := body[id]; !ok {
+			continue
+		}
+		child.JobMap[id] = jr.JobMap[id]
+		child.JobOrder = append(child.JobOrder, id)
+		for _, next := range jr.ConnMap[id] {
+			if _, inBody := body[next]; inBody {
+				child.ConnMap[id] = append(child.ConnMap[id], next)
+			}
+		}
+	}
+
+	child.Variables = jr.variablesSnapshot()
+	for key, value := range vars {
+		child.Variables[key] = value
+	}
+	child.PipelineLog.Variables = vars
+
+	jr.memoryStoreMu.RLock()
+	for key, dataset := range jr.memoryStore {
+		child.memoryStore[key] = dataset
+	}
+	for dbType, ctes := range jr.mapCTECache {
+		child.mapCTECache[dbType] = make(map[string]string, len(ctes))
+		for key, cte := range ctes {
+			child.mapCTECache[dbType][key] = cte
+		}
+	}
+	jr.memoryStoreMu.RUnlock()
+	return child
+}
+
+// failForeachJob registra a falha; sem StopOnError os filhos fora do sub-grafo seguem.
+func (jr *JobRunner) failForeachJob(jobID string, job models.Job, body map[string]struct{}, err error) {
+	end := time.Now()
+	jr.markJobFinalStatus(jobID, job, "error", err.Error(), end)
+	jr.markForeachBody(body, "error", err.Error(), end)
+	if job.StopOnError {
+		jr.PipelineLog.Status = "error"
+		jr.PipelineLog.EndedAt = end
+		jr.savePipelineLog()
+		jr.updateProjectStatus("error")
+		return
+	}
+	jr.runForeachSuccessors(jobID, body)
+}
+
+func (jr *JobRunner) runForeachSuccessors(jobID string, body map[string]struct{}) {
+	for _, nextID := range jr.ConnMap[jobID] {
+		if _, inBody := body[nextID]; inBody {
+			continue
+		}
+		jr.RunJob(nextID)
+	}
+}
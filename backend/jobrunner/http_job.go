@@ -0,0 +1,290 @@
+package jobrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout = 30 * time.Second
+	// Limite lido da resposta para as assercoes e o trecho gravado no log
+	maxHTTPResponseBytes = 1 << 20
+	maxHTTPLoggedBody    = 2000
+)
+
+// httpDoer retorna o cliente das chamadas http. jr.httpClient pode ser substituido
+// (ex: cliente de um servidor httptest); nil usa http.DefaultClient.
+func (jr *JobRunner) httpDoer() *http.Client {
+	if jr.httpClient != nil {
+		return jr.httpClient
+	}
+	return http.DefaultClient
+}
+
+func (jr *JobRunner) runHTTPJob(jobID string, job models.Job) {
+	log.Printf("Executando job http: %s\n", job.JobName)
+	start := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", start)
+		return
+	}
+
+	logger.AddJob(jr.PipelineLog, logger.JobLog{
+		JobID:       jobID,
+		JobName:     job.JobName,
+		Status:      "running",
+		StopOnError: job.StopOnError,
+		StartedAt:   start,
+		Total:       1,
+		Batches:     make([]logger.BatchLog, 0),
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Name = job.JobName
+		js.Status = "running"
+		js.StartedAt = &start
+		status.NotifySubscribers()
+	})
+
+	result, err := jr.executeHTTPRequest(job)
+	if result != nil {
+		logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+			jl.Result = result
+		})
+	}
+
+	end := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", end)
+		return
+	}
+	if err != nil {
+		log.Printf("Erro no job http %s: %v\n", job.ID, err)
+		jr.handleExecutionJobError(jobID, job, err)
+		return
+	}
+
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Status = "done"
+		jl.Processed = 1
+		jl.EndedAt = end
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Status = "done"
+		js.Processed = 1
+		js.Total = 1
+		js.Progress = 100
+		js.EndedAt = &end
+		status.NotifySubscribers()
+	})
+
+	for _, nextID := range jr.ConnMap[jobID] {
+		jr.RunJob(nextID)
+	}
+}
+
+// executeHTTPRequest faz a chamada e valida status e assercoes. O resultado e
+// retornado mesmo em caso de falha para ficar registrado no JobLog.
+func (jr *JobRunner) executeHTTPRequest(job models.Job) (map[string]interface{}, error) {
+	if job.HTTP == nil || strings.TrimSpace(job.HTTP.URL) == "" {
+		return nil, fmt.Errorf("job http sem url configurada")
+	}
+	spec := *job.HTTP
+
+	rawURL := strings.TrimSpace(jr.SubstituteVariables(spec.URL))
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return nil, fmt.Errorf("url invalida: %s", spec.URL)
+	}
+	body := jr.SubstituteVariables(spec.Body)
+	method := strings.ToUpper(strings.TrimSpace(spec.Method))
+	if method == "" {
+		method = http.MethodGet
+		if body != "" {
+			method = http.MethodPost
+		}
+	}
+	timeout := defaultHTTPTimeout
+	if spec.TimeoutSeconds > 0 {
+		timeout = time.Duration(spec.TimeoutSeconds) * time.Second
+	}
+
+	// Query string fica fora do log: costuma levar tokens
+	result := map[string]interface{}{
+		"method": method,
+		"url":    parsedURL.Scheme + "://" + parsedURL.Host + parsedURL.Path,
+	}
+
+	ctx, cancel := context.WithTimeout(jr.ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewBufferString(body))
+	if err != nil {
+		return result, err
+	}
+	for name, value := range spec.Headers {
+		req.Header.Set(name, jr.SubstituteVariables(value))
+	}
+	if body != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	requestStart := time.Now()
+	resp, err := jr.httpDoer().Do(req)
+	result["duration_ms"] = time.Since(requestStart).Milliseconds()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return result, fmt.Errorf("timeout de %s excedido na chamada %s %s", timeout, method, result["url"])
+		}
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseBytes))
+	if err != nil {
+		return result, fmt.Errorf("erro ao ler resposta: %w", err)
+	}
+	result["status"] = resp.StatusCode
+	excerpt := string(respBody)
+	if len(excerpt) > maxHTTPLoggedBody {
+		excerpt = excerpt[:maxHTTPLoggedBody] + "..."
+	}
+	result["response"] = excerpt
+
+	if !httpStatusExpected(resp.StatusCode, spec.ExpectedStatus) {
+		return result, fmt.Errorf("status %d nao esperado na chamada %s %s", resp.StatusCode, method, result["url"])
+	}
+
+	if len(spec.Assertions) > 0 {
+		checks := make([]map[string]interface{}, 0, len(spec.Assertions))
+		var failed error
+		for i, assertion := range spec.Assertions {
+			assertion.Value = jr.SubstituteVariables(assertion.Value)
+			err := checkHTTPAssertion(respBody, assertion)
+			check := map[string]interface{}{"type": assertion.Type, "ok": err == nil}
+			if assertion.Path != "" {
+				check["path"] = assertion.Path
+			}
+			if err != nil {
+				check["error"] = err.Error()
+				if failed == nil {
+					failed = fmt.Errorf("assercao %d (%s) falhou: %v", i+1, assertion.Type, err)
+				}
+			}
+			checks = append(checks, check)
+		}
+		result["assertions"] = checks
+		if failed != nil {
+			return result, failed
+		}
+	}
+	return result, nil
+}
+
+func httpStatusExpected(code int, expected []int) bool {
+	if len(expected) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, want := range expected {
+		if code == want {
+			return true
+		}
+	}
+	return false
+}
+
+func checkHTTPAssertion(body []byte, assertion models.HTTPAssertion) error {
+	switch strings.ToLower(strings.TrimSpace(assertion.Type)) {
+	case "contains":
+		if !strings.Contains(string(body), assertion.Value) {
+			return fmt.Errorf("resposta nao contem '%s'", assertion.Value)
+		}
+	case "not-contains":
+		if strings.Contains(string(body), assertion.Value) {
+			return fmt.Errorf("resposta contem '%s'", assertion.Value)
+		}
+	case "regex":
+		re, err := regexp.Compile(assertion.Value)
+		if err != nil {
+			return fmt.Errorf("regex invalida: %v", err)
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("resposta nao casa com '%s'", assertion.Value)
+		}
+	case "json-equals", "json-exists":
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return fmt.Errorf("resposta nao e json: %v", err)
+		}
+		val, ok := lookupJSONPath(doc, assertion.Path)
+		if !ok {
+			return fmt.Errorf("caminho '%s' nao encontrado", assertion.Path)
+		}
+		if strings.EqualFold(assertion.Type, "json-exists") {
+			return nil
+		}
+		got := jsonValueString(val)
+		if got != assertion.Value {
+			return fmt.Errorf("'%s' = '%s', esperado '%s'", assertion.Path, got, assertion.Value)
+		}
+	default:
+		return fmt.Errorf("tipo de assercao '%s' desconhecido", assertion.Type)
+	}
+	return nil
+}
+
+// lookupJSONPath navega por chaves e indices separados por ponto (ex: data.items.0.id).
+func lookupJSONPath(doc interface{}, path string) (interface{}, bool) {
+	current := doc
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$.")
+	if path == "" || path == "$" {
+		return current, true
+	}
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			val, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = val
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			current = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func jsonValueString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+	return valueToString(val)
+}
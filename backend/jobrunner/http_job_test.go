@@ -0,0 +1,151 @@
+package jobrunner
+
+import (
+	"context"
+	"etl/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newHTTPTestRunner(t *testing.T, handler http.HandlerFunc, vars map[string]string) (*JobRunner, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return &JobRunner{ctx: context.Background(), Variables: vars, httpClient: srv.Client()}, srv
+}
+
+func TestHTTPJobExpectedStatus(t *testing.T) {
+	jr, srv := newHTTPTestRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/aceito" {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}, nil)
+
+	cases := []struct {
+		name     string
+		path     string
+		expected []int
+		wantErr  bool
+	}{
+		{"2xx padrao", "/aceito", nil, false},
+		{"404 fora do padrao", "/outro", nil, true},
+		{"404 esperado", "/outro", []int{404}, false},
+		{"202 fora da lista", "/aceito", []int{200}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := models.Job{HTTP: &models.HTTPRequestSpec{URL: srv.URL + tc.path, ExpectedStatus: tc.expected}}
+			result, err := jr.executeHTTPRequest(job)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if result["status"] == nil {
+				t.Errorf("status nao registrado no resultado: %v", result)
+			}
+		})
+	}
+}
+
+func TestHTTPJobAssertions(t *testing.T) {
+	const body = `{"status":"ok","data":{"items":[{"id":7,"tags":["a"]}],"total":1.5,"vazio":null}}`
+	jr, srv := newHTTPTestRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body)
+	}, map[string]string{"esperado": "ok"})
+
+	cases := []struct {
+		name      string
+		assertion models.HTTPAssertion
+		wantErr   bool
+	}{
+		{"contains", models.HTTPAssertion{Type: "contains", Value: `"status":"ok"`}, false},
+		{"contains falha", models.HTTPAssertion{Type: "contains", Value: "erro"}, true},
+		{"not-contains", models.HTTPAssertion{Type: "not-contains", Value: "erro"}, false},
+		{"not-contains falha", models.HTTPAssertion{Type: "not-contains", Value: "items"}, true},
+		{"regex", models.HTTPAssertion{Type: "regex", Value: `"id":\d+`}, false},
+		{"regex falha", models.HTTPAssertion{Type: "regex", Value: `"id":"\w+"`}, true},
+		{"regex invalida", models.HTTPAssertion{Type: "regex", Value: `(`}, true},
+		{"json-equals texto", models.HTTPAssertion{Type: "json-equals", Path: "status", Value: "ok"}, false},
+		{"json-equals variavel", models.HTTPAssertion{Type: "json-equals", Path: "$.status", Value: "${esperado}"}, false},
+		{"json-equals indice", models.HTTPAssertion{Type: "json-equals", Path: "data.items.0.id", Value: "7"}, false},
+		{"json-equals decimal", models.HTTPAssertion{Type: "json-equals", Path: "data.total", Value: "1.5"}, false},
+		{"json-equals lista", models.HTTPAssertion{Type: "json-equals", Path: "data.items.0.tags", Value: `["a"]`}, false},
+		{"json-equals null", models.HTTPAssertion{Type: "json-equals", Path: "data.vazio", Value: "null"}, false},
+		{"json-equals falha", models.HTTPAssertion{Type: "json-equals", Path: "status", Value: "erro"}, true},
+		{"json-exists", models.HTTPAssertion{Type: "json-exists", Path: "data.items.0"}, false},
+		{"json-exists falha", models.HTTPAssertion{Type: "json-exists", Path: "data.items.1"}, true},
+		{"tipo desconhecido", models.HTTPAssertion{Type: "xpath", Value: "x"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := models.Job{HTTP: &models.HTTPRequestSpec{URL: srv.URL, Assertions: []models.HTTPAssertion{tc.assertion}}}
+			result, err := jr.executeHTTPRequest(job)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			checks, ok := result["assertions"].([]map[string]interface{})
+			if !ok || len(checks) != 1 || checks[0]["ok"] != !tc.wantErr {
+				t.Errorf("assertions no resultado = %v", result["assertions"])
+			}
+		})
+	}
+}
+
+func TestHTTPJobTemplating(t *testing.T) {
+	var gotMethod, gotPath, gotQuery, gotAuth, gotType, gotBody string
+	jr, srv := newHTTPTestRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotQuery = r.Method, r.URL.Path, r.URL.RawQuery
+		gotAuth, gotType = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		data, _ := io.ReadAll(r.Body)
+		gotBody = string(data)
+	}, map[string]string{"recurso": "cargas", "token": "segredo", "data": "2024-01-31"})
+
+	job := models.Job{HTTP: &models.HTTPRequestSpec{
+		URL:     srv.URL + "/api/${recurso}?token=${token}",
+		Headers: map[string]string{"Authorization": "Bearer ${token}"},
+		Body:    `{"data":"${data}"}`,
+	}}
+	result, err := jr.executeHTTPRequest(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != http.MethodPost {
+		t.Errorf("metodo = %s, esperado POST quando ha body", gotMethod)
+	}
+	if gotPath != "/api/cargas" || gotQuery != "token=segredo" {
+		t.Errorf("url recebida = %s?%s", gotPath, gotQuery)
+	}
+	if gotAuth != "Bearer segredo" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	if gotType != "application/json" {
+		t.Errorf("Content-Type = %q", gotType)
+	}
+	if gotBody != `{"data":"2024-01-31"}` {
+		t.Errorf("body = %q", gotBody)
+	}
+	if url, _ := result["url"].(string); strings.Contains(url, "segredo") {
+		t.Errorf("query string com token gravada no resultado: %s", url)
+	}
+}
+
+func TestHTTPJobTimeout(t *testing.T) {
+	release := make(chan struct{})
+	jr, srv := newHTTPTestRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}, nil)
+	defer close(release)
+
+	job := models.Job{HTTP: &models.HTTPRequestSpec{URL: srv.URL, TimeoutSeconds: 1}}
+	_, err := jr.executeHTTPRequest(job)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("err = %v, esperado timeout", err)
+	}
+}
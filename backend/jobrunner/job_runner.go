@@ -4,12 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"etl/dialects"
 	"etl/logger"
 	"etl/models"
 	"etl/status"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -36,6 +38,7 @@ type JobRunner struct {
 	ConnMap        map[string][]string
 	JobOrder       []string
 	Variables      map[string]string
+	variablesMu    sync.RWMutex        // set-variable altera Variables durante a execucao
 	PipelineLog    *logger.PipelineLog // Adicionado para logging
 	ProjectID      string
 	ctx            context.Context
@@ -56,9 +59,35 @@ type JobRunner struct {
 	mapParallel    bool
 	logFlushEvery  time.Duration
 	recordMapPool  sync.Pool
+	rowLimiter     *rowRateLimiter
+	countWorkers   int
+	throttleMu     sync.Mutex
+	throttled      map[string]time.Duration
+	queued         map[string]time.Duration
+	scheduler      *jobScheduler
+	mapSpillRows   int
+	mapSpillMode   string
+	spillMu        sync.Mutex
+	spillTables    map[spillTableKey]spillTable
+	httpClient     *http.Client
+	// subproject: runner pai (o log fica aninhado nele), projetos ancestrais e pools emprestados
+	parent         *JobRunner
+	projectChain   []string
+	sharedSourceDB bool
+	sharedDestDB   bool
+	statusPrefix   string // prefixo das chaves no mapa de status (runners aninhados)
 }
 
 func NewJobRunner(sourceDB, destDB *sql.DB, sourceDSN, destDSN string, dialect dialects.SQLDialect, concurrency int, project string, projectID string) *JobRunner {
+	jr := newJobRunner(context.Background(), sourceDB, destDB, sourceDSN, destDSN, dialect, concurrency, project, projectID)
+
+	// Salva o log inicial do pipeline
+	jr.savePipelineLog()
+
+	return jr
+}
+
+func newJobRunner(parentCtx context.Context, sourceDB, destDB *sql.DB, sourceDSN, destDSN string, dialect dialects.SQLDialect, concurrency int, project string, projectID string) *JobRunner {
 	// Inicializa o log do pipeline
 	pipelineLog := &logger.PipelineLog{
 		PipelineID: logger.GeneratePipelineID(project),
@@ -78,7 +107,6 @@ func NewJobRunner(sourceDB, destDB *sql.DB, sourceDSN, destDSN string, dialect d
 		DestinationDSN: destDSN,
 		Dialect:        dialect,
 		Concurrency:    concurrency,
-		Semaphore:      make(chan struct{}, concurrency),
 		WaitGroup:      &sync.WaitGroup{},
 		JobMap:         make(map[string]models.Job),
 		ConnMap:        make(map[string][]string),
@@ -91,15 +119,14 @@ func NewJobRunner(sourceDB, destDB *sql.DB, sourceDSN, destDSN string, dialect d
 		preCount:       envBoolDefault("ETL_PRECOUNT_ENABLED", true),
 		mapParallel:    envBoolDefault("ETL_MAP_PARALLEL_ENABLED", false),
 		logFlushEvery:  envDurationMsDefault("ETL_LOG_FLUSH_MS", 500),
+		mapSpillRows:   envIntDefault("ETL_MAP_SPILL_ROWS", 5000),
+		mapSpillMode:   envMapSpillMode(),
+		countWorkers:   1,
 	}
 	jr.recordMapPool.New = func() interface{} {
 		return make(map[string]interface{})
 	}
-	jr.ctx, jr.cancel = context.WithCancel(context.Background())
-
-	// Salva o log inicial do pipeline
-	jr.savePipelineLog()
-
+	jr.ctx, jr.cancel = context.WithCancel(parentCtx)
 	return jr
 }
 
@@ -111,13 +138,33 @@ func (jr *JobRunner) initCountManager() {
 		}
 		jr.countMap = make(map[string]*countFuture)
 		jr.countQueue = make(chan *countRequest, queueSize)
-		go jr.countWorker()
+		workers := jr.countWorkers
+		if workers < 1 {
+			workers = 1
+		}
+		for i := 0; i < workers; i++ {
+			go jr.countWorker()
+		}
 	})
 }
 
 func (jr *JobRunner) countWorker() {
 	for req := range jr.countQueue {
-		total, err := jr.Dialect.FetchTotalCount(jr.SourceDB, req.job)
+		release, waited, err := jr.acquireSourceSlot(jr.ctx)
+		jr.addThrottled(req.jobID, waited)
+		if err != nil {
+			req.future.err = err
+			close(req.future.done)
+			status.IncCountDone()
+			continue
+		}
+		var total int
+		if req.count != nil {
+			total, err = req.count()
+		} else {
+			total, err = jr.Dialect.FetchTotalCount(jr.SourceDB, req.job)
+		}
+		release()
 		req.future.total = total
 		req.future.err = err
 		close(req.future.done)
@@ -126,6 +173,12 @@ func (jr *JobRunner) countWorker() {
 }
 
 func (jr *JobRunner) requestCount(jobID string, job models.Job) *countFuture {
+	return jr.requestCustomCount(jobID, job, nil)
+}
+
+// requestCustomCount enfileira uma contagem propria do job (ex: com diretivas Map) nos
+// mesmos workers de count, respeitando maxConcurrentCounts.
+func (jr *JobRunner) requestCustomCount(jobID string, job models.Job, count func() (int, error)) *countFuture {
 	jr.initCountManager()
 	jr.countMu.Lock()
 	if future, ok := jr.countMap[jobID]; ok {
@@ -141,6 +194,7 @@ func (jr *JobRunner) requestCount(jobID string, job models.Job) *countFuture {
 	jr.countQueue <- &countRequest{
 		jobID:  jobID,
 		job:    job,
+		count:  count,
 		future: future,
 	}
 	return future
@@ -290,6 +344,7 @@ type countFuture struct {
 type countRequest struct {
 	jobID  string
 	job    models.Job
+	count  func() (int, error) // nil = FetchTotalCount do dialeto
 	future *countFuture
 }
 
@@ -307,7 +362,7 @@ func (jr *JobRunner) RunJob(jobID string) {
 	println("nome do job:", job.JobName)
 
 	switch strings.ToLower(job.Type) {
-	case "insert":
+	case "insert", "import-file", "api-extract":
 		jr.runInsertJob(jobID, job)
 	case "execution":
 		jr.runExecutionJob(jobID, job)
@@ -317,6 +372,26 @@ func (jr *JobRunner) RunJob(jobID string) {
 		jr.runConditionJob(jobID, job)
 	case "memory-select":
 		jr.runMemorySelectJob(jobID, job)
+	case "export-file":
+		jr.runExportFileJob(jobID, job)
+	case "http":
+		jr.runHTTPJob(jobID, job)
+	case "subproject":
+		jr.runSubprojectJob(jobID, job)
+	case "foreach":
+		jr.runForeachJob(jobID, job)
+	case "set-variable":
+		jr.runSetVariableJob(jobID, job)
+	case "reconcile":
+		jr.runReconcileJob(jobID, job)
+	case "schema-sync":
+		jr.runSchemaSyncJob(jobID, job)
+	case "sensor":
+		jr.runSensorJob(jobID, job)
+	case "cdc":
+		jr.runCDCJob(jobID, job)
+	case "delete-sync":
+		jr.runDeleteSyncJob(jobID, job)
 	default:
 		log.Printf("Tipo de job desconhecido: %s", job.Type)
 		// Log de erro para tipo desconhecido
@@ -348,6 +423,14 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 			return
 		}
 
+		// Vaga no agendador: liberada antes de disparar os proximos jobs
+		releaseJobSlot, err := jr.acquireJobSlot(jobID, job)
+		defer releaseJobSlot()
+		if err != nil {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", time.Now())
+			return
+		}
+
 		start := time.Now()
 		jobLog := logger.JobLog{
 			JobID:       jobID,
@@ -361,7 +444,7 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 		logger.AddJob(jr.PipelineLog, jobLog)
 		jr.savePipelineLog()
 
-		status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 			js.Name = job.JobName
 			js.Status = "running"
 			js.StartedAt = &start
@@ -372,6 +455,30 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 		job.InsertSQL = jr.SubstituteVariables(job.InsertSQL)
 		job.PostInsert = jr.SubstituteVariables(job.PostInsert)
 
+		// import-file e api-extract: as linhas vem de arquivos em input/ ou de uma API em vez do select
+		isImport := strings.ToLower(job.Type) == "import-file"
+		isAPI := strings.ToLower(job.Type) == "api-extract"
+		externalSource := isImport || isAPI
+		var importFiles []string
+		var apiSpec models.APISourceSpec
+		if isAPI {
+			apiSpec, err = resolveAPIJobSpec(job)
+			if err != nil {
+				log.Printf("Erro na configuracao da API do job %s: %v\n", job.ID, err)
+				jr.markJobFinalStatus(jobID, job, "error", err.Error(), time.Now())
+				return
+			}
+		}
+		if isImport {
+			importFiles, err = jr.resolveImportJobFiles(job)
+			if err != nil {
+				log.Printf("Erro ao localizar arquivos do job %s: %v\n", job.ID, err)
+				jr.markJobFinalStatus(jobID, job, "error", err.Error(), time.Now())
+				return
+			}
+			log.Printf("Job %s (%s): %d arquivo(s) para importar", job.ID, job.JobName, len(importFiles))
+		}
+
 		resolvedSelectSQL, mapDirectives, err := extractMapDirectives(job.SelectSQL)
 		if err != nil {
 			log.Printf("Erro ao processar diretivas Map no job %s: %v\n", job.ID, err)
@@ -383,12 +490,45 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 			log.Printf("Job %s (%s): %d diretiva(s) Map detectadas no select", job.ID, job.JobName, len(mapDirectives))
 		}
 
+		rowTransforms, err := compileRowPipeline(job.Transforms, jr.SubstituteVariables)
+		if err != nil {
+			log.Printf("Erro nas transformacoes do job %s: %v\n", job.ID, err)
+			jr.markJobFinalStatus(jobID, job, "error", err.Error(), time.Now())
+			return
+		}
+		rowMasker, err := compileMasking(job.Masking, jr.variablesSnapshot())
+		if err != nil {
+			log.Printf("Erro no mascaramento do job %s: %v\n", job.ID, err)
+			jr.markJobFinalStatus(jobID, job, "error", err.Error(), time.Now())
+			return
+		}
+		rowExprs, err := compileRowExpressions(job.Filter, job.ComputedColumns, jr.variablesSnapshot())
+		if err != nil {
+			log.Printf("Erro nas expressoes do job %s: %v\n", job.ID, err)
+			jr.markJobFinalStatus(jobID, job, "error", err.Error(), time.Now())
+			return
+		}
+		rowLookups, err := jr.compileLookups(job.Lookups, rowMasker)
+		if err != nil {
+			log.Printf("Erro nos lookups do job %s: %v\n", job.ID, err)
+			jr.markJobFinalStatus(jobID, job, "error", err.Error(), time.Now())
+			return
+		}
+		scd2, err := jr.newSCD2Writer(job, start)
+		if err != nil {
+			log.Printf("Erro na configuracao scd2 do job %s: %v\n", job.ID, err)
+			jr.markJobFinalStatus(jobID, job, "error", err.Error(), time.Now())
+			return
+		}
+
 		// total de registros (opcional; pode ser desabilitado para evitar varredura extra)
 		total := -1
-		if jr.preCount {
+		if jr.preCount && !externalSource {
 			if len(mapDirectives) > 0 {
 				countStart := time.Now()
-				total, err = jr.countSelectWithMapDirectives(job, mapDirectives)
+				total, err = jr.awaitCount(jr.requestCustomCount(jobID, job, func() (int, error) {
+					return jr.countSelectWithMapDirectives(job, mapDirectives)
+				}))
 				if err != nil {
 					log.Printf("Erro ao contar registros com Map: %v\n", err)
 					jr.markJobFinalStatus(jobID, job, "error", err.Error(), time.Now())
@@ -416,7 +556,7 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 		})
 		jr.savePipelineLog()
 
-		status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 			if total > 0 {
 				js.Total = total
 			} else {
@@ -429,13 +569,20 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 
 		// Ajusta concurrency: se total < batchSize, usa apenas 1 worker
 		concurrency := jr.Concurrency
+		if job.MaxSourceQueries > 0 && concurrency > job.MaxSourceQueries {
+			concurrency = job.MaxSourceQueries
+			log.Printf("Job %s (%s): leitura limitada a %d query(s) simultanea(s) na origem", job.ID, job.JobName, concurrency)
+		}
 		if total > 0 && total <= job.RecordsPerPage {
 			concurrency = 1
 			log.Printf("Total (%d) menor que batchSize (%d), usando apenas 1 worker", total, job.RecordsPerPage)
 		}
+		if externalSource {
+			concurrency = 1
+		}
 
 		writerConcurrency := jr.Concurrency
-		if writerConcurrency < 1 {
+		if writerConcurrency < 1 || scd2 != nil {
 			writerConcurrency = 1
 		}
 
@@ -446,10 +593,11 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 
 		// Controle de execucao do job
 		var processed int64
+		var filtered int64
 		var jobHadError atomic.Bool
 		var lastErr atomic.Value
 		reportJobError := func(errMsg string) {
-			status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+			status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 				js.Error = errMsg
 				if job.StopOnError {
 					js.Status = "error"
@@ -474,6 +622,12 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 
 		jobCtx, jobCancel := context.WithCancel(jr.ctx)
 		defer jobCancel()
+		jobLimiter := newRowRateLimiter(job.MaxRowsPerSecond)
+		deadLetter := jr.newDeadLetterSink(jobID, job)
+		defer deadLetter.close()
+		if deadLetter != nil {
+			log.Printf("Job %s (%s): modo tolerante a erros, linhas rejeitadas vao para %s", job.ID, job.JobName, deadLetter.describe())
+		}
 
 		closeOnce := &sync.Once{}
 		closeBatch := func() {
@@ -519,9 +673,7 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 						StartedAt: batchStart,
 					}
 
-					insertSQL, args := jr.Dialect.BuildInsertQuery(job, batch)
-
-					if _, err := tx.Exec(insertSQL, args...); err != nil {
+					failBatch := func(err error) {
 						setJobError(err)
 
 						analyzer := &logger.ErrorAnalyzer{}
@@ -536,21 +688,51 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 						jr.savePipelineLog()
 						jr.releaseBatchRecordMaps(batch)
 						jobCancel()
-						return
 					}
 
-					atomic.AddInt64(&processed, int64(len(batch)))
+					inserted := len(batch)
+					rejectedTotal := 0
+					if scd2 != nil {
+						if err := scd2.writeBatch(tx, batch); err != nil {
+							failBatch(err)
+							return
+						}
+					} else if deadLetter != nil {
+						var rejected []deadLetterEntry
+						inserted, rejected, err = jr.insertIsolatingRows(tx, job, batch)
+						if err != nil {
+							failBatch(err)
+							return
+						}
+						batchLog.Rejected = len(rejected)
+						rejectedTotal, err = deadLetter.reject(rejected)
+						if err != nil {
+							failBatch(err)
+							return
+						}
+					} else {
+						insertSQL, args := jr.Dialect.BuildInsertQuery(job, batch)
+						if _, err := tx.Exec(insertSQL, args...); err != nil {
+							failBatch(err)
+							return
+						}
+					}
+
+					atomic.AddInt64(&processed, int64(inserted))
 					// Mantem o contador do job sincronizado com o log do pipeline
 					logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
 						jl.Processed = int(atomic.LoadInt64(&processed))
+						if rejectedTotal > 0 {
+							jl.Rejected = rejectedTotal
+						}
 					})
 					batchLog.Status = "done"
-					batchLog.Rows = len(batch)
+					batchLog.Rows = inserted
 					batchLog.EndedAt = time.Now()
 					logger.AddBatch(jr.PipelineLog, jobID, batchLog)
 					jr.savePipelineLog()
 
-					status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+					status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 						js.Processed = int(processed)
 						if total > 0 {
 							js.Progress = float64(processed) / float64(total) * 100
@@ -574,25 +756,179 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 			}()
 		}
 
-		// Resolve tabela principal uma única vez (EXPLAIN)
+		// Resolve tabela principal uma única vez (EXPLAIN); import-file e api-extract nao leem da origem
 		hashKeyExpr := ""
-		if len(mapDirectives) > 0 {
-			explainStart := time.Now()
-			hashKeyExpr, err = jr.getHashKeyExprFromExplainWithMapDirectives(job, mapDirectives, jobCtx)
-			log.Printf("Job %s (%s): hash key com Map resolvido em %s (hashKeyExpr=%s)", job.ID, job.JobName, time.Since(explainStart), hashKeyExpr)
-		} else {
-			hashKeyExpr, err = jr.getHashKeyExprFromExplain(job)
+		if !externalSource {
+			releaseExplain, waited, err := jr.acquireSourceSlot(jobCtx)
+			jr.addThrottled(jobID, waited)
+			if err != nil {
+				setJobError(err)
+				jobCancel()
+				return
+			}
+			if len(mapDirectives) > 0 {
+				explainStart := time.Now()
+				hashKeyExpr, err = jr.getHashKeyExprFromExplainWithMapDirectives(job, mapDirectives, jobCtx)
+				log.Printf("Job %s (%s): hash key com Map resolvido em %s (hashKeyExpr=%s)", job.ID, job.JobName, time.Since(explainStart), hashKeyExpr)
+			} else {
+				hashKeyExpr, err = jr.getHashKeyExprFromExplain(job)
+			}
+			releaseExplain()
+			if err != nil {
+				log.Printf("Erro no EXPLAIN do job %s: %v", job.ID, err)
+				setJobError(err)
+				jobCancel()
+				return
+			}
 		}
-		if err != nil {
-			log.Printf("Erro no EXPLAIN do job %s: %v", job.ID, err)
-			setJobError(err)
+
+		// Linha que falhou na transformacao: vai para o dead-letter ou falha o job como erro de lote
+		rejectTransformedRow := func(rec map[string]interface{}, transformErr error) bool {
+			if deadLetter != nil {
+				if _, err := deadLetter.reject([]deadLetterEntry{{Row: deadLetterRow(rec), Error: transformErr.Error()}}); err != nil {
+					setJobError(err)
+					jobCancel()
+					return false
+				}
+				return true
+			}
+			now := time.Now()
+			logger.AddBatch(jr.PipelineLog, jobID, logger.BatchLog{
+				Offset:    int(atomic.LoadInt64(&processed)),
+				Limit:     1,
+				Status:    "error",
+				Error:     transformErr.Error(),
+				ErrorType: "validation_error",
+				ErrorCode: "TRANSFORM_ERROR",
+				StartedAt: now,
+				EndedAt:   now,
+			})
+			jr.savePipelineLog()
+			setJobError(transformErr)
 			jobCancel()
-			return
+			return false
+		}
+
+		// import-file/api-extract: linha invalida vai para o dead-letter ou falha o job; o BatchLog registra arquivo (ou pagina) e linha
+		var importLineLogs int64
+		rejectImportLine := func(rec map[string]interface{}, pos importPosition, lineErr error) bool {
+			now := time.Now()
+			batchLog := logger.BatchLog{
+				Offset:    int(atomic.LoadInt64(&processed)),
+				Limit:     1,
+				Status:    "error",
+				Error:     fmt.Sprintf("%s: %v", pos, lineErr),
+				ErrorType: "validation_error",
+				ErrorCode: "IMPORT_LINE_ERROR",
+				File:      pos.file,
+				Line:      pos.line,
+				Page:      pos.page,
+				StartedAt: now,
+				EndedAt:   now,
+			}
+			if deadLetter != nil {
+				if _, err := deadLetter.reject([]deadLetterEntry{{Row: deadLetterRow(rec), Error: batchLog.Error}}); err != nil {
+					setJobError(err)
+					jobCancel()
+					return false
+				}
+				// O dead-letter guarda todas as linhas; o log do pipeline detalha apenas as primeiras
+				if atomic.AddInt64(&importLineLogs, 1) <= maxImportLineLogs {
+					batchLog.Status = "rejected"
+					batchLog.Rejected = 1
+					logger.AddBatch(jr.PipelineLog, jobID, batchLog)
+					jr.savePipelineLog()
+				}
+				return true
+			}
+			logger.AddBatch(jr.PipelineLog, jobID, batchLog)
+			jr.savePipelineLog()
+			setJobError(errors.New(batchLog.Error))
+			jobCancel()
+			return false
 		}
 
 		// Leitura paralela por bucket (cada worker lê o seu)
 		var readersWG sync.WaitGroup
-		for w := 0; w < concurrency; w++ {
+		sqlReaders := concurrency
+		if externalSource {
+			sqlReaders = 0
+			readersWG.Add(1)
+			go func() {
+				defer readersWG.Done()
+				status.AddWorkerActive(1, 0)
+				defer status.AddWorkerActive(-1, 0)
+
+				batchSize := job.RecordsPerPage
+				if batchSize <= 0 {
+					batchSize = defaultImportBatchSize
+				}
+				buffer := make([]map[string]interface{}, 0, batchSize)
+				send := func() bool {
+					waited, err := jr.waitSourceRows(jobCtx, jobLimiter, len(buffer))
+					jr.addThrottled(jobID, waited)
+					if err != nil {
+						return false
+					}
+					select {
+					case batchChan <- buffer:
+					case <-jobCtx.Done():
+						return false
+					}
+					buffer = make([]map[string]interface{}, 0, batchSize)
+					return true
+				}
+
+				handle := func(rec map[string]interface{}, pos importPosition, lineErr error) bool {
+					if jr.shouldStop() || jobCtx.Err() != nil {
+						return false
+					}
+					if lineErr == nil {
+						lineErr = rowTransforms.apply(rec)
+					}
+					if lineErr == nil {
+						lineErr = rowLookups.apply(rec)
+					}
+					keep := true
+					if lineErr == nil {
+						keep, lineErr = rowExprs.apply(rec)
+					}
+					if lineErr != nil {
+						rowMasker.apply(rec)
+						return rejectImportLine(rec, pos, lineErr)
+					}
+					if !keep {
+						atomic.AddInt64(&filtered, 1)
+						return true
+					}
+					rowMasker.apply(rec)
+					buffer = append(buffer, rec)
+					if len(buffer) == batchSize {
+						return send()
+					}
+					return true
+				}
+				var err error
+				if isAPI {
+					err = jr.readAPIPages(jobCtx, apiSpec, handle, func(batch logger.BatchLog) {
+						logger.AddBatch(jr.PipelineLog, jobID, batch)
+						jr.savePipelineLog()
+					})
+				} else {
+					err = readImportFiles(jobCtx, jr.ProjectID, *job.File, importFiles, job.Columns, handle)
+				}
+				if err != nil {
+					log.Printf("Erro na leitura da origem do job %s: %v", job.ID, err)
+					setJobError(err)
+					jobCancel()
+					return
+				}
+				if len(buffer) > 0 {
+					send()
+				}
+			}()
+		}
+		for w := 0; w < sqlReaders; w++ {
 			readersWG.Add(1)
 			go func(workerID int) {
 				defer readersWG.Done()
@@ -608,18 +944,23 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 				} else {
 					log.Printf("Job %s (%s): leitura sem hash (worker unico)", job.ID, job.JobName)
 				}
-				if len(mapDirectives) > 0 {
-					compiledQuery, compileErr := jr.compileSQLWithMapDirectives(query, mapDirectives, normalizeDBTypeFromDSN(jr.SourceDSN))
-					if compileErr != nil {
-						log.Printf("Erro ao compilar Map via CTE no bucket %d: %v", workerID, compileErr)
-						setJobError(compileErr)
-						jobCancel()
-						return
-					}
-					query = compiledQuery
+				query, sourceExec, releaseMaps, compileErr := jr.prepareMapSQL(jobCtx, jr.SourceDB, nil, normalizeDBTypeFromDSN(jr.SourceDSN), query, mapDirectives)
+				if compileErr != nil {
+					log.Printf("Erro ao compilar Map via CTE no bucket %d: %v", workerID, compileErr)
+					setJobError(compileErr)
+					jobCancel()
+					return
+				}
+				defer releaseMaps()
+
+				releaseSlot, waited, err := jr.acquireSourceSlot(jobCtx)
+				jr.addThrottled(jobID, waited)
+				if err != nil {
+					return
 				}
+				defer releaseSlot()
 
-				rows, err := jr.SourceDB.QueryContext(jobCtx, query)
+				rows, err := sourceExec.QueryContext(jobCtx, query)
 				if err != nil {
 					log.Printf("Erro na query do bucket %d: %v", workerID, err)
 					setJobError(err)
@@ -629,6 +970,8 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 				defer rows.Close()
 
 				cols, _ := rows.Columns()
+				colTypes, _ := rows.ColumnTypes()
+				workerExprs := rowExprs.withColumnTypes(cols, colTypes)
 				batchSize := job.RecordsPerPage
 				buffer := make([]map[string]interface{}, 0, batchSize)
 				values := make([]interface{}, len(cols))
@@ -651,9 +994,38 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 					for i, col := range cols {
 						rec[col] = values[i]
 					}
+					// Mascaramento sempre roda, inclusive nas linhas que vao para o dead-letter
+					err := rowTransforms.apply(rec)
+					if err == nil {
+						err = rowLookups.apply(rec)
+					}
+					keep := true
+					if err == nil {
+						keep, err = workerExprs.apply(rec)
+					}
+					if err != nil {
+						rowMasker.apply(rec)
+						ok := rejectTransformedRow(rec, err)
+						jr.releaseRecordMap(rec)
+						if !ok {
+							return
+						}
+						continue
+					}
+					if !keep {
+						atomic.AddInt64(&filtered, 1)
+						jr.releaseRecordMap(rec)
+						continue
+					}
+					rowMasker.apply(rec)
 					buffer = append(buffer, rec)
 
 					if len(buffer) == batchSize {
+						waited, err := jr.waitSourceRows(jobCtx, jobLimiter, len(buffer))
+						jr.addThrottled(jobID, waited)
+						if err != nil {
+							return
+						}
 						select {
 						case batchChan <- buffer:
 						case <-jobCtx.Done():
@@ -664,6 +1036,11 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 				}
 
 				if len(buffer) > 0 {
+					waited, err := jr.waitSourceRows(jobCtx, jobLimiter, len(buffer))
+					jr.addThrottled(jobID, waited)
+					if err != nil {
+						return
+					}
 					select {
 					case batchChan <- buffer:
 					case <-jobCtx.Done():
@@ -699,15 +1076,45 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 		})
 		jr.savePipelineLog()
 		if jobHadError.Load() {
-			status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+			status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 				js.Processed = 0
 				js.Progress = 0
 				status.NotifySubscribers()
 			})
 		}
-		if total > 0 && !jobHadError.Load() && finalProcessed < total {
+		rejectedRows := deadLetter.rejectedCount()
+		if rejectedRows > 0 {
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				jl.Rejected = rejectedRows
+			})
+			status.AppendLog(fmt.Sprintf("%s - Job: %s enviou %d linha(s) rejeitada(s) para %s", jr.PipelineLog.Project, job.JobName, rejectedRows, deadLetter.describe()))
+		}
+		filteredRows := int(atomic.LoadInt64(&filtered))
+		if filteredRows > 0 {
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				jl.Filtered = filteredRows
+			})
+			log.Printf("Job %s (%s): %d linha(s) descartada(s) pelo filtro", job.ID, job.JobName, filteredRows)
+		}
+		if scd2 != nil {
+			counts := scd2.result()
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				jl.SCD2 = counts
+			})
+			log.Printf("Job %s (%s): scd2 com %d linha(s) nova(s), %d alterada(s) e %d sem alteracao", job.ID, job.JobName, counts.New, counts.Changed, counts.Unchanged)
+		}
+		if misses := rowLookups.missCount(); misses > 0 {
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				jl.LookupMisses = misses
+			})
+			log.Printf("Job %s (%s): %d chave(s) nao encontrada(s) nos lookups", job.ID, job.JobName, misses)
+		}
+		if total > 0 && !jobHadError.Load() && finalProcessed+rejectedRows+filteredRows < total {
 			jobHadError.Store(true)
 			mismatchErr := fmt.Sprintf("inconsistencia: processados %d de %d registros sem erro SQL", finalProcessed, total)
+			if rejectedRows > 0 || filteredRows > 0 {
+				mismatchErr = fmt.Sprintf("inconsistencia: processados %d, rejeitados %d e filtrados %d de %d registros", finalProcessed, rejectedRows, filteredRows, total)
+			}
 			if concurrency > 1 {
 				mismatchErr += " (possivel divergencia no particionamento hash por chave)"
 			} else {
@@ -720,11 +1127,19 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 			log.Printf("Job %s (%s): %s", job.ID, job.JobName, mismatchErr)
 		}
 
+		runStatus := "done"
 		if jobHadError.Load() || jr.shouldStop() || jobCtx.Err() != nil {
-			if err := jr.deleteInsertTarget(job); err != nil {
-				log.Printf("Erro ao limpar destino do job %s: %v", job.ID, err)
+			runStatus = "rolled_back"
+			// scd2: o destino guarda o historico; a transacao do writer ja foi desfeita
+			if scd2 == nil {
+				if err := jr.deleteInsertTarget(job); err != nil {
+					log.Printf("Erro ao limpar destino do job %s: %v", job.ID, err)
+				}
 			}
 		}
+		if err := deadLetter.finish(runStatus); err != nil {
+			log.Printf("Erro ao atualizar dead-letter do job %s: %v", job.ID, err)
+		}
 
 		if jobHadError.Load() {
 			errMsg := "erro durante execução"
@@ -736,7 +1151,7 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 				jr.PipelineLog.Status = "error"
 				jr.PipelineLog.EndedAt = end
 				jr.savePipelineLog()
-				status.UpdateProjectStatus("error")
+				jr.updateProjectStatus("error")
 				return
 			}
 		} else if jr.shouldStop() {
@@ -746,6 +1161,7 @@ func (jr *JobRunner) runInsertJob(jobID string, job models.Job) {
 			jr.markJobFinalStatus(jobID, job, "done", "", end)
 		}
 
+		releaseJobSlot()
 		for _, nextID := range jr.ConnMap[jobID] {
 			jr.RunJob(nextID)
 		}
@@ -773,7 +1189,7 @@ func (jr *JobRunner) runExecutionJob(jobID string, job models.Job) {
 	logger.AddJob(jr.PipelineLog, jobLog)
 	jr.savePipelineLog()
 
-	status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 		js.Name = job.JobName
 		js.Status = "running"
 		js.StartedAt = &start
@@ -799,13 +1215,12 @@ func (jr *JobRunner) runExecutionJob(jobID string, job models.Job) {
 		return
 	}
 
-	if len(directives) > 0 {
-		resolvedSQL, err = jr.compileSQLWithMapDirectives(resolvedSQL, directives, dbType)
-		if err != nil {
-			jr.handleExecutionJobError(jobID, job, err)
-			return
-		}
+	resolvedSQL, _, releaseMaps, err := jr.prepareMapSQL(jr.ctx, targetDB, conn, dbType, resolvedSQL, directives)
+	if err != nil {
+		jr.handleExecutionJobError(jobID, job, err)
+		return
 	}
+	defer releaseMaps()
 	if strings.TrimSpace(resolvedSQL) != "" {
 		_, err = conn.ExecContext(jr.ctx, resolvedSQL)
 	}
@@ -825,7 +1240,7 @@ func (jr *JobRunner) runExecutionJob(jobID string, job models.Job) {
 		})
 		jr.savePipelineLog()
 
-		status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 			js.Status = "error"
 			js.Error = err.Error()
 			status.NotifySubscribers()
@@ -836,7 +1251,7 @@ func (jr *JobRunner) runExecutionJob(jobID string, job models.Job) {
 			jr.PipelineLog.Status = "error"
 			jr.PipelineLog.EndedAt = end
 			jr.savePipelineLog()
-			status.UpdateProjectStatus("error")
+			jr.updateProjectStatus("error")
 			return
 		}
 	} else {
@@ -847,7 +1262,7 @@ func (jr *JobRunner) runExecutionJob(jobID string, job models.Job) {
 		})
 		jr.savePipelineLog()
 
-		status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 			js.Status = "done"
 			js.EndedAt = &end
 			status.NotifySubscribers()
@@ -880,7 +1295,7 @@ func (jr *JobRunner) runConditionJob(jobID string, job models.Job) {
 	logger.AddJob(jr.PipelineLog, jobLog)
 	jr.savePipelineLog()
 
-	status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 		js.Name = job.JobName
 		js.Status = "running"
 		status.NotifySubscribers()
@@ -897,15 +1312,17 @@ func (jr *JobRunner) runConditionJob(jobID string, job models.Job) {
 			jr.PipelineLog.Status = "error"
 			jr.PipelineLog.EndedAt = end
 			jr.savePipelineLog()
-			status.UpdateProjectStatus("error")
+			jr.updateProjectStatus("error")
 		}
 		return
 	}
 	job.SelectSQL = resolvedSQL
 
 	var result bool
+	var conditionExec mapExecutor = targetDB
 	if len(directives) > 0 {
-		job.SelectSQL, err = jr.compileSQLWithMapDirectives(job.SelectSQL, directives, dbType)
+		var releaseMaps func()
+		job.SelectSQL, conditionExec, releaseMaps, err = jr.prepareMapSQL(jr.ctx, targetDB, nil, dbType, job.SelectSQL, directives)
 		if err != nil {
 			end := time.Now()
 			jr.markJobFinalStatus(jobID, job, "error", err.Error(), end)
@@ -913,12 +1330,13 @@ func (jr *JobRunner) runConditionJob(jobID string, job models.Job) {
 				jr.PipelineLog.Status = "error"
 				jr.PipelineLog.EndedAt = end
 				jr.savePipelineLog()
-				status.UpdateProjectStatus("error")
+				jr.updateProjectStatus("error")
 			}
 			return
 		}
+		defer releaseMaps()
 	}
-	err = targetDB.QueryRowContext(jr.ctx, job.SelectSQL).Scan(&result)
+	err = conditionExec.QueryRowContext(jr.ctx, job.SelectSQL).Scan(&result)
 	end := time.Now()
 
 	if jr.shouldStop() {
@@ -936,7 +1354,7 @@ func (jr *JobRunner) runConditionJob(jobID string, job models.Job) {
 		})
 		jr.savePipelineLog()
 
-		status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 			js.Status = "error"
 			js.Error = err.Error()
 			status.NotifySubscribers()
@@ -947,7 +1365,7 @@ func (jr *JobRunner) runConditionJob(jobID string, job models.Job) {
 			jr.PipelineLog.Status = "error"
 			jr.PipelineLog.EndedAt = end
 			jr.savePipelineLog()
-			status.UpdateProjectStatus("error")
+			jr.updateProjectStatus("error")
 		}
 		return
 	}
@@ -964,7 +1382,7 @@ func (jr *JobRunner) runConditionJob(jobID string, job models.Job) {
 		})
 		jr.savePipelineLog()
 
-		status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 			js.Status = "error"
 			js.Error = errMsg
 			status.NotifySubscribers()
@@ -975,7 +1393,7 @@ func (jr *JobRunner) runConditionJob(jobID string, job models.Job) {
 			jr.PipelineLog.Status = "error"
 			jr.PipelineLog.EndedAt = end
 			jr.savePipelineLog()
-			status.UpdateProjectStatus("error")
+			jr.updateProjectStatus("error")
 		}
 		return
 	} else {
@@ -987,7 +1405,7 @@ func (jr *JobRunner) runConditionJob(jobID string, job models.Job) {
 		})
 		jr.savePipelineLog()
 
-		status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 			js.Status = "done"
 			status.NotifySubscribers()
 		})
@@ -1019,7 +1437,7 @@ func (jr *JobRunner) runMemorySelectJob(jobID string, job models.Job) {
 	logger.AddJob(jr.PipelineLog, jobLog)
 	jr.savePipelineLog()
 
-	status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 		js.Name = job.JobName
 		js.Status = "running"
 		js.StartedAt = &start
@@ -1043,7 +1461,41 @@ func (jr *JobRunner) runMemorySelectJob(jobID string, job models.Job) {
 	}
 
 	job.SelectSQL = jr.SubstituteVariables(job.SelectSQL)
-	rows, err := jr.DestinationDB.Query(job.SelectSQL)
+	targetDB, _ := jr.resolveExecutionDB(job)
+
+	cacheHash := ""
+	if job.CacheTTLSeconds > 0 {
+		dsn := jr.DestinationDSN
+		if targetDB == jr.SourceDB {
+			dsn = jr.SourceDSN
+		}
+		cacheHash = mapCacheHash(job, dsn)
+		if dataset, ok := loadCachedMap(jr.ProjectID, key, cacheHash); ok {
+			if err := jr.storeMemoryMap(key, dataset); err != nil {
+				jr.failMemorySelectJob(jobID, job, err)
+				return
+			}
+			log.Printf("Job memory-select %s carregado do cache (%d linhas)", job.JobName, len(dataset.Rows))
+			status.AppendLog(fmt.Sprintf("%s - Job: %s carregou o map '%s' do cache em disco", jr.PipelineLog.Project, job.JobName, key))
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				jl.FromCache = true
+			})
+			jr.finishMemorySelectJob(jobID, job, len(dataset.Rows))
+			return
+		}
+	}
+
+	if targetDB == jr.SourceDB {
+		log.Printf("Job memory-select %s lendo do banco de origem", job.JobName)
+		releaseSlot, waited, err := jr.acquireSourceSlot(jr.ctx)
+		jr.addThrottled(jobID, waited)
+		if err != nil {
+			jr.failMemorySelectJob(jobID, job, err)
+			return
+		}
+		defer releaseSlot()
+	}
+	rows, err := targetDB.QueryContext(jr.ctx, job.SelectSQL)
 	if err != nil {
 		jr.failMemorySelectJob(jobID, job, err)
 		return
@@ -1111,20 +1563,30 @@ func (jr *JobRunner) runMemorySelectJob(jobID string, job models.Job) {
 		jr.failMemorySelectJob(jobID, job, err)
 		return
 	}
+	if cacheHash != "" {
+		ttl := time.Duration(job.CacheTTLSeconds) * time.Second
+		if err := saveCachedMap(jr.ProjectID, key, cacheHash, job, dataset, ttl); err != nil {
+			log.Printf("Aviso: falha ao gravar cache do map '%s': %v", key, err)
+		}
+	}
+
+	jr.finishMemorySelectJob(jobID, job, len(records))
+}
 
+func (jr *JobRunner) finishMemorySelectJob(jobID string, job models.Job, rowCount int) {
 	end := time.Now()
 	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
 		jl.Status = "done"
-		jl.Processed = len(records)
-		jl.Total = len(records)
+		jl.Processed = rowCount
+		jl.Total = rowCount
 		jl.EndedAt = end
 	})
 	jr.savePipelineLog()
 
-	status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 		js.Status = "done"
-		js.Processed = len(records)
-		js.Total = len(records)
+		js.Processed = rowCount
+		js.Total = rowCount
 		js.Progress = 100
 		js.EndedAt = &end
 		status.NotifySubscribers()
@@ -1142,7 +1604,7 @@ func (jr *JobRunner) failMemorySelectJob(jobID string, job models.Job, runErr er
 		jr.PipelineLog.Status = "error"
 		jr.PipelineLog.EndedAt = end
 		jr.savePipelineLog()
-		status.UpdateProjectStatus("error")
+		jr.updateProjectStatus("error")
 		return
 	}
 	for _, nextID := range jr.ConnMap[jobID] {
@@ -1284,14 +1746,46 @@ func (jr *JobRunner) releaseBatchRecordMaps(batch []map[string]interface{}) {
 }
 
 func (jr *JobRunner) resolveExecutionDB(job models.Job) (*sql.DB, string) {
-	conn := strings.ToLower(strings.TrimSpace(job.Connection))
-	switch conn {
-	case "origem", "source", "src", "source_db":
+	if IsSourceConnection(job.Connection) {
 		return jr.SourceDB, normalizeDBTypeFromDSN(jr.SourceDSN)
-	case "destino", "destination", "dest", "target", "destination_db":
-		return jr.DestinationDB, normalizeDBTypeFromDSN(jr.DestinationDSN)
+	}
+	return jr.DestinationDB, normalizeDBTypeFromDSN(jr.DestinationDSN)
+}
+
+// ValidateSourceDialect recusa, antes da execucao, jobs que leem da origem pela leitura
+// particionada por hash (insert e export-file) quando o dialeto nao a implementa.
+func ValidateSourceDialect(dialect dialects.SQLDialect, jobMap map[string]models.Job, jobOrder []string) error {
+	if dialect == nil || dialect.SupportsHashRead() {
+		return nil
+	}
+	unsupported := make([]string, 0)
+	for _, id := range jobOrder {
+		job := jobMap[id]
+		switch strings.ToLower(job.Type) {
+		case "insert":
+		case "export-file":
+			if !IsSourceConnection(job.Connection) {
+				continue
+			}
+		default:
+			continue
+		}
+		unsupported = append(unsupported, fmt.Sprintf("%s (%s)", job.JobName, job.Type))
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("origem sem suporte a leitura particionada; jobs nao suportados: %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// IsSourceConnection indica se o campo connection do job aponta para o banco de origem.
+// Qualquer outro valor (inclusive vazio) usa o destino.
+func IsSourceConnection(connection string) bool {
+	switch strings.ToLower(strings.TrimSpace(connection)) {
+	case "origem", "source", "src", "source_db":
+		return true
 	default:
-		return jr.DestinationDB, normalizeDBTypeFromDSN(jr.DestinationDSN)
+		return false
 	}
 }
 
@@ -1302,7 +1796,7 @@ func (jr *JobRunner) handleExecutionJobError(jobID string, job models.Job, err e
 		jr.PipelineLog.Status = "error"
 		jr.PipelineLog.EndedAt = end
 		jr.savePipelineLog()
-		status.UpdateProjectStatus("error")
+		jr.updateProjectStatus("error")
 		return
 	}
 	for _, nextID := range jr.ConnMap[jobID] {
@@ -1349,14 +1843,16 @@ func ExtractMapDirectiveKeys(sqlText string) ([]string, error) {
 	return keys, nil
 }
 
-func (jr *JobRunner) compileSQLWithMapDirectives(sqlText string, directives []mapDirective, targetDBType string) (string, error) {
+// compileSQLWithMapDirectives adiciona as CTEs dos maps ao SQL. Maps presentes em spilled
+// (chave -> tabela materializada) leem da tabela em vez de embutir as linhas.
+func (jr *JobRunner) compileSQLWithMapDirectives(sqlText string, directives []mapDirective, targetDBType string, spilled map[string]string) (string, error) {
 	baseSQL := strings.TrimSpace(sqlText)
 	baseSQL = strings.TrimSuffix(baseSQL, ";")
 	if len(directives) == 0 || baseSQL == "" {
 		return baseSQL, nil
 	}
 
-	cteDefs, err := jr.buildMapCTEDefinitions(targetDBType, directives)
+	cteDefs, err := jr.buildMapCTEDefinitions(targetDBType, directives, spilled)
 	if err != nil {
 		return "", err
 	}
@@ -1373,9 +1869,17 @@ func (jr *JobRunner) compileSQLWithMapDirectives(sqlText string, directives []ma
 	return fmt.Sprintf("WITH %s %s", cteDefs, baseSQL), nil
 }
 
-func (jr *JobRunner) buildMapCTEDefinitions(targetDBType string, directives []mapDirective) (string, error) {
+func (jr *JobRunner) buildMapCTEDefinitions(targetDBType string, directives []mapDirective, spilled map[string]string) (string, error) {
 	parts := make([]string, 0, len(directives))
 	for _, directive := range directives {
+		if table, ok := spilled[directive.Key]; ok {
+			dataset, exists := jr.getMemoryMap(directive.Key)
+			if !exists {
+				return "", fmt.Errorf("map '%s' nao encontrado no contexto da pipeline", directive.Key)
+			}
+			parts = append(parts, buildSpilledMapCTEDefinition(strings.ToLower(strings.TrimSpace(targetDBType)), directive.Key, table, dataset))
+			continue
+		}
 		cte, err := jr.getOrBuildMapCTEDefinition(targetDBType, directive.Key)
 		if err != nil {
 			return "", err
@@ -1618,6 +2122,21 @@ func classifyColumnValue(value interface{}) (string, error) {
 
 func mapDBTypeToSQLType(targetDBType, dbTypeName string) string {
 	switch {
+	case dbTypeName == "UUID":
+		if targetDBType == "postgres" {
+			return "UUID"
+		}
+		return "CHAR(36)"
+	case strings.Contains(dbTypeName, "JSON"):
+		if targetDBType == "postgres" {
+			return "JSONB"
+		}
+		return "JSON"
+	case strings.Contains(dbTypeName, "INTERVAL"):
+		if targetDBType == "postgres" {
+			return "INTERVAL"
+		}
+		return "TEXT"
 	case strings.Contains(dbTypeName, "INT"):
 		return "BIGINT"
 	case strings.Contains(dbTypeName, "DECIMAL"), strings.Contains(dbTypeName, "NUMERIC"):
@@ -1634,6 +2153,12 @@ func mapDBTypeToSQLType(targetDBType, dbTypeName string) string {
 		return "BOOLEAN"
 	case strings.Contains(dbTypeName, "TIMESTAMP"):
 		return "TIMESTAMP"
+	case strings.Contains(dbTypeName, "DATETIME"):
+		// DATETIME do MySQL guarda hora: nao pode cair no caso DATE
+		if targetDBType == "postgres" {
+			return "TIMESTAMP"
+		}
+		return "DATETIME"
 	case strings.Contains(dbTypeName, "DATE"):
 		if targetDBType == "postgres" {
 			return "DATE"
@@ -1681,7 +2206,12 @@ func (jr *JobRunner) storeMemoryMap(key string, dataset memoryDataset) error {
 	sourceDBType := normalizeDBTypeFromDSN(jr.SourceDSN)
 	destDBType := normalizeDBTypeFromDSN(jr.DestinationDSN)
 	prebuilt := make(map[string]string, 2)
-	for _, dbType := range []string{sourceDBType, destDBType} {
+	dbTypes := []string{sourceDBType, destDBType}
+	if jr.shouldSpillMap(dataset) {
+		// Map grande: sera materializado em tabela no primeiro uso
+		dbTypes = nil
+	}
+	for _, dbType := range dbTypes {
 		dbType = strings.ToLower(strings.TrimSpace(dbType))
 		if dbType == "" {
 			dbType = "postgres"
@@ -1795,7 +2325,7 @@ func (jr *JobRunner) markJobError(jobID string, job models.Job, err error) {
 		jl.EndedAt = end
 	})
 	jr.savePipelineLog()
-	status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 		js.Status = "error"
 		js.Error = err.Error()
 		js.EndedAt = &end
@@ -1805,6 +2335,8 @@ func (jr *JobRunner) markJobError(jobID string, job models.Job, err error) {
 
 // Marca status final do job
 func (jr *JobRunner) markJobFinalStatus(jobID string, job models.Job, statusStr, errMsg string, end time.Time) {
+	jr.recordThrottledTime(jobID, job)
+	jr.recordQueuedTime(jobID)
 	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
 		jl.Status = statusStr
 		jl.Error = errMsg
@@ -1812,7 +2344,7 @@ func (jr *JobRunner) markJobFinalStatus(jobID string, job models.Job, statusStr,
 		jl.Processed = int(jl.Processed)
 	})
 	jr.savePipelineLog()
-	status.UpdateJobStatus(job.ID, func(js *status.JobStatus) {
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
 		js.Status = statusStr
 		js.Error = errMsg
 		js.EndedAt = &end
@@ -1848,6 +2380,8 @@ func (jr *JobRunner) Run(startIDs []string) {
 	if jr.countQueue != nil {
 		close(jr.countQueue)
 	}
+	jr.dropSpilledTables()
+	jr.closeDatabases()
 
 	log.Printf("Pipeline %s finalizado com status: %s\n", jr.PipelineLog.PipelineID, jr.PipelineLog.Status)
 }
@@ -1884,20 +2418,43 @@ func (jr *JobRunner) Stop(reason string) {
 	status.UpdateProjectStatus("stop")
 	status.AppendLog(fmt.Sprintf("%s - Pipeline interrompida: %s", jr.PipelineLog.Project, reason))
 	jr.cancel()
-	if jr.SourceDB != nil {
-		_ = jr.SourceDB.Close()
-	}
-	if jr.DestinationDB != nil {
-		_ = jr.DestinationDB.Close()
-	}
+	// As tabelas de map precisam dos pools abertos: Run so chega ao drop depois do Wait
+	jr.dropSpilledTables()
+	jr.closeDatabases()
 	for id, job := range jr.JobMap {
-		js := status.GetJobStatus(id)
+		js := status.GetJobStatus(jr.statusKey(id))
 		if js == nil || (js.Status != "done" && js.Status != "error") {
 			jr.markJobFinalStatus(id, job, "error", "pipeline interrompida", time.Now())
 		}
 	}
 }
 
+// closeDatabases fecha os pools dedicados da execucao (Close e idempotente).
+// Pools emprestados pelo pipeline pai (subproject) ficam abertos.
+func (jr *JobRunner) closeDatabases() {
+	if jr.SourceDB != nil && !jr.sharedSourceDB {
+		_ = jr.SourceDB.Close()
+	}
+	if jr.DestinationDB != nil && !jr.sharedDestDB {
+		_ = jr.DestinationDB.Close()
+	}
+}
+
+// statusKey retorna a chave do job no mapa global de status. Runners aninhados prefixam
+// o id com o job pai: os ids vem do cliente e podem repetir entre projetos.
+func (jr *JobRunner) statusKey(jobID string) string {
+	return jr.statusPrefix + jobID
+}
+
+// updateProjectStatus altera o status global do projeto. Runners aninhados (subproject,
+// foreach) nao alteram: o job pai trata o erro e decide pelo projeto.
+func (jr *JobRunner) updateProjectStatus(projectStatus string) {
+	if jr.parent != nil {
+		return
+	}
+	status.UpdateProjectStatus(projectStatus)
+}
+
 func (jr *JobRunner) shouldStop() bool {
 	if jr.stopped.Load() {
 		return true
@@ -1918,6 +2475,14 @@ func (jr *JobRunner) flushPipelineLogNow() {
 }
 
 func (jr *JobRunner) persistPipelineLog(force bool) {
+	// subproject: o log esta aninhado no job do pipeline pai e e salvo junto com ele
+	if jr.parent != nil {
+		jr.parent.savePipelineLog()
+		if force {
+			jr.parent.flushPipelineLogNow()
+		}
+		return
+	}
 	jr.logFlushMu.Lock()
 	dirty := jr.logDirty
 	now := time.Now()
@@ -2012,6 +2577,8 @@ func envDurationMsDefault(key string, defMs int) time.Duration {
 
 // SubstituteVariables substitui placeholders nas queries SQL com os valores das variáveis
 func (jr *JobRunner) SubstituteVariables(query string) string {
+	jr.variablesMu.RLock()
+	defer jr.variablesMu.RUnlock()
 	for key, value := range jr.Variables {
 		placeholder := fmt.Sprintf("${%s}", key)
 		query = strings.ReplaceAll(query, placeholder, value)
@@ -2019,6 +2586,27 @@ func (jr *JobRunner) SubstituteVariables(query string) string {
 	return query
 }
 
+// setVariable altera uma variavel em tempo de execucao (job set-variable).
+func (jr *JobRunner) setVariable(name, value string) {
+	jr.variablesMu.Lock()
+	if jr.Variables == nil {
+		jr.Variables = make(map[string]string)
+	}
+	jr.Variables[name] = value
+	jr.variablesMu.Unlock()
+}
+
+// variablesSnapshot copia as variaveis atuais para quem precisa do mapa inteiro.
+func (jr *JobRunner) variablesSnapshot() map[string]string {
+	jr.variablesMu.RLock()
+	defer jr.variablesMu.RUnlock()
+	vars := make(map[string]string, len(jr.Variables))
+	for key, value := range jr.Variables {
+		vars[key] = value
+	}
+	return vars
+}
+
 // CleanSQLNewlines limpa as quebras de linha nas queries SQL para evitar problemas no PostgreSQL
 func (jr *JobRunner) CleanSQLNewlines(sql string) string {
 	// Preserva quebras de linha em strings literais (entre aspas simples)
@@ -2094,15 +2682,16 @@ func (jr *JobRunner) getHashKeyExprFromExplain(job models.Job) (string, error) {
 }
 
 func (jr *JobRunner) getHashKeyExprFromExplainWithMapDirectives(job models.Job, directives []mapDirective, ctx context.Context) (string, error) {
-	compiledSQL, err := jr.compileSQLWithMapDirectives(job.SelectSQL, directives, normalizeDBTypeFromDSN(jr.SourceDSN))
+	compiledSQL, sourceExec, releaseMaps, err := jr.prepareMapSQL(ctx, jr.SourceDB, nil, normalizeDBTypeFromDSN(jr.SourceDSN), job.SelectSQL, directives)
 	if err != nil {
 		return "", err
 	}
+	defer releaseMaps()
 	jobWithMap := job
 	jobWithMap.SelectSQL = compiledSQL
 
 	queryExplain := jr.Dialect.BuildExplainSelectQueryByHash(jobWithMap)
-	rowsExplain, err := jr.SourceDB.QueryContext(ctx, queryExplain)
+	rowsExplain, err := sourceExec.QueryContext(ctx, queryExplain)
 	if err != nil {
 		return "", err
 	}
@@ -2353,16 +2942,18 @@ func stripSQLComments(sqlText string) string {
 	return b.String()
 }
 
+// countSelectWithMapDirectives roda dentro de um worker de count, que ja reservou a vaga na origem.
 func (jr *JobRunner) countSelectWithMapDirectives(job models.Job, directives []mapDirective) (int, error) {
 	ctx := jr.ctx
-	selectSQL, err := jr.compileSQLWithMapDirectives(job.SelectSQL, directives, normalizeDBTypeFromDSN(jr.SourceDSN))
+	selectSQL, sourceExec, releaseMaps, err := jr.prepareMapSQL(ctx, jr.SourceDB, nil, normalizeDBTypeFromDSN(jr.SourceDSN), job.SelectSQL, directives)
 	if err != nil {
 		return 0, err
 	}
+	defer releaseMaps()
 	countSQL := fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS t", selectSQL)
 
 	var total int
-	if err := jr.SourceDB.QueryRowContext(ctx, countSQL).Scan(&total); err != nil {
+	if err := sourceExec.QueryRowContext(ctx, countSQL).Scan(&total); err != nil {
 		return 0, err
 	}
 	return total, nil
@@ -0,0 +1,254 @@
+package jobrunner
+
+import (
+	"etl/models"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// rowLookups enriquece as linhas lidas com colunas de maps de memory-select,
+// via hash-join em Go. Permite juntar dados de bancos diferentes (ex: fato da
+// origem com chaves substitutas de dimensoes do destino) sem passar por SQL.
+type rowLookups struct {
+	steps  []lookupIndex
+	masker *rowMasker // mascara a chave citada no erro de reject
+	misses int64
+}
+
+type lookupIndex struct {
+	step       models.LookupStep
+	mapKey     string
+	onMissing  string
+	outColumns []string
+	keyKinds   []string
+	index      map[string]map[string]interface{}
+}
+
+// lookupKeySeparator separa os valores de chaves compostas.
+const lookupKeySeparator = "\x1f"
+
+const lookupTimeLayout = "2006-01-02 15:04:05.999999999"
+
+// compileLookups monta os indices a partir dos maps ja carregados na pipeline.
+// Retorna nil quando o job nao tem lookups.
+func (jr *JobRunner) compileLookups(steps []models.LookupStep, masker *rowMasker) (*rowLookups, error) {
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	lookups := &rowLookups{steps: make([]lookupIndex, 0, len(steps)), masker: masker}
+	for i, step := range steps {
+		mapKey, err := normalizeMemoryMapKey(step.Map)
+		if err != nil {
+			return nil, fmt.Errorf("lookup %d: %w", i+1, err)
+		}
+		if len(step.SourceColumns) == 0 {
+			return nil, fmt.Errorf("lookup %d (%s): informe sourceColumns", i+1, mapKey)
+		}
+		mapColumns := step.MapColumns
+		if len(mapColumns) == 0 {
+			mapColumns = step.SourceColumns
+		}
+		if len(mapColumns) != len(step.SourceColumns) {
+			return nil, fmt.Errorf("lookup %d (%s): sourceColumns e mapColumns com tamanhos diferentes", i+1, mapKey)
+		}
+		if len(step.Columns) == 0 {
+			return nil, fmt.Errorf("lookup %d (%s): informe as colunas do map a anexar", i+1, mapKey)
+		}
+
+		onMissing := strings.ToLower(strings.TrimSpace(step.OnMissing))
+		switch onMissing {
+		case "":
+			onMissing = "null"
+		case "null", "default", "reject":
+		default:
+			return nil, fmt.Errorf("lookup %d (%s): onMissing '%s' invalido (use null, default ou reject)", i+1, mapKey, step.OnMissing)
+		}
+
+		dataset, ok := jr.getMemoryMap(mapKey)
+		if !ok {
+			return nil, fmt.Errorf("lookup %d: map '%s' nao encontrado no contexto da pipeline", i+1, mapKey)
+		}
+		known := make(map[string]bool, len(dataset.Columns))
+		for _, col := range dataset.Columns {
+			known[col] = true
+		}
+		for _, col := range append(append([]string{}, mapColumns...), step.Columns...) {
+			if !known[col] {
+				return nil, fmt.Errorf("lookup %d: coluna '%s' nao existe no map '%s'", i+1, col, mapKey)
+			}
+		}
+
+		idx := lookupIndex{
+			step:       step,
+			mapKey:     mapKey,
+			onMissing:  onMissing,
+			outColumns: make([]string, len(step.Columns)),
+			keyKinds:   make([]string, len(mapColumns)),
+			index:      make(map[string]map[string]interface{}, len(dataset.Rows)),
+		}
+		for c, col := range step.Columns {
+			idx.outColumns[c] = step.Prefix + col
+		}
+		// O tipo da coluna do map define como os dois lados da chave sao comparados
+		for c, col := range mapColumns {
+			if dbType, ok := dataset.ColumnDBTypes[col]; ok {
+				idx.keyKinds[c] = exportKindFromDBType(dbType)
+			}
+		}
+
+		// Chaves duplicadas: vale a primeira linha do map (lookup de dimensao)
+		duplicates := 0
+		for _, row := range dataset.Rows {
+			key, ok := lookupKey(row, mapColumns, idx.keyKinds)
+			if !ok {
+				continue
+			}
+			if _, exists := idx.index[key]; exists {
+				duplicates++
+				continue
+			}
+			values := make(map[string]interface{}, len(step.Columns))
+			for _, col := range step.Columns {
+				values[col] = row[col]
+			}
+			idx.index[key] = values
+		}
+		if duplicates > 0 {
+			log.Printf("Aviso: lookup no map '%s' ignorou %d linha(s) com chave duplicada", mapKey, duplicates)
+		}
+		lookups.steps = append(lookups.steps, idx)
+	}
+	return lookups, nil
+}
+
+// apply anexa as colunas encontradas na propria linha. Retorna erro quando a
+// chave nao existe e o lookup esta configurado para rejeitar.
+func (l *rowLookups) apply(rec map[string]interface{}) error {
+	if l == nil {
+		return nil
+	}
+	for i := range l.steps {
+		s := &l.steps[i]
+		key, ok := lookupKey(rec, s.step.SourceColumns, s.keyKinds)
+		var values map[string]interface{}
+		if ok {
+			values, ok = s.index[key]
+		}
+		if ok {
+			for c, col := range s.step.Columns {
+				rec[s.outColumns[c]] = values[col]
+			}
+			continue
+		}
+
+		atomic.AddInt64(&l.misses, 1)
+		switch s.onMissing {
+		case "reject":
+			return fmt.Errorf("lookup no map '%s': chave %s nao encontrada", s.mapKey, describeLookupKey(rec, s.step.SourceColumns, l.masker))
+		case "default":
+			for c, col := range s.step.Columns {
+				rec[s.outColumns[c]] = s.step.Defaults[col]
+			}
+		default:
+			for _, out := range s.outColumns {
+				rec[out] = nil
+			}
+		}
+	}
+	return nil
+}
+
+func (l *rowLookups) missCount() int {
+	if l == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&l.misses))
+}
+
+// lookupKey normaliza os valores pelo tipo da coluna do map para que tipos diferentes
+// entre bancos casem: numeros pelo decimal exato (10.00 e 10) e datas em UTC com
+// precisao total. Sem tipo conhecido, valores numericos e datas do driver seguem a
+// mesma regra e texto fica como veio. Chave com valor nulo nunca casa.
+func lookupKey(row map[string]interface{}, columns []string, kinds []string) (string, bool) {
+	if len(columns) == 1 {
+		val := row[columns[0]]
+		if val == nil {
+			return "", false
+		}
+		return lookupKeyValue(val, kinds[0]), true
+	}
+	parts := make([]string, len(columns))
+	for i, col := range columns {
+		val := row[col]
+		if val == nil {
+			return "", false
+		}
+		parts[i] = lookupKeyValue(val, kinds[i])
+	}
+	return strings.Join(parts, lookupKeySeparator), true
+}
+
+func lookupKeyValue(val interface{}, kind string) string {
+	switch v := val.(type) {
+	case time.Time:
+		return v.UTC().Format(lookupTimeLayout)
+	case bool:
+		return reconcileValue(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		kind = "decimal"
+	}
+	switch kind {
+	case "int", "decimal", "float":
+		return reconcileNumber(valueToString(val))
+	case "date", "timestamp":
+		if t, err := parseDateValue(val, ""); err == nil {
+			return t.UTC().Format(lookupTimeLayout)
+		}
+	case "bool":
+		if b, ok := parseDBBool(valueToString(val)); ok {
+			return reconcileValue(b)
+		}
+	}
+	return valueToString(val)
+}
+
+// describeLookupKey cita a chave na mensagem de erro ja com o mascaramento do job.
+func describeLookupKey(row map[string]interface{}, columns []string, masker *rowMasker) string {
+	key := make(map[string]interface{}, len(columns))
+	for _, col := range columns {
+		key[col] = row[col]
+	}
+	masker.apply(key)
+	parts := make([]string, len(columns))
+	for i, col := range columns {
+		parts[i] = fmt.Sprintf("%s=%v", col, key[col])
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// LookupOutputColumns retorna as colunas anexadas pelos lookups, na ordem de execucao.
+func LookupOutputColumns(steps []models.LookupStep) []string {
+	out := make([]string, 0)
+	for _, step := range steps {
+		for _, col := range step.Columns {
+			out = append(out, step.Prefix+col)
+		}
+	}
+	return out
+}
+
+// LookupMapKeys retorna as chaves dos maps usados pelos lookups do job.
+func LookupMapKeys(steps []models.LookupStep) ([]string, error) {
+	keys := make([]string, 0, len(steps))
+	for _, step := range steps {
+		key, err := normalizeMemoryMapKey(step.Map)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
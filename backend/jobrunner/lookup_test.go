@@ -0,0 +1,62 @@
+package jobrunner
+
+import (
+	"etl/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupKey(t *testing.T) {
+	sp := time.FixedZone("BRT", -3*3600)
+	cases := []struct {
+		name       string
+		source     interface{}
+		mapValue   interface{}
+		kind       string
+		wantsMatch bool
+	}{
+		{"numeric com escala", []byte("10.00"), int64(10), "decimal", true},
+		{"numeric x int sem tipo", []byte("10.00"), int64(10), "", false},
+		{"int32 x int64", int32(7), int64(7), "int", true},
+		{"bigint acima de 2^53", []byte("9007199254740993"), []byte("9007199254740992"), "int", false},
+		{"texto preserva zeros", "007", "7", "string", false},
+		{"texto igual", []byte("SP"), "SP", "string", true},
+		{"timestamp em fusos diferentes", time.Date(2024, 3, 10, 9, 0, 0, 0, sp), time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC), "timestamp", true},
+		{"timestamp com nanossegundos", time.Date(2024, 3, 10, 12, 0, 0, 1, time.UTC), time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC), "timestamp", false},
+		{"timestamp texto x driver", "2024-03-10 12:00:00", time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC), "timestamp", true},
+		{"data texto x driver", "2024-03-10", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), "date", true},
+		{"bool texto x driver", "t", true, "bool", true},
+	}
+	for _, tc := range cases {
+		source, _ := lookupKey(map[string]interface{}{"k": tc.source}, []string{"k"}, []string{tc.kind})
+		mapped, _ := lookupKey(map[string]interface{}{"k": tc.mapValue}, []string{"k"}, []string{tc.kind})
+		if (source == mapped) != tc.wantsMatch {
+			t.Errorf("%s: chaves %q e %q, casamento esperado %v", tc.name, source, mapped, tc.wantsMatch)
+		}
+	}
+
+	composite := map[string]interface{}{"a": []byte("1.50"), "b": "x"}
+	key, ok := lookupKey(composite, []string{"a", "b"}, []string{"decimal", "string"})
+	if !ok || key != "1.5"+lookupKeySeparator+"x" {
+		t.Errorf("chave composta = %q, %v", key, ok)
+	}
+	if _, ok := lookupKey(map[string]interface{}{"a": nil, "b": "x"}, []string{"a", "b"}, []string{"", ""}); ok {
+		t.Errorf("chave com nulo nao deve casar")
+	}
+}
+
+func TestDescribeLookupKeyMasksValues(t *testing.T) {
+	masker, err := compileMasking([]models.MaskingRule{{Column: "cpf", Rule: "redact"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := map[string]interface{}{"cpf": "12345678901", "loja": int64(3)}
+	got := describeLookupKey(rec, []string{"cpf", "loja"}, masker)
+	if strings.Contains(got, "12345678901") || !strings.Contains(got, "loja=3") {
+		t.Errorf("describeLookupKey = %s", got)
+	}
+	if rec["cpf"] != "12345678901" {
+		t.Errorf("linha original alterada: %v", rec["cpf"])
+	}
+}
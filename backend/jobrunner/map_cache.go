@@ -0,0 +1,300 @@
+package jobrunner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"etl/models"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache em disco dos datasets de memory-select (opcional por job, via cacheTtlSeconds).
+// Cada map fica em data/projects/<id>/cache/maps/<chave>.json. O hash do SQL resolvido,
+// da conexao e das colunas invalida o cache quando a definicao do job muda.
+
+type mapCacheFile struct {
+	Key           string            `json:"key"`
+	Hash          string            `json:"hash"`
+	JobID         string            `json:"job_id"`
+	JobName       string            `json:"job_name"`
+	CreatedAt     time.Time         `json:"created_at"`
+	ExpiresAt     time.Time         `json:"expires_at"`
+	Columns       []string          `json:"columns"`
+	ColumnDBTypes map[string]string `json:"column_db_types"`
+	Rows          [][]mapCacheCell  `json:"rows"`
+}
+
+// mapCacheCell preserva o tipo do valor (JSON nao diferencia int/float nem datas).
+// T: n (null), i (int), u (uint), f (float), b (bool), s (string), t (data/hora).
+type mapCacheCell struct {
+	T string `json:"t"`
+	V string `json:"v,omitempty"`
+}
+
+// MapCacheEntry resume um map em cache para a API.
+type MapCacheEntry struct {
+	Key       string    `json:"key"`
+	JobID     string    `json:"jobId"`
+	JobName   string    `json:"jobName"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Expired   bool      `json:"expired"`
+	Rows      int       `json:"rows"`
+	Columns   []string  `json:"columns"`
+	SizeBytes int64     `json:"sizeBytes"`
+}
+
+func mapCacheDir(projectID string) string {
+	return filepath.Join("data", "projects", projectID, "cache", "maps")
+}
+
+func mapCachePath(projectID, key string) string {
+	return filepath.Join(mapCacheDir(projectID), key+".json")
+}
+
+// mapCacheHash identifica a definicao do map: SQL ja com variaveis substituidas, banco e colunas.
+func mapCacheHash(job models.Job, dsn string) string {
+	h := sha256.New()
+	h.Write([]byte(job.SelectSQL))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.ToLower(strings.TrimSpace(job.Connection))))
+	h.Write([]byte{0})
+	h.Write([]byte(dsn))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.Join(job.Columns, ",")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadCachedMap retorna o dataset em cache se existir, nao estiver expirado e o hash conferir.
+func loadCachedMap(projectID, key, hash string) (memoryDataset, bool) {
+	raw, err := os.ReadFile(mapCachePath(projectID, key))
+	if err != nil {
+		return memoryDataset{}, false
+	}
+	var file mapCacheFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return memoryDataset{}, false
+	}
+	if file.Hash != hash || time.Now().After(file.ExpiresAt) {
+		return memoryDataset{}, false
+	}
+
+	rows := make([]map[string]interface{}, 0, len(file.Rows))
+	for _, cells := range file.Rows {
+		if len(cells) != len(file.Columns) {
+			return memoryDataset{}, false
+		}
+		row := make(map[string]interface{}, len(file.Columns))
+		for i, col := range file.Columns {
+			val, err := decodeMapCacheCell(cells[i])
+			if err != nil {
+				return memoryDataset{}, false
+			}
+			row[col] = val
+		}
+		rows = append(rows, row)
+	}
+	return memoryDataset{Columns: file.Columns, ColumnDBTypes: file.ColumnDBTypes, Rows: rows}, true
+}
+
+func saveCachedMap(projectID, key, hash string, job models.Job, dataset memoryDataset, ttl time.Duration) error {
+	now := time.Now()
+	file := mapCacheFile{
+		Key:           key,
+		Hash:          hash,
+		JobID:         job.ID,
+		JobName:       job.JobName,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+		Columns:       dataset.Columns,
+		ColumnDBTypes: dataset.ColumnDBTypes,
+		Rows:          make([][]mapCacheCell, 0, len(dataset.Rows)),
+	}
+	for _, row := range dataset.Rows {
+		cells := make([]mapCacheCell, len(dataset.Columns))
+		for i, col := range dataset.Columns {
+			cell, err := encodeMapCacheCell(row[col])
+			if err != nil {
+				return fmt.Errorf("coluna '%s': %w", col, err)
+			}
+			cells[i] = cell
+		}
+		file.Rows = append(file.Rows, cells)
+	}
+
+	raw, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mapCacheDir(projectID), 0755); err != nil {
+		return err
+	}
+	// Grava em arquivo temporario unico e renomeia: sem cache parcial e sem disputa
+	// entre execucoes que gravam o mesmo map ao mesmo tempo
+	path := mapCachePath(projectID, key)
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func encodeMapCacheCell(value interface{}) (mapCacheCell, error) {
+	switch v := value.(type) {
+	case nil:
+		return mapCacheCell{T: "n"}, nil
+	case bool:
+		return mapCacheCell{T: "b", V: strconv.FormatBool(v)}, nil
+	case int:
+		return mapCacheCell{T: "i", V: strconv.FormatInt(int64(v), 10)}, nil
+	case int8:
+		return mapCacheCell{T: "i", V: strconv.FormatInt(int64(v), 10)}, nil
+	case int16:
+		return mapCacheCell{T: "i", V: strconv.FormatInt(int64(v), 10)}, nil
+	case int32:
+		return mapCacheCell{T: "i", V: strconv.FormatInt(int64(v), 10)}, nil
+	case int64:
+		return mapCacheCell{T: "i", V: strconv.FormatInt(v, 10)}, nil
+	case uint:
+		return mapCacheCell{T: "u", V: strconv.FormatUint(uint64(v), 10)}, nil
+	case uint8:
+		return mapCacheCell{T: "u", V: strconv.FormatUint(uint64(v), 10)}, nil
+	case uint16:
+		return mapCacheCell{T: "u", V: strconv.FormatUint(uint64(v), 10)}, nil
+	case uint32:
+		return mapCacheCell{T: "u", V: strconv.FormatUint(uint64(v), 10)}, nil
+	case uint64:
+		return mapCacheCell{T: "u", V: strconv.FormatUint(v, 10)}, nil
+	case float32:
+		return mapCacheCell{T: "f", V: strconv.FormatFloat(float64(v), 'g', -1, 32)}, nil
+	case float64:
+		return mapCacheCell{T: "f", V: strconv.FormatFloat(v, 'g', -1, 64)}, nil
+	case string:
+		return mapCacheCell{T: "s", V: v}, nil
+	case time.Time:
+		return mapCacheCell{T: "t", V: v.Format(time.RFC3339Nano)}, nil
+	default:
+		return mapCacheCell{}, fmt.Errorf("valor com tipo nao suportado no cache: %T", value)
+	}
+}
+
+func decodeMapCacheCell(cell mapCacheCell) (interface{}, error) {
+	switch cell.T {
+	case "n":
+		return nil, nil
+	case "b":
+		return strconv.ParseBool(cell.V)
+	case "i":
+		return strconv.ParseInt(cell.V, 10, 64)
+	case "u":
+		return strconv.ParseUint(cell.V, 10, 64)
+	case "f":
+		return strconv.ParseFloat(cell.V, 64)
+	case "s":
+		return cell.V, nil
+	case "t":
+		return time.Parse(time.RFC3339Nano, cell.V)
+	default:
+		return nil, fmt.Errorf("tipo de celula desconhecido: %s", cell.T)
+	}
+}
+
+// ListMapCache lista os maps em cache do projeto (inclusive expirados).
+func ListMapCache(projectID string) ([]MapCacheEntry, error) {
+	entries := make([]MapCacheEntry, 0)
+	files, err := os.ReadDir(mapCacheDir(projectID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(mapCacheDir(projectID), f.Name())
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var file mapCacheFile
+		if err := json.Unmarshal(raw, &file); err != nil {
+			continue
+		}
+		entries = append(entries, MapCacheEntry{
+			Key:       file.Key,
+			JobID:     file.JobID,
+			JobName:   file.JobName,
+			CreatedAt: file.CreatedAt,
+			ExpiresAt: file.ExpiresAt,
+			Expired:   now.After(file.ExpiresAt),
+			Rows:      len(file.Rows),
+			Columns:   file.Columns,
+			SizeBytes: int64(len(raw)),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// InvalidateMapCache remove o map informado ou, com key vazia, todo o cache do projeto.
+// Retorna a quantidade de maps removidos.
+func InvalidateMapCache(projectID, key string) (int, error) {
+	if key != "" {
+		normalized, err := normalizeMemoryMapKey(key)
+		if err != nil {
+			return 0, err
+		}
+		if err := os.Remove(mapCachePath(projectID, normalized)); err != nil {
+			if os.IsNotExist(err) {
+				return 0, nil
+			}
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	files, err := os.ReadDir(mapCacheDir(projectID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	removed := 0
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(mapCacheDir(projectID), f.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
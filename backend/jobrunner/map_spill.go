@@ -0,0 +1,354 @@
+package jobrunner
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Maps grandes (acima de ETL_MAP_SPILL_ROWS linhas) nao sao mais embutidos no SQL
+// como SELECT ... UNION ALL. Os dados sao gravados em uma tabela e a CTE do Map
+// passa a apenas ler dessa tabela.
+//
+// ETL_MAP_SPILL_MODE:
+//   - "table" (padrao): tabela da pipeline (UNLOGGED no Postgres), criada uma vez
+//     por banco e removida ao final da execucao.
+//   - "temp": tabela temporaria de sessao, criada na conexao que executa a query.
+const (
+	mapSpillModeTable = "table"
+	mapSpillModeTemp  = "temp"
+
+	// Linhas por INSERT ao materializar no MySQL
+	mapSpillInsertBatch = 500
+)
+
+// mapExecutor e implementado por *sql.DB e *sql.Conn.
+type mapExecutor interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// spillTableKey identifica uma tabela de map materializada em um banco.
+type spillTableKey struct {
+	db  *sql.DB
+	key string
+}
+
+type spillTable struct {
+	name   string
+	dbType string
+}
+
+func envIntDefault(key string, def int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+func envMapSpillMode() string {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("ETL_MAP_SPILL_MODE")))
+	if mode == mapSpillModeTemp {
+		return mapSpillModeTemp
+	}
+	return mapSpillModeTable
+}
+
+// shouldSpillMap indica se o map deve ser materializado em tabela em vez de CTE inline.
+func (jr *JobRunner) shouldSpillMap(dataset memoryDataset) bool {
+	return jr.mapSpillRows > 0 && len(dataset.Rows) > jr.mapSpillRows
+}
+
+// prepareMapSQL compila as diretivas Map para execucao em db.
+// Maps grandes sao materializados antes; o executor retornado deve ser usado para rodar o SQL
+// (no modo "temp" e a conexao onde as tabelas temporarias foram criadas).
+// Se pinned for informado, as tabelas temporarias sao criadas nessa conexao.
+// A funcao de liberacao deve ser chamada apos o termino da query.
+func (jr *JobRunner) prepareMapSQL(ctx context.Context, db *sql.DB, pinned *sql.Conn, dbType, sqlText string, directives []mapDirective) (string, mapExecutor, func(), error) {
+	var executor mapExecutor = db
+	if pinned != nil {
+		executor = pinned
+	}
+	noop := func() {}
+	if len(directives) == 0 {
+		return sqlText, executor, noop, nil
+	}
+
+	spillKeys := make([]string, 0)
+	seen := make(map[string]bool, len(directives))
+	for _, directive := range directives {
+		if seen[directive.Key] {
+			continue
+		}
+		seen[directive.Key] = true
+		if dataset, ok := jr.getMemoryMap(directive.Key); ok && jr.shouldSpillMap(dataset) {
+			spillKeys = append(spillKeys, directive.Key)
+		}
+	}
+	if len(spillKeys) == 0 {
+		compiled, err := jr.compileSQLWithMapDirectives(sqlText, directives, dbType, nil)
+		return compiled, executor, noop, err
+	}
+
+	tables := make(map[string]string, len(spillKeys))
+	release := noop
+	if jr.mapSpillMode == mapSpillModeTemp {
+		conn := pinned
+		if conn == nil {
+			var err error
+			conn, err = db.Conn(ctx)
+			if err != nil {
+				return "", nil, noop, err
+			}
+		}
+		created := make([]string, 0, len(spillKeys))
+		release = func() {
+			dropCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			for _, name := range created {
+				if _, err := conn.ExecContext(dropCtx, dropSpillTableSQL(dbType, name, true)); err != nil {
+					log.Printf("Aviso: tabela temporaria de map %s nao removida: %v", name, err)
+				}
+			}
+			if pinned == nil {
+				_ = conn.Close()
+			}
+		}
+		for _, key := range spillKeys {
+			dataset, _ := jr.getMemoryMap(key)
+			name := spillTableName("etl_map_tmp", "", key)
+			if err := materializeMapTable(ctx, conn, dbType, name, dataset, true); err != nil {
+				release()
+				return "", nil, noop, fmt.Errorf("map '%s': erro ao materializar tabela temporaria: %w", key, err)
+			}
+			created = append(created, name)
+			tables[key] = name
+		}
+		executor = conn
+	} else {
+		for _, key := range spillKeys {
+			name, err := jr.ensurePipelineSpillTable(ctx, db, dbType, key)
+			if err != nil {
+				return "", nil, noop, fmt.Errorf("map '%s': erro ao materializar tabela: %w", key, err)
+			}
+			tables[key] = name
+		}
+	}
+
+	compiled, err := jr.compileSQLWithMapDirectives(sqlText, directives, dbType, tables)
+	if err != nil {
+		release()
+		return "", nil, noop, err
+	}
+	return compiled, executor, release, nil
+}
+
+// ensurePipelineSpillTable cria (uma vez por banco) a tabela da pipeline com os dados do map.
+func (jr *JobRunner) ensurePipelineSpillTable(ctx context.Context, db *sql.DB, dbType, key string) (string, error) {
+	jr.spillMu.Lock()
+	defer jr.spillMu.Unlock()
+
+	tableKey := spillTableKey{db: db, key: key}
+	if table, ok := jr.spillTables[tableKey]; ok {
+		return table.name, nil
+	}
+	dataset, ok := jr.getMemoryMap(key)
+	if !ok {
+		return "", fmt.Errorf("map '%s' nao encontrado no contexto da pipeline", key)
+	}
+
+	name := spillTableName("etl_map", jr.PipelineLog.PipelineID, key)
+	start := time.Now()
+	if err := materializeMapTable(ctx, db, dbType, name, dataset, false); err != nil {
+		_, _ = db.ExecContext(context.Background(), dropSpillTableSQL(dbType, name, false))
+		return "", err
+	}
+	if jr.spillTables == nil {
+		jr.spillTables = make(map[spillTableKey]spillTable)
+	}
+	jr.spillTables[tableKey] = spillTable{name: name, dbType: dbType}
+	log.Printf("Map '%s' materializado em %s (%d linhas) em %s", key, name, len(dataset.Rows), time.Since(start))
+	return name, nil
+}
+
+// dropSpilledTables remove as tabelas de map criadas pela pipeline.
+func (jr *JobRunner) dropSpilledTables() {
+	jr.spillMu.Lock()
+	tables := jr.spillTables
+	jr.spillTables = nil
+	jr.spillMu.Unlock()
+
+	for key, table := range tables {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if _, err := key.db.ExecContext(ctx, dropSpillTableSQL(table.dbType, table.name, false)); err != nil {
+			log.Printf("Aviso: tabela de map %s nao removida: %v", table.name, err)
+		}
+		cancel()
+	}
+}
+
+// spillTableName gera um nome curto e valido (limite de 63 caracteres do Postgres).
+func spillTableName(prefix, pipelineID, key string) string {
+	name := prefix
+	if pipelineID != "" {
+		sum := sha1.Sum([]byte(pipelineID))
+		name += "_" + hex.EncodeToString(sum[:])[:8]
+	}
+	safeKey := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(key))
+	if max := 63 - len(name) - 1; len(safeKey) > max {
+		safeKey = safeKey[:max]
+	}
+	return name + "_" + safeKey
+}
+
+func dropSpillTableSQL(dbType, name string, temporary bool) string {
+	if temporary {
+		if dbType == "mysql" {
+			return "DROP TEMPORARY TABLE IF EXISTS " + quoteIdentifier(dbType, name)
+		}
+		// pg_temp garante que apenas a tabela temporaria da sessao seja removida
+		return "DROP TABLE IF EXISTS pg_temp." + quoteIdentifier(dbType, name)
+	}
+	return "DROP TABLE IF EXISTS " + quoteIdentifier(dbType, name)
+}
+
+type txBeginner interface {
+	mapExecutor
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// materializeMapTable cria a tabela e carrega as linhas do map:
+// COPY no Postgres e INSERT em lotes no MySQL.
+func materializeMapTable(ctx context.Context, target txBeginner, dbType, name string, dataset memoryDataset, temporary bool) error {
+	if len(dataset.Columns) == 0 {
+		return fmt.Errorf("map sem colunas para materializacao")
+	}
+	colDefs := make([]string, 0, len(dataset.Columns))
+	for _, col := range dataset.Columns {
+		sqlType, err := inferColumnSQLType(dbType, col, dataset)
+		if err != nil {
+			return err
+		}
+		colDefs = append(colDefs, quoteIdentifier(dbType, col)+" "+sqlType)
+	}
+
+	createKind := "TABLE"
+	switch {
+	case temporary && dbType == "mysql":
+		createKind = "TEMPORARY TABLE"
+	case temporary:
+		createKind = "TEMP TABLE"
+	case dbType == "postgres":
+		createKind = "UNLOGGED TABLE"
+	}
+	if _, err := target.ExecContext(ctx, dropSpillTableSQL(dbType, name, temporary)); err != nil {
+		return err
+	}
+	createSQL := fmt.Sprintf("CREATE %s %s (%s)", createKind, quoteIdentifier(dbType, name), strings.Join(colDefs, ", "))
+	if _, err := target.ExecContext(ctx, createSQL); err != nil {
+		return err
+	}
+
+	tx, err := target.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if dbType == "mysql" {
+		err = insertMapRowsBatched(ctx, tx, dbType, name, dataset)
+	} else {
+		err = copyMapRows(ctx, tx, name, dataset)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func copyMapRows(ctx context.Context, tx *sql.Tx, name string, dataset memoryDataset) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(name, dataset.Columns...))
+	if err != nil {
+		return err
+	}
+	args := make([]interface{}, len(dataset.Columns))
+	for _, row := range dataset.Rows {
+		for i, col := range dataset.Columns {
+			args[i] = row[col]
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
+
+func insertMapRowsBatched(ctx context.Context, tx *sql.Tx, dbType, name string, dataset memoryDataset) error {
+	quotedCols := make([]string, len(dataset.Columns))
+	for i, col := range dataset.Columns {
+		quotedCols[i] = quoteIdentifier(dbType, col)
+	}
+	rowPlaceholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(dataset.Columns)), ", ") + ")"
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdentifier(dbType, name), strings.Join(quotedCols, ", "))
+
+	batch := mapSpillInsertBatch
+	if limit := 60000 / len(dataset.Columns); limit < batch {
+		batch = limit
+	}
+	if batch < 1 {
+		batch = 1
+	}
+	for start := 0; start < len(dataset.Rows); start += batch {
+		end := start + batch
+		if end > len(dataset.Rows) {
+			end = len(dataset.Rows)
+		}
+		placeholders := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(dataset.Columns))
+		for _, row := range dataset.Rows[start:end] {
+			placeholders = append(placeholders, rowPlaceholder)
+			for _, col := range dataset.Columns {
+				args = append(args, row[col])
+			}
+		}
+		if _, err := tx.ExecContext(ctx, prefix+strings.Join(placeholders, ", "), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildSpilledMapCTEDefinition gera a CTE do map lendo da tabela materializada.
+func buildSpilledMapCTEDefinition(targetDBType, cteName, table string, dataset memoryDataset) string {
+	quotedCols := make([]string, 0, len(dataset.Columns))
+	for _, col := range dataset.Columns {
+		quotedCols = append(quotedCols, quoteIdentifier(targetDBType, col))
+	}
+	cols := strings.Join(quotedCols, ", ")
+	return fmt.Sprintf("%s (%s) AS (SELECT %s FROM %s)", quoteIdentifier(targetDBType, cteName), cols, cols, quoteIdentifier(targetDBType, table))
+}
@@ -0,0 +1,233 @@
+package jobrunner
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"etl/models"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const defaultMaskingKeyName = "ETL_MASKING_KEY"
+
+var pseudonymFirstNames = []string{
+	"Ana", "Bruno", "Carla", "Daniel", "Eduarda", "Felipe", "Gabriela", "Henrique",
+	"Isabela", "Joao", "Larissa", "Marcos", "Natalia", "Otavio", "Paula", "Rafael",
+	"Sabrina", "Thiago", "Vanessa", "William", "Beatriz", "Caio", "Fernanda", "Gustavo",
+	"Helena", "Igor", "Juliana", "Lucas", "Mariana", "Pedro", "Renata", "Vitor",
+}
+
+var pseudonymLastNames = []string{
+	"Almeida", "Barbosa", "Cardoso", "Dias", "Esteves", "Ferreira", "Gomes", "Henriques",
+	"Lima", "Martins", "Nogueira", "Oliveira", "Pereira", "Queiroz", "Ribeiro", "Santos",
+	"Teixeira", "Vieira", "Araujo", "Batista", "Correia", "Duarte", "Freitas", "Moura",
+	"Pinto", "Rocha", "Souza", "Tavares", "Castro", "Monteiro", "Moreira", "Ramos",
+}
+
+// rowMasker aplica as regras de mascaramento do job. As regras deterministicas
+// usam HMAC-SHA256 apenas sobre o valor, entao o mesmo valor com a mesma chave
+// gera o mesmo resultado em qualquer tabela ou job.
+type rowMasker struct {
+	rules []maskRule
+}
+
+type maskRule struct {
+	rule models.MaskingRule
+	kind string
+	key  []byte
+}
+
+// compileMasking valida as regras e resolve as chaves. Retorna nil quando o job nao tem regras.
+func compileMasking(rules []models.MaskingRule, variables map[string]string) (*rowMasker, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	masker := &rowMasker{rules: make([]maskRule, 0, len(rules))}
+	for i, rule := range rules {
+		r := maskRule{rule: rule, kind: strings.ToLower(strings.TrimSpace(rule.Rule))}
+		if strings.TrimSpace(rule.Column) == "" {
+			return nil, fmt.Errorf("mascaramento %d: informe a coluna", i+1)
+		}
+		switch r.kind {
+		case "redact", "null":
+		case "hash", "cpf", "cnpj", "pseudonym", "email", "phone":
+			keyName := strings.TrimSpace(rule.Key)
+			if keyName == "" {
+				keyName = defaultMaskingKeyName
+			}
+			key := variables[keyName]
+			if key == "" {
+				key = os.Getenv(keyName)
+			}
+			if key == "" {
+				return nil, fmt.Errorf("mascaramento %d (%s): chave '%s' nao definida nas variaveis do projeto nem no ambiente", i+1, r.kind, keyName)
+			}
+			r.key = []byte(key)
+		default:
+			return nil, fmt.Errorf("mascaramento %d: regra '%s' desconhecida", i+1, rule.Rule)
+		}
+		masker.rules = append(masker.rules, r)
+	}
+	return masker, nil
+}
+
+// apply mascara a linha no proprio map. Valores nulos permanecem nulos.
+func (m *rowMasker) apply(rec map[string]interface{}) {
+	if m == nil {
+		return
+	}
+	for i := range m.rules {
+		r := &m.rules[i]
+		val, ok := rec[r.rule.Column]
+		if !ok || val == nil {
+			continue
+		}
+		rec[r.rule.Column] = r.mask(valueToString(val))
+	}
+}
+
+func (r *maskRule) mask(value string) interface{} {
+	switch r.kind {
+	case "null":
+		return nil
+	case "redact":
+		return redactValue(value, r.rule.KeepStart, r.rule.KeepEnd, r.rule.MaskChar)
+	case "hash":
+		digest := hex.EncodeToString(r.digest("hash", value))
+		if r.rule.Length > 0 && r.rule.Length < len(digest) {
+			return digest[:r.rule.Length]
+		}
+		return digest
+	case "cpf":
+		digits := checkDigitsCPF(r.digits("cpf", value, 9))
+		if strings.ContainsAny(value, ".-") {
+			return fmt.Sprintf("%s.%s.%s-%s", digits[0:3], digits[3:6], digits[6:9], digits[9:11])
+		}
+		return digits
+	case "cnpj":
+		digits := checkDigitsCNPJ(r.digits("cnpj", value, 12))
+		if strings.ContainsAny(value, "./-") {
+			return fmt.Sprintf("%s.%s.%s/%s-%s", digits[0:2], digits[2:5], digits[5:8], digits[8:12], digits[12:14])
+		}
+		return digits
+	case "pseudonym":
+		sum := r.digest("pseudonym", strings.ToLower(strings.TrimSpace(value)))
+		first := pseudonymFirstNames[int(binary.BigEndian.Uint32(sum[0:4])%uint32(len(pseudonymFirstNames)))]
+		last := pseudonymLastNames[int(binary.BigEndian.Uint32(sum[4:8])%uint32(len(pseudonymLastNames)))]
+		return first + " " + last
+	case "email":
+		local := hex.EncodeToString(r.digest("email", strings.ToLower(strings.TrimSpace(value))))[:12]
+		return "user_" + local + "@example.com"
+	case "phone":
+		return r.maskPhone(value)
+	}
+	return value
+}
+
+func (r *maskRule) digest(scope, value string) []byte {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(scope))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// digits gera n digitos deterministicos a partir do valor normalizado (somente digitos).
+func (r *maskRule) digits(scope, value string, n int) string {
+	normalized := onlyDigits(value)
+	if normalized == "" {
+		normalized = value
+	}
+	var b strings.Builder
+	for block := 0; b.Len() < n; block++ {
+		sum := r.digest(scope, fmt.Sprintf("%s#%d", normalized, block))
+		for _, c := range sum {
+			if b.Len() == n {
+				break
+			}
+			b.WriteByte('0' + c%10)
+		}
+	}
+	return b.String()
+}
+
+// maskPhone troca os digitos do telefone mantendo a pontuacao e os primeiros KeepStart digitos (ex: DDD).
+func (r *maskRule) maskPhone(value string) string {
+	fake := r.digits("phone", value, len(value))
+	out := []rune(value)
+	seen := 0
+	for i, ch := range out {
+		if !unicode.IsDigit(ch) {
+			continue
+		}
+		if seen >= r.rule.KeepStart {
+			out[i] = rune(fake[seen])
+		}
+		seen++
+	}
+	return string(out)
+}
+
+func redactValue(value string, keepStart, keepEnd int, maskChar string) string {
+	if maskChar == "" {
+		maskChar = "*"
+	}
+	runes := []rune(value)
+	if keepStart < 0 {
+		keepStart = 0
+	}
+	if keepEnd < 0 {
+		keepEnd = 0
+	}
+	if keepStart+keepEnd >= len(runes) {
+		return strings.Repeat(maskChar, len(runes))
+	}
+	return string(runes[:keepStart]) + strings.Repeat(maskChar, len(runes)-keepStart-keepEnd) + string(runes[len(runes)-keepEnd:])
+}
+
+func onlyDigits(value string) string {
+	var b strings.Builder
+	for _, ch := range value {
+		if ch >= '0' && ch <= '9' {
+			b.WriteRune(ch)
+		}
+	}
+	return b.String()
+}
+
+// checkDigitsCPF recebe 9 digitos e retorna o CPF com os 2 digitos verificadores.
+func checkDigitsCPF(base string) string {
+	// Evita sequencias repetidas (111.111.111-11), rejeitadas pelos validadores
+	if strings.Count(base, base[:1]) == len(base) {
+		base = base[:8] + string(rune('0'+(base[8]-'0'+1)%10))
+	}
+	d1 := mod11Digit(base, []int{10, 9, 8, 7, 6, 5, 4, 3, 2})
+	d2 := mod11Digit(base+d1, []int{11, 10, 9, 8, 7, 6, 5, 4, 3, 2})
+	return base + d1 + d2
+}
+
+// checkDigitsCNPJ recebe 12 digitos e retorna o CNPJ com os 2 digitos verificadores.
+func checkDigitsCNPJ(base string) string {
+	if strings.Count(base, base[:1]) == len(base) {
+		base = base[:11] + string(rune('0'+(base[11]-'0'+1)%10))
+	}
+	d1 := mod11Digit(base, []int{5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2})
+	d2 := mod11Digit(base+d1, []int{6, 5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2})
+	return base + d1 + d2
+}
+
+func mod11Digit(digits string, weights []int) string {
+	sum := 0
+	for i, w := range weights {
+		sum += int(digits[i]-'0') * w
+	}
+	rest := sum % 11
+	if rest < 2 {
+		return "0"
+	}
+	return string(rune('0' + 11 - rest))
+}
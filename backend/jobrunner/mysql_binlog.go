@@ -0,0 +1,1268 @@
+package jobrunner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cliente minimo do protocolo de replicacao do MySQL: autentica, pede o binlog a
+// partir de arquivo/posicao ou de um GTID set (COM_BINLOG_DUMP[_GTID] sem bloqueio,
+// o servidor encerra com EOF ao chegar no fim) e decodifica os eventos de linha.
+
+const (
+	mysqlClientLongPassword     = 0x00000001
+	mysqlClientLongFlag         = 0x00000004
+	mysqlClientProtocol41       = 0x00000200
+	mysqlClientTransactions     = 0x00002000
+	mysqlClientSecureConnection = 0x00008000
+	mysqlClientPluginAuth       = 0x00080000
+
+	mysqlComQuery          = 0x03
+	mysqlComBinlogDump     = 0x12
+	mysqlComBinlogDumpGTID = 0x1e
+
+	mysqlBinlogDumpNonBlock    = 0x01
+	mysqlBinlogThroughGTID     = 0x04
+	mysqlBinlogEventHeaderSize = 19
+)
+
+// Tipos de evento do binlog tratados pelo cdc
+const (
+	binlogQueryEvent       = 2
+	binlogRotateEvent      = 4
+	binlogFormatDescEvent  = 15
+	binlogXIDEvent         = 16
+	binlogTableMapEvent    = 19
+	binlogWriteRowsV1      = 23
+	binlogUpdateRowsV1     = 24
+	binlogDeleteRowsV1     = 25
+	binlogWriteRowsV2      = 30
+	binlogUpdateRowsV2     = 31
+	binlogDeleteRowsV2     = 32
+	binlogGTIDEvent        = 33
+	binlogTransactionEvent = 40
+)
+
+// Tipos de coluna do protocolo
+const (
+	mysqlTypeDecimal    = 0
+	mysqlTypeTiny       = 1
+	mysqlTypeShort      = 2
+	mysqlTypeLong       = 3
+	mysqlTypeFloat      = 4
+	mysqlTypeDouble     = 5
+	mysqlTypeNull       = 6
+	mysqlTypeTimestamp  = 7
+	mysqlTypeLongLong   = 8
+	mysqlTypeInt24      = 9
+	mysqlTypeDate       = 10
+	mysqlTypeTime       = 11
+	mysqlTypeDatetime   = 12
+	mysqlTypeYear       = 13
+	mysqlTypeVarchar    = 15
+	mysqlTypeBit        = 16
+	mysqlTypeTimestamp2 = 17
+	mysqlTypeDatetime2  = 18
+	mysqlTypeTime2      = 19
+	mysqlTypeJSON       = 245
+	mysqlTypeNewDecimal = 246
+	mysqlTypeEnum       = 247
+	mysqlTypeSet        = 248
+	mysqlTypeTinyBlob   = 249
+	mysqlTypeMediumBlob = 250
+	mysqlTypeLongBlob   = 251
+	mysqlTypeBlob       = 252
+	mysqlTypeVarString  = 253
+	mysqlTypeString     = 254
+	mysqlTypeGeometry   = 255
+)
+
+type mysqlBinlogConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	seq  byte
+}
+
+// binlogEvent e um evento ja sem o checksum.
+type binlogEvent struct {
+	Type   byte
+	LogPos uint32 // posicao do proximo evento no arquivo atual
+	Body   []byte
+}
+
+// dialMySQLBinlog conecta e autentica (mysql_native_password ou caching_sha2_password).
+func dialMySQLBinlog(ctx context.Context, network, addr, user, password string) (*mysqlBinlogConn, error) {
+	if network == "" {
+		network = "tcp"
+	}
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &mysqlBinlogConn{conn: conn, br: bufio.NewReaderSize(conn, 64*1024)}
+	if err := c.handshake(user, password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *mysqlBinlogConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *mysqlBinlogConn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(c.br, header[:]); err != nil {
+			return nil, err
+		}
+		size := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+		c.seq = header[3] + 1
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(c.br, chunk); err != nil {
+			return nil, err
+		}
+		payload = append(payload, chunk...)
+		// Pacotes de 16MB continuam no proximo
+		if size < 0xffffff {
+			return payload, nil
+		}
+	}
+}
+
+func (c *mysqlBinlogConn) writePacket(payload []byte) error {
+	packet := make([]byte, 4, 4+len(payload))
+	packet[0] = byte(len(payload))
+	packet[1] = byte(len(payload) >> 8)
+	packet[2] = byte(len(payload) >> 16)
+	packet[3] = c.seq
+	c.seq++
+	_, err := c.conn.Write(append(packet, payload...))
+	return err
+}
+
+func (c *mysqlBinlogConn) writeCommand(payload []byte) error {
+	c.seq = 0
+	return c.writePacket(payload)
+}
+
+func (c *mysqlBinlogConn) handshake(user, password string) error {
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(packet) > 0 && packet[0] == 0xff {
+		return parseMySQLError(packet)
+	}
+	r := &binlogReader{buf: packet}
+	if protocol := r.byte(); protocol != 10 {
+		return fmt.Errorf("versao de protocolo mysql nao suportada: %d", protocol)
+	}
+	r.cstring() // versao do servidor
+	r.uint32()  // id da conexao
+	scramble := append([]byte(nil), r.next(8)...)
+	r.byte() // filler
+	capabilities := uint32(r.uint16())
+	plugin := "mysql_native_password"
+	if r.remaining() > 0 {
+		r.byte()   // charset
+		r.uint16() // status
+		capabilities |= uint32(r.uint16()) << 16
+		authLen := int(r.byte())
+		r.next(10)
+		if capabilities&mysqlClientSecureConnection != 0 {
+			n := authLen - 8
+			if n < 13 {
+				n = 13
+			}
+			scramble = append(scramble, r.next(n)...)
+			scramble = scramble[:20]
+		}
+		if capabilities&mysqlClientPluginAuth != 0 && r.remaining() > 0 {
+			plugin = r.cstring()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	authResp, err := mysqlScramble(plugin, password, scramble)
+	if err != nil {
+		return err
+	}
+	flags := uint32(mysqlClientLongPassword | mysqlClientLongFlag | mysqlClientProtocol41 | mysqlClientTransactions | mysqlClientSecureConnection | mysqlClientPluginAuth)
+	resp := make([]byte, 0, 64+len(user)+len(authResp))
+	resp = binary.LittleEndian.AppendUint32(resp, flags)
+	resp = binary.LittleEndian.AppendUint32(resp, 16*1024*1024)
+	resp = append(resp, 45) // utf8mb4_general_ci
+	resp = append(resp, make([]byte, 23)...)
+	resp = append(resp, user...)
+	resp = append(resp, 0, byte(len(authResp)))
+	resp = append(resp, authResp...)
+	resp = append(resp, plugin...)
+	resp = append(resp, 0)
+	if err := c.writePacket(resp); err != nil {
+		return err
+	}
+	return c.finishAuth(plugin, password, scramble)
+}
+
+// finishAuth trata troca de plugin e a autenticacao completa do caching_sha2_password
+// (sem TLS a senha vai cifrada com a chave publica RSA do servidor).
+func (c *mysqlBinlogConn) finishAuth(plugin, password string, scramble []byte) error {
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if len(packet) == 0 {
+			return fmt.Errorf("resposta vazia na autenticacao")
+		}
+		switch packet[0] {
+		case 0x00:
+			return nil
+		case 0xff:
+			return parseMySQLError(packet)
+		case 0xfe:
+			r := &binlogReader{buf: packet, pos: 1}
+			plugin = r.cstring()
+			scramble = append([]byte(nil), r.rest()...)
+			if n := len(scramble); n > 0 && scramble[n-1] == 0 {
+				scramble = scramble[:n-1]
+			}
+			resp, err := mysqlScramble(plugin, password, scramble)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(resp); err != nil {
+				return err
+			}
+		case 0x01:
+			if plugin != "caching_sha2_password" || len(packet) < 2 {
+				return fmt.Errorf("resposta de autenticacao inesperada para %s", plugin)
+			}
+			switch packet[1] {
+			case 3: // fast auth: OK vem em seguida
+			case 4:
+				if err := c.writePacket([]byte{2}); err != nil { // pede a chave publica
+					return err
+				}
+				keyPacket, err := c.readPacket()
+				if err != nil {
+					return err
+				}
+				if len(keyPacket) == 0 || keyPacket[0] != 0x01 {
+					return fmt.Errorf("servidor nao enviou a chave publica")
+				}
+				encrypted, err := mysqlEncryptPassword(password, scramble, keyPacket[1:])
+				if err != nil {
+					return err
+				}
+				if err := c.writePacket(encrypted); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("resposta de autenticacao desconhecida: %d", packet[1])
+			}
+		default:
+			return fmt.Errorf("pacote de autenticacao desconhecido: 0x%02x", packet[0])
+		}
+	}
+}
+
+func mysqlScramble(plugin, password string, scramble []byte) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	switch plugin {
+	case "mysql_native_password":
+		stage1 := sha1.Sum([]byte(password))
+		stage2 := sha1.Sum(stage1[:])
+		h := sha1.New()
+		h.Write(scramble)
+		h.Write(stage2[:])
+		out := h.Sum(nil)
+		for i := range out {
+			out[i] ^= stage1[i]
+		}
+		return out, nil
+	case "caching_sha2_password":
+		m1 := sha256.Sum256([]byte(password))
+		m2 := sha256.Sum256(m1[:])
+		h := sha256.New()
+		h.Write(m2[:])
+		h.Write(scramble)
+		out := h.Sum(nil)
+		for i := range out {
+			out[i] ^= m1[i]
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("plugin de autenticacao nao suportado: %s", plugin)
+}
+
+func mysqlEncryptPassword(password string, scramble, pemKey []byte) ([]byte, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, fmt.Errorf("chave publica do servidor invalida")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("chave publica do servidor nao e RSA")
+	}
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, plain, nil)
+}
+
+func parseMySQLError(packet []byte) error {
+	r := &binlogReader{buf: packet, pos: 1}
+	code := r.uint16()
+	if r.remaining() > 0 && r.buf[r.pos] == '#' {
+		r.next(6)
+	}
+	return fmt.Errorf("mysql erro %d: %s", code, string(r.rest()))
+}
+
+// exec executa um comando sem resultset (ex: SET) na conexao de replicacao.
+func (c *mysqlBinlogConn) exec(query string) error {
+	if err := c.writeCommand(append([]byte{mysqlComQuery}, query...)); err != nil {
+		return err
+	}
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(packet) > 0 && packet[0] == 0xff {
+		return parseMySQLError(packet)
+	}
+	if len(packet) == 0 || packet[0] != 0x00 {
+		return fmt.Errorf("resposta inesperada para %s", query)
+	}
+	return nil
+}
+
+// startDump pede o binlog a partir de arquivo/posicao (gtid nil) ou do GTID set.
+func (c *mysqlBinlogConn) startDump(serverID uint32, file string, pos uint32, gtid mysqlGTIDSet) error {
+	if gtid != nil {
+		data := gtid.encode()
+		payload := []byte{mysqlComBinlogDumpGTID}
+		payload = binary.LittleEndian.AppendUint16(payload, mysqlBinlogDumpNonBlock|mysqlBinlogThroughGTID)
+		payload = binary.LittleEndian.AppendUint32(payload, serverID)
+		payload = binary.LittleEndian.AppendUint32(payload, 0) // sem nome de arquivo
+		payload = binary.LittleEndian.AppendUint64(payload, 4)
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(len(data)))
+		return c.writeCommand(append(payload, data...))
+	}
+	payload := []byte{mysqlComBinlogDump}
+	payload = binary.LittleEndian.AppendUint32(payload, pos)
+	payload = binary.LittleEndian.AppendUint16(payload, mysqlBinlogDumpNonBlock)
+	payload = binary.LittleEndian.AppendUint32(payload, serverID)
+	return c.writeCommand(append(payload, file...))
+}
+
+// readEvent retorna o proximo evento ou io.EOF quando o servidor chega ao fim do binlog.
+func (c *mysqlBinlogConn) readEvent(checksum bool) (binlogEvent, error) {
+	packet, err := c.readPacket()
+	if err != nil {
+		return binlogEvent{}, err
+	}
+	if len(packet) == 0 {
+		return binlogEvent{}, fmt.Errorf("pacote vazio no binlog")
+	}
+	switch packet[0] {
+	case 0xfe:
+		if len(packet) < 9 {
+			return binlogEvent{}, io.EOF
+		}
+	case 0xff:
+		return binlogEvent{}, parseMySQLError(packet)
+	}
+	data := packet[1:]
+	if len(data) < mysqlBinlogEventHeaderSize {
+		return binlogEvent{}, fmt.Errorf("evento de binlog truncado")
+	}
+	size := int(binary.LittleEndian.Uint32(data[9:13]))
+	if size > len(data) || size < mysqlBinlogEventHeaderSize {
+		return binlogEvent{}, fmt.Errorf("tamanho de evento invalido: %d", size)
+	}
+	body := data[mysqlBinlogEventHeaderSize:size]
+	if checksum && len(body) >= 4 {
+		body = body[:len(body)-4]
+	}
+	return binlogEvent{Type: data[4], LogPos: binary.LittleEndian.Uint32(data[13:17]), Body: body}, nil
+}
+
+// binlogReader le campos little-endian dos pacotes e eventos.
+type binlogReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *binlogReader) remaining() int {
+	return len(r.buf) - r.pos
+}
+
+func (r *binlogReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.buf) {
+		r.err = fmt.Errorf("evento de binlog truncado")
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *binlogReader) rest() []byte {
+	if r.err != nil {
+		return nil
+	}
+	b := r.buf[r.pos:]
+	r.pos = len(r.buf)
+	return b
+}
+
+func (r *binlogReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *binlogReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *binlogReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *binlogReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// uintN le um inteiro little-endian de n bytes.
+func (r *binlogReader) uintN(n int) uint64 {
+	b := r.next(n)
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+// uintBE le um inteiro big-endian de n bytes (formatos de data e decimal).
+func (r *binlogReader) uintBE(n int) uint64 {
+	b := r.next(n)
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v
+}
+
+func (r *binlogReader) lenenc() uint64 {
+	switch first := r.byte(); first {
+	case 0xfc:
+		return r.uintN(2)
+	case 0xfd:
+		return r.uintN(3)
+	case 0xfe:
+		return r.uintN(8)
+	default:
+		return uint64(first)
+	}
+}
+
+func (r *binlogReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	for i := r.pos; i < len(r.buf); i++ {
+		if r.buf[i] == 0 {
+			s := string(r.buf[r.pos:i])
+			r.pos = i + 1
+			return s
+		}
+	}
+	r.err = fmt.Errorf("texto sem terminador no pacote mysql")
+	return ""
+}
+
+// mysqlTableMap e a definicao da tabela enviada no TABLE_MAP_EVENT. Names e Unsigned
+// vem dos metadados opcionais (binlog_row_metadata) e ficam nil quando ausentes.
+type mysqlTableMap struct {
+	Schema   string
+	Table    string
+	Types    []byte
+	Meta     []uint16
+	Names    []string
+	Unsigned []bool
+}
+
+// Metadados opcionais do TABLE_MAP_EVENT usados na conferencia do schema
+const (
+	binlogMetaSignedness = 1
+	binlogMetaColumnName = 4
+)
+
+func parseTableMapEvent(body []byte) (uint64, mysqlTableMap, error) {
+	r := &binlogReader{buf: body}
+	tableID := r.uintN(6)
+	r.uint16() // flags
+	tm := mysqlTableMap{}
+	tm.Schema = string(r.next(int(r.byte())))
+	r.byte()
+	tm.Table = string(r.next(int(r.byte())))
+	r.byte()
+	count := int(r.lenenc())
+	tm.Types = append([]byte(nil), r.next(count)...)
+	m := &binlogReader{buf: r.next(int(r.lenenc()))}
+	tm.Meta = make([]uint16, count)
+	for i := 0; i < count && r.err == nil && m.err == nil; i++ {
+		switch tm.Types[i] {
+		case mysqlTypeFloat, mysqlTypeDouble, mysqlTypeBlob, mysqlTypeGeometry, mysqlTypeJSON,
+			mysqlTypeTimestamp2, mysqlTypeDatetime2, mysqlTypeTime2:
+			tm.Meta[i] = uint16(m.byte())
+		case mysqlTypeVarchar, mysqlTypeVarString, mysqlTypeBit:
+			tm.Meta[i] = m.uint16()
+		case mysqlTypeNewDecimal, mysqlTypeString, mysqlTypeEnum, mysqlTypeSet:
+			// big-endian: (precisao, escala) ou (tipo real, tamanho)
+			tm.Meta[i] = uint16(m.byte())<<8 | uint16(m.byte())
+		}
+	}
+	if m.err != nil {
+		return tableID, tm, m.err
+	}
+	r.next((count + 7) / 8) // colunas que aceitam NULL
+	for r.err == nil && r.remaining() > 0 {
+		kind := r.byte()
+		field := &binlogReader{buf: r.next(int(r.lenenc()))}
+		switch kind {
+		case binlogMetaSignedness:
+			// Um bit por coluna numerica, do bit mais alto para o mais baixo
+			bits := field.rest()
+			tm.Unsigned = make([]bool, count)
+			n := 0
+			for i, typ := range tm.Types {
+				if !mysqlNumericType(typ) {
+					continue
+				}
+				if n/8 < len(bits) {
+					tm.Unsigned[i] = bits[n/8]&(0x80>>(uint(n)%8)) != 0
+				}
+				n++
+			}
+		case binlogMetaColumnName:
+			tm.Names = make([]string, 0, count)
+			for field.err == nil && field.remaining() > 0 {
+				tm.Names = append(tm.Names, string(field.next(int(field.lenenc()))))
+			}
+			if field.err != nil {
+				return tableID, tm, field.err
+			}
+		}
+	}
+	return tableID, tm, r.err
+}
+
+func mysqlNumericType(typ byte) bool {
+	switch typ {
+	case mysqlTypeTiny, mysqlTypeShort, mysqlTypeInt24, mysqlTypeLong, mysqlTypeLongLong,
+		mysqlTypeFloat, mysqlTypeDouble, mysqlTypeDecimal, mysqlTypeNewDecimal:
+		return true
+	}
+	return false
+}
+
+// mysqlColumnInfo complementa o TABLE_MAP com nome, sinal e valores de enum/set.
+type mysqlColumnInfo struct {
+	Name     string
+	DataType string // data_type do information_schema, em minusculas
+	Unsigned bool
+	Binary   bool
+	Values   []string // enum/set
+}
+
+// mysqlBinlogTypes lista os tipos de binlog validos para cada data_type; tipos
+// antigos (TIMESTAMP, DATETIME, TIME sem fsp) valem para tabelas anteriores ao 5.6.
+var mysqlBinlogTypes = map[string][]byte{
+	"tinyint":    {mysqlTypeTiny},
+	"smallint":   {mysqlTypeShort},
+	"mediumint":  {mysqlTypeInt24},
+	"int":        {mysqlTypeLong},
+	"integer":    {mysqlTypeLong},
+	"bigint":     {mysqlTypeLongLong},
+	"float":      {mysqlTypeFloat},
+	"double":     {mysqlTypeDouble},
+	"real":       {mysqlTypeDouble},
+	"decimal":    {mysqlTypeNewDecimal},
+	"numeric":    {mysqlTypeNewDecimal},
+	"year":       {mysqlTypeYear},
+	"date":       {mysqlTypeDate},
+	"datetime":   {mysqlTypeDatetime2, mysqlTypeDatetime},
+	"timestamp":  {mysqlTypeTimestamp2, mysqlTypeTimestamp},
+	"time":       {mysqlTypeTime2, mysqlTypeTime},
+	"char":       {mysqlTypeString},
+	"binary":     {mysqlTypeString},
+	"varchar":    {mysqlTypeVarchar},
+	"varbinary":  {mysqlTypeVarchar},
+	"tinytext":   {mysqlTypeBlob},
+	"text":       {mysqlTypeBlob},
+	"mediumtext": {mysqlTypeBlob},
+	"longtext":   {mysqlTypeBlob},
+	"tinyblob":   {mysqlTypeBlob},
+	"blob":       {mysqlTypeBlob},
+	"mediumblob": {mysqlTypeBlob},
+	"longblob":   {mysqlTypeBlob},
+	"enum":       {mysqlTypeEnum},
+	"set":        {mysqlTypeSet},
+	"bit":        {mysqlTypeBit},
+	"json":       {mysqlTypeJSON},
+}
+
+// checkMySQLTableMap confere o TABLE_MAP com as colunas lidas do information_schema:
+// quantidade, tipo de cada coluna e, quando o binlog traz os metadados opcionais,
+// nome e sinal. Uma divergencia indica ALTER TABLE entre a leitura do schema e o
+// evento; decodificar assim gravaria valores nas colunas erradas.
+func checkMySQLTableMap(tm mysqlTableMap, columns []mysqlColumnInfo) error {
+	if len(tm.Types) != len(columns) {
+		return fmt.Errorf("tabela %s.%s com %d colunas no binlog e %d no information_schema", tm.Schema, tm.Table, len(tm.Types), len(columns))
+	}
+	if tm.Names != nil && len(tm.Names) != len(columns) {
+		return fmt.Errorf("tabela %s.%s com %d nomes de coluna no binlog e %d colunas", tm.Schema, tm.Table, len(tm.Names), len(columns))
+	}
+	for i, col := range columns {
+		typ := tm.Types[i]
+		if typ == mysqlTypeString && tm.Meta[i]>>8 != 0 {
+			// ENUM e SET chegam como STRING com o tipo real no metadado
+			if real := byte(tm.Meta[i] >> 8); real == mysqlTypeEnum || real == mysqlTypeSet {
+				typ = real
+			}
+		}
+		if allowed, known := mysqlBinlogTypes[col.DataType]; known && bytes.IndexByte(allowed, typ) < 0 {
+			return fmt.Errorf("coluna %s (%s) com tipo %d no binlog", col.Name, col.DataType, typ)
+		}
+		if tm.Names != nil && !strings.EqualFold(tm.Names[i], col.Name) {
+			return fmt.Errorf("coluna %d chamada %s no binlog e %s no information_schema", i+1, tm.Names[i], col.Name)
+		}
+		if tm.Unsigned != nil && tm.Unsigned[i] != col.Unsigned {
+			// So os inteiros usam o sinal na decodificacao
+			switch typ {
+			case mysqlTypeTiny, mysqlTypeShort, mysqlTypeInt24, mysqlTypeLong, mysqlTypeLongLong:
+				return fmt.Errorf("coluna %s com sinal diferente no binlog", col.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// mysqlRowChange e uma linha alterada; Before so existe em update e delete.
+type mysqlRowChange struct {
+	Before map[string]interface{}
+	After  map[string]interface{}
+}
+
+// parseRowsEvent decodifica as linhas de um WRITE/UPDATE/DELETE_ROWS (v1 ou v2).
+func parseRowsEvent(eventType byte, body []byte, tm mysqlTableMap, columns []mysqlColumnInfo) ([]mysqlRowChange, error) {
+	r := &binlogReader{buf: body}
+	r.uintN(6) // table id
+	r.uint16() // flags
+	if eventType >= binlogWriteRowsV2 {
+		extra := int(r.uint16())
+		r.next(extra - 2)
+	}
+	count := int(r.lenenc())
+	if count != len(tm.Types) || count != len(columns) {
+		return nil, fmt.Errorf("tabela %s.%s com %d colunas no binlog e %d no information_schema", tm.Schema, tm.Table, count, len(columns))
+	}
+	bitmapSize := (count + 7) / 8
+	present := r.next(bitmapSize)
+	var presentAfter []byte
+	isUpdate := eventType == binlogUpdateRowsV1 || eventType == binlogUpdateRowsV2
+	if isUpdate {
+		presentAfter = r.next(bitmapSize)
+	}
+
+	changes := make([]mysqlRowChange, 0)
+	for r.err == nil && r.remaining() > 0 {
+		row, err := readBinlogRow(r, present, tm, columns)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case isUpdate:
+			after, err := readBinlogRow(r, presentAfter, tm, columns)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, mysqlRowChange{Before: row, After: after})
+		case eventType == binlogDeleteRowsV1 || eventType == binlogDeleteRowsV2:
+			changes = append(changes, mysqlRowChange{Before: row})
+		default:
+			changes = append(changes, mysqlRowChange{After: row})
+		}
+	}
+	return changes, r.err
+}
+
+func readBinlogRow(r *binlogReader, present []byte, tm mysqlTableMap, columns []mysqlColumnInfo) (map[string]interface{}, error) {
+	presentCount := 0
+	for i := range tm.Types {
+		if present[i/8]&(1<<(uint(i)%8)) != 0 {
+			presentCount++
+		}
+	}
+	nulls := r.next((presentCount + 7) / 8)
+	row := make(map[string]interface{}, presentCount)
+	idx := 0
+	for i, typ := range tm.Types {
+		if present[i/8]&(1<<(uint(i)%8)) == 0 {
+			continue
+		}
+		isNull := nulls != nil && nulls[idx/8]&(1<<(uint(idx)%8)) != 0
+		idx++
+		if isNull {
+			row[columns[i].Name] = nil
+			continue
+		}
+		value, err := readBinlogValue(r, typ, tm.Meta[i], columns[i])
+		if err != nil {
+			return nil, fmt.Errorf("coluna %s: %w", columns[i].Name, err)
+		}
+		row[columns[i].Name] = value
+	}
+	return row, r.err
+}
+
+// readBinlogValue converte um valor do formato de linha do binlog. Datas vao como texto
+// (ou time.Time para TIMESTAMP, que e UTC); datas zeradas viram NULL.
+func readBinlogValue(r *binlogReader, typ byte, meta uint16, col mysqlColumnInfo) (interface{}, error) {
+	if typ == mysqlTypeString && meta>>8 != 0 {
+		// ENUM e SET chegam como STRING com o tipo real no metadado
+		if real := byte(meta >> 8); real == mysqlTypeEnum || real == mysqlTypeSet {
+			typ = real
+			meta &= 0xff
+		}
+	}
+	switch typ {
+	case mysqlTypeTiny:
+		v := r.uintN(1)
+		if col.Unsigned {
+			return int64(v), r.err
+		}
+		return int64(int8(v)), r.err
+	case mysqlTypeShort:
+		v := r.uintN(2)
+		if col.Unsigned {
+			return int64(v), r.err
+		}
+		return int64(int16(v)), r.err
+	case mysqlTypeInt24:
+		v := r.uintN(3)
+		if !col.Unsigned && v&0x800000 != 0 {
+			return int64(v) - 0x1000000, r.err
+		}
+		return int64(v), r.err
+	case mysqlTypeLong:
+		v := r.uintN(4)
+		if col.Unsigned {
+			return int64(v), r.err
+		}
+		return int64(int32(v)), r.err
+	case mysqlTypeLongLong:
+		v := r.uint64()
+		if col.Unsigned {
+			if v > math.MaxInt64 {
+				return strconv.FormatUint(v, 10), r.err
+			}
+			return int64(v), r.err
+		}
+		return int64(v), r.err
+	case mysqlTypeFloat:
+		return float64(math.Float32frombits(r.uint32())), r.err
+	case mysqlTypeDouble:
+		return math.Float64frombits(r.uint64()), r.err
+	case mysqlTypeYear:
+		v := r.uintN(1)
+		if v == 0 {
+			return nil, r.err
+		}
+		return int64(v) + 1900, r.err
+	case mysqlTypeNewDecimal:
+		return readBinlogDecimal(r, int(meta>>8), int(meta&0xff))
+	case mysqlTypeVarchar, mysqlTypeVarString:
+		size := 1
+		if meta > 255 {
+			size = 2
+		}
+		return binlogText(r.next(int(r.uintN(size))), col), r.err
+	case mysqlTypeString:
+		maxLen := int(((meta>>4)&0x300)^0x300) + int(meta&0xff)
+		size := 1
+		if maxLen > 255 {
+			size = 2
+		}
+		return binlogText(r.next(int(r.uintN(size))), col), r.err
+	case mysqlTypeEnum:
+		idx := int(r.uintN(int(meta)))
+		if idx == 0 || idx > len(col.Values) {
+			return "", r.err
+		}
+		return col.Values[idx-1], r.err
+	case mysqlTypeSet:
+		bits := r.uintN(int(meta))
+		items := make([]string, 0)
+		for i, v := range col.Values {
+			if bits&(1<<uint(i)) != 0 {
+				items = append(items, v)
+			}
+		}
+		return strings.Join(items, ","), r.err
+	case mysqlTypeBit:
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		return int64(r.uintBE((nbits + 7) / 8)), r.err
+	case mysqlTypeBlob, mysqlTypeGeometry, mysqlTypeTinyBlob, mysqlTypeMediumBlob, mysqlTypeLongBlob:
+		data := r.next(int(r.uintN(int(meta))))
+		if typ == mysqlTypeGeometry {
+			return append([]byte(nil), data...), r.err
+		}
+		return binlogText(data, col), r.err
+	case mysqlTypeJSON:
+		data := r.next(int(r.uintN(int(meta))))
+		if r.err != nil {
+			return nil, r.err
+		}
+		if len(data) == 0 {
+			return nil, nil
+		}
+		value, err := decodeMySQLJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		text, err := json.Marshal(value)
+		return string(text), err
+	case mysqlTypeDate:
+		v := r.uintN(3)
+		if v == 0 {
+			return nil, r.err
+		}
+		return fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&15, v&31), r.err
+	case mysqlTypeDatetime:
+		v := r.uint64()
+		if v == 0 {
+			return nil, r.err
+		}
+		d, t := v/1000000, v%1000000
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", d/10000, (d/100)%100, d%100, t/10000, (t/100)%100, t%100), r.err
+	case mysqlTypeTimestamp:
+		sec := r.uint32()
+		if sec == 0 {
+			return nil, r.err
+		}
+		return time.Unix(int64(sec), 0).UTC(), r.err
+	case mysqlTypeTime:
+		v := r.uintN(3)
+		return fmt.Sprintf("%02d:%02d:%02d", v/10000, (v/100)%100, v%100), r.err
+	case mysqlTypeTimestamp2:
+		sec := r.uintBE(4)
+		usec := readBinlogFraction(r, int(meta))
+		if sec == 0 && usec == 0 {
+			return nil, r.err
+		}
+		return time.Unix(int64(sec), int64(usec)*1000).UTC(), r.err
+	case mysqlTypeDatetime2:
+		packed := int64(r.uintBE(5)) - 0x8000000000
+		usec := readBinlogFraction(r, int(meta))
+		if packed == 0 && usec == 0 {
+			return nil, r.err
+		}
+		ymd, hms := packed>>17, packed%(1<<17)
+		ym := ymd >> 5
+		text := fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", ym/13, ym%13, ymd%32, hms>>12, (hms>>6)%64, hms%64)
+		return text + formatBinlogFraction(usec, int(meta)), r.err
+	case mysqlTypeTime2:
+		return readBinlogTime2(r, int(meta))
+	}
+	return nil, fmt.Errorf("tipo de coluna %d nao suportado no cdc", typ)
+}
+
+func binlogText(data []byte, col mysqlColumnInfo) interface{} {
+	if col.Binary {
+		return append([]byte(nil), data...)
+	}
+	return string(data)
+}
+
+// readBinlogFraction le a fracao de segundo (fsp) e retorna em microssegundos.
+func readBinlogFraction(r *binlogReader, fsp int) int {
+	switch fsp {
+	case 1, 2:
+		return int(r.uintBE(1)) * 10000
+	case 3, 4:
+		return int(r.uintBE(2)) * 100
+	case 5, 6:
+		return int(r.uintBE(3))
+	}
+	return 0
+}
+
+func formatBinlogFraction(usec, fsp int) string {
+	if fsp <= 0 {
+		return ""
+	}
+	return "." + fmt.Sprintf("%06d", usec)[:fsp]
+}
+
+func readBinlogTime2(r *binlogReader, fsp int) (interface{}, error) {
+	intpart := int64(r.uintBE(3)) - 0x800000
+	var packed int64
+	switch fsp {
+	case 1, 2:
+		frac := int64(r.uintBE(1))
+		if intpart < 0 && frac != 0 {
+			intpart++
+			frac -= 0x100
+		}
+		packed = intpart<<24 + frac*10000
+	case 3, 4:
+		frac := int64(r.uintBE(2))
+		if intpart < 0 && frac != 0 {
+			intpart++
+			frac -= 0x10000
+		}
+		packed = intpart<<24 + frac*100
+	case 5, 6:
+		// 6 bytes lidos como um unico inteiro com deslocamento
+		frac := int64(r.uintBE(3))
+		packed = ((intpart+0x800000)<<24 | frac) - 0x800000000000
+	default:
+		packed = intpart << 24
+	}
+	sign := ""
+	if packed < 0 {
+		sign = "-"
+		packed = -packed
+	}
+	hms, usec := packed>>24, int(packed%(1<<24))
+	text := fmt.Sprintf("%s%02d:%02d:%02d", sign, (hms>>12)%(1<<10), (hms>>6)%64, hms%64)
+	return text + formatBinlogFraction(usec, fsp), r.err
+}
+
+// readBinlogDecimal decodifica o DECIMAL compactado (grupos de 9 digitos em 4 bytes).
+func readBinlogDecimal(r *binlogReader, precision, scale int) (interface{}, error) {
+	digBytes := [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+	intg := precision - scale
+	intg0, intg0x := intg/9, intg%9
+	frac0, frac0x := scale/9, scale%9
+	size := intg0*4 + digBytes[intg0x] + frac0*4 + digBytes[frac0x]
+	raw := r.next(size)
+	if r.err != nil {
+		return nil, r.err
+	}
+	data := append([]byte(nil), raw...)
+	negative := data[0]&0x80 == 0
+	data[0] ^= 0x80
+	if negative {
+		for i := range data {
+			data[i] ^= 0xff
+		}
+	}
+	d := &binlogReader{buf: data}
+	var b strings.Builder
+	if intg0x > 0 {
+		b.WriteString(strconv.FormatUint(d.uintBE(digBytes[intg0x]), 10))
+	}
+	for i := 0; i < intg0; i++ {
+		b.WriteString(fmt.Sprintf("%09d", d.uintBE(4)))
+	}
+	integer := strings.TrimLeft(b.String(), "0")
+	if integer == "" {
+		integer = "0"
+	}
+	var frac strings.Builder
+	for i := 0; i < frac0; i++ {
+		frac.WriteString(fmt.Sprintf("%09d", d.uintBE(4)))
+	}
+	if frac0x > 0 {
+		frac.WriteString(fmt.Sprintf("%0*d", frac0x, d.uintBE(digBytes[frac0x])))
+	}
+	text := integer
+	if scale > 0 {
+		text += "." + frac.String()
+	}
+	if negative {
+		text = "-" + text
+	}
+	return text, d.err
+}
+
+// decodeMySQLJSON converte o JSON binario do MySQL para valores Go.
+func decodeMySQLJSON(data []byte) (interface{}, error) {
+	return decodeMySQLJSONValue(data[0], data[1:])
+}
+
+func decodeMySQLJSONValue(typ byte, data []byte) (interface{}, error) {
+	r := &binlogReader{buf: data}
+	switch typ {
+	case 0x00, 0x01, 0x02, 0x03:
+		return decodeMySQLJSONContainer(typ, data)
+	case 0x04:
+		switch r.byte() {
+		case 1:
+			return true, r.err
+		case 2:
+			return false, r.err
+		}
+		return nil, r.err
+	case 0x05:
+		return int64(int16(r.uint16())), r.err
+	case 0x06:
+		return int64(r.uint16()), r.err
+	case 0x07:
+		return int64(int32(r.uint32())), r.err
+	case 0x08:
+		return int64(r.uint32()), r.err
+	case 0x09:
+		return int64(r.uint64()), r.err
+	case 0x0a:
+		return r.uint64(), r.err
+	case 0x0b:
+		return math.Float64frombits(r.uint64()), r.err
+	case 0x0c:
+		return string(r.next(int(readJSONVarLen(r)))), r.err
+	case 0x0f:
+		fieldType := r.byte()
+		raw := r.next(int(readJSONVarLen(r)))
+		if r.err != nil {
+			return nil, r.err
+		}
+		if fieldType == mysqlTypeNewDecimal && len(raw) >= 2 {
+			d := &binlogReader{buf: raw[2:]}
+			value, err := readBinlogDecimal(d, int(raw[0]), int(raw[1]))
+			if err != nil {
+				return nil, err
+			}
+			return json.Number(value.(string)), nil
+		}
+		return base64.StdEncoding.EncodeToString(raw), nil
+	}
+	return nil, fmt.Errorf("tipo JSON binario desconhecido: %d", typ)
+}
+
+func readJSONVarLen(r *binlogReader) uint64 {
+	var length uint64
+	for i := 0; i < 5; i++ {
+		b := r.byte()
+		length |= uint64(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return length
+}
+
+func decodeMySQLJSONContainer(typ byte, data []byte) (interface{}, error) {
+	large := typ == 0x01 || typ == 0x03
+	isObject := typ == 0x00 || typ == 0x01
+	width := 2
+	if large {
+		width = 4
+	}
+	r := &binlogReader{buf: data}
+	count := int(r.uintN(width))
+	r.uintN(width) // tamanho total
+
+	keys := make([]string, count)
+	if isObject {
+		for i := 0; i < count; i++ {
+			offset := int(r.uintN(width))
+			length := int(r.uint16())
+			if offset+length > len(data) {
+				return nil, fmt.Errorf("chave JSON fora do limite")
+			}
+			keys[i] = string(data[offset : offset+length])
+		}
+	}
+	values := make([]interface{}, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		valueType := r.byte()
+		entry := r.next(width)
+		var inline bool
+		switch valueType {
+		case 0x04, 0x05, 0x06:
+			inline = true
+		case 0x07, 0x08:
+			inline = large
+		}
+		var err error
+		if inline {
+			values[i], err = decodeMySQLJSONValue(valueType, entry)
+		} else {
+			offset := int((&binlogReader{buf: entry}).uintN(width))
+			if offset > len(data) {
+				return nil, fmt.Errorf("valor JSON fora do limite")
+			}
+			values[i], err = decodeMySQLJSONValue(valueType, data[offset:])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if !isObject {
+		return values, nil
+	}
+	obj := make(map[string]interface{}, count)
+	for i, key := range keys {
+		obj[key] = values[i]
+	}
+	return obj, nil
+}
+
+// mysqlGTIDSet guarda os intervalos [inicio, fim) executados por UUID de servidor.
+type mysqlGTIDSet map[string][][2]uint64
+
+func parseMySQLGTIDSet(text string) (mysqlGTIDSet, error) {
+	set := make(mysqlGTIDSet)
+	text = strings.Join(strings.Fields(text), "")
+	if text == "" {
+		return set, nil
+	}
+	for _, part := range strings.Split(text, ",") {
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("GTID set invalido: %s", part)
+		}
+		sid := strings.ToLower(fields[0])
+		if _, err := hex.DecodeString(strings.ReplaceAll(sid, "-", "")); err != nil || len(strings.ReplaceAll(sid, "-", "")) != 32 {
+			return nil, fmt.Errorf("UUID invalido no GTID set: %s", fields[0])
+		}
+		for _, interval := range fields[1:] {
+			bounds := strings.SplitN(interval, "-", 2)
+			start, err := strconv.ParseUint(bounds[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("intervalo invalido no GTID set: %s (GTIDs com tag nao sao suportados)", interval)
+			}
+			end := start
+			if len(bounds) == 2 {
+				if end, err = strconv.ParseUint(bounds[1], 10, 64); err != nil {
+					return nil, fmt.Errorf("intervalo invalido no GTID set: %s", interval)
+				}
+			}
+			set.addRange(sid, start, end+1)
+		}
+	}
+	return set, nil
+}
+
+func (s mysqlGTIDSet) add(sid string, gno uint64) {
+	s.addRange(strings.ToLower(sid), gno, gno+1)
+}
+
+func (s mysqlGTIDSet) addRange(sid string, start, end uint64) {
+	intervals := append(s[sid], [2]uint64{start, end})
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i][0] < intervals[j][0] })
+	merged := intervals[:1]
+	for _, iv := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if iv[0] <= last[1] {
+			if iv[1] > last[1] {
+				last[1] = iv[1]
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	s[sid] = merged
+}
+
+func (s mysqlGTIDSet) String() string {
+	sids := make([]string, 0, len(s))
+	for sid := range s {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+	parts := make([]string, 0, len(sids))
+	for _, sid := range sids {
+		item := sid
+		for _, iv := range s[sid] {
+			if iv[1]-iv[0] == 1 {
+				item += fmt.Sprintf(":%d", iv[0])
+			} else {
+				item += fmt.Sprintf(":%d-%d", iv[0], iv[1]-1)
+			}
+		}
+		parts = append(parts, item)
+	}
+	return strings.Join(parts, ",")
+}
+
+// encode gera o formato binario do COM_BINLOG_DUMP_GTID.
+func (s mysqlGTIDSet) encode() []byte {
+	sids := make([]string, 0, len(s))
+	for sid := range s {
+		sids = append(sids, sid)
+	}
+	sort.Strings(sids)
+	out := binary.LittleEndian.AppendUint64(nil, uint64(len(sids)))
+	for _, sid := range sids {
+		uuid, _ := hex.DecodeString(strings.ReplaceAll(sid, "-", ""))
+		out = append(out, uuid...)
+		out = binary.LittleEndian.AppendUint64(out, uint64(len(s[sid])))
+		for _, iv := range s[sid] {
+			out = binary.LittleEndian.AppendUint64(out, iv[0])
+			out = binary.LittleEndian.AppendUint64(out, iv[1])
+		}
+	}
+	return out
+}
+
+// formatMySQLUUID formata os 16 bytes do GTID_EVENT como UUID.
+func formatMySQLUUID(b []byte) string {
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,576 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"etl/models"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestReadBinlogDecimal(t *testing.T) {
+	cases := []struct {
+		precision, scale int
+		data             string
+		want             string
+	}{
+		{5, 2, "80 7B 2D", "123.45"},
+		{5, 2, "7F 84 D2", "-123.45"},
+		{14, 4, "81 0D FB 38 D2 04 D2", "1234567890.1234"},
+		{14, 4, "7E F2 04 C7 2D FB 2D", "-1234567890.1234"},
+		{10, 0, "80 00 00 00 00", "0"},
+		{20, 10, "80 00 00 00 00 00 00 00 00 01", "0.0000000001"},
+		{4, 2, "80 05", "0.05"},
+	}
+	for _, tc := range cases {
+		r := &binlogReader{buf: mustHex(t, tc.data)}
+		got, err := readBinlogDecimal(r, tc.precision, tc.scale)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.want, err)
+		}
+		if got != tc.want {
+			t.Errorf("DECIMAL(%d,%d) %s = %v, esperado %s", tc.precision, tc.scale, tc.data, got, tc.want)
+		}
+		if r.remaining() != 0 {
+			t.Errorf("%s: %d bytes nao lidos", tc.want, r.remaining())
+		}
+	}
+	if _, err := readBinlogDecimal(&binlogReader{buf: []byte{0x80}}, 5, 2); err == nil {
+		t.Errorf("decimal truncado: esperado erro")
+	}
+}
+
+func TestReadBinlogValueTemporal(t *testing.T) {
+	cases := []struct {
+		name string
+		typ  byte
+		meta uint16
+		data string
+		want interface{}
+	}{
+		{"date", mysqlTypeDate, 0, "5D D0 0F", "2024-02-29"},
+		{"date zerada", mysqlTypeDate, 0, "00 00 00", nil},
+		{"year", mysqlTypeYear, 0, "7C", int64(2024)},
+		{"year zero", mysqlTypeYear, 0, "00", nil},
+		{"datetime2", mysqlTypeDatetime2, 0, "99 B2 D4 C7 AD", "2024-03-10 12:30:45"},
+		{"datetime2 fsp 3", mysqlTypeDatetime2, 3, "99 63 FF 7E FB 04 CE", "1999-12-31 23:59:59.123"},
+		{"datetime2 zerado", mysqlTypeDatetime2, 0, "80 00 00 00 00", nil},
+		{"timestamp2", mysqlTypeTimestamp2, 0, "65 53 F1 00", time.Unix(1700000000, 0).UTC()},
+		{"timestamp2 fsp 6", mysqlTypeTimestamp2, 6, "65 53 F1 00 03 D0 90", time.Unix(1700000000, 250000000).UTC()},
+		{"timestamp2 zerado", mysqlTypeTimestamp2, 0, "00 00 00 00", nil},
+		{"time2 maximo", mysqlTypeTime2, 0, "B4 6E FB", "838:59:59"},
+		{"time2 negativo", mysqlTypeTime2, 0, "7F EF 7D", "-01:02:03"},
+		{"time2 negativo fsp 2", mysqlTypeTime2, 2, "7F FF FE CE", "-00:00:01.50"},
+		{"time2 negativo fsp 4", mysqlTypeTime2, 4, "7F 5F FF FB 2E", "-10:00:00.1234"},
+		{"time2 fsp 6", mysqlTypeTime2, 6, "80 C8 B8 09 FB F1", "12:34:56.654321"},
+		{"time2 negativo fsp 6", mysqlTypeTime2, 6, "7F FF FF FF FF FF", "-00:00:00.000001"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &binlogReader{buf: mustHex(t, tc.data)}
+			got, err := readBinlogValue(r, tc.typ, tc.meta, mysqlColumnInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("valor = %#v, esperado %#v", got, tc.want)
+			}
+			if r.remaining() != 0 {
+				t.Errorf("%d bytes nao lidos", r.remaining())
+			}
+		})
+	}
+}
+
+func TestReadBinlogValueIntegers(t *testing.T) {
+	cases := []struct {
+		typ      byte
+		data     string
+		unsigned bool
+		want     interface{}
+	}{
+		{mysqlTypeTiny, "FF", false, int64(-1)},
+		{mysqlTypeTiny, "FF", true, int64(255)},
+		{mysqlTypeShort, "00 80", false, int64(-32768)},
+		{mysqlTypeInt24, "FF FF FF", false, int64(-1)},
+		{mysqlTypeInt24, "FF FF FF", true, int64(16777215)},
+		{mysqlTypeLong, "FF FF FF FF", true, int64(4294967295)},
+		{mysqlTypeLongLong, "FF FF FF FF FF FF FF FF", false, int64(-1)},
+		{mysqlTypeLongLong, "FF FF FF FF FF FF FF FF", true, "18446744073709551615"},
+	}
+	for _, tc := range cases {
+		r := &binlogReader{buf: mustHex(t, tc.data)}
+		got, err := readBinlogValue(r, tc.typ, 0, mysqlColumnInfo{Unsigned: tc.unsigned})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("tipo %d %s (unsigned %v) = %#v, esperado %#v", tc.typ, tc.data, tc.unsigned, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeMySQLJSON(t *testing.T) {
+	// {"a":1,"b":[true,"x"],"c":null,"d":12.50} em um objeto pequeno
+	object := []byte{
+		0x00,        // objeto pequeno
+		4, 0, 54, 0, // 4 elementos, 54 bytes
+		32, 0, 1, 0, 33, 0, 1, 0, 34, 0, 1, 0, 35, 0, 1, 0, // chaves
+		0x05, 1, 0, // a: int16 inline
+		0x02, 36, 0, // b: array pequeno no offset 36
+		0x04, 0, 0, // c: null inline
+		0x0f, 48, 0, // d: opaco no offset 48
+		'a', 'b', 'c', 'd',
+		2, 0, 12, 0, 0x04, 1, 0, 0x0c, 10, 0, 1, 'x', // [true,"x"]
+		mysqlTypeNewDecimal, 4, 4, 2, 0x8C, 0x32, // DECIMAL(4,2) 12.50
+	}
+	// [-70000, 70000] em um array grande com inteiros de 32 bits inline
+	large := []byte{0x03, 2, 0, 0, 0, 18, 0, 0, 0}
+	large = append(large, 0x07)
+	large = binary.LittleEndian.AppendUint32(large, uint32(0xFFFEEE90))
+	large = append(large, 0x08)
+	large = binary.LittleEndian.AppendUint32(large, 70000)
+
+	cases := []struct {
+		name string
+		data []byte
+		want interface{}
+	}{
+		{"objeto", object, map[string]interface{}{
+			"a": int64(1),
+			"b": []interface{}{true, "x"},
+			"c": nil,
+			"d": json.Number("12.50"),
+		}},
+		{"array grande", large, []interface{}{int64(-70000), int64(70000)}},
+		{"string", []byte{0x0c, 3, 'a', 'b', 'c'}, "abc"},
+		{"false", []byte{0x04, 2}, false},
+		{"int64", append([]byte{0x09}, binary.LittleEndian.AppendUint64(nil, uint64(math.MaxInt64))...), int64(math.MaxInt64)},
+		{"uint64", append([]byte{0x0a}, binary.LittleEndian.AppendUint64(nil, math.MaxUint64)...), uint64(math.MaxUint64)},
+		{"double", append([]byte{0x0b}, binary.LittleEndian.AppendUint64(nil, math.Float64bits(-2.5))...), -2.5},
+		{"opaco", []byte{0x0f, mysqlTypeBlob, 2, 0xDE, 0xAD}, "3q0="},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeMySQLJSON(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("valor = %#v, esperado %#v", got, tc.want)
+			}
+		})
+	}
+
+	for name, data := range map[string][]byte{
+		"tipo desconhecido": {0x20},
+		"chave fora":        {0x00, 1, 0, 10, 0, 200, 0, 1, 0, 0x04, 1, 0},
+		"valor fora":        {0x02, 1, 0, 10, 0, 0x0c, 200, 0},
+		"string truncada":   {0x0c, 5, 'a'},
+	} {
+		if _, err := decodeMySQLJSON(data); err == nil {
+			t.Errorf("%s: esperado erro", name)
+		}
+	}
+}
+
+func TestMySQLGTIDSet(t *testing.T) {
+	set, err := parseMySQLGTIDSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:7,\n 3e11fa47-71ca-11e1-9e33-c80aa9429563:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,3e11fa47-71ca-11e1-9e33-c80aa9429563:10"
+	if got := set.String(); got != want {
+		t.Errorf("String() = %s, esperado %s", got, want)
+	}
+	set.add("3E11FA47-71CA-11E1-9E33-C80AA9429562", 6)
+	set.add("3e11fa47-71ca-11e1-9e33-c80aa9429563", 11)
+	const merged = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-7,3e11fa47-71ca-11e1-9e33-c80aa9429563:10-11"
+	if got := set.String(); got != merged {
+		t.Errorf("apos add = %s, esperado %s", got, merged)
+	}
+
+	single, err := parseMySQLGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := binary.LittleEndian.AppendUint64(nil, 1)
+	encoded = append(encoded, mustHex(t, "3e11fa4771ca11e19e33c80aa9429562")...)
+	for _, v := range []uint64{2, 1, 6, 7, 8} {
+		encoded = binary.LittleEndian.AppendUint64(encoded, v)
+	}
+	if got := single.encode(); !bytes.Equal(got, encoded) {
+		t.Errorf("encode() = %x, esperado %x", got, encoded)
+	}
+
+	if empty, err := parseMySQLGTIDSet(" "); err != nil || len(empty) != 0 || !bytes.Equal(empty.encode(), make([]byte, 8)) {
+		t.Errorf("GTID set vazio = %v, %v", empty, err)
+	}
+	for _, text := range []string{
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562",
+		"xyz:1",
+		"3e11fa47-71ca-11e1-9e33-c80aa942956:1",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:a",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-b",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:tag:1",
+	} {
+		if _, err := parseMySQLGTIDSet(text); err == nil {
+			t.Errorf("%q: esperado erro", text)
+		}
+	}
+}
+
+// binlogTestColumns descreve a tabela usada nos eventos de teste.
+var binlogTestColumns = []mysqlColumnInfo{
+	{Name: "id", DataType: "int", Unsigned: true},
+	{Name: "nome", DataType: "varchar"},
+	{Name: "valor", DataType: "decimal"},
+	{Name: "status", DataType: "enum", Values: []string{"ativo", "inativo"}},
+	{Name: "criado", DataType: "datetime"},
+}
+
+// tableMapBody monta um TABLE_MAP_EVENT da tabela de teste; optional sao os
+// metadados opcionais ja codificados.
+func tableMapBody(types []byte, meta []byte, optional []byte) []byte {
+	body := []byte{42, 0, 0, 0, 0, 0, 1, 0}
+	body = append(append(append(body, 4), "loja"...), 0)
+	body = append(append(append(body, 8), "clientes"...), 0)
+	body = append(body, byte(len(types)))
+	body = append(body, types...)
+	body = append(body, byte(len(meta)))
+	body = append(body, meta...)
+	body = append(body, make([]byte, (len(types)+7)/8)...)
+	return append(body, optional...)
+}
+
+var (
+	binlogTestTypes = []byte{mysqlTypeLong, mysqlTypeVarchar, mysqlTypeNewDecimal, mysqlTypeString, mysqlTypeDatetime2}
+	binlogTestMeta  = []byte{0x90, 0x01, 5, 2, mysqlTypeEnum, 1, 0}
+)
+
+func binlogColumnNames(names ...string) []byte {
+	field := make([]byte, 0)
+	for _, name := range names {
+		field = append(append(field, byte(len(name))), name...)
+	}
+	return append([]byte{binlogMetaColumnName, byte(len(field))}, field...)
+}
+
+func TestParseTableMapEvent(t *testing.T) {
+	optional := append([]byte{binlogMetaSignedness, 1, 0x80}, binlogColumnNames("id", "nome", "valor", "status", "criado")...)
+	optional = append(optional, 99, 2, 0xAA, 0xBB) // tipo desconhecido e ignorado
+	tableID, tm, err := parseTableMapEvent(tableMapBody(binlogTestTypes, binlogTestMeta, optional))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tableID != 42 || tm.Schema != "loja" || tm.Table != "clientes" {
+		t.Errorf("tabela = %d %s.%s", tableID, tm.Schema, tm.Table)
+	}
+	want := mysqlTableMap{
+		Schema:   "loja",
+		Table:    "clientes",
+		Types:    binlogTestTypes,
+		Meta:     []uint16{0, 400, 5<<8 | 2, uint16(mysqlTypeEnum)<<8 | 1, 0},
+		Names:    []string{"id", "nome", "valor", "status", "criado"},
+		Unsigned: []bool{true, false, false, false, false},
+	}
+	if !reflect.DeepEqual(tm, want) {
+		t.Errorf("table map = %+v, esperado %+v", tm, want)
+	}
+
+	// Sem metadados opcionais (binlog_row_metadata=MINIMAL em versoes antigas)
+	_, tm, err = parseTableMapEvent(tableMapBody(binlogTestTypes, binlogTestMeta, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm.Names != nil || tm.Unsigned != nil {
+		t.Errorf("metadados opcionais inesperados: %+v", tm)
+	}
+
+	if _, _, err := parseTableMapEvent(tableMapBody(binlogTestTypes, binlogTestMeta[:3], nil)); err == nil {
+		t.Errorf("metadados truncados: esperado erro")
+	}
+}
+
+func TestCheckMySQLTableMap(t *testing.T) {
+	_, base, err := parseTableMapEvent(tableMapBody(binlogTestTypes, binlogTestMeta, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withNames := base
+	withNames.Names = []string{"ID", "nome", "valor", "status", "criado"}
+	withSign := base
+	withSign.Unsigned = []bool{true, false, false, false, false}
+
+	renamed := base
+	renamed.Names = []string{"id", "apelido", "valor", "status", "criado"}
+	signed := base
+	signed.Unsigned = []bool{false, false, false, false, false}
+	retyped := base
+	retyped.Types = []byte{mysqlTypeLong, mysqlTypeVarchar, mysqlTypeNewDecimal, mysqlTypeString, mysqlTypeTimestamp2}
+	notEnum := base
+	notEnum.Meta = []uint16{0, 400, 5<<8 | 2, uint16(mysqlTypeString)<<8 | 40, 0}
+	extra := base
+	extra.Types = append(append([]byte(nil), base.Types...), mysqlTypeLong)
+	extra.Meta = append(append([]uint16(nil), base.Meta...), 0)
+
+	unknown := append([]mysqlColumnInfo(nil), binlogTestColumns...)
+	unknown[4].DataType = "vector"
+
+	cases := []struct {
+		name    string
+		tm      mysqlTableMap
+		columns []mysqlColumnInfo
+		wantErr bool
+	}{
+		{"igual", base, binlogTestColumns, false},
+		{"nomes iguais", withNames, binlogTestColumns, false},
+		{"sinal igual", withSign, binlogTestColumns, false},
+		{"tipo desconhecido aceito", retyped, unknown, false},
+		{"coluna renomeada", renamed, binlogTestColumns, true},
+		{"sinal alterado", signed, binlogTestColumns, true},
+		{"tipo alterado", retyped, binlogTestColumns, true},
+		{"enum virou char", notEnum, binlogTestColumns, true},
+		{"coluna adicionada", extra, binlogTestColumns, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkMySQLTableMap(tc.tm, tc.columns)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// binlogTestRow codifica uma linha completa da tabela de teste (nil = NULL).
+func binlogTestRow(id uint32, nome interface{}, valor string, status byte, criado string) []byte {
+	nulls := byte(0)
+	values := binary.LittleEndian.AppendUint32(nil, id)
+	if s, ok := nome.(string); ok {
+		values = binary.LittleEndian.AppendUint16(values, uint16(len(s)))
+		values = append(values, s...)
+	} else {
+		nulls |= 1 << 1
+	}
+	decimal, _ := hex.DecodeString(valor)
+	values = append(values, decimal...)
+	values = append(values, status)
+	if criado != "" {
+		packed, _ := hex.DecodeString(criado)
+		values = append(values, packed...)
+	} else {
+		nulls |= 1 << 4
+	}
+	return append([]byte{nulls}, values...)
+}
+
+func rowsEventBody(eventType byte, rows ...[]byte) []byte {
+	body := []byte{42, 0, 0, 0, 0, 0, 1, 0}
+	if eventType >= binlogWriteRowsV2 {
+		body = append(body, 2, 0)
+	}
+	body = append(body, 5, 0x1F)
+	if eventType == binlogUpdateRowsV1 || eventType == binlogUpdateRowsV2 {
+		body = append(body, 0x1F)
+	}
+	for _, row := range rows {
+		body = append(body, row...)
+	}
+	return body
+}
+
+func TestParseRowsEvent(t *testing.T) {
+	_, tm, err := parseTableMapEvent(tableMapBody(binlogTestTypes, binlogTestMeta, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ana := binlogTestRow(0xFFFFFFFF, "ana", "807B2D", 2, "99B2D4C7AD")
+	bia := binlogTestRow(8, nil, "7F84D2", 1, "")
+	anaRow := map[string]interface{}{"id": int64(4294967295), "nome": "ana", "valor": "123.45", "status": "inativo", "criado": "2024-03-10 12:30:45"}
+	biaRow := map[string]interface{}{"id": int64(8), "nome": nil, "valor": "-123.45", "status": "ativo", "criado": nil}
+
+	cases := []struct {
+		name      string
+		eventType byte
+		rows      [][]byte
+		want      []mysqlRowChange
+	}{
+		{"write v2", binlogWriteRowsV2, [][]byte{ana, bia}, []mysqlRowChange{{After: anaRow}, {After: biaRow}}},
+		{"write v1", binlogWriteRowsV1, [][]byte{ana}, []mysqlRowChange{{After: anaRow}}},
+		{"update v2", binlogUpdateRowsV2, [][]byte{ana, bia}, []mysqlRowChange{{Before: anaRow, After: biaRow}}},
+		{"update v1", binlogUpdateRowsV1, [][]byte{bia, ana}, []mysqlRowChange{{Before: biaRow, After: anaRow}}},
+		{"delete v2", binlogDeleteRowsV2, [][]byte{bia}, []mysqlRowChange{{Before: biaRow}}},
+		{"delete v1", binlogDeleteRowsV1, [][]byte{ana, bia}, []mysqlRowChange{{Before: anaRow}, {Before: biaRow}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRowsEvent(tc.eventType, rowsEventBody(tc.eventType, tc.rows...), tm, binlogTestColumns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("linhas = %+v, esperado %+v", got, tc.want)
+			}
+		})
+	}
+
+	// Imagem parcial (binlog_row_image=MINIMAL): so id e nome presentes
+	partial := []byte{42, 0, 0, 0, 0, 0, 1, 0, 2, 0, 5, 0x03, 0x00, 7, 0, 0, 0, 2, 0, 'j', 'o'}
+	got, err := parseRowsEvent(binlogWriteRowsV2, partial, tm, binlogTestColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []mysqlRowChange{{After: map[string]interface{}{"id": int64(7), "nome": "jo"}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("imagem parcial = %+v, esperado %+v", got, want)
+	}
+
+	if _, err := parseRowsEvent(binlogWriteRowsV2, rowsEventBody(binlogWriteRowsV2, ana[:6]), tm, binlogTestColumns); err == nil {
+		t.Errorf("linha truncada: esperado erro")
+	}
+	if _, err := parseRowsEvent(binlogWriteRowsV2, rowsEventBody(binlogWriteRowsV2, ana), tm, binlogTestColumns[:4]); err == nil {
+		t.Errorf("quantidade de colunas diferente: esperado erro")
+	}
+}
+
+func TestMySQLQueryEventKind(t *testing.T) {
+	cases := map[string]string{
+		"BEGIN":                       "BEGIN",
+		"commit;":                     "COMMIT",
+		" ROLLBACK ":                  "ROLLBACK",
+		"ROLLBACK TO SAVEPOINT sp1":   "SAVEPOINT",
+		"rollback to sp1":             "SAVEPOINT",
+		"SAVEPOINT sp1":               "SAVEPOINT",
+		"RELEASE SAVEPOINT sp1":       "SAVEPOINT",
+		"ALTER TABLE clientes ADD x":  "",
+		"RELEASE":                     "",
+		"":                            "",
+		"BEGINNING_OF_SOMETHING_ELSE": "",
+	}
+	for query, want := range cases {
+		if got := mysqlQueryEventKind(query); got != want {
+			t.Errorf("mysqlQueryEventKind(%q) = %q, esperado %q", query, got, want)
+		}
+	}
+}
+
+func queryEventBody(query string) []byte {
+	body := make([]byte, 8)
+	body = append(body, 4, 0, 0, 0, 0) // schema com 4 letras, sem erro, sem status
+	body = append(append(body, "loja"...), 0)
+	return append(body, query...)
+}
+
+func TestMySQLBinlogStreamTransactions(t *testing.T) {
+	s := &mysqlBinlogStream{
+		schema:    "loja",
+		table:     "clientes",
+		columns:   binlogTestColumns,
+		tables:    make(map[uint64]mysqlTableMap),
+		current:   mysqlBinlogPosition{File: "binlog.000001", Pos: 4},
+		committed: mysqlBinlogPosition{File: "binlog.000001", Pos: 4},
+		batchSize: 1000,
+	}
+	row := binlogTestRow(1, "ana", "807B2D", 1, "")
+	events := []binlogEvent{
+		{Type: binlogQueryEvent, LogPos: 100, Body: queryEventBody("BEGIN")},
+		{Type: binlogTableMapEvent, LogPos: 150, Body: tableMapBody(binlogTestTypes, binlogTestMeta, nil)},
+		{Type: binlogWriteRowsV2, LogPos: 200, Body: rowsEventBody(binlogWriteRowsV2, row)},
+		{Type: binlogXIDEvent, LogPos: 230},
+		// Transacao desfeita: descartada, mas a posicao avanca
+		{Type: binlogQueryEvent, LogPos: 300, Body: queryEventBody("BEGIN")},
+		{Type: binlogWriteRowsV2, LogPos: 350, Body: rowsEventBody(binlogWriteRowsV2, row)},
+		{Type: binlogQueryEvent, LogPos: 380, Body: queryEventBody("SAVEPOINT sp1")},
+		{Type: binlogQueryEvent, LogPos: 400, Body: queryEventBody("ROLLBACK")},
+		// Transacao sem XID (tabela nao transacional) fecha no COMMIT
+		{Type: binlogQueryEvent, LogPos: 500, Body: queryEventBody("BEGIN")},
+		{Type: binlogDeleteRowsV2, LogPos: 550, Body: rowsEventBody(binlogDeleteRowsV2, row)},
+		{Type: binlogQueryEvent, LogPos: 560, Body: queryEventBody("INSERT INTO log VALUES (1)")},
+		{Type: binlogQueryEvent, LogPos: 600, Body: queryEventBody("COMMIT")},
+		// DDL fora de transacao se confirma sozinho
+		{Type: binlogQueryEvent, LogPos: 700, Body: queryEventBody("CREATE TABLE outra (id INT)")},
+	}
+	wantPos := []uint32{4, 4, 4, 230, 230, 230, 230, 400, 400, 400, 400, 600, 700}
+	for i, ev := range events {
+		if err := s.handle(ev); err != nil {
+			t.Fatalf("evento %d: %v", i, err)
+		}
+		if s.committed.Pos != wantPos[i] {
+			t.Errorf("evento %d: posicao confirmada %d, esperado %d", i, s.committed.Pos, wantPos[i])
+		}
+	}
+	if len(s.pending) != 2 {
+		t.Fatalf("%d transacoes pendentes, esperado 2: %+v", len(s.pending), s.pending)
+	}
+	if c := s.pending[0].Changes; len(c) != 1 || c[0].Kind != 'I' || c[0].New["nome"] != "ana" {
+		t.Errorf("primeira transacao = %+v", c)
+	}
+	if c := s.pending[1].Changes; len(c) != 1 || c[0].Kind != 'D' || c[0].Old["id"] != int64(1) {
+		t.Errorf("segunda transacao = %+v", c)
+	}
+
+	// TABLE_MAP com a tabela alterada (coluna renomeada) interrompe o cdc
+	renamed := tableMapBody(binlogTestTypes, binlogTestMeta, binlogColumnNames("id", "apelido", "valor", "status", "criado"))
+	if err := s.handle(binlogEvent{Type: binlogTableMapEvent, LogPos: 800, Body: renamed}); err == nil {
+		t.Errorf("schema divergente: esperado erro")
+	}
+}
+
+func TestMySQLBinlogStreamMasking(t *testing.T) {
+	masker, err := compileMasking([]models.MaskingRule{{Column: "nome", Rule: "hash"}}, map[string]string{defaultMaskingKeyName: "segredo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &mysqlBinlogStream{
+		schema:    "loja",
+		table:     "clientes",
+		columns:   binlogTestColumns,
+		tables:    make(map[uint64]mysqlTableMap),
+		target:    cdcTarget{Keys: []string{"id"}, Masker: masker},
+		current:   mysqlBinlogPosition{File: "binlog.000001", Pos: 4},
+		committed: mysqlBinlogPosition{File: "binlog.000001", Pos: 4},
+		batchSize: 1000,
+	}
+	before := binlogTestRow(1, "ana", "807B2D", 1, "")
+	after := binlogTestRow(1, "bia", "807B2D", 1, "")
+	events := []binlogEvent{
+		{Type: binlogQueryEvent, LogPos: 100, Body: queryEventBody("BEGIN")},
+		{Type: binlogTableMapEvent, LogPos: 150, Body: tableMapBody(binlogTestTypes, binlogTestMeta, nil)},
+		{Type: binlogUpdateRowsV2, LogPos: 200, Body: rowsEventBody(binlogUpdateRowsV2, before, after)},
+		{Type: binlogXIDEvent, LogPos: 230},
+	}
+	for i, ev := range events {
+		if err := s.handle(ev); err != nil {
+			t.Fatalf("evento %d: %v", i, err)
+		}
+	}
+	if len(s.pending) != 1 || len(s.pending[0].Changes) != 1 {
+		t.Fatalf("transacoes pendentes = %+v", s.pending)
+	}
+	c := s.pending[0].Changes[0]
+	want := func(v string) interface{} {
+		rec := map[string]interface{}{"nome": v}
+		masker.apply(rec)
+		return rec["nome"]
+	}
+	if c.Old["nome"] != want("ana") || c.New["nome"] != want("bia") {
+		t.Errorf("nome nao mascarado: antigo %v, novo %v", c.Old["nome"], c.New["nome"])
+	}
+	if c.Old["id"] != int64(1) || c.New["id"] != int64(1) {
+		t.Errorf("chave alterada pelo mascaramento: %v, %v", c.Old["id"], c.New["id"])
+	}
+}
@@ -0,0 +1,456 @@
+package jobrunner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// Escritor Parquet minimo: colunas OPTIONAL planas, encoding PLAIN, sem compressao,
+// uma pagina de dados por coluna em cada row group. O rodape usa o protocolo
+// Thrift compact, montado manualmente para nao depender de bibliotecas externas.
+
+const parquetRowGroupRows = 50000
+
+// Tipos fisicos e convertidos do formato Parquet
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedDate            = 6
+	parquetConvertedTimestampMicros = 10
+)
+
+type parquetColumnChunk struct {
+	physicalType int32
+	name         string
+	numValues    int64
+	offset       int64
+	size         int64
+}
+
+type parquetRowGroup struct {
+	chunks   []parquetColumnChunk
+	numRows  int64
+	byteSize int64
+}
+
+type parquetFileWriter struct {
+	file      *os.File
+	w         *bufio.Writer
+	columns   []exportColumn
+	offset    int64
+	buffered  [][]interface{}
+	rows      int
+	pending   int64
+	totalRows int64
+	groups    []parquetRowGroup
+}
+
+func newParquetFileWriter(path string, columns []exportColumn) (*parquetFileWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	pw := &parquetFileWriter{
+		file:     f,
+		w:        bufio.NewWriterSize(f, 256*1024),
+		columns:  columns,
+		buffered: make([][]interface{}, len(columns)),
+	}
+	if err := pw.writeBytes([]byte("PAR1")); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return pw, nil
+}
+
+func parquetPhysicalType(kind string) int32 {
+	switch kind {
+	case "bool":
+		return parquetBoolean
+	case "int", "timestamp":
+		return parquetInt64
+	case "date":
+		return parquetInt32
+	case "float":
+		return parquetDouble
+	default:
+		return parquetByteArray
+	}
+}
+
+func parquetConvertedType(kind string) int32 {
+	switch kind {
+	case "date":
+		return parquetConvertedDate
+	case "timestamp":
+		return parquetConvertedTimestampMicros
+	case "bool", "int", "float":
+		return -1
+	default:
+		return parquetConvertedUTF8
+	}
+}
+
+// parquetValue converte o valor da linha para o tipo fisico da coluna.
+func parquetValue(val interface{}, kind string) (interface{}, error) {
+	switch kind {
+	case "bool":
+		return castValue(val, "bool", "")
+	case "int":
+		return castValue(val, "int", "")
+	case "float":
+		return castValue(val, "float", "")
+	case "timestamp", "date":
+		t, err := parseDateValue(val, "")
+		if err != nil {
+			return nil, err
+		}
+		if kind == "date" {
+			day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			return int32(day.Unix() / 86400), nil
+		}
+		return t.UnixMicro(), nil
+	default:
+		return valueToString(val), nil
+	}
+}
+
+func (pw *parquetFileWriter) writeRow(values []interface{}) error {
+	for i, val := range values {
+		if val == nil {
+			pw.buffered[i] = append(pw.buffered[i], nil)
+			continue
+		}
+		converted, err := parquetValue(val, pw.columns[i].kind)
+		if err != nil {
+			return fmt.Errorf("coluna '%s': %w", pw.columns[i].name, err)
+		}
+		switch v := converted.(type) {
+		case string:
+			pw.pending += int64(len(v)) + 4
+		default:
+			pw.pending += 8
+		}
+		pw.buffered[i] = append(pw.buffered[i], converted)
+	}
+	pw.rows++
+	if pw.rows >= parquetRowGroupRows {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+func (pw *parquetFileWriter) size() int64 {
+	return pw.offset + pw.pending
+}
+
+func (pw *parquetFileWriter) writeBytes(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+func (pw *parquetFileWriter) flushRowGroup() error {
+	if pw.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{numRows: int64(pw.rows), chunks: make([]parquetColumnChunk, len(pw.columns))}
+	for i, col := range pw.columns {
+		values := pw.buffered[i]
+		physical := parquetPhysicalType(col.kind)
+		data := encodeParquetPage(values, physical)
+		header := encodeParquetPageHeader(len(values), len(data))
+
+		chunk := parquetColumnChunk{
+			physicalType: physical,
+			name:         col.name,
+			numValues:    int64(len(values)),
+			offset:       pw.offset,
+			size:         int64(len(header) + len(data)),
+		}
+		if err := pw.writeBytes(header); err != nil {
+			return err
+		}
+		if err := pw.writeBytes(data); err != nil {
+			return err
+		}
+		group.chunks[i] = chunk
+		group.byteSize += chunk.size
+		pw.buffered[i] = pw.buffered[i][:0]
+	}
+	pw.groups = append(pw.groups, group)
+	pw.totalRows += int64(pw.rows)
+	pw.rows = 0
+	pw.pending = 0
+	return nil
+}
+
+func (pw *parquetFileWriter) close() error {
+	err := pw.flushRowGroup()
+	if err == nil {
+		footer := pw.encodeFileMetaData()
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+		for _, chunk := range [][]byte{footer, length[:], []byte("PAR1")} {
+			if err = pw.writeBytes(chunk); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = pw.w.Flush()
+	}
+	if closeErr := pw.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// encodeParquetPage gera niveis de definicao (RLE, largura 1) e os valores nao nulos em PLAIN.
+func encodeParquetPage(values []interface{}, physical int32) []byte {
+	levels := make([]byte, 0, 16)
+	for i := 0; i < len(values); {
+		defined := values[i] != nil
+		run := 1
+		for i+run < len(values) && (values[i+run] != nil) == defined {
+			run++
+		}
+		levels = appendUvarint(levels, uint64(run)<<1)
+		if defined {
+			levels = append(levels, 1)
+		} else {
+			levels = append(levels, 0)
+		}
+		i += run
+	}
+
+	out := make([]byte, 4, 4+len(levels)+8*len(values))
+	binary.LittleEndian.PutUint32(out, uint32(len(levels)))
+	out = append(out, levels...)
+
+	var bits byte
+	var nbits uint
+	for _, val := range values {
+		if val == nil {
+			continue
+		}
+		switch physical {
+		case parquetBoolean:
+			if val.(bool) {
+				bits |= 1 << nbits
+			}
+			nbits++
+			if nbits == 8 {
+				out = append(out, bits)
+				bits, nbits = 0, 0
+			}
+		case parquetInt32:
+			out = binary.LittleEndian.AppendUint32(out, uint32(val.(int32)))
+		case parquetInt64:
+			out = binary.LittleEndian.AppendUint64(out, uint64(val.(int64)))
+		case parquetDouble:
+			out = binary.LittleEndian.AppendUint64(out, math.Float64bits(val.(float64)))
+		default:
+			s := val.(string)
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(s)))
+			out = append(out, s...)
+		}
+	}
+	if nbits > 0 {
+		out = append(out, bits)
+	}
+	return out
+}
+
+func encodeParquetPageHeader(numValues, size int) []byte {
+	t := &thriftCompactWriter{}
+	t.i32(1, 0) // DATA_PAGE
+	t.i32(2, int32(size))
+	t.i32(3, int32(size))
+	t.structBegin(5)
+	t.i32(1, int32(numValues))
+	t.i32(2, 0) // PLAIN
+	t.i32(3, 3) // RLE
+	t.i32(4, 3) // RLE
+	t.structEnd()
+	t.stop()
+	return t.buf
+}
+
+func (pw *parquetFileWriter) encodeFileMetaData() []byte {
+	t := &thriftCompactWriter{}
+	t.i32(1, 1)
+
+	t.listBegin(2, thriftStruct, len(pw.columns)+1)
+	t.elemBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.structEnd()
+	for _, col := range pw.columns {
+		t.elemBegin()
+		t.i32(1, parquetPhysicalType(col.kind))
+		t.i32(3, 1) // OPTIONAL
+		t.binary(4, col.name)
+		if converted := parquetConvertedType(col.kind); converted >= 0 {
+			t.i32(6, converted)
+		}
+		t.structEnd()
+	}
+
+	t.i64(3, pw.totalRows)
+
+	t.listBegin(4, thriftStruct, len(pw.groups))
+	for _, group := range pw.groups {
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(group.chunks))
+		for _, chunk := range group.chunks {
+			t.elemBegin()
+			t.i64(2, chunk.offset)
+			t.structBegin(3)
+			t.i32(1, chunk.physicalType)
+			t.listBegin(2, thriftI32, 2)
+			t.listI32(0) // PLAIN
+			t.listI32(3) // RLE
+			t.listBegin(3, thriftBinary, 1)
+			t.listBinary(chunk.name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, chunk.numValues)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, group.byteSize)
+		t.i64(3, group.numRows)
+		t.structEnd()
+	}
+	t.binary(6, "etl")
+	t.stop()
+	return t.buf
+}
+
+// -------------------- Thrift compact --------------------
+
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+type thriftCompactWriter struct {
+	buf     []byte
+	lastID  int16
+	idStack []int16
+}
+
+func (t *thriftCompactWriter) fieldHeader(id int16, typ byte) {
+	delta := id - t.lastID
+	if delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = appendUvarint(t.buf, zigzag64(int64(id)))
+	}
+	t.lastID = id
+}
+
+func (t *thriftCompactWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.buf = appendUvarint(t.buf, zigzag64(int64(v)))
+}
+
+func (t *thriftCompactWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.buf = appendUvarint(t.buf, zigzag64(v))
+}
+
+func (t *thriftCompactWriter) binary(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.listBinary(s)
+}
+
+func (t *thriftCompactWriter) structBegin(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.elemBegin()
+}
+
+// elemBegin inicia uma struct sem cabecalho de campo (elemento de lista).
+func (t *thriftCompactWriter) elemBegin() {
+	t.idStack = append(t.idStack, t.lastID)
+	t.lastID = 0
+}
+
+func (t *thriftCompactWriter) structEnd() {
+	t.stop()
+	t.lastID = t.idStack[len(t.idStack)-1]
+	t.idStack = t.idStack[:len(t.idStack)-1]
+}
+
+func (t *thriftCompactWriter) stop() {
+	t.buf = append(t.buf, 0)
+}
+
+func (t *thriftCompactWriter) listBegin(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elemType)
+		return
+	}
+	t.buf = append(t.buf, 0xF0|elemType)
+	t.buf = appendUvarint(t.buf, uint64(size))
+}
+
+func (t *thriftCompactWriter) listI32(v int32) {
+	t.buf = appendUvarint(t.buf, zigzag64(int64(v)))
+}
+
+func (t *thriftCompactWriter) listBinary(s string) {
+	t.buf = appendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func zigzag64(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+// exportKindFromDBType mapeia o tipo informado pelo driver para o tipo da coluna exportada.
+func exportKindFromDBType(dbType string) string {
+	dbType = strings.ToUpper(strings.TrimSpace(dbType))
+	switch {
+	case dbType == "":
+		return "string"
+	case strings.Contains(dbType, "INTERVAL"), strings.Contains(dbType, "POINT"):
+		return "string"
+	case strings.Contains(dbType, "BOOL"):
+		return "bool"
+	case isIntDBType(dbType):
+		return "int"
+	case strings.Contains(dbType, "DECIMAL"), strings.Contains(dbType, "NUMERIC"):
+		return "decimal"
+	case isFloatDBType(dbType):
+		return "float"
+	case dbType == "DATE":
+		return "date"
+	case strings.Contains(dbType, "TIMESTAMP"), strings.Contains(dbType, "DATETIME"):
+		return "timestamp"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,263 @@
+package jobrunner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// thriftReader decodifica o protocolo compact em mapas (id do campo -> valor) para
+// conferir o que o escritor gerou sem depender de uma biblioteca Parquet.
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		panic(fmt.Sprintf("varint invalido na posicao %d", r.pos))
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		size := int(r.uvarint())
+		s := string(r.buf[r.pos : r.pos+size])
+		r.pos += size
+		return s
+	case thriftList:
+		head := r.buf[r.pos]
+		r.pos++
+		size := int(head >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		items := make([]interface{}, size)
+		for i := range items {
+			items[i] = r.value(head & 0x0F)
+		}
+		return items
+	case thriftStruct:
+		return r.readStruct()
+	}
+	panic(fmt.Sprintf("tipo thrift %d nao suportado", typ))
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var lastID int16
+	for {
+		head := r.buf[r.pos]
+		r.pos++
+		if head == 0 {
+			return fields
+		}
+		id := lastID + int16(head>>4)
+		if head>>4 == 0 {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(head & 0x0F)
+		lastID = id
+	}
+}
+
+func TestParquetWriterRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.parquet")
+	columns := []exportColumn{
+		{name: "id", kind: "int"},
+		{name: "nome", kind: "string"},
+		{name: "ativo", kind: "bool"},
+		{name: "valor", kind: "float"},
+		{name: "dia", kind: "date"},
+		{name: "criado", kind: "timestamp"},
+	}
+	created := time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC)
+	rows := [][]interface{}{
+		{int64(1), "ana", true, 1.5, "2024-03-10", created},
+		{int64(2), nil, false, nil, nil, nil},
+		{int64(3), "bia", true, -2.25, "1970-01-02", created.Add(time.Second)},
+	}
+
+	pw, err := newParquetFileWriter(path, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := pw.writeRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("magic PAR1 ausente no inicio ou no fim")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLen
+	footer := &thriftReader{buf: data[footerStart : len(data)-8]}
+	meta := footer.readStruct()
+	if footer.pos != footerLen {
+		t.Fatalf("rodape lido ate %d, esperado %d", footer.pos, footerLen)
+	}
+
+	if meta[1] != int64(1) {
+		t.Errorf("version = %v, esperado 1", meta[1])
+	}
+	if meta[3] != int64(len(rows)) {
+		t.Errorf("num_rows = %v, esperado %d", meta[3], len(rows))
+	}
+	if meta[6] != "etl" {
+		t.Errorf("created_by = %v", meta[6])
+	}
+
+	schema := meta[2].([]interface{})
+	if len(schema) != len(columns)+1 {
+		t.Fatalf("schema com %d elementos, esperado %d", len(schema), len(columns)+1)
+	}
+	root := schema[0].(map[int16]interface{})
+	if root[4] != "schema" || root[5] != int64(len(columns)) {
+		t.Errorf("raiz do schema = %v", root)
+	}
+	wantConverted := map[string]interface{}{
+		"nome":   int64(parquetConvertedUTF8),
+		"dia":    int64(parquetConvertedDate),
+		"criado": int64(parquetConvertedTimestampMicros),
+	}
+	for i, col := range columns {
+		elem := schema[i+1].(map[int16]interface{})
+		if elem[4] != col.name {
+			t.Errorf("schema[%d] nome = %v, esperado %s", i+1, elem[4], col.name)
+		}
+		if elem[1] != int64(parquetPhysicalType(col.kind)) {
+			t.Errorf("coluna %s: tipo %v", col.name, elem[1])
+		}
+		if elem[3] != int64(1) {
+			t.Errorf("coluna %s: repetition %v, esperado OPTIONAL", col.name, elem[3])
+		}
+		if elem[6] != wantConverted[col.name] {
+			t.Errorf("coluna %s: converted_type %v, esperado %v", col.name, elem[6], wantConverted[col.name])
+		}
+	}
+
+	groups := meta[4].([]interface{})
+	if len(groups) != 1 {
+		t.Fatalf("%d row groups, esperado 1", len(groups))
+	}
+	group := groups[0].(map[int16]interface{})
+	if group[3] != int64(len(rows)) {
+		t.Errorf("row group num_rows = %v", group[3])
+	}
+	chunks := group[1].([]interface{})
+	if len(chunks) != len(columns) {
+		t.Fatalf("%d column chunks, esperado %d", len(chunks), len(columns))
+	}
+
+	var groupSize int64
+	pages := make([][]byte, len(columns))
+	for i, col := range columns {
+		chunk := chunks[i].(map[int16]interface{})
+		colMeta := chunk[3].(map[int16]interface{})
+		if path := colMeta[3].([]interface{}); len(path) != 1 || path[0] != col.name {
+			t.Errorf("coluna %s: path_in_schema %v", col.name, path)
+		}
+		if colMeta[5] != int64(len(rows)) {
+			t.Errorf("coluna %s: num_values %v", col.name, colMeta[5])
+		}
+		if chunk[2] != colMeta[9] {
+			t.Errorf("coluna %s: file_offset %v difere de data_page_offset %v", col.name, chunk[2], colMeta[9])
+		}
+		offset := int(colMeta[9].(int64))
+		size := int(colMeta[6].(int64))
+		groupSize += int64(size)
+
+		header := &thriftReader{buf: data[offset : offset+size]}
+		page := header.readStruct()
+		if page[1] != int64(0) {
+			t.Errorf("coluna %s: page type %v", col.name, page[1])
+		}
+		dataHeader := page[5].(map[int16]interface{})
+		if dataHeader[1] != int64(len(rows)) {
+			t.Errorf("coluna %s: page num_values %v", col.name, dataHeader[1])
+		}
+		if header.pos+int(page[2].(int64)) != size {
+			t.Errorf("coluna %s: cabecalho (%d) + pagina (%v) != tamanho do chunk (%d)", col.name, header.pos, page[2], size)
+		}
+		pages[i] = data[offset+header.pos : offset+size]
+	}
+	if group[2] != groupSize {
+		t.Errorf("total_byte_size = %v, esperado %d", group[2], groupSize)
+	}
+
+	// Pagina de "id": tres valores definidos, int64 PLAIN
+	ids := pages[0]
+	levelsLen := int(binary.LittleEndian.Uint32(ids))
+	if !bytes.Equal(ids[4:4+levelsLen], []byte{3 << 1, 1}) {
+		t.Errorf("niveis de definicao de id = %v", ids[4:4+levelsLen])
+	}
+	for i, want := range []int64{1, 2, 3} {
+		got := int64(binary.LittleEndian.Uint64(ids[4+levelsLen+8*i:]))
+		if got != want {
+			t.Errorf("id[%d] = %d, esperado %d", i, got, want)
+		}
+	}
+
+	// Pagina de "valor": definido, nulo, definido
+	values := pages[3]
+	levelsLen = int(binary.LittleEndian.Uint32(values))
+	if !bytes.Equal(values[4:4+levelsLen], []byte{1 << 1, 1, 1 << 1, 0, 1 << 1, 1}) {
+		t.Errorf("niveis de definicao de valor = %v", values[4:4+levelsLen])
+	}
+	plain := values[4+levelsLen:]
+	if len(plain) != 16 {
+		t.Fatalf("valor com %d bytes, esperado 16", len(plain))
+	}
+	for i, want := range []float64{1.5, -2.25} {
+		if got := math.Float64frombits(binary.LittleEndian.Uint64(plain[8*i:])); got != want {
+			t.Errorf("valor[%d] = %v, esperado %v", i, got, want)
+		}
+	}
+
+	// Pagina de "nome": strings com prefixo de tamanho
+	names := pages[1]
+	levelsLen = int(binary.LittleEndian.Uint32(names))
+	wantNames := []byte{3, 0, 0, 0, 'a', 'n', 'a', 3, 0, 0, 0, 'b', 'i', 'a'}
+	if got := names[4+levelsLen:]; !bytes.Equal(got, wantNames) {
+		t.Errorf("nome = %v, esperado %v", got, wantNames)
+	}
+
+	// Pagina de "dia": dias desde 1970-01-01 em int32
+	days := pages[4]
+	levelsLen = int(binary.LittleEndian.Uint32(days))
+	wantDay := int32(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+	for i, want := range []int32{wantDay, 1} {
+		if got := int32(binary.LittleEndian.Uint32(days[4+levelsLen+4*i:])); got != want {
+			t.Errorf("dia[%d] = %d, esperado %d", i, got, want)
+		}
+	}
+}
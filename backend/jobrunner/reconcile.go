@@ -0,0 +1,478 @@
+package jobrunner
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultReconcileDetails = 50
+
+// reconcileThrottleRows e o intervalo de linhas lidas da origem entre as esperas dos limites.
+const reconcileThrottleRows = 1000
+
+func (jr *JobRunner) runReconcileJob(jobID string, job models.Job) {
+	log.Printf("Executando job reconcile: %s\n", job.JobName)
+	start := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", start)
+		return
+	}
+
+	logger.AddJob(jr.PipelineLog, logger.JobLog{
+		JobID:       jobID,
+		JobName:     job.JobName,
+		Status:      "running",
+		StopOnError: job.StopOnError,
+		StartedAt:   start,
+		Total:       1,
+		Batches:     make([]logger.BatchLog, 0),
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Name = job.JobName
+		js.Status = "running"
+		js.StartedAt = &start
+		status.NotifySubscribers()
+	})
+
+	result, err := jr.reconcile(jobID, job)
+	if result != nil {
+		logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+			jl.Reconcile = result
+			jl.Processed = result.SourceRows
+		})
+	}
+
+	end := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", end)
+		return
+	}
+	if err == nil && !result.Passed {
+		err = fmt.Errorf("conferencia falhou: %s", reconcileSummary(result))
+	}
+	if err != nil {
+		log.Printf("Erro no job reconcile %s: %v\n", job.ID, err)
+		jr.handleExecutionJobError(jobID, job, err)
+		return
+	}
+
+	jr.recordThrottledTime(jobID, job)
+	jr.recordQueuedTime(jobID)
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Status = "done"
+		jl.EndedAt = end
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Status = "done"
+		js.Processed = 1
+		js.Total = 1
+		js.Progress = 100
+		js.EndedAt = &end
+		status.NotifySubscribers()
+	})
+
+	for _, nextID := range jr.ConnMap[jobID] {
+		jr.RunJob(nextID)
+	}
+}
+
+func (jr *JobRunner) reconcile(jobID string, job models.Job) (*logger.ReconcileResult, error) {
+	if job.Reconcile == nil || strings.TrimSpace(job.Reconcile.DestinationSQL) == "" {
+		return nil, fmt.Errorf("job reconcile sem consulta de destino")
+	}
+	spec := *job.Reconcile
+	sourceSQL := spec.SourceSQL
+	if strings.TrimSpace(sourceSQL) == "" {
+		sourceSQL = job.SelectSQL
+	}
+	sourceSQL = trimReconcileSQL(jr.SubstituteVariables(sourceSQL))
+	destSQL := trimReconcileSQL(jr.SubstituteVariables(spec.DestinationSQL))
+	if sourceSQL == "" {
+		return nil, fmt.Errorf("job reconcile sem consulta de origem")
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(spec.Mode))
+	switch mode {
+	case "", "count":
+		checks := []reconcileMetric{{name: "count", expr: "COUNT(*)"}}
+		return jr.reconcileMetrics(jobID, "count", spec, sourceSQL, destSQL, checks)
+	case "aggregate":
+		if len(spec.Aggregates) == 0 {
+			return nil, fmt.Errorf("modo aggregate exige aggregates")
+		}
+		metrics := make([]reconcileMetric, 0, len(spec.Aggregates))
+		for _, agg := range spec.Aggregates {
+			fn := strings.ToLower(strings.TrimSpace(agg.Func))
+			switch fn {
+			case "sum", "min", "max", "count":
+			default:
+				return nil, fmt.Errorf("funcao '%s' nao suportada (use sum, min, max ou count)", agg.Func)
+			}
+			if strings.TrimSpace(agg.Column) == "" {
+				return nil, fmt.Errorf("agregacao %s sem coluna", fn)
+			}
+			metrics = append(metrics, reconcileMetric{name: fmt.Sprintf("%s(%s)", fn, agg.Column), fn: fn, column: agg.Column})
+		}
+		return jr.reconcileMetrics(jobID, "aggregate", spec, sourceSQL, destSQL, metrics)
+	case "hash":
+		return jr.reconcileHash(jobID, job, spec, sourceSQL, destSQL)
+	default:
+		return nil, fmt.Errorf("modo '%s' desconhecido (use count, aggregate ou hash)", spec.Mode)
+	}
+}
+
+type reconcileMetric struct {
+	name   string
+	expr   string // expressao pronta (count); vazio = fn(coluna) com a coluna citada no dialeto
+	fn     string
+	column string
+}
+
+func (m reconcileMetric) sql(dbType string) string {
+	if m.expr != "" {
+		return m.expr
+	}
+	return fmt.Sprintf("%s(%s)", strings.ToUpper(m.fn), quoteIdentifier(dbType, m.column))
+}
+
+// value formata o resultado da metrica: count e sum sao sempre numericos; min e max
+// podem ser de colunas texto e ficam como vieram.
+func (m reconcileMetric) value(val interface{}) string {
+	if m.fn == "min" || m.fn == "max" {
+		return reconcileValue(val)
+	}
+	return reconcileNumber(reconcileValue(val))
+}
+
+func (jr *JobRunner) reconcileMetrics(jobID, mode string, spec models.ReconcileSpec, sourceSQL, destSQL string, metrics []reconcileMetric) (*logger.ReconcileResult, error) {
+	releaseSlot, waited, err := jr.acquireSourceSlot(jr.ctx)
+	jr.addThrottled(jobID, waited)
+	if err != nil {
+		return nil, err
+	}
+	sourceValues, err := jr.queryReconcileMetrics(jr.SourceDB, normalizeDBTypeFromDSN(jr.SourceDSN), sourceSQL, metrics)
+	releaseSlot()
+	if err != nil {
+		return nil, fmt.Errorf("origem: %w", err)
+	}
+	destValues, err := jr.queryReconcileMetrics(jr.DestinationDB, normalizeDBTypeFromDSN(jr.DestinationDSN), destSQL, metrics)
+	if err != nil {
+		return nil, fmt.Errorf("destino: %w", err)
+	}
+
+	result := &logger.ReconcileResult{Mode: mode, Passed: true}
+	for i, metric := range metrics {
+		check := logger.ReconcileCheck{
+			Name:        metric.name,
+			Source:      metric.value(sourceValues[i]),
+			Destination: metric.value(destValues[i]),
+		}
+		check.Passed = reconcileWithinTolerance(check.Source, check.Destination, spec.Tolerance, spec.TolerancePercent)
+		if !check.Passed {
+			result.Passed = false
+		}
+		if metric.name == "count" {
+			result.SourceRows, _ = strconv.Atoi(check.Source)
+			result.DestinationRows, _ = strconv.Atoi(check.Destination)
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	return result, nil
+}
+
+func (jr *JobRunner) queryReconcileMetrics(db *sql.DB, dbType, query string, metrics []reconcileMetric) ([]interface{}, error) {
+	exprs := make([]string, len(metrics))
+	for i, metric := range metrics {
+		exprs[i] = fmt.Sprintf("%s AS rc_%d", metric.sql(dbType), i)
+	}
+	wrapped := fmt.Sprintf("SELECT %s FROM (%s) rc", strings.Join(exprs, ", "), query)
+	values := make([]interface{}, len(metrics))
+	pointers := make([]interface{}, len(metrics))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := db.QueryRowContext(jr.ctx, wrapped).Scan(pointers...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// reconcileWithinTolerance compara valores numericos com a tolerancia; demais valores
+// precisam ser iguais.
+func reconcileWithinTolerance(source, dest string, tolerance, tolerancePercent float64) bool {
+	if source == dest {
+		return true
+	}
+	s, okS := new(big.Rat).SetString(strings.TrimSpace(source))
+	d, okD := new(big.Rat).SetString(strings.TrimSpace(dest))
+	if !okS || !okD {
+		return false
+	}
+	// Diferenca exata: bigint acima de 2^53 nao pode empatar por arredondamento
+	diffRat := new(big.Rat).Sub(s, d)
+	if diffRat.Sign() == 0 {
+		return true
+	}
+	diff, _ := diffRat.Abs(diffRat).Float64()
+	if diff <= tolerance {
+		return true
+	}
+	sf, _ := s.Float64()
+	return tolerancePercent > 0 && diff <= math.Abs(sf)*tolerancePercent/100
+}
+
+// reconcileHash compara as linhas por chave usando um hash das colunas comparadas.
+func (jr *JobRunner) reconcileHash(jobID string, job models.Job, spec models.ReconcileSpec, sourceSQL, destSQL string) (*logger.ReconcileResult, error) {
+	keys := spec.KeyColumns
+	if len(keys) == 0 {
+		keys = job.PrimaryKeys
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("modo hash exige keyColumns ou PrimaryKeys")
+	}
+	maxDetails := spec.MaxDetails
+	if maxDetails <= 0 {
+		maxDetails = defaultReconcileDetails
+	}
+
+	releaseSlot, waited, err := jr.acquireSourceSlot(jr.ctx)
+	jr.addThrottled(jobID, waited)
+	if err != nil {
+		return nil, err
+	}
+	jobLimiter := newRowRateLimiter(job.MaxRowsPerSecond)
+	throttle := func(rows int) error {
+		waited, err := jr.waitSourceRows(jr.ctx, jobLimiter, rows)
+		jr.addThrottled(jobID, waited)
+		return err
+	}
+	sourceHashes := make(map[string][sha1.Size]byte)
+	sourceRows, err := scanReconcileRows(jr.ctx, jr.SourceDB, sourceSQL, keys, spec.CompareColumns, throttle, func(key string, digest [sha1.Size]byte) {
+		sourceHashes[key] = digest
+	})
+	releaseSlot()
+	if err != nil {
+		return nil, fmt.Errorf("origem: %w", err)
+	}
+
+	result := &logger.ReconcileResult{Mode: "hash", SourceRows: sourceRows}
+	destRows, err := scanReconcileRows(jr.ctx, jr.DestinationDB, destSQL, keys, spec.CompareColumns, nil, func(key string, digest [sha1.Size]byte) {
+		sourceDigest, ok := sourceHashes[key]
+		if !ok {
+			result.ExtraCount++
+			result.ExtraKeys = appendReconcileKey(result, result.ExtraKeys, key, maxDetails)
+			return
+		}
+		delete(sourceHashes, key)
+		if sourceDigest != digest {
+			result.DifferingCount++
+			result.DifferingKeys = appendReconcileKey(result, result.DifferingKeys, key, maxDetails)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("destino: %w", err)
+	}
+	result.DestinationRows = destRows
+
+	missing := make([]string, 0, len(sourceHashes))
+	for key := range sourceHashes {
+		missing = append(missing, key)
+	}
+	sort.Strings(missing)
+	result.MissingCount = len(missing)
+	for _, key := range missing {
+		result.MissingKeys = appendReconcileKey(result, result.MissingKeys, key, maxDetails)
+	}
+	mismatches := result.MissingCount + result.ExtraCount + result.DifferingCount
+	result.Passed = mismatches <= spec.MaxMismatches
+	return result, nil
+}
+
+func appendReconcileKey(result *logger.ReconcileResult, list []string, key string, max int) []string {
+	if len(list) >= max {
+		result.Truncated = true
+		return list
+	}
+	return append(list, key)
+}
+
+// scanReconcileRows le a consulta e entrega a chave e o hash das colunas comparadas de cada linha.
+// throttle, quando informado, recebe a quantidade de linhas lidas a cada reconcileThrottleRows.
+func scanReconcileRows(ctx context.Context, db *sql.DB, query string, keys, compare []string, throttle func(rows int) error, handle func(key string, digest [sha1.Size]byte)) (int, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	// Normalizacao por tipo da coluna: so colunas numericas tem 10.50 igual a 10.5
+	kinds := make([]string, len(columns))
+	for i, ct := range columnTypes {
+		kinds[i] = exportKindFromDBType(ct.DatabaseTypeName())
+	}
+	positions := make(map[string]int, len(columns))
+	for i, col := range columns {
+		positions[strings.ToLower(col)] = i
+	}
+	keyIdx, err := reconcileColumnIndexes(positions, keys)
+	if err != nil {
+		return 0, err
+	}
+	var compareIdx []int
+	if len(compare) > 0 {
+		if compareIdx, err = reconcileColumnIndexes(positions, compare); err != nil {
+			return 0, err
+		}
+	} else {
+		isKey := make(map[int]bool, len(keyIdx))
+		for _, idx := range keyIdx {
+			isKey[idx] = true
+		}
+		// Ordem alfabetica: origem e destino podem listar as colunas em ordens diferentes
+		names := make([]string, 0, len(columns))
+		for i, col := range columns {
+			if !isKey[i] {
+				names = append(names, strings.ToLower(col))
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			compareIdx = append(compareIdx, positions[name])
+		}
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	count := 0
+	keyParts := make([]string, len(keyIdx))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return count, err
+		}
+		count++
+		if throttle != nil && count%reconcileThrottleRows == 0 {
+			if err := throttle(reconcileThrottleRows); err != nil {
+				return count, err
+			}
+		}
+		for i, idx := range keyIdx {
+			keyParts[i] = reconcileColumnValue(values[idx], kinds[idx])
+		}
+		h := sha1.New()
+		for _, idx := range compareIdx {
+			if values[idx] == nil {
+				h.Write([]byte{0})
+			} else {
+				h.Write([]byte(reconcileColumnValue(values[idx], kinds[idx])))
+			}
+			h.Write([]byte{0x1f})
+		}
+		var digest [sha1.Size]byte
+		copy(digest[:], h.Sum(nil))
+		handle(strings.Join(keyParts, "|"), digest)
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	if throttle != nil && count%reconcileThrottleRows > 0 {
+		return count, throttle(count % reconcileThrottleRows)
+	}
+	return count, nil
+}
+
+func reconcileColumnIndexes(positions map[string]int, names []string) ([]int, error) {
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		idx, ok := positions[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("coluna '%s' nao encontrada no resultado", name)
+		}
+		indexes[i] = idx
+	}
+	return indexes, nil
+}
+
+// reconcileValue converte o valor para texto sem perder precisao ([]byte e string,
+// datas em UTC). Numeros so sao normalizados por reconcileNumber.
+func reconcileValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05.999999")
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	return valueToString(val)
+}
+
+// reconcileColumnValue normaliza o valor conforme o tipo da coluna: numeros pelo valor
+// decimal exato (10.50 e 10.5) e datas em UTC; texto fica como veio ("007" e "7" diferem).
+func reconcileColumnValue(val interface{}, kind string) string {
+	switch kind {
+	case "int", "decimal", "float":
+		return reconcileNumber(reconcileValue(val))
+	case "date", "timestamp":
+		return deleteSyncTimeValue(val)
+	}
+	return reconcileValue(val)
+}
+
+// reconcileNumber reescreve um numero em decimal canonico sem passar por float64:
+// bigint acima de 2^53 e NUMERIC longos continuam exatos. Texto nao numerico volta igual.
+func reconcileNumber(text string) string {
+	r, ok := parseDecimal(text)
+	if !ok {
+		return text
+	}
+	return formatDecimal(r)
+}
+
+func reconcileSummary(result *logger.ReconcileResult) string {
+	if result.Mode == "hash" {
+		return fmt.Sprintf("%d faltando no destino, %d sobrando no destino, %d divergentes",
+			result.MissingCount, result.ExtraCount, result.DifferingCount)
+	}
+	failed := make([]string, 0)
+	for _, check := range result.Checks {
+		if !check.Passed {
+			failed = append(failed, fmt.Sprintf("%s origem=%s destino=%s", check.Name, check.Source, check.Destination))
+		}
+	}
+	return strings.Join(failed, "; ")
+}
+
+// trimReconcileSQL remove o ponto e virgula final para a consulta poder virar subconsulta.
+func trimReconcileSQL(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), "; \n\t")
+}
@@ -0,0 +1,440 @@
+package jobrunner
+
+import (
+	"etl/models"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rowPipeline aplica as transformacoes declaradas no job em cada linha lida,
+// antes do envio para os writers. E compilado uma vez por job.
+type rowPipeline struct {
+	steps []rowTransform
+}
+
+type rowTransform struct {
+	step        models.TransformStep
+	kind        string
+	target      string
+	regex       *regexp.Regexp
+	inputLayout string
+	outLayout   string
+	template    []templatePart
+}
+
+type templatePart struct {
+	literal string
+	column  string
+}
+
+var templateColumnRegex = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// Formatos tentados quando o job nao informa inputFormat.
+var defaultDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"02/01/2006 15:04:05",
+	"02/01/2006",
+}
+
+// compileRowPipeline valida as transformacoes. Retorna nil quando o job nao tem transformacoes.
+func compileRowPipeline(steps []models.TransformStep, substitute func(string) string) (*rowPipeline, error) {
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	if substitute == nil {
+		substitute = func(s string) string { return s }
+	}
+
+	pipeline := &rowPipeline{steps: make([]rowTransform, 0, len(steps))}
+	for i, step := range steps {
+		step.Value = substitute(step.Value)
+		step.Replacement = substitute(step.Replacement)
+		step.Expression = substitute(step.Expression)
+
+		t := rowTransform{
+			step:   step,
+			kind:   strings.ToLower(strings.TrimSpace(step.Type)),
+			target: strings.TrimSpace(step.Target),
+		}
+		if t.target == "" {
+			t.target = step.Column
+		}
+
+		switch t.kind {
+		case "rename":
+			if step.Column == "" || strings.TrimSpace(step.Target) == "" {
+				return nil, fmt.Errorf("transformacao %d (rename): informe column e target", i+1)
+			}
+		case "cast":
+			if step.Column == "" {
+				return nil, fmt.Errorf("transformacao %d (cast): informe column", i+1)
+			}
+			switch strings.ToLower(step.To) {
+			case "int", "integer", "bigint", "float", "decimal", "numeric", "string", "text", "bool", "boolean", "date", "datetime", "timestamp":
+			default:
+				return nil, fmt.Errorf("transformacao %d (cast): tipo '%s' nao suportado", i+1, step.To)
+			}
+			t.inputLayout = convertDateLayout(step.InputFormat)
+		case "trim":
+		case "default":
+			if step.Column == "" {
+				return nil, fmt.Errorf("transformacao %d (default): informe column", i+1)
+			}
+		case "concat":
+			if len(step.Columns) == 0 || t.target == "" {
+				return nil, fmt.Errorf("transformacao %d (concat): informe columns e target", i+1)
+			}
+		case "regex-replace":
+			if step.Column == "" || step.Pattern == "" {
+				return nil, fmt.Errorf("transformacao %d (regex-replace): informe column e pattern", i+1)
+			}
+			re, err := regexp.Compile(step.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("transformacao %d (regex-replace): regex invalida: %v", i+1, err)
+			}
+			t.regex = re
+		case "date-format":
+			if step.Column == "" || step.Format == "" {
+				return nil, fmt.Errorf("transformacao %d (date-format): informe column e format", i+1)
+			}
+			t.inputLayout = convertDateLayout(step.InputFormat)
+			t.outLayout = convertDateLayout(step.Format)
+		case "compute":
+			if t.target == "" || strings.TrimSpace(step.Expression) == "" {
+				return nil, fmt.Errorf("transformacao %d (compute): informe target e expression", i+1)
+			}
+			t.template = parseTemplate(step.Expression)
+		default:
+			return nil, fmt.Errorf("transformacao %d: tipo '%s' desconhecido", i+1, step.Type)
+		}
+		pipeline.steps = append(pipeline.steps, t)
+	}
+	return pipeline, nil
+}
+
+// apply transforma a linha no proprio map.
+func (p *rowPipeline) apply(rec map[string]interface{}) error {
+	if p == nil {
+		return nil
+	}
+	for i := range p.steps {
+		if err := p.steps[i].apply(rec); err != nil {
+			return fmt.Errorf("transformacao %d (%s): %w", i+1, p.steps[i].kind, err)
+		}
+	}
+	return nil
+}
+
+func (t *rowTransform) apply(rec map[string]interface{}) error {
+	step := t.step
+	switch t.kind {
+	case "rename":
+		val, ok := rec[step.Column]
+		if !ok {
+			return fmt.Errorf("coluna '%s' nao encontrada", step.Column)
+		}
+		delete(rec, step.Column)
+		rec[t.target] = val
+	case "cast":
+		val, err := castValue(rec[step.Column], strings.ToLower(step.To), t.inputLayout)
+		if err != nil {
+			return fmt.Errorf("coluna '%s': %w", step.Column, err)
+		}
+		rec[step.Column] = val
+	case "trim":
+		if step.Column != "" {
+			rec[step.Column] = trimValue(rec[step.Column], step.Value)
+			return nil
+		}
+		for col, val := range rec {
+			rec[col] = trimValue(val, step.Value)
+		}
+	case "default":
+		if val, ok := rec[step.Column]; !ok || val == nil {
+			rec[step.Column] = step.Value
+		}
+	case "concat":
+		parts := make([]string, 0, len(step.Columns))
+		for _, col := range step.Columns {
+			val, ok := rec[col]
+			if !ok {
+				return fmt.Errorf("coluna '%s' nao encontrada", col)
+			}
+			if val == nil {
+				continue
+			}
+			parts = append(parts, valueToString(val))
+		}
+		rec[t.target] = strings.Join(parts, step.Value)
+	case "regex-replace":
+		val := rec[step.Column]
+		if val == nil {
+			return nil
+		}
+		rec[step.Column] = t.regex.ReplaceAllString(valueToString(val), step.Replacement)
+	case "date-format":
+		val := rec[step.Column]
+		if val == nil {
+			return nil
+		}
+		parsed, err := parseDateValue(val, t.inputLayout)
+		if err != nil {
+			return fmt.Errorf("coluna '%s': %w", step.Column, err)
+		}
+		rec[step.Column] = parsed.Format(t.outLayout)
+	case "compute":
+		var b strings.Builder
+		for _, part := range t.template {
+			if part.column == "" {
+				b.WriteString(part.literal)
+				continue
+			}
+			val, ok := rec[part.column]
+			if !ok {
+				return fmt.Errorf("coluna '%s' nao encontrada", part.column)
+			}
+			if val != nil {
+				b.WriteString(valueToString(val))
+			}
+		}
+		rec[t.target] = b.String()
+	}
+	return nil
+}
+
+func parseTemplate(expr string) []templatePart {
+	parts := make([]templatePart, 0)
+	last := 0
+	for _, loc := range templateColumnRegex.FindAllStringSubmatchIndex(expr, -1) {
+		if loc[0] > last {
+			parts = append(parts, templatePart{literal: expr[last:loc[0]]})
+		}
+		parts = append(parts, templatePart{column: expr[loc[2]:loc[3]]})
+		last = loc[1]
+	}
+	if last < len(expr) {
+		parts = append(parts, templatePart{literal: expr[last:]})
+	}
+	return parts
+}
+
+func trimValue(val interface{}, cutset string) interface{} {
+	var s string
+	switch v := val.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return val
+	}
+	if cutset == "" {
+		return strings.TrimSpace(s)
+	}
+	return strings.Trim(s, cutset)
+}
+
+func valueToString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// parseDecimal le um numero decimal (com expoente opcional) sem passar por float64.
+func parseDecimal(text string) (*big.Rat, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.ContainsAny(text, "/_xXoObB") {
+		return nil, false
+	}
+	return new(big.Rat).SetString(text)
+}
+
+// formatDecimal escreve o valor em decimal canonico ("10.5", "-3", "0.00001").
+// Fracoes sem representacao decimal finita (1/3) ficam com 20 casas.
+func formatDecimal(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	// Valores decimais tem denominador 2^a*5^b: max(a, b) casas representam o valor exato
+	den := new(big.Int).Set(r.Denom())
+	rem := new(big.Int)
+	places := 0
+	for _, factor := range []int64{2, 5} {
+		f := big.NewInt(factor)
+		count := 0
+		for {
+			q, m := new(big.Int).QuoRem(den, f, rem)
+			if m.Sign() != 0 {
+				break
+			}
+			den = q
+			count++
+		}
+		if count > places {
+			places = count
+		}
+	}
+	if den.Cmp(big.NewInt(1)) != 0 {
+		places = 20
+	}
+	return strings.TrimRight(strings.TrimRight(r.FloatString(places), "0"), ".")
+}
+
+// castValue converte o valor para o tipo pedido. Os erros nao citam o valor, que pode
+// estar em uma coluna com regra de mascaramento.
+func castValue(val interface{}, to, inputLayout string) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+	switch to {
+	case "string", "text":
+		return valueToString(val), nil
+	case "int", "integer", "bigint":
+		switch v := val.(type) {
+		case int64:
+			return v, nil
+		case int:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case float32:
+			val = float64(v)
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		if f, ok := val.(float64); ok {
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return nil, fmt.Errorf("valor nao e inteiro")
+			}
+			return int64(f), nil
+		}
+		s := strings.TrimSpace(valueToString(val))
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		// "10.00" e "1e3" sao inteiros; "3.7" nao e truncado
+		r, ok := parseDecimal(strings.Replace(s, ",", ".", 1))
+		if !ok || !r.IsInt() || !r.Num().IsInt64() {
+			return nil, fmt.Errorf("valor nao e inteiro")
+		}
+		return r.Num().Int64(), nil
+	case "float":
+		switch v := val.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		}
+		s := strings.TrimSpace(valueToString(val))
+		f, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+		if err != nil {
+			return nil, fmt.Errorf("valor nao e numerico")
+		}
+		return f, nil
+	case "decimal", "numeric":
+		// Decimal fica em texto canonico exato, sem passar por float64
+		switch v := val.(type) {
+		case int64, int, int32:
+			return valueToString(v), nil
+		case *big.Rat:
+			return formatDecimal(v), nil
+		}
+		s := strings.TrimSpace(valueToString(val))
+		r, ok := parseDecimal(strings.Replace(s, ",", ".", 1))
+		if !ok {
+			return nil, fmt.Errorf("valor nao e numerico")
+		}
+		return formatDecimal(r), nil
+	case "bool", "boolean":
+		switch v := val.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		}
+		s := valueToString(val)
+		b, ok := parseDBBool(s)
+		if !ok {
+			return nil, fmt.Errorf("valor nao e booleano")
+		}
+		return b, nil
+	case "date":
+		t, err := parseDateValue(val, inputLayout)
+		if err != nil {
+			return nil, err
+		}
+		return t.Format("2006-01-02"), nil
+	case "datetime", "timestamp":
+		return parseDateValue(val, inputLayout)
+	}
+	return nil, fmt.Errorf("tipo '%s' nao suportado", to)
+}
+
+func parseDateValue(val interface{}, layout string) (time.Time, error) {
+	if t, ok := val.(time.Time); ok {
+		return t, nil
+	}
+	s := strings.TrimSpace(valueToString(val))
+	if layout != "" {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("data fora do formato informado")
+		}
+		return t, nil
+	}
+	for _, l := range defaultDateLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("data em formato nao reconhecido")
+}
+
+// convertDateLayout aceita formatos no estilo YYYY-MM-DD HH:mm:ss e converte para o layout do Go.
+// Layouts do Go (2006-01-02) sao mantidos.
+func convertDateLayout(format string) string {
+	format = strings.TrimSpace(format)
+	if format == "" || strings.Contains(format, "2006") {
+		return format
+	}
+	replacer := strings.NewReplacer(
+		"YYYY", "2006",
+		"YY", "06",
+		"MM", "01",
+		"DD", "02",
+		"HH", "15",
+		"mm", "04",
+		"ss", "05",
+		"SSS", "000",
+	)
+	return replacer.Replace(format)
+}
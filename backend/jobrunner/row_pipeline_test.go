@@ -0,0 +1,207 @@
+package jobrunner
+
+import (
+	"etl/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCastValue(t *testing.T) {
+	cases := []struct {
+		val    interface{}
+		to     string
+		layout string
+		want   interface{}
+	}{
+		{nil, "int", "", nil},
+		{"42", "int", "", int64(42)},
+		{[]byte(" -7 "), "int", "", int64(-7)},
+		{"10.00", "int", "", int64(10)},
+		{"10,0", "int", "", int64(10)},
+		{"1e3", "int", "", int64(1000)},
+		{12.0, "int", "", int64(12)},
+		{float32(3), "integer", "", int64(3)},
+		{int32(5), "bigint", "", int64(5)},
+		{true, "int", "", int64(1)},
+		{"1.5", "float", "", 1.5},
+		{"2,25", "float", "", 2.25},
+		{int64(3), "float", "", 3.0},
+		{"19.90", "decimal", "", "19.9"},
+		{"0.1", "numeric", "", "0.1"},
+		{"12345678901234567890.123456789", "decimal", "", "12345678901234567890.123456789"},
+		{"10,50", "decimal", "", "10.5"},
+		{"1.5e2", "decimal", "", "150"},
+		{0.1, "decimal", "", "0.1"},
+		{int64(7), "decimal", "", "7"},
+		{int64(7), "string", "", "7"},
+		{[]byte("abc"), "text", "", "abc"},
+		{"true", "bool", "", true},
+		{"0", "boolean", "", false},
+		{int64(2), "bool", "", true},
+		{"2024-03-10 12:30:00", "date", "", "2024-03-10"},
+		{"10/03/2024", "date", "02/01/2006", "2024-03-10"},
+		{"10/03/2024 08:15", "timestamp", "02/01/2006 15:04", time.Date(2024, 3, 10, 8, 15, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		got, err := castValue(tc.val, tc.to, tc.layout)
+		if err != nil {
+			t.Errorf("castValue(%#v, %s): %v", tc.val, tc.to, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("castValue(%#v, %s) = %#v, esperado %#v", tc.val, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestCastValueErrors(t *testing.T) {
+	cases := []struct {
+		val interface{}
+		to  string
+	}{
+		{"3.7", "int"},
+		{3.7, "int"},
+		{"abc", "int"},
+		{"99999999999999999999", "int"},
+		{1e19, "int"},
+		{"1/2", "decimal"},
+		{"0x10", "decimal"},
+		{"abc", "numeric"},
+		{"abc", "float"},
+		{"talvez", "bool"},
+		{"31/02/2024", "date"},
+		{"x", "uuid"},
+	}
+	for _, tc := range cases {
+		got, err := castValue(tc.val, tc.to, "")
+		if err == nil {
+			t.Errorf("castValue(%#v, %s) = %#v, esperado erro", tc.val, tc.to, got)
+			continue
+		}
+		if s, ok := tc.val.(string); ok && strings.Contains(err.Error(), s) {
+			t.Errorf("castValue(%#v, %s): erro cita o valor: %v", tc.val, tc.to, err)
+		}
+	}
+}
+
+func TestConvertDateLayout(t *testing.T) {
+	cases := map[string]string{
+		"":                          "",
+		"YYYY-MM-DD":                "2006-01-02",
+		"DD/MM/YYYY HH:mm:ss":       "02/01/2006 15:04:05",
+		"DD/MM/YY":                  "02/01/06",
+		"YYYY-MM-DD HH:mm:ss.SSS":   "2006-01-02 15:04:05.000",
+		"2006-01-02T15:04:05Z07:00": "2006-01-02T15:04:05Z07:00",
+		" YYYYMMDD ":                "20060102",
+	}
+	for format, want := range cases {
+		if got := convertDateLayout(format); got != want {
+			t.Errorf("convertDateLayout(%q) = %q, esperado %q", format, got, want)
+		}
+	}
+}
+
+func TestRowPipelineApply(t *testing.T) {
+	pipeline, err := compileRowPipeline([]models.TransformStep{
+		{Type: "rename", Column: "nm", Target: "nome"},
+		{Type: "trim", Column: "nome"},
+		{Type: "trim", Column: "doc", Value: "."},
+		{Type: "cast", Column: "qtd", To: "int"},
+		{Type: "cast", Column: "preco", To: "decimal"},
+		{Type: "default", Column: "uf", Value: "${UF_PADRAO}"},
+		{Type: "default", Column: "pais", Value: "BR"},
+		{Type: "concat", Columns: []string{"nome", "obs", "uf"}, Target: "rotulo", Value: "/"},
+		{Type: "regex-replace", Column: "fone", Pattern: `\D`, Replacement: ""},
+		{Type: "date-format", Column: "nascimento", InputFormat: "DD/MM/YYYY", Format: "YYYY-MM-DD"},
+		{Type: "compute", Target: "chave", Expression: "{{ uf }}-{{qtd}}{{obs}}"},
+	}, func(s string) string {
+		if s == "${UF_PADRAO}" {
+			return "SP"
+		}
+		return s
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := map[string]interface{}{
+		"nm":         []byte("  Ana "),
+		"doc":        "..123..",
+		"qtd":        "3",
+		"preco":      []byte("19.90"),
+		"uf":         nil,
+		"pais":       "PT",
+		"obs":        nil,
+		"fone":       "(11) 9999-0000",
+		"nascimento": "10/03/1990",
+	}
+	if err := pipeline.apply(rec); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"nome":       "Ana",
+		"doc":        "123",
+		"qtd":        int64(3),
+		"preco":      "19.9",
+		"uf":         "SP",
+		"pais":       "PT",
+		"obs":        nil,
+		"rotulo":     "Ana/SP",
+		"fone":       "1199990000",
+		"nascimento": "1990-03-10",
+		"chave":      "SP-3",
+	}
+	if !reflect.DeepEqual(rec, want) {
+		t.Errorf("linha = %#v\nesperado %#v", rec, want)
+	}
+
+	// trim sem coluna aplica em todos os textos
+	all, err := compileRowPipeline([]models.TransformStep{{Type: "trim"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = map[string]interface{}{"a": " x ", "b": []byte(" y"), "c": int64(1)}
+	if err := all.apply(rec); err != nil || rec["a"] != "x" || rec["b"] != "y" || rec["c"] != int64(1) {
+		t.Errorf("trim geral = %#v, %v", rec, err)
+	}
+}
+
+func TestRowPipelineErrors(t *testing.T) {
+	invalid := [][]models.TransformStep{
+		{{Type: "rename", Column: "a"}},
+		{{Type: "cast", Column: "a", To: "uuid"}},
+		{{Type: "cast", To: "int"}},
+		{{Type: "default"}},
+		{{Type: "concat", Target: "x"}},
+		{{Type: "regex-replace", Column: "a", Pattern: "("}},
+		{{Type: "date-format", Column: "a"}},
+		{{Type: "compute", Target: "x"}},
+		{{Type: "desconhecido"}},
+	}
+	for i, steps := range invalid {
+		if _, err := compileRowPipeline(steps, nil); err == nil {
+			t.Errorf("caso %d (%s): esperado erro de compilacao", i, steps[0].Type)
+		}
+	}
+
+	runtime := []struct {
+		step models.TransformStep
+		rec  map[string]interface{}
+	}{
+		{models.TransformStep{Type: "rename", Column: "a", Target: "b"}, map[string]interface{}{}},
+		{models.TransformStep{Type: "cast", Column: "a", To: "int"}, map[string]interface{}{"a": "3.7"}},
+		{models.TransformStep{Type: "concat", Columns: []string{"a"}, Target: "b"}, map[string]interface{}{}},
+		{models.TransformStep{Type: "date-format", Column: "a", Format: "YYYY"}, map[string]interface{}{"a": "ontem"}},
+		{models.TransformStep{Type: "compute", Target: "b", Expression: "{{a}}"}, map[string]interface{}{}},
+	}
+	for _, tc := range runtime {
+		pipeline, err := compileRowPipeline([]models.TransformStep{tc.step}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pipeline.apply(tc.rec); err == nil {
+			t.Errorf("%s: esperado erro", tc.step.Type)
+		}
+	}
+}
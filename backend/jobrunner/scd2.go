@@ -0,0 +1,329 @@
+package jobrunner
+
+import (
+	"database/sql"
+	"etl/logger"
+	"etl/models"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Escrita SCD tipo 2 do insert: cada lote consulta, na propria transacao do writer, a
+// versao corrente das chaves recebidas; chaves novas sao inseridas, chaves com mudanca
+// nas colunas rastreadas tem a versao corrente fechada antes da nova ser inserida e as
+// demais sao ignoradas. Usa um unico writer para a mesma chave nao ganhar duas versoes
+// correntes em transacoes paralelas.
+
+const scd2LookupChunk = 500
+
+type scd2Writer struct {
+	jr        *JobRunner
+	destType  string
+	table     string // nome ja com aspas
+	columns   []string
+	keys      []string
+	tracked   []string
+	validFrom string
+	validTo   string
+	current   string
+	effective string // coluna com a data da mudanca (vazio = startedAt)
+	startedAt string
+
+	newRows       int64
+	changedRows   int64
+	unchangedRows int64
+}
+
+// newSCD2Writer valida a configuracao scd2 do job; retorna nil quando o job nao usa scd2.
+func (jr *JobRunner) newSCD2Writer(job models.Job, start time.Time) (*scd2Writer, error) {
+	if job.SCD2 == nil {
+		return nil, nil
+	}
+	spec := *job.SCD2
+	if jobToleratesErrors(job) {
+		return nil, fmt.Errorf("scd2 nao suporta errorMode tolerate")
+	}
+	if len(job.Columns) == 0 {
+		return nil, fmt.Errorf("scd2 requer columns")
+	}
+	table, ok := extractInsertTable(job.InsertSQL)
+	if !ok {
+		return nil, fmt.Errorf("scd2: nao foi possivel identificar a tabela do insert")
+	}
+	destType := normalizeDBTypeFromDSN(jr.DestinationDSN)
+	schema, name := splitSchemaSyncTable(destType, table)
+
+	w := &scd2Writer{
+		jr:        jr,
+		destType:  destType,
+		table:     quoteSchemaSyncTable(destType, schema, name),
+		columns:   job.Columns,
+		keys:      spec.BusinessKeys,
+		validFrom: scd2ColumnOrDefault(spec.ValidFromColumn, "valid_from"),
+		validTo:   scd2ColumnOrDefault(spec.ValidToColumn, "valid_to"),
+		current:   scd2ColumnOrDefault(spec.CurrentColumn, "is_current"),
+		effective: strings.TrimSpace(spec.EffectiveColumn),
+		startedAt: start.UTC().Format("2006-01-02 15:04:05"),
+	}
+	if len(w.keys) == 0 {
+		w.keys = job.PrimaryKeys
+	}
+	if len(w.keys) == 0 {
+		return nil, fmt.Errorf("scd2 requer businessKeys ou primaryKeys")
+	}
+
+	inColumns := make(map[string]bool, len(job.Columns))
+	for _, col := range job.Columns {
+		inColumns[col] = true
+	}
+	for _, col := range []string{w.validFrom, w.validTo, w.current} {
+		if inColumns[col] {
+			return nil, fmt.Errorf("scd2: a coluna %s e preenchida pelo job e nao pode estar em columns", col)
+		}
+	}
+	isKey := make(map[string]bool, len(w.keys))
+	for _, key := range w.keys {
+		if !inColumns[key] {
+			return nil, fmt.Errorf("scd2: chave %s nao esta em columns", key)
+		}
+		isKey[key] = true
+	}
+	if w.effective != "" && !inColumns[w.effective] {
+		return nil, fmt.Errorf("scd2: effectiveColumn %s nao esta em columns", w.effective)
+	}
+	w.tracked = spec.TrackedColumns
+	if len(w.tracked) == 0 {
+		// A data da mudanca muda a cada versao e nao conta como alteracao
+		for _, col := range job.Columns {
+			if !isKey[col] && col != w.effective {
+				w.tracked = append(w.tracked, col)
+			}
+		}
+	}
+	for _, col := range w.tracked {
+		if !inColumns[col] {
+			return nil, fmt.Errorf("scd2: coluna rastreada %s nao esta em columns", col)
+		}
+	}
+	return w, nil
+}
+
+func scd2ColumnOrDefault(column, fallback string) string {
+	if column = strings.TrimSpace(column); column != "" {
+		return column
+	}
+	return fallback
+}
+
+// writeBatch grava o lote na transacao do writer.
+func (w *scd2Writer) writeBatch(tx *sql.Tx, batch []map[string]interface{}) error {
+	// A mesma chave repetida no lote: vale a ultima linha recebida
+	order := make([]string, 0, len(batch))
+	latest := make(map[string]map[string]interface{}, len(batch))
+	keyValues := make(map[string][]interface{}, len(batch))
+	for _, rec := range batch {
+		values := make([]interface{}, len(w.keys))
+		for i, key := range w.keys {
+			values[i] = rec[key]
+		}
+		id := scd2Key(values)
+		if _, seen := latest[id]; !seen {
+			order = append(order, id)
+			keyValues[id] = values
+		}
+		latest[id] = rec
+	}
+
+	current, err := w.loadCurrent(tx, order, keyValues)
+	if err != nil {
+		return fmt.Errorf("scd2: erro ao ler versoes correntes: %w", err)
+	}
+
+	closing := make(map[string][][]interface{}) // data de fechamento -> chaves
+	closingOrder := make([]string, 0)
+	inserts := make([]map[string]interface{}, 0, len(order))
+	var added, changed, unchanged int64
+	for _, id := range order {
+		rec := latest[id]
+		effective := w.effectiveValue(rec)
+		if cur, ok := current[id]; ok {
+			if !w.trackedChanged(cur, rec) {
+				unchanged++
+				continue
+			}
+			if _, ok := closing[effective]; !ok {
+				closingOrder = append(closingOrder, effective)
+			}
+			closing[effective] = append(closing[effective], keyValues[id])
+			changed++
+		} else {
+			added++
+		}
+		row := make(map[string]interface{}, len(rec)+3)
+		for _, col := range w.columns {
+			row[col] = rec[col]
+		}
+		row[w.validFrom] = effective
+		row[w.validTo] = nil
+		row[w.current] = true
+		inserts = append(inserts, row)
+	}
+
+	// Fecha as versoes correntes antes de inserir as novas
+	for _, effective := range closingOrder {
+		keys := closing[effective]
+		for startIdx := 0; startIdx < len(keys); startIdx += scd2LookupChunk {
+			endIdx := startIdx + scd2LookupChunk
+			if endIdx > len(keys) {
+				endIdx = len(keys)
+			}
+			setArgs := []interface{}{effective}
+			placeholder := "?"
+			if w.destType == "postgres" {
+				placeholder = "$1"
+			}
+			where, args := buildKeyInClause(w.destType, w.keys, keys[startIdx:endIdx], setArgs)
+			query := fmt.Sprintf("UPDATE %s SET %s = %s, %s = FALSE WHERE %s = TRUE AND %s",
+				w.table,
+				quoteIdentifier(w.destType, w.validTo), placeholder,
+				quoteIdentifier(w.destType, w.current),
+				quoteIdentifier(w.destType, w.current), where)
+			if _, err := tx.ExecContext(w.jr.ctx, query, args...); err != nil {
+				return fmt.Errorf("scd2: erro ao fechar versoes: %w", err)
+			}
+		}
+	}
+
+	if len(inserts) > 0 {
+		columns := append(append([]string(nil), w.columns...), w.validFrom, w.validTo, w.current)
+		writeJob := models.Job{
+			Columns:   columns,
+			InsertSQL: fmt.Sprintf("INSERT INTO %s (%s)", w.table, quoteSchemaSyncColumns(w.destType, columns)),
+		}
+		insertSQL, args := w.jr.Dialect.BuildInsertQuery(writeJob, inserts)
+		if _, err := tx.ExecContext(w.jr.ctx, insertSQL, args...); err != nil {
+			return err
+		}
+	}
+
+	atomic.AddInt64(&w.newRows, added)
+	atomic.AddInt64(&w.changedRows, changed)
+	atomic.AddInt64(&w.unchangedRows, unchanged)
+	return nil
+}
+
+// loadCurrent le as colunas rastreadas da versao corrente das chaves do lote.
+func (w *scd2Writer) loadCurrent(tx *sql.Tx, order []string, keyValues map[string][]interface{}) (map[string][]interface{}, error) {
+	selectCols := append(append([]string(nil), w.keys...), w.tracked...)
+	current := make(map[string][]interface{}, len(order))
+	for startIdx := 0; startIdx < len(order); startIdx += scd2LookupChunk {
+		endIdx := startIdx + scd2LookupChunk
+		if endIdx > len(order) {
+			endIdx = len(order)
+		}
+		tuples := make([][]interface{}, 0, endIdx-startIdx)
+		for _, id := range order[startIdx:endIdx] {
+			tuples = append(tuples, keyValues[id])
+		}
+		where, args := buildKeyInClause(w.destType, w.keys, tuples, nil)
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = TRUE AND %s",
+			quoteSchemaSyncColumns(w.destType, selectCols), w.table,
+			quoteIdentifier(w.destType, w.current), where)
+		rows, err := tx.QueryContext(w.jr.ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			values := make([]interface{}, len(selectCols))
+			pointers := make([]interface{}, len(values))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+			if err := rows.Scan(pointers...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			current[scd2Key(values[:len(w.keys)])] = values[len(w.keys):]
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+func (w *scd2Writer) trackedChanged(current []interface{}, rec map[string]interface{}) bool {
+	for i, col := range w.tracked {
+		if !scd2Equal(current[i], rec[col]) {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveValue e a data da versao: a coluna configurada ou o inicio do job.
+// Datas vao como texto UTC para o fechamento e a nova versao usarem o mesmo valor.
+func (w *scd2Writer) effectiveValue(rec map[string]interface{}) string {
+	if w.effective == "" || rec[w.effective] == nil {
+		return w.startedAt
+	}
+	if t, ok := rec[w.effective].(time.Time); ok {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	return valueToString(rec[w.effective])
+}
+
+func (w *scd2Writer) result() *logger.SCD2Result {
+	return &logger.SCD2Result{
+		New:       int(atomic.LoadInt64(&w.newRows)),
+		Changed:   int(atomic.LoadInt64(&w.changedRows)),
+		Unchanged: int(atomic.LoadInt64(&w.unchangedRows)),
+	}
+}
+
+// scd2Equal compara uma coluna rastreada da versao corrente com a da origem: datas em
+// UTC e, quando um dos lados e numerico, pelo valor decimal exato (o destino pode
+// devolver 10.50 como texto para o 10.5 da origem). Texto compara como veio.
+func scd2Equal(current, incoming interface{}) bool {
+	if current == nil || incoming == nil {
+		return current == nil && incoming == nil
+	}
+	a := deleteSyncTimeValue(reconcileValue(current))
+	b := deleteSyncTimeValue(reconcileValue(incoming))
+	if a == b {
+		return true
+	}
+	if scd2Numeric(current) || scd2Numeric(incoming) {
+		return reconcileNumber(a) == reconcileNumber(b)
+	}
+	return false
+}
+
+func scd2Numeric(val interface{}) bool {
+	switch val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
+// scd2Key identifica a chave de negocio pelo valor exato; normalizar juntaria chaves
+// distintas (como "007" e "7") na mesma versao.
+func scd2Key(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+			parts[i] = "\x00"
+		case time.Time:
+			parts[i] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			parts[i] = valueToString(value)
+		}
+	}
+	return strings.Join(parts, "\x1f")
+}
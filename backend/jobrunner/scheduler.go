@@ -0,0 +1,175 @@
+package jobrunner
+
+import (
+	"context"
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobScheduler controla quantos jobs pesados rodam ao mesmo tempo.
+// Cada job ocupa "weight" vagas; a fila e ordenada por prioridade (maior primeiro)
+// e, dentro da mesma prioridade, por ordem de chegada. O primeiro da fila sempre
+// tem preferencia, evitando que jobs pesados fiquem esperando indefinidamente.
+type jobScheduler struct {
+	mu       sync.Mutex
+	capacity int
+	inUse    int
+	seq      int64
+	waiting  []*jobTicket
+}
+
+type jobTicket struct {
+	weight   int
+	priority int
+	seq      int64
+	ready    chan struct{}
+	granted  bool
+}
+
+func newJobScheduler(maxParallelJobs int) *jobScheduler {
+	if maxParallelJobs <= 0 {
+		return nil
+	}
+	return &jobScheduler{capacity: maxParallelJobs}
+}
+
+// acquire bloqueia ate haver vagas para o job. Retorna a funcao de liberacao
+// (segura para chamar mais de uma vez) e o tempo aguardado na fila.
+func (s *jobScheduler) acquire(ctx context.Context, weight, priority int, onWait func()) (func(), time.Duration, error) {
+	if s == nil {
+		return func() {}, 0, nil
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	if weight > s.capacity {
+		weight = s.capacity
+	}
+
+	s.mu.Lock()
+	s.seq++
+	ticket := &jobTicket{weight: weight, priority: priority, seq: s.seq, ready: make(chan struct{})}
+	s.waiting = append(s.waiting, ticket)
+	sort.SliceStable(s.waiting, func(i, j int) bool {
+		if s.waiting[i].priority != s.waiting[j].priority {
+			return s.waiting[i].priority > s.waiting[j].priority
+		}
+		return s.waiting[i].seq < s.waiting[j].seq
+	})
+	s.dispatchLocked()
+	granted := ticket.granted
+	s.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() { s.release(weight) })
+	}
+	if granted {
+		return release, 0, nil
+	}
+
+	if onWait != nil {
+		onWait()
+	}
+	start := time.Now()
+	select {
+	case <-ticket.ready:
+		return release, time.Since(start), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if ticket.granted {
+			s.mu.Unlock()
+			release()
+		} else {
+			s.removeLocked(ticket)
+			s.dispatchLocked()
+			s.mu.Unlock()
+		}
+		return func() {}, time.Since(start), ctx.Err()
+	}
+}
+
+func (s *jobScheduler) release(weight int) {
+	s.mu.Lock()
+	s.inUse -= weight
+	if s.inUse < 0 {
+		s.inUse = 0
+	}
+	s.dispatchLocked()
+	s.mu.Unlock()
+}
+
+// dispatchLocked libera os primeiros da fila enquanto houver vagas.
+func (s *jobScheduler) dispatchLocked() {
+	for len(s.waiting) > 0 {
+		head := s.waiting[0]
+		if s.inUse+head.weight > s.capacity {
+			return
+		}
+		s.inUse += head.weight
+		head.granted = true
+		close(head.ready)
+		s.waiting = s.waiting[1:]
+	}
+}
+
+func (s *jobScheduler) removeLocked(ticket *jobTicket) {
+	for i, t := range s.waiting {
+		if t == ticket {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// ApplyJobScheduler configura o limite de jobs paralelos definido no projeto.
+// Deve ser chamado antes de Run.
+func (jr *JobRunner) ApplyJobScheduler(project models.Project) {
+	jr.scheduler = newJobScheduler(project.MaxParallelJobs)
+	if jr.scheduler != nil {
+		log.Printf("Agendador de jobs: maxParallelJobs=%d", project.MaxParallelJobs)
+	}
+}
+
+// acquireJobSlot aguarda vaga no agendador para um job pesado.
+// O tempo em fila fica registrado em QueuedMs no log do job.
+func (jr *JobRunner) acquireJobSlot(jobID string, job models.Job) (func(), error) {
+	onWait := func() {
+		log.Printf("Job %s (%s) aguardando vaga no agendador (prioridade=%d, peso=%d)", job.ID, job.JobName, job.Priority, job.Weight)
+		status.AppendLog(fmt.Sprintf("%s - Job: %s aguardando vaga para execucao", jr.PipelineLog.Project, job.JobName))
+	}
+	release, waited, err := jr.scheduler.acquire(jr.ctx, job.Weight, job.Priority, onWait)
+	jr.addQueued(jobID, waited)
+	return release, err
+}
+
+func (jr *JobRunner) addQueued(jobID string, waited time.Duration) {
+	if waited <= 0 {
+		return
+	}
+	jr.throttleMu.Lock()
+	if jr.queued == nil {
+		jr.queued = make(map[string]time.Duration)
+	}
+	jr.queued[jobID] += waited
+	jr.throttleMu.Unlock()
+}
+
+// recordQueuedTime grava no log do job o tempo aguardado na fila do agendador.
+func (jr *JobRunner) recordQueuedTime(jobID string) {
+	jr.throttleMu.Lock()
+	waited := jr.queued[jobID]
+	jr.throttleMu.Unlock()
+	if waited <= 0 {
+		return
+	}
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.QueuedMs = waited.Milliseconds()
+	})
+}
@@ -0,0 +1,525 @@
+package jobrunner
+
+import (
+	"context"
+	"database/sql"
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SchemaSyncColumn descreve uma coluna da tabela de destino no plano do schema-sync.
+type SchemaSyncColumn struct {
+	Name       string `json:"name"`
+	SourceType string `json:"sourceType,omitempty"` // tipo informado pelo driver de origem
+	TargetType string `json:"targetType"`
+	Nullable   bool   `json:"nullable"`
+	Exists     bool   `json:"exists"` // ja existe na tabela de destino
+}
+
+// SchemaSyncPlan e o DDL gerado para alinhar a tabela do InsertSQL ao SelectSQL.
+type SchemaSyncPlan struct {
+	Table       string             `json:"table"`
+	TableExists bool               `json:"tableExists"`
+	Columns     []SchemaSyncColumn `json:"columns"`
+	Statements  []string           `json:"statements"`
+	Warnings    []string           `json:"warnings,omitempty"`
+	Applied     bool               `json:"applied"`
+	// AppliedStatements conta os comandos ja efetivados; no MySQL o DDL confirma
+	// sozinho e um erro no meio deixa os anteriores aplicados.
+	AppliedStatements int `json:"appliedStatements"`
+}
+
+type schemaSyncExistingColumn struct {
+	DataType string
+	Nullable bool
+}
+
+// PlanSchemaSync le os tipos das colunas do SelectSQL (sem trazer linhas) e monta o
+// CREATE TABLE ou os ALTER TABLE necessarios na tabela do InsertSQL. SQL ja deve
+// vir com as variaveis substituidas; columnTypes forca o tipo de destino por coluna.
+func PlanSchemaSync(ctx context.Context, sourceDB *sql.DB, destDB *sql.DB, destType string, job models.Job, columnTypes map[string]string) (*SchemaSyncPlan, error) {
+	selectSQL := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(job.SelectSQL), ";"))
+	if selectSQL == "" {
+		return nil, fmt.Errorf("schema-sync requer um job com SelectSQL")
+	}
+	_, directives, err := extractMapDirectives(selectSQL)
+	if err != nil {
+		return nil, err
+	}
+	if len(directives) > 0 {
+		return nil, fmt.Errorf("schema-sync nao suporta SelectSQL com diretivas Map")
+	}
+	table, ok := extractInsertTable(job.InsertSQL)
+	if !ok {
+		return nil, fmt.Errorf("nao foi possivel identificar a tabela do InsertSQL")
+	}
+	schema, tableName := splitSchemaSyncTable(destType, table)
+
+	sourceColumns, err := querySchemaColumnTypes(ctx, sourceDB, selectSQL)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler colunas do SelectSQL: %w", err)
+	}
+
+	pkSet := make(map[string]bool, len(job.PrimaryKeys))
+	for _, pk := range job.PrimaryKeys {
+		pkSet[normalizeColumnName(pk)] = true
+	}
+	overrides := make(map[string]string, len(columnTypes))
+	for col, typ := range columnTypes {
+		if strings.TrimSpace(typ) != "" {
+			overrides[normalizeColumnName(col)] = strings.TrimSpace(typ)
+		}
+	}
+
+	plan := &SchemaSyncPlan{Table: table, Columns: make([]SchemaSyncColumn, 0), Statements: make([]string, 0)}
+	byName := make(map[string]*sql.ColumnType, len(sourceColumns))
+	resultNames := make([]string, 0, len(sourceColumns))
+	for _, ct := range sourceColumns {
+		byName[normalizeColumnName(ct.Name())] = ct
+		resultNames = append(resultNames, ct.Name())
+	}
+
+	// Colunas de destino: Columns do job (ou o resultset), mais as anexadas por lookups
+	// e colunas calculadas, que nao tem tipo na origem e viram TEXT
+	targetNames := job.Columns
+	if len(targetNames) == 0 {
+		targetNames = resultNames
+	}
+	seen := make(map[string]bool)
+	addColumn := func(name string) {
+		key := normalizeColumnName(name)
+		if name == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		col := SchemaSyncColumn{Name: name, Nullable: !pkSet[key], TargetType: "TEXT"}
+		if ct, ok := byName[key]; ok {
+			col.SourceType = strings.ToUpper(ct.DatabaseTypeName())
+			col.TargetType = schemaColumnSQLType(destType, ct, pkSet[key])
+		} else if destType == "mysql" && pkSet[key] {
+			col.TargetType = "VARCHAR(255)"
+		}
+		if typ, ok := overrides[key]; ok {
+			col.TargetType = typ
+		}
+		plan.Columns = append(plan.Columns, col)
+	}
+	for _, name := range targetNames {
+		addColumn(strings.TrimSpace(name))
+	}
+	for _, name := range LookupOutputColumns(job.Lookups) {
+		addColumn(name)
+	}
+	for _, cc := range job.ComputedColumns {
+		addColumn(strings.TrimSpace(cc.Name))
+	}
+	for _, pk := range job.PrimaryKeys {
+		if !seen[normalizeColumnName(pk)] {
+			return nil, fmt.Errorf("chave primaria '%s' nao esta entre as colunas de destino", pk)
+		}
+	}
+
+	existing, err := fetchSchemaSyncColumns(ctx, destDB, destType, schema, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler colunas da tabela %s: %w", table, err)
+	}
+	plan.TableExists = len(existing) > 0
+
+	quotedTable := quoteSchemaSyncTable(destType, schema, tableName)
+	if !plan.TableExists {
+		defs := make([]string, 0, len(plan.Columns)+1)
+		for _, col := range plan.Columns {
+			def := quoteIdentifier(destType, col.Name) + " " + col.TargetType
+			if !col.Nullable {
+				def += " NOT NULL"
+			}
+			defs = append(defs, def)
+		}
+		if len(job.PrimaryKeys) > 0 {
+			defs = append(defs, "PRIMARY KEY ("+quoteSchemaSyncColumns(destType, job.PrimaryKeys)+")")
+		}
+		plan.Statements = append(plan.Statements, fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", quotedTable, strings.Join(defs, ",\n  ")))
+		return plan, nil
+	}
+
+	for i := range plan.Columns {
+		col := &plan.Columns[i]
+		current, ok := existing[normalizeColumnName(col.Name)]
+		if !ok {
+			// Coluna nova entra sempre como NULL para nao falhar com linhas existentes
+			plan.Statements = append(plan.Statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quotedTable, quoteIdentifier(destType, col.Name), col.TargetType))
+			if !col.Nullable {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("coluna %s adicionada como NULL: preencha antes de usar como chave", col.Name))
+			}
+			continue
+		}
+		col.Exists = true
+		if !schemaTypesCompatible(col.TargetType, current.DataType) {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("coluna %s: destino %s, origem mapeada para %s (tipo nao alterado)", col.Name, current.DataType, col.TargetType))
+		}
+	}
+
+	if len(job.PrimaryKeys) > 0 {
+		hasPK, err := schemaSyncHasPrimaryKey(ctx, destDB, destType, schema, tableName)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler chave primaria da tabela %s: %w", table, err)
+		}
+		if !hasPK {
+			plan.Statements = append(plan.Statements, fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", quotedTable, quoteSchemaSyncColumns(destType, job.PrimaryKeys)))
+		}
+	}
+	return plan, nil
+}
+
+// ApplySchemaSync executa o DDL do plano na ordem gerada. No Postgres o plano roda em
+// uma transacao (tudo ou nada); no MySQL, que nao desfaz DDL, o erro informa quantos
+// comandos ja foram aplicados.
+func ApplySchemaSync(ctx context.Context, destDB *sql.DB, destType string, plan *SchemaSyncPlan) error {
+	plan.AppliedStatements = 0
+	if destType == "postgres" {
+		tx, err := destDB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range plan.Statements {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("erro ao executar '%s' (nenhum comando aplicado): %w", stmt, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		plan.AppliedStatements = len(plan.Statements)
+		plan.Applied = true
+		return nil
+	}
+
+	for i, stmt := range plan.Statements {
+		if _, err := destDB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("erro ao executar '%s' (%d de %d comando(s) ja aplicado(s)): %w", stmt, i, len(plan.Statements), err)
+		}
+		plan.AppliedStatements = i + 1
+	}
+	plan.Applied = true
+	return nil
+}
+
+// querySchemaColumnTypes executa o SelectSQL sem linhas so para obter os metadados.
+func querySchemaColumnTypes(ctx context.Context, db *sql.DB, selectSQL string) ([]*sql.ColumnType, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM (%s) ss WHERE 1=0", selectSQL))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("consulta sem colunas")
+	}
+	return types, rows.Err()
+}
+
+// schemaColumnSQLType converte o tipo do driver para o DDL do destino, mantendo
+// tamanho e precisao quando o driver informa; o restante segue mapDBTypeToSQLType.
+func schemaColumnSQLType(targetDBType string, ct *sql.ColumnType, primaryKey bool) string {
+	name := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(ct.DatabaseTypeName())), "UNSIGNED ")
+	switch {
+	case name == "VARCHAR", name == "NVARCHAR", name == "CHAR", name == "BPCHAR", name == "NCHAR":
+		length, ok := ct.Length()
+		if ok && length > 0 && length <= 10485760 && !(targetDBType == "mysql" && length > 16383) {
+			if name == "CHAR" || name == "BPCHAR" || name == "NCHAR" {
+				return fmt.Sprintf("CHAR(%d)", length)
+			}
+			return fmt.Sprintf("VARCHAR(%d)", length)
+		}
+		if targetDBType == "mysql" {
+			if primaryKey {
+				return "VARCHAR(255)"
+			}
+			return "LONGTEXT"
+		}
+		return "TEXT"
+	case strings.Contains(name, "TEXT"):
+		if targetDBType == "mysql" {
+			if primaryKey {
+				return "VARCHAR(255)"
+			}
+			return "LONGTEXT"
+		}
+		return "TEXT"
+	case name == "DECIMAL", name == "NUMERIC":
+		precision, scale, ok := ct.DecimalSize()
+		if ok && precision > 0 && precision <= 65 {
+			if targetDBType == "postgres" {
+				return fmt.Sprintf("NUMERIC(%d,%d)", precision, scale)
+			}
+			return fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+		}
+	case name == "INT2", name == "SMALLINT", name == "TINYINT", name == "YEAR":
+		return "SMALLINT"
+	case name == "INT4", name == "INT", name == "INTEGER", name == "MEDIUMINT", name == "SERIAL":
+		if targetDBType == "mysql" {
+			return "INT"
+		}
+		return "INTEGER"
+	case name == "INT8", name == "BIGINT", name == "BIGSERIAL":
+		return "BIGINT"
+	case name == "BYTEA", strings.Contains(name, "BLOB"), strings.Contains(name, "BINARY"):
+		if targetDBType == "postgres" {
+			return "BYTEA"
+		}
+		return "LONGBLOB"
+	case name == "TIMESTAMPTZ":
+		if targetDBType == "postgres" {
+			return "TIMESTAMPTZ"
+		}
+		return "DATETIME(6)"
+	case name == "TIMESTAMP":
+		// TIMESTAMP do MySQL tem faixa menor e atualizacao automatica
+		if targetDBType == "mysql" {
+			return "DATETIME(6)"
+		}
+		return "TIMESTAMP"
+	}
+	return mapDBTypeToSQLType(targetDBType, name)
+}
+
+// schemaTypesCompatible compara o tipo planejado com o data_type do information_schema
+// pela familia (texto, inteiro, numerico...), ignorando tamanho e precisao.
+func schemaTypesCompatible(planned, current string) bool {
+	return schemaTypeFamily(planned) == schemaTypeFamily(current)
+}
+
+func schemaTypeFamily(typeName string) string {
+	upper := strings.ToUpper(typeName)
+	if idx := strings.Index(upper, "("); idx >= 0 {
+		upper = upper[:idx]
+	}
+	upper = strings.TrimSpace(upper)
+	switch {
+	case strings.Contains(upper, "CHAR"), strings.Contains(upper, "TEXT"):
+		return "text"
+	case strings.Contains(upper, "INTERVAL"):
+		return "interval"
+	case strings.Contains(upper, "INT"), upper == "YEAR":
+		return "integer"
+	case strings.Contains(upper, "DECIMAL"), strings.Contains(upper, "NUMERIC"):
+		return "numeric"
+	case strings.Contains(upper, "DOUBLE"), strings.Contains(upper, "FLOAT"), strings.Contains(upper, "REAL"):
+		return "float"
+	case strings.Contains(upper, "BOOL"), upper == "BIT":
+		return "bool"
+	case strings.Contains(upper, "TIMESTAMP"), strings.Contains(upper, "DATETIME"):
+		return "timestamp"
+	case strings.Contains(upper, "DATE"):
+		return "date"
+	case strings.Contains(upper, "TIME"):
+		return "time"
+	case strings.Contains(upper, "JSON"):
+		return "json"
+	case strings.Contains(upper, "BLOB"), strings.Contains(upper, "BINARY"), upper == "BYTEA":
+		return "binary"
+	default:
+		return upper
+	}
+}
+
+// splitSchemaSyncTable separa schema e tabela do nome extraido do InsertSQL.
+// Nomes sem aspas no Postgres sao convertidos para minusculas, como o banco faz.
+func splitSchemaSyncTable(dbType, table string) (string, string) {
+	parts := make([]string, 0, 2)
+	var b strings.Builder
+	inQuote := false
+	for _, r := range table {
+		switch {
+		case r == '"' || r == '`':
+			inQuote = !inQuote
+			b.WriteRune(r)
+		case r == '.' && !inQuote:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	parts = append(parts, b.String())
+
+	normalize := func(ident string) string {
+		ident = strings.TrimSpace(ident)
+		if len(ident) >= 2 && (ident[0] == '"' || ident[0] == '`') && ident[len(ident)-1] == ident[0] {
+			return ident[1 : len(ident)-1]
+		}
+		if dbType == "postgres" {
+			return strings.ToLower(ident)
+		}
+		return ident
+	}
+	if len(parts) == 1 {
+		return "", normalize(parts[0])
+	}
+	return normalize(parts[len(parts)-2]), normalize(parts[len(parts)-1])
+}
+
+func quoteSchemaSyncTable(dbType, schema, table string) string {
+	if schema == "" {
+		return quoteIdentifier(dbType, table)
+	}
+	return quoteIdentifier(dbType, schema) + "." + quoteIdentifier(dbType, table)
+}
+
+func quoteSchemaSyncColumns(dbType string, columns []string) string {
+	quoted := make([]string, 0, len(columns))
+	for _, col := range columns {
+		quoted = append(quoted, quoteIdentifier(dbType, strings.TrimSpace(col)))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// fetchSchemaSyncColumns retorna as colunas atuais da tabela (vazio = tabela inexistente).
+func fetchSchemaSyncColumns(ctx context.Context, db *sql.DB, dbType, schema, table string) (map[string]schemaSyncExistingColumn, error) {
+	query := `SELECT column_name, data_type, is_nullable FROM information_schema.columns
+WHERE table_schema = COALESCE(NULLIF($1::text, ''), current_schema()) AND table_name = $2`
+	if dbType == "mysql" {
+		query = `SELECT column_name, data_type, is_nullable FROM information_schema.columns
+WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?`
+	}
+	rows, err := db.QueryContext(ctx, query, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]schemaSyncExistingColumn)
+	for rows.Next() {
+		var name, dataType, nullable string
+		if err := rows.Scan(&name, &dataType, &nullable); err != nil {
+			return nil, err
+		}
+		columns[normalizeColumnName(name)] = schemaSyncExistingColumn{DataType: dataType, Nullable: strings.EqualFold(nullable, "YES")}
+	}
+	return columns, rows.Err()
+}
+
+func schemaSyncHasPrimaryKey(ctx context.Context, db *sql.DB, dbType, schema, table string) (bool, error) {
+	query := `SELECT COUNT(*) FROM information_schema.table_constraints
+WHERE constraint_type = 'PRIMARY KEY' AND table_schema = COALESCE(NULLIF($1::text, ''), current_schema()) AND table_name = $2`
+	if dbType == "mysql" {
+		query = `SELECT COUNT(*) FROM information_schema.table_constraints
+WHERE constraint_type = 'PRIMARY KEY' AND table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?`
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, query, schema, table).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// runSchemaSyncJob gera (e, fora do modo preview, executa) o DDL da tabela de destino
+// do job configurado em SchemaSync.JobID, ou do proprio job quando vazio.
+func (jr *JobRunner) runSchemaSyncJob(jobID string, job models.Job) {
+	log.Printf("Executando job schema-sync: %s\n", job.JobName)
+	start := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", start)
+		return
+	}
+
+	logger.AddJob(jr.PipelineLog, logger.JobLog{
+		JobID:       jobID,
+		JobName:     job.JobName,
+		Status:      "running",
+		StopOnError: job.StopOnError,
+		StartedAt:   start,
+		Total:       1,
+		Batches:     make([]logger.BatchLog, 0),
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Name = job.JobName
+		js.Status = "running"
+		js.StartedAt = &start
+		status.NotifySubscribers()
+	})
+
+	plan, err := jr.evaluateSchemaSync(job)
+	end := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", end)
+		return
+	}
+	if err != nil {
+		log.Printf("Erro no job schema-sync %s: %v\n", job.ID, err)
+		jr.handleExecutionJobError(jobID, job, err)
+		return
+	}
+	log.Printf("Job %s (%s): tabela %s, %d comando(s) DDL, aplicado=%t", job.ID, job.JobName, plan.Table, len(plan.Statements), plan.Applied)
+	for _, warning := range plan.Warnings {
+		status.AppendLog(fmt.Sprintf("%s - Job: %s aviso: %s", jr.PipelineLog.Project, job.JobName, warning))
+	}
+
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Status = "done"
+		jl.Processed = 1
+		jl.EndedAt = end
+		jl.Result = map[string]interface{}{
+			"table":             plan.Table,
+			"statements":        plan.Statements,
+			"warnings":          plan.Warnings,
+			"applied":           plan.Applied,
+			"appliedStatements": plan.AppliedStatements,
+		}
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Status = "done"
+		js.Processed = 1
+		js.Total = 1
+		js.Progress = 100
+		js.EndedAt = &end
+		status.NotifySubscribers()
+	})
+
+	for _, nextID := range jr.ConnMap[jobID] {
+		jr.RunJob(nextID)
+	}
+}
+
+func (jr *JobRunner) evaluateSchemaSync(job models.Job) (*SchemaSyncPlan, error) {
+	spec := models.SchemaSyncSpec{}
+	if job.SchemaSync != nil {
+		spec = *job.SchemaSync
+	}
+	target := job
+	if id := strings.TrimSpace(spec.JobID); id != "" {
+		var ok bool
+		target, ok = jr.JobMap[id]
+		if !ok {
+			return nil, fmt.Errorf("job %s do schema-sync nao encontrado", id)
+		}
+	}
+	target.SelectSQL = jr.SubstituteVariables(target.SelectSQL)
+	target.InsertSQL = jr.SubstituteVariables(target.InsertSQL)
+
+	destType := normalizeDBTypeFromDSN(jr.DestinationDSN)
+	plan, err := PlanSchemaSync(jr.ctx, jr.SourceDB, jr.DestinationDB, destType, target, spec.ColumnTypes)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Preview {
+		return plan, nil
+	}
+	if err := ApplySchemaSync(jr.ctx, jr.DestinationDB, destType, plan); err != nil {
+		return plan, err
+	}
+	return plan, nil
+}
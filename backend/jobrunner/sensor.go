@@ -0,0 +1,158 @@
+package jobrunner
+
+import (
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	defaultSensorInterval = 60 * time.Second
+	defaultSensorTimeout  = time.Hour
+)
+
+// runSensorJob reavalia a condicao do SelectSQL a cada intervalo ate retornar
+// verdadeiro. Roda em goroutine propria (sem vaga no agendador, pois so aguarda)
+// e falha quando o tempo maximo se esgota; Stop interrompe a espera na hora.
+func (jr *JobRunner) runSensorJob(jobID string, job models.Job) {
+	jr.WaitGroup.Add(1)
+	go func() {
+		defer jr.WaitGroup.Done()
+		log.Printf("Executando job sensor: %s\n", job.JobName)
+		start := time.Now()
+		if jr.shouldStop() {
+			jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", start)
+			return
+		}
+
+		interval, timeout := defaultSensorInterval, defaultSensorTimeout
+		if job.Sensor != nil {
+			if job.Sensor.IntervalSeconds > 0 {
+				interval = time.Duration(job.Sensor.IntervalSeconds) * time.Second
+			}
+			if job.Sensor.TimeoutSeconds > 0 {
+				timeout = time.Duration(job.Sensor.TimeoutSeconds) * time.Second
+			}
+		}
+
+		logger.AddJob(jr.PipelineLog, logger.JobLog{
+			JobID:       jobID,
+			JobName:     job.JobName,
+			Status:      "running",
+			StopOnError: job.StopOnError,
+			StartedAt:   start,
+			Total:       1,
+			Batches:     make([]logger.BatchLog, 0),
+		})
+		jr.savePipelineLog()
+
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+			js.Name = job.JobName
+			js.Status = "running"
+			js.StartedAt = &start
+			status.NotifySubscribers()
+		})
+
+		deadline := start.Add(timeout)
+		polls := 0
+		var err error
+		for {
+			polls++
+			var ready bool
+			ready, err = jr.evaluateSensor(job)
+			if jr.shouldStop() {
+				jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", time.Now())
+				return
+			}
+			if err != nil || ready {
+				break
+			}
+
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				err = fmt.Errorf("condicao do sensor nao ficou verdadeira em %s (%d verificacao(oes))", timeout, polls)
+				break
+			}
+			wait := interval
+			if wait > remaining {
+				wait = remaining
+			}
+			status.AppendLog(fmt.Sprintf("%s - Job: %s verificacao %d: condicao falsa, nova tentativa em %s", jr.PipelineLog.Project, job.JobName, polls, wait.Round(time.Second)))
+			logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+				jl.Result = map[string]interface{}{"polls": polls}
+			})
+			jr.savePipelineLog()
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-jr.ctx.Done():
+				timer.Stop()
+				jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", time.Now())
+				return
+			case <-timer.C:
+			}
+		}
+
+		end := time.Now()
+		if err != nil {
+			log.Printf("Erro no job sensor %s: %v\n", job.ID, err)
+			status.AppendLog(fmt.Sprintf("%s - Job: %s sensor falhou: %v", jr.PipelineLog.Project, job.JobName, err))
+			jr.handleExecutionJobError(jobID, job, err)
+			return
+		}
+		status.AppendLog(fmt.Sprintf("%s - Job: %s verificacao %d: condicao verdadeira", jr.PipelineLog.Project, job.JobName, polls))
+
+		logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+			jl.Status = "done"
+			jl.Processed = 1
+			jl.EndedAt = end
+			jl.Result = map[string]interface{}{
+				"polls":         polls,
+				"waitedSeconds": int(end.Sub(start).Seconds()),
+			}
+		})
+		jr.savePipelineLog()
+
+		status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+			js.Status = "done"
+			js.Processed = 1
+			js.Total = 1
+			js.Progress = 100
+			js.EndedAt = &end
+			status.NotifySubscribers()
+		})
+
+		for _, nextID := range jr.ConnMap[jobID] {
+			jr.RunJob(nextID)
+		}
+	}()
+}
+
+// evaluateSensor executa a condicao uma vez, como o job condition (incluindo diretivas Map).
+func (jr *JobRunner) evaluateSensor(job models.Job) (bool, error) {
+	job.SelectSQL = jr.SubstituteVariables(job.SelectSQL)
+	targetDB, dbType := jr.resolveExecutionDB(job)
+	resolvedSQL, directives, err := extractMapDirectives(job.SelectSQL)
+	if err != nil {
+		return false, err
+	}
+
+	var exec mapExecutor = targetDB
+	if len(directives) > 0 {
+		var releaseMaps func()
+		resolvedSQL, exec, releaseMaps, err = jr.prepareMapSQL(jr.ctx, targetDB, nil, dbType, resolvedSQL, directives)
+		if err != nil {
+			return false, err
+		}
+		defer releaseMaps()
+	}
+
+	var ready bool
+	if err := exec.QueryRowContext(jr.ctx, resolvedSQL).Scan(&ready); err != nil {
+		return false, err
+	}
+	return ready, nil
+}
@@ -0,0 +1,164 @@
+package jobrunner
+
+import (
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func (jr *JobRunner) runSetVariableJob(jobID string, job models.Job) {
+	log.Printf("Executando job set-variable: %s\n", job.JobName)
+	start := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", start)
+		return
+	}
+
+	logger.AddJob(jr.PipelineLog, logger.JobLog{
+		JobID:       jobID,
+		JobName:     job.JobName,
+		Status:      "running",
+		StopOnError: job.StopOnError,
+		StartedAt:   start,
+		Total:       1,
+		Batches:     make([]logger.BatchLog, 0),
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Name = job.JobName
+		js.Status = "running"
+		js.StartedAt = &start
+		status.NotifySubscribers()
+	})
+
+	name, value, rowCount, err := jr.evaluateSetVariable(job)
+	end := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", end)
+		return
+	}
+	if err != nil {
+		log.Printf("Erro no job set-variable %s: %v\n", job.ID, err)
+		jr.handleExecutionJobError(jobID, job, err)
+		return
+	}
+
+	jr.setVariable(name, value)
+	logger.SetVariable(jr.PipelineLog, name, value)
+	log.Printf("Job %s (%s): variavel %s atribuida (%d linha(s))", job.ID, job.JobName, name, rowCount)
+
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Status = "done"
+		jl.Processed = 1
+		jl.EndedAt = end
+		jl.Result = map[string]interface{}{
+			"variable": name,
+			"value":    value,
+			"rows":     rowCount,
+		}
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Status = "done"
+		js.Processed = 1
+		js.Total = 1
+		js.Progress = 100
+		js.EndedAt = &end
+		status.NotifySubscribers()
+	})
+
+	for _, nextID := range jr.ConnMap[jobID] {
+		jr.RunJob(nextID)
+	}
+}
+
+// evaluateSetVariable executa o SelectSQL e monta o valor da variavel a partir da
+// primeira coluna (valor unico ou lista unida pelo separador).
+func (jr *JobRunner) evaluateSetVariable(job models.Job) (string, string, int, error) {
+	if job.SetVariable == nil || strings.TrimSpace(job.SetVariable.Name) == "" {
+		return "", "", 0, fmt.Errorf("job set-variable sem nome de variavel")
+	}
+	spec := *job.SetVariable
+	name := strings.TrimSpace(spec.Name)
+	if !variableNamePattern.MatchString(name) {
+		return "", "", 0, fmt.Errorf("nome de variavel invalido: %s", name)
+	}
+	mode := strings.ToLower(strings.TrimSpace(spec.Mode))
+	if mode == "" {
+		mode = "scalar"
+	}
+	if mode != "scalar" && mode != "list" {
+		return "", "", 0, fmt.Errorf("modo '%s' desconhecido (use scalar ou list)", spec.Mode)
+	}
+	query := strings.TrimSpace(jr.SubstituteVariables(job.SelectSQL))
+	if query == "" {
+		return "", "", 0, fmt.Errorf("job set-variable sem SelectSQL")
+	}
+
+	db, _ := jr.resolveExecutionDB(job)
+	rows, err := db.QueryContext(jr.ctx, query)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", "", 0, err
+	}
+	if len(columns) == 0 {
+		return "", "", 0, fmt.Errorf("consulta sem colunas")
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	items := make([]string, 0)
+	rowCount := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return "", "", 0, err
+		}
+		rowCount++
+		item := variableValueString(values[0])
+		if spec.Quote {
+			item = "'" + strings.ReplaceAll(item, "'", "''") + "'"
+		}
+		items = append(items, item)
+		if mode == "scalar" {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", "", 0, err
+	}
+	if rowCount == 0 && !spec.AllowEmpty {
+		return "", "", 0, fmt.Errorf("consulta nao retornou linhas para a variavel %s", name)
+	}
+
+	separator := spec.Separator
+	if separator == "" {
+		separator = ","
+	}
+	return name, strings.Join(items, separator), rowCount, nil
+}
+
+// variableValueString converte o valor lido para variavel. Datas mantem a fracao de
+// segundo e o fuso (RFC3339Nano), para que filtros como "> ${ultima_carga}" nao percam linhas.
+func variableValueString(val interface{}) string {
+	if t, ok := val.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return valueToString(val)
+}
@@ -0,0 +1,320 @@
+package jobrunner
+
+import (
+	"database/sql"
+	"etl/dialects"
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Intervalo de atualizacao do progresso do job subproject
+const subprojectRollupInterval = time.Second
+
+// SubprojectDefinition e um projeto carregado para execucao dentro de um job subproject.
+type SubprojectDefinition struct {
+	Project        models.Project // credenciais ja decifradas
+	Dialect        dialects.SQLDialect
+	SourceDSN      string
+	DestinationDSN string
+	JobMap         map[string]models.Job
+	JobOrder       []string
+	ConnMap        map[string][]string
+	// OpenDatabase abre um pool dedicado quando o subprojeto usa outro banco
+	OpenDatabase func(cfg models.DatabaseConfig) (*sql.DB, error)
+}
+
+// SubprojectLoader carrega um projeto pelo id (leitura de project.json e jobs fica nos handlers).
+type SubprojectLoader func(projectID string) (*SubprojectDefinition, error)
+
+var subprojectLoader SubprojectLoader
+
+// SetSubprojectLoader registra o carregador usado pelos jobs subproject.
+func SetSubprojectLoader(loader SubprojectLoader) {
+	subprojectLoader = loader
+}
+
+// RootJobIDs retorna os jobs que nao sao destino de nenhuma conexao, na ordem do projeto.
+// Sem raiz detectada (ex: so ciclos), todos os jobs sao executados.
+func RootJobIDs(jobOrder []string, connMap map[string][]string) []string {
+	usedTargets := make(map[string]bool)
+	for _, targets := range connMap {
+		for _, target := range targets {
+			usedTargets[target] = true
+		}
+	}
+	roots := make([]string, 0, len(jobOrder))
+	for _, id := range jobOrder {
+		if !usedTargets[id] {
+			roots = append(roots, id)
+		}
+	}
+	if len(roots) == 0 {
+		log.Println("Nenhum job raiz detectado — executando todos os jobs.")
+		roots = append(roots, jobOrder...)
+	}
+	return roots
+}
+
+// projectLineage retorna os projetos em execucao do pipeline raiz ate este runner.
+func (jr *JobRunner) projectLineage() []string {
+	lineage := make([]string, 0, len(jr.projectChain)+1)
+	lineage = append(lineage, jr.projectChain...)
+	return append(lineage, jr.ProjectID)
+}
+
+func (jr *JobRunner) runSubprojectJob(jobID string, job models.Job) {
+	log.Printf("Executando job subproject: %s\n", job.JobName)
+	start := time.Now()
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", start)
+		return
+	}
+
+	logger.AddJob(jr.PipelineLog, logger.JobLog{
+		JobID:       jobID,
+		JobName:     job.JobName,
+		Status:      "running",
+		StopOnError: job.StopOnError,
+		StartedAt:   start,
+		Batches:     make([]logger.BatchLog, 0),
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Name = job.JobName
+		js.Status = "running"
+		js.StartedAt = &start
+		status.NotifySubscribers()
+	})
+
+	child, err := jr.newSubprojectRunner(job)
+	if err != nil {
+		log.Printf("Erro no job subproject %s: %v\n", job.ID, err)
+		jr.handleExecutionJobError(jobID, job, err)
+		return
+	}
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Total = len(child.JobOrder)
+		jl.SubPipeline = child.PipelineLog
+	})
+	jr.savePipelineLog()
+	status.AppendLog(fmt.Sprintf("%s - Job: %s executando projeto %s", jr.PipelineLog.Project, job.JobName, child.PipelineLog.Project))
+
+	for _, id := range child.JobOrder {
+		status.UpdateJobStatus(child.statusKey(id), func(js *status.JobStatus) {
+			js.Status = "pending"
+			js.StartedAt = nil
+			js.EndedAt = nil
+			js.Processed = 0
+			js.Total = 0
+			js.Progress = 0
+			js.Error = ""
+			status.NotifySubscribers()
+		})
+	}
+
+	// Progresso do pai = jobs do subprojeto finalizados
+	stopRollup := make(chan struct{})
+	rollupDone := make(chan struct{})
+	go func() {
+		defer close(rollupDone)
+		ticker := time.NewTicker(subprojectRollupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				jr.rollupSubprojectStatus(jobID, job, child)
+			case <-stopRollup:
+				return
+			}
+		}
+	}()
+
+	child.runNested(RootJobIDs(child.JobOrder, child.ConnMap))
+	close(stopRollup)
+	<-rollupDone
+	finished, failed := jr.rollupSubprojectStatus(jobID, job, child)
+
+	end := time.Now()
+	childStatus := "done"
+	var runErr error
+	switch {
+	case jr.shouldStop():
+		childStatus = "stopped"
+	case len(failed) > 0:
+		childStatus = "error"
+		runErr = fmt.Errorf("projeto %s: %d job(s) com erro (%s)", child.PipelineLog.Project, len(failed), strings.Join(failed, ", "))
+	case child.PipelineLog.Status == "error":
+		childStatus = "error"
+		runErr = fmt.Errorf("projeto %s finalizado com erro", child.PipelineLog.Project)
+	}
+	// O log filho e lido pelo pai ao salvar: alteracoes diretas ficam sob o lock do logger
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		child.PipelineLog.Status = childStatus
+		child.PipelineLog.EndedAt = end
+		jl.Processed = finished
+	})
+
+	if jr.shouldStop() {
+		jr.markJobFinalStatus(jobID, job, "error", "pipeline interrompida", end)
+		return
+	}
+	if runErr != nil {
+		log.Printf("Erro no job subproject %s: %v\n", job.ID, runErr)
+		jr.handleExecutionJobError(jobID, job, runErr)
+		return
+	}
+
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Status = "done"
+		jl.EndedAt = end
+	})
+	jr.savePipelineLog()
+
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Status = "done"
+		js.Progress = 100
+		js.EndedAt = &end
+		status.NotifySubscribers()
+	})
+
+	for _, nextID := range jr.ConnMap[jobID] {
+		jr.RunJob(nextID)
+	}
+}
+
+// newSubprojectRunner carrega o projeto do job e cria o runner filho. Bancos com o
+// mesmo DSN do pai reutilizam os pools dele; os demais abrem pools proprios.
+func (jr *JobRunner) newSubprojectRunner(job models.Job) (*JobRunner, error) {
+	if job.Subproject == nil || strings.TrimSpace(job.Subproject.ProjectID) == "" {
+		return nil, fmt.Errorf("job subproject sem projeto configurado")
+	}
+	if subprojectLoader == nil {
+		return nil, fmt.Errorf("carregador de subprojetos nao registrado")
+	}
+	projectID := strings.TrimSpace(jr.SubstituteVariables(job.Subproject.ProjectID))
+
+	lineage := jr.projectLineage()
+	for _, ancestor := range lineage {
+		if ancestor == projectID {
+			return nil, fmt.Errorf("ciclo entre projetos: %s -> %s", strings.Join(lineage, " -> "), projectID)
+		}
+	}
+
+	def, err := subprojectLoader(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceDB, sharedSource, err := jr.subprojectDatabase(def, def.Project.SourceDatabase, def.SourceDSN)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao conectar no banco de origem do projeto %s: %w", def.Project.ProjectName, err)
+	}
+	destDB, sharedDest, err := jr.subprojectDatabase(def, def.Project.DestinationDatabase, def.DestinationDSN)
+	if err != nil {
+		if !sharedSource {
+			_ = sourceDB.Close()
+		}
+		return nil, fmt.Errorf("erro ao conectar no banco de destino do projeto %s: %w", def.Project.ProjectName, err)
+	}
+
+	child := newJobRunner(jr.ctx, sourceDB, destDB, def.SourceDSN, def.DestinationDSN, def.Dialect, def.Project.Concurrency, def.Project.ProjectName, projectID)
+	child.parent = jr
+	child.projectChain = lineage
+	child.statusPrefix = jr.statusKey(job.ID) + "/"
+	child.sharedSourceDB = sharedSource
+	child.sharedDestDB = sharedDest
+	child.httpClient = jr.httpClient
+	child.JobMap = def.JobMap
+	child.JobOrder = def.JobOrder
+	child.ConnMap = def.ConnMap
+	for key, value := range job.Subproject.Variables {
+		child.Variables[key] = jr.SubstituteVariables(value)
+	}
+	child.ApplySourceThrottle(def.Project)
+	child.ApplyJobScheduler(def.Project)
+	return child, nil
+}
+
+func (jr *JobRunner) subprojectDatabase(def *SubprojectDefinition, cfg models.DatabaseConfig, dsn string) (*sql.DB, bool, error) {
+	switch dsn {
+	case jr.SourceDSN:
+		return jr.SourceDB, true, nil
+	case jr.DestinationDSN:
+		return jr.DestinationDB, true, nil
+	}
+	if def.OpenDatabase == nil {
+		return nil, false, fmt.Errorf("abertura de banco nao disponivel")
+	}
+	db, err := def.OpenDatabase(cfg)
+	return db, false, err
+}
+
+// runNested executa o DAG de um runner filho (subproject, foreach) e aguarda o fim. Diferente de Run, nao
+// altera o runner ativo nem o status do projeto e fecha apenas os pools proprios.
+func (jr *JobRunner) runNested(startIDs []string) {
+	log.Printf("Iniciando execucao aninhada %s (pipeline %s)\n", jr.PipelineLog.Project, jr.PipelineLog.PipelineID)
+	defer jr.clearMemoryStore()
+
+	for _, id := range startIDs {
+		if jr.shouldStop() {
+			break
+		}
+		jr.RunJob(id)
+	}
+	jr.WaitGroup.Wait()
+
+	if jr.shouldStop() {
+		for id, job := range jr.JobMap {
+			js := status.GetJobStatus(jr.statusKey(id))
+			if js != nil && js.Status == "running" {
+				jr.markJobFinalStatus(id, job, "error", "pipeline interrompida", time.Now())
+			}
+		}
+	}
+	if jr.countQueue != nil {
+		close(jr.countQueue)
+	}
+	jr.dropSpilledTables()
+	jr.closeDatabases()
+	jr.cancel()
+	log.Printf("Execucao aninhada %s finalizada\n", jr.PipelineLog.Project)
+}
+
+// rollupSubprojectStatus replica no job pai o progresso dos jobs do subprojeto.
+// Retorna quantos jobs terminaram e os nomes dos que falharam.
+func (jr *JobRunner) rollupSubprojectStatus(jobID string, job models.Job, child *JobRunner) (int, []string) {
+	finished := 0
+	failed := make([]string, 0)
+	for _, id := range child.JobOrder {
+		js := status.GetJobStatus(child.statusKey(id))
+		if js == nil {
+			continue
+		}
+		switch js.Status {
+		case "done":
+			finished++
+		case "error":
+			finished++
+			failed = append(failed, child.JobMap[id].JobName)
+		}
+	}
+	total := len(child.JobOrder)
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.Processed = finished
+	})
+	status.UpdateJobStatus(jr.statusKey(job.ID), func(js *status.JobStatus) {
+		js.Processed = finished
+		js.Total = total
+		if total > 0 {
+			js.Progress = float64(finished) * 100 / float64(total)
+		}
+		status.NotifySubscribers()
+	})
+	return finished, failed
+}
@@ -0,0 +1,141 @@
+package jobrunner
+
+import (
+	"context"
+	"etl/logger"
+	"etl/models"
+	"etl/status"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// rowRateLimiter limita a quantidade de linhas lidas por segundo.
+// Cada chamada reserva o intervalo correspondente as linhas pedidas, entao
+// lotes maiores que a taxa configurada tambem sao aceitos (apenas esperam mais).
+type rowRateLimiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+func newRowRateLimiter(rowsPerSecond int) *rowRateLimiter {
+	if rowsPerSecond <= 0 {
+		return nil
+	}
+	return &rowRateLimiter{rate: float64(rowsPerSecond)}
+}
+
+func (l *rowRateLimiter) wait(ctx context.Context, rows int) (time.Duration, error) {
+	if l == nil || rows <= 0 {
+		return 0, nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(rows) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return delay, ctx.Err()
+	}
+}
+
+// ApplySourceThrottle configura os limites de protecao da origem definidos no projeto.
+// Deve ser chamado antes de Run.
+func (jr *JobRunner) ApplySourceThrottle(project models.Project) {
+	jr.rowLimiter = newRowRateLimiter(project.MaxRowsPerSecond)
+	if project.MaxSourceQueries > 0 {
+		jr.Semaphore = make(chan struct{}, project.MaxSourceQueries)
+	} else {
+		jr.Semaphore = nil
+	}
+	jr.countWorkers = 1
+	if project.MaxConcurrentCounts > 0 {
+		jr.countWorkers = project.MaxConcurrentCounts
+	}
+	if project.MaxRowsPerSecond > 0 || project.MaxSourceQueries > 0 || project.MaxConcurrentCounts > 0 {
+		log.Printf("Protecao da origem: maxRowsPerSecond=%d maxSourceQueries=%d maxConcurrentCounts=%d",
+			project.MaxRowsPerSecond, project.MaxSourceQueries, project.MaxConcurrentCounts)
+	}
+}
+
+// acquireSourceSlot reserva uma vaga de query na origem (compartilhada entre todos os jobs).
+// Retorna a funcao de liberacao e o tempo aguardado.
+func (jr *JobRunner) acquireSourceSlot(ctx context.Context) (func(), time.Duration, error) {
+	if jr.Semaphore == nil {
+		return func() {}, 0, nil
+	}
+
+	select {
+	case jr.Semaphore <- struct{}{}:
+		return jr.releaseSourceSlot, 0, nil
+	default:
+	}
+
+	start := time.Now()
+	select {
+	case jr.Semaphore <- struct{}{}:
+		return jr.releaseSourceSlot, time.Since(start), nil
+	case <-ctx.Done():
+		return func() {}, time.Since(start), ctx.Err()
+	}
+}
+
+func (jr *JobRunner) releaseSourceSlot() {
+	<-jr.Semaphore
+}
+
+// waitSourceRows aplica os limites de linhas por segundo do projeto e do job.
+func (jr *JobRunner) waitSourceRows(ctx context.Context, jobLimiter *rowRateLimiter, rows int) (time.Duration, error) {
+	waitedJob, err := jobLimiter.wait(ctx, rows)
+	if err != nil {
+		return waitedJob, err
+	}
+	waitedProject, err := jr.rowLimiter.wait(ctx, rows)
+	return waitedJob + waitedProject, err
+}
+
+func (jr *JobRunner) addThrottled(jobID string, waited time.Duration) {
+	if waited <= 0 {
+		return
+	}
+	jr.throttleMu.Lock()
+	if jr.throttled == nil {
+		jr.throttled = make(map[string]time.Duration)
+	}
+	jr.throttled[jobID] += waited
+	jr.throttleMu.Unlock()
+}
+
+func (jr *JobRunner) throttledFor(jobID string) time.Duration {
+	jr.throttleMu.Lock()
+	defer jr.throttleMu.Unlock()
+	return jr.throttled[jobID]
+}
+
+// recordThrottledTime grava no log do job o tempo acumulado em espera pelos limites da origem.
+func (jr *JobRunner) recordThrottledTime(jobID string, job models.Job) {
+	waited := jr.throttledFor(jobID)
+	if waited <= 0 {
+		return
+	}
+	logger.UpdateJob(jr.PipelineLog, jobID, func(jl *logger.JobLog) {
+		jl.ThrottledMs = waited.Milliseconds()
+	})
+	status.AppendLog(fmt.Sprintf("%s - Job: %s aguardou %s por limites de protecao da origem", jr.PipelineLog.Project, job.JobName, waited.Round(time.Millisecond)))
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"encoding/json"
+	"errors"
 	"etl/status"
 	"fmt"
 	"os"
@@ -19,6 +20,11 @@ type BatchLog struct {
 	ErrorType string    `json:"error_type,omitempty"` // "sql_error", "connection_error", "validation_error", etc.
 	ErrorCode string    `json:"error_code,omitempty"` // Código específico do erro
 	Rows      int       `json:"rows"`
+	Rejected  int       `json:"rejected,omitempty"` // Linhas enviadas ao dead-letter
+	File      string    `json:"file,omitempty"`     // import-file: arquivo da linha com erro
+	Line      int       `json:"line,omitempty"`     // import-file: numero da linha com erro
+	Page      int       `json:"page,omitempty"`     // api-extract: pagina buscada
+	Position  string    `json:"position,omitempty"` // cdc: posicao confirmada na origem apos o lote
 	StartedAt time.Time `json:"started_at"`
 	EndedAt   time.Time `json:"ended_at"`
 }
@@ -36,9 +42,54 @@ type JobLog struct {
 	EndedAt      time.Time              `json:"ended_at"`
 	Processed    int                    `json:"processed"`
 	Total        int                    `json:"total"`
+	ThrottledMs  int64                  `json:"throttled_ms,omitempty"`  // Tempo aguardando limites de protecao da origem
+	Rejected     int                    `json:"rejected,omitempty"`      // Linhas enviadas ao dead-letter
+	Filtered     int                    `json:"filtered,omitempty"`      // Linhas descartadas pelo filtro do job
+	LookupMisses int                    `json:"lookup_misses,omitempty"` // Chaves nao encontradas nos lookups
+	FromCache    bool                   `json:"from_cache,omitempty"`    // memory-select carregado do cache em disco
+	QueuedMs     int64                  `json:"queued_ms,omitempty"`     // Tempo aguardando vaga no agendador de jobs
+	Files        []string               `json:"files,omitempty"`         // Arquivos gerados (export-file)
+	Result       map[string]interface{} `json:"result,omitempty"`        // Resultado de jobs sem linhas (ex: http)
+	SubPipeline  *PipelineLog           `json:"sub_pipeline,omitempty"`  // subproject: log da execucao do projeto filho
+	Iterations   []*PipelineLog         `json:"iterations,omitempty"`    // foreach: log de cada iteracao
+	Reconcile    *ReconcileResult       `json:"reconcile,omitempty"`     // reconcile: resultado da conferencia
+	SCD2         *SCD2Result            `json:"scd2,omitempty"`          // insert com scd2: linhas novas, alteradas e sem alteracao
 	Batches      []BatchLog             `json:"batches"`
 }
 
+// ReconcileResult e o resultado de um job reconcile. As listas de chaves sao limitadas
+// (Truncated indica que havia mais divergencias que as listadas).
+type ReconcileResult struct {
+	Mode            string           `json:"mode"`
+	Passed          bool             `json:"passed"`
+	Checks          []ReconcileCheck `json:"checks,omitempty"`
+	SourceRows      int              `json:"source_rows,omitempty"`
+	DestinationRows int              `json:"destination_rows,omitempty"`
+	MissingCount    int              `json:"missing_count,omitempty"`   // chaves da origem ausentes no destino
+	ExtraCount      int              `json:"extra_count,omitempty"`     // chaves do destino ausentes na origem
+	DifferingCount  int              `json:"differing_count,omitempty"` // chaves com valores diferentes
+	MissingKeys     []string         `json:"missing_keys,omitempty"`
+	ExtraKeys       []string         `json:"extra_keys,omitempty"`
+	DifferingKeys   []string         `json:"differing_keys,omitempty"`
+	Truncated       bool             `json:"truncated,omitempty"`
+}
+
+// SCD2Result conta as linhas de um insert em modo scd2: novas chaves, versoes fechadas
+// por mudanca nas colunas rastreadas e linhas iguais a versao corrente.
+type SCD2Result struct {
+	New       int `json:"new"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// ReconcileCheck compara uma metrica (count, sum(valor), ...) entre origem e destino.
+type ReconcileCheck struct {
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Passed      bool   `json:"passed"`
+}
+
 type PipelineLog struct {
 	PipelineID string    `json:"pipeline_id"`
 	ProjectID  string    `json:"project_id,omitempty"`
@@ -47,6 +98,8 @@ type PipelineLog struct {
 	StartedAt  time.Time `json:"started_at"`
 	EndedAt    time.Time `json:"ended_at"`
 	Jobs       []JobLog  `json:"jobs"`
+	// Variaveis usadas na execucao (ex: valores da linha em uma iteracao de foreach)
+	Variables map[string]string `json:"variables,omitempty"`
 }
 
 var (
@@ -163,6 +216,30 @@ func AddBatch(log *PipelineLog, jobID string, batch BatchLog) {
 	}
 }
 
+// SetVariable registra no log o valor atribuido a uma variavel durante a execucao.
+func SetVariable(log *PipelineLog, name, value string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if log.Variables == nil {
+		log.Variables = make(map[string]string)
+	}
+	log.Variables[name] = value
+	status.AppendLog(fmt.Sprintf("%s - Variavel %s = %s", log.Project, name, value))
+}
+
+// FailedJobNames retorna os jobs com status error no log.
+func FailedJobNames(log *PipelineLog) []string {
+	mu.Lock()
+	defer mu.Unlock()
+	failed := make([]string, 0)
+	for _, job := range log.Jobs {
+		if job.Status == "error" {
+			failed = append(failed, job.JobName)
+		}
+	}
+	return failed
+}
+
 // Função auxiliar para listar todos os logs de pipeline
 func ListPipelineLogs() ([]string, error) {
 	logsDir := "logs"
@@ -305,7 +382,7 @@ func GetErrorSummary(pipelineID string) (map[string]interface{}, error) {
 
 	for _, job := range log.Jobs {
 		if job.Error != "" {
-			errorType, errorCode, details := analyzer.AnalyzeError(fmt.Errorf(job.Error))
+			errorType, errorCode, details := analyzer.AnalyzeError(errors.New(job.Error))
 
 			jobError := map[string]interface{}{
 				"job_id":        job.JobID,
@@ -328,7 +405,7 @@ func GetErrorSummary(pipelineID string) (map[string]interface{}, error) {
 		// Analisa erros de batches
 		for _, batch := range job.Batches {
 			if batch.Error != "" {
-				errorType, errorCode, details := analyzer.AnalyzeError(fmt.Errorf(batch.Error))
+				errorType, errorCode, details := analyzer.AnalyzeError(errors.New(batch.Error))
 
 				batchError := map[string]interface{}{
 					"job_id":        job.JobID,
@@ -408,11 +408,20 @@ func (e *PDFExporter) addJobDetails(log *PipelineLog) {
 }
 
 func (e *PDFExporter) addJobCard(index int, job *JobLog) {
-	startY := e.pdf.GetY()
 	cardH := 28.0
 	if strings.TrimSpace(job.Error) != "" {
 		cardH = 44.0
 	}
+	reconcileLines := reconcileReportLines(job.Reconcile)
+	reconcileH := 0.0
+	if len(reconcileLines) > 0 {
+		reconcileH = 9 + 4.5*float64(len(reconcileLines))
+		cardH += reconcileH + 2
+		if e.pdf.GetY()+cardH > 280 {
+			e.pdf.AddPage()
+		}
+	}
+	startY := e.pdf.GetY()
 	pageW, _ := e.pdf.GetPageSize()
 	left, _, right, _ := e.pdf.GetMargins()
 	cardW := pageW - left - right
@@ -478,9 +487,80 @@ func (e *PDFExporter) addJobCard(index int, job *JobLog) {
 		e.pdf.MultiCell(cardW-12, 4, removeAccents(job.Error), "", "L", false)
 	}
 
+	if len(reconcileLines) > 0 {
+		boxY := startY + 22
+		if strings.TrimSpace(job.Error) != "" {
+			boxY += 20
+		}
+		boxColor := reportTheme.success
+		if !job.Reconcile.Passed {
+			boxColor = reportTheme.danger
+		}
+		e.pdf.SetFillColor(248, 250, 252)
+		e.pdf.SetDrawColor(boxColor.r, boxColor.g, boxColor.b)
+		e.pdf.RoundedRect(left+3, boxY, cardW-6, reconcileH, 1.5, "1234", "DF")
+		e.pdf.SetFont("Arial", "B", 10)
+		e.pdf.SetTextColor(boxColor.r, boxColor.g, boxColor.b)
+		e.pdf.SetXY(left+6, boxY+2)
+		title := "Reconciliacao OK"
+		if !job.Reconcile.Passed {
+			title = "Reconciliacao com divergencias"
+		}
+		e.pdf.CellFormat(cardW-12, 4, fmt.Sprintf("%s (%s)", title, job.Reconcile.Mode), "", 1, "L", false, 0, "")
+		e.pdf.SetFont("Arial", "", 8.5)
+		e.pdf.SetTextColor(reportTheme.gray900.r, reportTheme.gray900.g, reportTheme.gray900.b)
+		for i, line := range reconcileLines {
+			e.pdf.SetXY(left+6, boxY+7+4.5*float64(i))
+			fitted, _ := e.fitTextToWidth(removeAccents(line), cardW-12, "", 8.5, 8.5)
+			e.pdf.CellFormat(cardW-12, 4, fitted, "", 1, "L", false, 0, "")
+		}
+	}
+
 	e.pdf.SetY(startY + cardH + 1)
 }
 
+// reconcileReportLines resume o resultado do job reconcile (metricas e chaves divergentes).
+func reconcileReportLines(result *ReconcileResult) []string {
+	if result == nil {
+		return nil
+	}
+	lines := make([]string, 0)
+	for _, check := range result.Checks {
+		mark := "OK"
+		if !check.Passed {
+			mark = "DIVERGENTE"
+		}
+		lines = append(lines, fmt.Sprintf("%s: origem %s | destino %s | %s", check.Name, check.Source, check.Destination, mark))
+	}
+	if result.Mode == "hash" {
+		lines = append(lines, fmt.Sprintf("Linhas: origem %d | destino %d | faltando %d | sobrando %d | divergentes %d",
+			result.SourceRows, result.DestinationRows, result.MissingCount, result.ExtraCount, result.DifferingCount))
+		keyLines := []struct {
+			label string
+			keys  []string
+		}{
+			{"Faltando no destino", result.MissingKeys},
+			{"Sobrando no destino", result.ExtraKeys},
+			{"Divergentes", result.DifferingKeys},
+		}
+		for _, kl := range keyLines {
+			if len(kl.keys) == 0 {
+				continue
+			}
+			shown := kl.keys
+			if len(shown) > 10 {
+				shown = shown[:10]
+			}
+			suffix := ""
+			if len(shown) < len(kl.keys) || result.Truncated {
+				suffix = " ..."
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s%s", kl.label, strings.Join(shown, ", "), suffix))
+		}
+	}
+	return lines
+}
+
 func (e *PDFExporter) addConclusions(log *PipelineLog) {
 	if e.pdf.GetY() > 220 {
 		e.pdf.AddPage()
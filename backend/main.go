@@ -33,6 +33,7 @@ func main() {
 	router.PUT("/projects/:id/jobs/:jobId", handlers.UpdateJob)
 	router.DELETE("/projects/:id/jobs/:jobId", handlers.DeleteJob)
 	router.POST("/projects/:id/jobs/:jobId/resume", handlers.ResumeJob)
+	router.POST("/projects/:id/jobs/:jobId/schema-sync", handlers.SchemaSyncJob)
 	router.POST("/jobs/validate", handlers.ValidateJobHandler)
 
 	// Variáveis
@@ -49,6 +50,11 @@ func main() {
 	router.PUT("/projects/:id/visual-elements/:elementId", handlers.UpdateVisualElement)
 	router.DELETE("/projects/:id/visual-elements/:elementId", handlers.DeleteVisualElement)
 
+	// Cache de maps em memoria (memory-select com cacheTtlSeconds)
+	router.GET("/projects/:id/map-cache", handlers.ListMapCache)
+	router.DELETE("/projects/:id/map-cache", handlers.InvalidateMapCache)
+	router.DELETE("/projects/:id/map-cache/:key", handlers.InvalidateMapCache)
+
 	// Executar projeto
 	router.POST("/projects/:id/run", handlers.RunProject)
 	router.POST("/projects/:id/stop", handlers.StopProject)
@@ -16,6 +16,298 @@ type Job struct {
 	StopOnError    bool     `json:"stopOnError"`
 	Left           int      `json:"left"`
 	Top            int      `json:"top"`
+
+	// Limites de leitura na origem (0 = sem limite)
+	MaxRowsPerSecond int `json:"maxRowsPerSecond,omitempty"`
+	MaxSourceQueries int `json:"maxSourceQueries,omitempty"`
+
+	// Agendamento: prioridade maior sai antes da fila; peso ocupa vagas de maxParallelJobs
+	Priority int `json:"priority,omitempty"`
+	Weight   int `json:"weight,omitempty"`
+
+	// Tolerancia a erros de escrita: "fail" (padrao) ou "tolerate".
+	// Em "tolerate", linhas rejeitadas vao para o dead-letter ("file" ou "table")
+	// e o job so falha quando ErrorBudget (linhas rejeitadas, 0 = sem limite) e excedido.
+	ErrorMode       string `json:"errorMode,omitempty"`
+	DeadLetter      string `json:"deadLetter,omitempty"`
+	DeadLetterTable string `json:"deadLetterTable,omitempty"`
+	ErrorBudget     int    `json:"errorBudget,omitempty"`
+
+	// Transformacoes aplicadas em cada linha entre a leitura e a escrita
+	Transforms []TransformStep `json:"transforms,omitempty"`
+
+	// Mascaramento de dados pessoais, aplicado apos as transformacoes
+	Masking []MaskingRule `json:"masking,omitempty"`
+
+	// Expressoes avaliadas em cada linha (ver jobrunner/expression.go)
+	Filter          string           `json:"filter,omitempty"`
+	ComputedColumns []ComputedColumn `json:"computedColumns,omitempty"`
+
+	// memory-select: reutiliza o dataset gravado em disco por ate N segundos (0 = sem cache)
+	CacheTTLSeconds int `json:"cacheTtlSeconds,omitempty"`
+
+	// Enriquecimento por hash-join com maps de memory-select (ver jobrunner/lookup.go)
+	Lookups []LookupStep `json:"lookups,omitempty"`
+
+	// export-file: arquivo gerado a partir do select
+	File *FileSpec `json:"file,omitempty"`
+
+	// http: chamada a webhook/API no meio do DAG
+	HTTP *HTTPRequestSpec `json:"http,omitempty"`
+
+	// api-extract: origem HTTP paginada no lugar do select
+	API *APISourceSpec `json:"api,omitempty"`
+
+	// subproject: executa o DAG de outro projeto dentro desta execucao
+	Subproject *SubprojectSpec `json:"subproject,omitempty"`
+
+	// foreach: repete um sub-grafo para cada linha do SelectSQL
+	Foreach *ForeachSpec `json:"foreach,omitempty"`
+
+	// set-variable: atribui o resultado do SelectSQL a uma variavel de execucao
+	SetVariable *SetVariableSpec `json:"setVariable,omitempty"`
+
+	// reconcile: compara origem e destino apos a carga
+	Reconcile *ReconcileSpec `json:"reconcile,omitempty"`
+
+	// schema-sync: cria/ajusta a tabela do InsertSQL a partir das colunas do SelectSQL
+	SchemaSync *SchemaSyncSpec `json:"schemaSync,omitempty"`
+
+	// sensor: reavalia a condicao do SelectSQL ate retornar verdadeiro
+	Sensor *SensorSpec `json:"sensor,omitempty"`
+
+	// cdc: replica alteracoes da tabela de origem no destino pelas PrimaryKeys
+	CDC *CDCSpec `json:"cdc,omitempty"`
+
+	// delete-sync: remove do destino as chaves que nao existem mais na origem
+	DeleteSync *DeleteSyncSpec `json:"deleteSync,omitempty"`
+
+	// Escrita em modo dimensao SCD tipo 2 (historico por versao) no insert
+	SCD2 *SCD2Spec `json:"scd2,omitempty"`
+}
+
+// CDCSpec configura o job cdc. No Postgres usa slot de replicacao logica e publicacao
+// (criados se nao existirem); no MySQL le o binlog em formato ROW a partir da posicao
+// gravada, de BinlogFile/BinlogPosition ou GTIDSet (sem nenhum, comeca na posicao atual).
+// A tabela de destino vem de TargetTable ou do InsertSQL.
+type CDCSpec struct {
+	SourceTable string `json:"sourceTable"`           // schema.tabela na origem
+	TargetTable string `json:"targetTable,omitempty"` // vazio = tabela do InsertSQL
+	Slot        string `json:"slot,omitempty"`        // padrao etl_<jobId>
+	Publication string `json:"publication,omitempty"` // padrao = nome do slot
+	BatchSize   int    `json:"batchSize,omitempty"`   // alteracoes lidas por lote (padrao 10000)
+
+	BinlogFile     string `json:"binlogFile,omitempty"`     // mysql: arquivo inicial
+	BinlogPosition uint32 `json:"binlogPosition,omitempty"` // mysql: posicao inicial no arquivo
+	GTIDSet        string `json:"gtidSet,omitempty"`        // mysql: GTIDs ja aplicados (ativa o modo GTID)
+	UseGTID        bool   `json:"useGtid,omitempty"`        // mysql: acompanha a posicao por GTID
+	ServerID       uint32 `json:"serverId,omitempty"`       // mysql: server_id da replica (padrao derivado do job)
+}
+
+// SCD2Spec configura a escrita de um insert como dimensao SCD tipo 2: cada linha e
+// comparada com a versao corrente da chave; se alguma coluna rastreada mudou, a versao
+// corrente e fechada (validTo, isCurrent falso) e uma nova versao e inserida.
+type SCD2Spec struct {
+	BusinessKeys    []string `json:"businessKeys,omitempty"`    // padrao: PrimaryKeys do job
+	TrackedColumns  []string `json:"trackedColumns,omitempty"`  // vazio = todas as Columns exceto chaves
+	ValidFromColumn string   `json:"validFromColumn,omitempty"` // padrao valid_from
+	ValidToColumn   string   `json:"validToColumn,omitempty"`   // padrao valid_to
+	CurrentColumn   string   `json:"currentColumn,omitempty"`   // padrao is_current
+	EffectiveColumn string   `json:"effectiveColumn,omitempty"` // coluna com a data da mudanca (padrao: inicio do job)
+}
+
+// DeleteSyncSpec configura o job delete-sync: as chaves ordenadas da origem e do destino
+// sao comparadas e as que sobram no destino sao apagadas ou marcadas (SoftDeleteColumn).
+type DeleteSyncSpec struct {
+	SourceSQL        string   `json:"sourceSql,omitempty"`        // padrao: SelectSQL do job
+	TargetTable      string   `json:"targetTable,omitempty"`      // vazio = tabela do InsertSQL
+	KeyColumns       []string `json:"keyColumns,omitempty"`       // padrao: PrimaryKeys do job
+	SoftDeleteColumn string   `json:"softDeleteColumn,omitempty"` // marca em vez de apagar
+	SoftDeleteValue  string   `json:"softDeleteValue,omitempty"`  // expressao SQL da marca (padrao TRUE; outra = marca so nas nulas)
+	BatchSize        int      `json:"batchSize,omitempty"`        // chaves por comando (padrao 1000)
+	AllowEmptySource bool     `json:"allowEmptySource,omitempty"` // permite apagar tudo quando a origem vem vazia
+}
+
+// SensorSpec configura o intervalo entre verificacoes e o tempo maximo de espera do job sensor.
+type SensorSpec struct {
+	IntervalSeconds int `json:"intervalSeconds,omitempty"` // padrao 60
+	TimeoutSeconds  int `json:"timeoutSeconds,omitempty"`  // padrao 3600
+}
+
+// SchemaSyncSpec configura o job schema-sync. JobID aponta o job de carga cujo
+// SelectSQL/InsertSQL sao usados (vazio = os do proprio job).
+type SchemaSyncSpec struct {
+	JobID       string            `json:"jobId,omitempty"`
+	Preview     bool              `json:"preview,omitempty"`     // apenas gera o DDL, sem executar
+	ColumnTypes map[string]string `json:"columnTypes,omitempty"` // tipo forcado por coluna de destino
+}
+
+// ReconcileSpec define a conferencia entre uma consulta na origem e outra no destino.
+// Modos: count (padrao), aggregate (funcoes por coluna) ou hash (linha a linha por chave).
+type ReconcileSpec struct {
+	Mode             string               `json:"mode,omitempty"`
+	SourceSQL        string               `json:"sourceSql,omitempty"` // padrao: SelectSQL do job
+	DestinationSQL   string               `json:"destinationSql"`
+	Aggregates       []ReconcileAggregate `json:"aggregates,omitempty"`
+	KeyColumns       []string             `json:"keyColumns,omitempty"`       // hash: padrao PrimaryKeys do job
+	CompareColumns   []string             `json:"compareColumns,omitempty"`   // hash: vazio = todas exceto as chaves
+	Tolerance        float64              `json:"tolerance,omitempty"`        // count/aggregate: diferenca absoluta aceita
+	TolerancePercent float64              `json:"tolerancePercent,omitempty"` // count/aggregate: diferenca percentual aceita
+	MaxMismatches    int                  `json:"maxMismatches,omitempty"`    // hash: chaves divergentes aceitas
+	MaxDetails       int                  `json:"maxDetails,omitempty"`       // hash: chaves listadas por categoria, padrao 50
+}
+
+// ReconcileAggregate e uma funcao (sum, min, max, count) aplicada a uma coluna.
+type ReconcileAggregate struct {
+	Column string `json:"column"`
+	Func   string `json:"func"`
+}
+
+// SetVariableSpec define a variavel preenchida pelo SelectSQL (na conexao do job).
+type SetVariableSpec struct {
+	Name       string `json:"name"`
+	Mode       string `json:"mode,omitempty"`       // scalar (padrao): 1a coluna da 1a linha; list: 1a coluna de todas as linhas
+	Separator  string `json:"separator,omitempty"`  // list: padrao ","
+	Quote      bool   `json:"quote,omitempty"`      // list: valores entre aspas simples (ex: para IN (...))
+	AllowEmpty bool   `json:"allowEmpty,omitempty"` // sem linhas atribui vazio em vez de falhar
+}
+
+// ForeachSpec define o sub-grafo repetido por linha. As colunas da linha viram
+// variaveis (${coluna}) nos jobs do sub-grafo.
+type ForeachSpec struct {
+	Body            []string `json:"body,omitempty"`            // jobs que iniciam o sub-grafo (padrao: filhos diretos do foreach)
+	Mode            string   `json:"mode,omitempty"`            // sequential (padrao) ou parallel
+	MaxParallel     int      `json:"maxParallel,omitempty"`     // parallel: iteracoes simultaneas, padrao 4
+	VariablePrefix  string   `json:"variablePrefix,omitempty"`  // prefixo das variaveis da linha (ex: row_)
+	ContinueOnError bool     `json:"continueOnError,omitempty"` // segue com as proximas iteracoes apos uma falha
+}
+
+// SubprojectSpec aponta o projeto reutilizado e as variaveis sobrescritas nele.
+// Os valores aceitam ${variaveis} do projeto pai.
+type SubprojectSpec struct {
+	ProjectID string            `json:"projectId"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// APISourceSpec descreve um endpoint JSON paginado usado como origem.
+// URL, headers e body aceitam ${variaveis} (ex: Authorization: Bearer ${API_TOKEN}).
+type APISourceSpec struct {
+	URL            string            `json:"url"`
+	Method         string            `json:"method,omitempty"` // padrao GET
+	Headers        map[string]string `json:"headers,omitempty"`
+	Body           string            `json:"body,omitempty"`
+	RecordsPath    string            `json:"recordsPath,omitempty"` // caminho da lista de registros (vazio = resposta e a lista)
+	Columns        []FileColumn      `json:"columns,omitempty"`     // Source = caminho JSON no registro (vazio = registro achatado)
+	Pagination     APIPagination     `json:"pagination,omitempty"`
+	TimeoutSeconds int               `json:"timeoutSeconds,omitempty"` // por requisicao, padrao 30
+	MaxRetries     int               `json:"maxRetries,omitempty"`     // tentativas extras em 429/5xx, padrao 3
+}
+
+// APIPagination define como buscar as proximas paginas.
+// Tipos: none (padrao), page, offset, cursor, link (cabecalho Link rel="next").
+type APIPagination struct {
+	Type       string `json:"type,omitempty"`
+	Param      string `json:"param,omitempty"`      // parametro da pagina/offset/cursor (padrao page, offset, cursor)
+	SizeParam  string `json:"sizeParam,omitempty"`  // parametro do tamanho da pagina (ex: per_page, limit)
+	Size       int    `json:"size,omitempty"`       // tamanho da pagina; pagina menor encerra page/offset
+	Start      int    `json:"start,omitempty"`      // primeira pagina (padrao 1) ou offset inicial (padrao 0)
+	CursorPath string `json:"cursorPath,omitempty"` // cursor: caminho do proximo cursor na resposta
+	MaxPages   int    `json:"maxPages,omitempty"`
+}
+
+// HTTPRequestSpec descreve a chamada do job http. URL, headers e body aceitam ${variaveis}.
+type HTTPRequestSpec struct {
+	Method         string            `json:"method,omitempty"` // padrao GET (POST quando ha body)
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Body           string            `json:"body,omitempty"`
+	TimeoutSeconds int               `json:"timeoutSeconds,omitempty"` // padrao 30
+	ExpectedStatus []int             `json:"expectedStatus,omitempty"` // vazio = qualquer 2xx
+	Assertions     []HTTPAssertion   `json:"assertions,omitempty"`
+}
+
+// HTTPAssertion valida o corpo da resposta.
+// Tipos: contains, not-contains, regex, json-equals, json-exists.
+type HTTPAssertion struct {
+	Type  string `json:"type"`
+	Path  string `json:"path,omitempty"` // json-*: caminho com pontos (ex: data.items.0.id)
+	Value string `json:"value,omitempty"`
+}
+
+// FileSpec descreve o arquivo lido ou gerado por jobs de arquivo.
+// Path e relativo ao diretorio output/ (export-file) ou input/ (import-file) do
+// projeto e aceita variaveis; na importacao tambem aceita glob (ex: vendas/*.csv).
+type FileSpec struct {
+	Path            string `json:"path"`
+	Format          string `json:"format,omitempty"`     // csv (padrao), jsonl ou parquet (apenas export)
+	Delimiter       string `json:"delimiter,omitempty"`  // csv: padrao ","; aceita "tab"
+	Quote           string `json:"quote,omitempty"`      // csv: caractere de aspas (padrao ")
+	QuoteMode       string `json:"quoteMode,omitempty"`  // csv: minimal (padrao), all ou none
+	Encoding        string `json:"encoding,omitempty"`   // utf-8 (padrao) ou latin1
+	NoHeader        bool   `json:"noHeader,omitempty"`   // csv: nao escreve a linha de cabecalho
+	NullValue       string `json:"nullValue,omitempty"`  // csv: texto usado para nulos (padrao vazio, tambem na leitura)
+	DateFormat      string `json:"dateFormat,omitempty"` // csv/jsonl: formato de data/hora (YYYY-MM-DD HH:mm:ss)
+	MaxRowsPerFile  int    `json:"maxRowsPerFile,omitempty"`
+	MaxBytesPerFile int64  `json:"maxBytesPerFile,omitempty"`
+
+	// import-file: schema do arquivo (vazio = cabecalho do csv ou chaves do jsonl)
+	Columns []FileColumn `json:"columns,omitempty"`
+}
+
+// FileColumn mapeia um campo do arquivo importado para uma coluna do job.
+type FileColumn struct {
+	Name        string `json:"name"`
+	Source      string `json:"source,omitempty"`      // nome no cabecalho/chave json (vazio = Name)
+	Type        string `json:"type,omitempty"`        // int, float, bool, date, datetime ou string (padrao)
+	InputFormat string `json:"inputFormat,omitempty"` // formato de data do arquivo
+}
+
+// LookupStep busca as chaves da linha em um map de memory-select e anexa colunas do map.
+// OnMissing: null (padrao), default (usa Defaults) ou reject (linha rejeitada).
+type LookupStep struct {
+	Map           string                 `json:"map"`
+	SourceColumns []string               `json:"sourceColumns"`
+	MapColumns    []string               `json:"mapColumns,omitempty"` // colunas-chave no map (vazio = SourceColumns)
+	Columns       []string               `json:"columns"`              // colunas do map anexadas a linha
+	Prefix        string                 `json:"prefix,omitempty"`     // prefixo das colunas anexadas
+	OnMissing     string                 `json:"onMissing,omitempty"`
+	Defaults      map[string]interface{} `json:"defaults,omitempty"` // valores por coluna anexada quando OnMissing = default
+}
+
+// ComputedColumn define uma coluna de destino calculada por expressao.
+type ComputedColumn struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// MaskingRule descreve o mascaramento de uma coluna.
+// Regras: hash, cpf, cnpj, redact, null, pseudonym, email, phone.
+// As regras deterministicas usam HMAC com a chave lida da variavel do projeto
+// (ou variavel de ambiente) indicada em Key; padrao ETL_MASKING_KEY.
+type MaskingRule struct {
+	Column    string `json:"column"`
+	Rule      string `json:"rule"`
+	Key       string `json:"key,omitempty"`
+	KeepStart int    `json:"keepStart,omitempty"` // redact/phone: caracteres preservados no inicio
+	KeepEnd   int    `json:"keepEnd,omitempty"`   // redact: caracteres preservados no final
+	MaskChar  string `json:"maskChar,omitempty"`  // redact: caractere de mascara (padrao *)
+	Length    int    `json:"length,omitempty"`    // hash: tamanho do hash em hexadecimal
+}
+
+// TransformStep descreve uma transformacao de linha.
+// Tipos: rename, cast, trim, default, concat, regex-replace, date-format, compute.
+type TransformStep struct {
+	Type        string   `json:"type"`
+	Column      string   `json:"column,omitempty"`      // coluna de origem
+	Target      string   `json:"target,omitempty"`      // coluna de destino (rename, concat, compute; vazio = Column)
+	Columns     []string `json:"columns,omitempty"`     // concat
+	To          string   `json:"to,omitempty"`          // cast: int, float, string, bool, date, datetime
+	Value       string   `json:"value,omitempty"`       // default, separador do concat, caracteres do trim
+	Pattern     string   `json:"pattern,omitempty"`     // regex-replace
+	Replacement string   `json:"replacement,omitempty"` // regex-replace
+	InputFormat string   `json:"inputFormat,omitempty"` // cast/date-format: formato de leitura (ex: DD/MM/YYYY)
+	Format      string   `json:"format,omitempty"`      // date-format: formato de saida
+	Expression  string   `json:"expression,omitempty"`  // compute: template com {{coluna}}
 }
 
 // UnmarshalJSON aceita tanto posInsertSql (novo) quanto posInsert (legado).
@@ -35,6 +327,51 @@ func (j *Job) UnmarshalJSON(data []byte) error {
 		StopOnError    bool     `json:"stopOnError"`
 		Left           int      `json:"left"`
 		Top            int      `json:"top"`
+
+		MaxRowsPerSecond int `json:"maxRowsPerSecond,omitempty"`
+		MaxSourceQueries int `json:"maxSourceQueries,omitempty"`
+
+		Priority int `json:"priority,omitempty"`
+		Weight   int `json:"weight,omitempty"`
+
+		ErrorMode       string `json:"errorMode,omitempty"`
+		DeadLetter      string `json:"deadLetter,omitempty"`
+		DeadLetterTable string `json:"deadLetterTable,omitempty"`
+		ErrorBudget     int    `json:"errorBudget,omitempty"`
+
+		Transforms []TransformStep `json:"transforms,omitempty"`
+		Masking    []MaskingRule   `json:"masking,omitempty"`
+
+		Filter          string           `json:"filter,omitempty"`
+		ComputedColumns []ComputedColumn `json:"computedColumns,omitempty"`
+
+		CacheTTLSeconds int `json:"cacheTtlSeconds,omitempty"`
+
+		Lookups []LookupStep `json:"lookups,omitempty"`
+
+		File *FileSpec `json:"file,omitempty"`
+
+		HTTP *HTTPRequestSpec `json:"http,omitempty"`
+
+		API *APISourceSpec `json:"api,omitempty"`
+
+		Subproject *SubprojectSpec `json:"subproject,omitempty"`
+
+		Foreach *ForeachSpec `json:"foreach,omitempty"`
+
+		SetVariable *SetVariableSpec `json:"setVariable,omitempty"`
+
+		Reconcile *ReconcileSpec `json:"reconcile,omitempty"`
+
+		SchemaSync *SchemaSyncSpec `json:"schemaSync,omitempty"`
+
+		Sensor *SensorSpec `json:"sensor,omitempty"`
+
+		CDC *CDCSpec `json:"cdc,omitempty"`
+
+		DeleteSync *DeleteSyncSpec `json:"deleteSync,omitempty"`
+
+		SCD2 *SCD2Spec `json:"scd2,omitempty"`
 	}
 
 	var aux jobJSON
@@ -59,6 +396,32 @@ func (j *Job) UnmarshalJSON(data []byte) error {
 	j.StopOnError = aux.StopOnError
 	j.Left = aux.Left
 	j.Top = aux.Top
+	j.MaxRowsPerSecond = aux.MaxRowsPerSecond
+	j.MaxSourceQueries = aux.MaxSourceQueries
+	j.Priority = aux.Priority
+	j.Weight = aux.Weight
+	j.ErrorMode = aux.ErrorMode
+	j.DeadLetter = aux.DeadLetter
+	j.DeadLetterTable = aux.DeadLetterTable
+	j.ErrorBudget = aux.ErrorBudget
+	j.Transforms = aux.Transforms
+	j.Masking = aux.Masking
+	j.Filter = aux.Filter
+	j.ComputedColumns = aux.ComputedColumns
+	j.CacheTTLSeconds = aux.CacheTTLSeconds
+	j.Lookups = aux.Lookups
+	j.File = aux.File
+	j.HTTP = aux.HTTP
+	j.API = aux.API
+	j.Subproject = aux.Subproject
+	j.Foreach = aux.Foreach
+	j.SetVariable = aux.SetVariable
+	j.Reconcile = aux.Reconcile
+	j.SchemaSync = aux.SchemaSync
+	j.Sensor = aux.Sensor
+	j.CDC = aux.CDC
+	j.DeleteSync = aux.DeleteSync
+	j.SCD2 = aux.SCD2
 
 	return nil
 }
@@ -80,6 +443,51 @@ func (j Job) MarshalJSON() ([]byte, error) {
 		StopOnError    bool     `json:"stopOnError"`
 		Left           int      `json:"left"`
 		Top            int      `json:"top"`
+
+		MaxRowsPerSecond int `json:"maxRowsPerSecond,omitempty"`
+		MaxSourceQueries int `json:"maxSourceQueries,omitempty"`
+
+		Priority int `json:"priority,omitempty"`
+		Weight   int `json:"weight,omitempty"`
+
+		ErrorMode       string `json:"errorMode,omitempty"`
+		DeadLetter      string `json:"deadLetter,omitempty"`
+		DeadLetterTable string `json:"deadLetterTable,omitempty"`
+		ErrorBudget     int    `json:"errorBudget,omitempty"`
+
+		Transforms []TransformStep `json:"transforms,omitempty"`
+		Masking    []MaskingRule   `json:"masking,omitempty"`
+
+		Filter          string           `json:"filter,omitempty"`
+		ComputedColumns []ComputedColumn `json:"computedColumns,omitempty"`
+
+		CacheTTLSeconds int `json:"cacheTtlSeconds,omitempty"`
+
+		Lookups []LookupStep `json:"lookups,omitempty"`
+
+		File *FileSpec `json:"file,omitempty"`
+
+		HTTP *HTTPRequestSpec `json:"http,omitempty"`
+
+		API *APISourceSpec `json:"api,omitempty"`
+
+		Subproject *SubprojectSpec `json:"subproject,omitempty"`
+
+		Foreach *ForeachSpec `json:"foreach,omitempty"`
+
+		SetVariable *SetVariableSpec `json:"setVariable,omitempty"`
+
+		Reconcile *ReconcileSpec `json:"reconcile,omitempty"`
+
+		SchemaSync *SchemaSyncSpec `json:"schemaSync,omitempty"`
+
+		Sensor *SensorSpec `json:"sensor,omitempty"`
+
+		CDC *CDCSpec `json:"cdc,omitempty"`
+
+		DeleteSync *DeleteSyncSpec `json:"deleteSync,omitempty"`
+
+		SCD2 *SCD2Spec `json:"scd2,omitempty"`
 	}
 
 	out := jobJSON{
@@ -97,6 +505,51 @@ func (j Job) MarshalJSON() ([]byte, error) {
 		StopOnError:    j.StopOnError,
 		Left:           j.Left,
 		Top:            j.Top,
+
+		MaxRowsPerSecond: j.MaxRowsPerSecond,
+		MaxSourceQueries: j.MaxSourceQueries,
+
+		Priority: j.Priority,
+		Weight:   j.Weight,
+
+		ErrorMode:       j.ErrorMode,
+		DeadLetter:      j.DeadLetter,
+		DeadLetterTable: j.DeadLetterTable,
+		ErrorBudget:     j.ErrorBudget,
+
+		Transforms: j.Transforms,
+		Masking:    j.Masking,
+
+		Filter:          j.Filter,
+		ComputedColumns: j.ComputedColumns,
+
+		CacheTTLSeconds: j.CacheTTLSeconds,
+
+		Lookups: j.Lookups,
+
+		File: j.File,
+
+		HTTP: j.HTTP,
+
+		API: j.API,
+
+		Subproject: j.Subproject,
+
+		Foreach: j.Foreach,
+
+		SetVariable: j.SetVariable,
+
+		Reconcile: j.Reconcile,
+
+		SchemaSync: j.SchemaSync,
+
+		Sensor: j.Sensor,
+
+		CDC: j.CDC,
+
+		DeleteSync: j.DeleteSync,
+
+		SCD2: j.SCD2,
 	}
 
 	return json.Marshal(out)
@@ -109,6 +562,12 @@ type ValidateJobRequest struct {
 	ProjectID      string `json:"projectId"`
 	Type           string `json:"type,omitempty"`
 	ValidationMode string `json:"validationMode,omitempty"`
+	Connection     string `json:"connection,omitempty"` // origem/destino (memory-select e validacao select-only)
+
+	// Expressoes do job, validadas antes da execucao
+	Filter          string           `json:"filter,omitempty"`
+	ComputedColumns []ComputedColumn `json:"computedColumns,omitempty"`
+	Lookups         []LookupStep     `json:"lookups,omitempty"`
 }
 
 type ValidateJobResponse struct {
@@ -7,6 +7,13 @@ type DatabaseConfig struct {
 	User     string `json:"user"`
 	Password string `json:"password"`
 	Database string `json:"database"`
+
+	// Pool de conexoes (0/vazio = padrao do driver)
+	MaxOpenConns           int    `json:"maxOpenConns,omitempty"`
+	MaxIdleConns           int    `json:"maxIdleConns,omitempty"`
+	ConnMaxLifetimeSeconds int    `json:"connMaxLifetimeSeconds,omitempty"`
+	StatementTimeoutMs     int    `json:"statementTimeoutMs,omitempty"`
+	ApplicationName        string `json:"applicationName,omitempty"`
 }
 
 type JobConnection struct {
@@ -52,4 +59,12 @@ type Project struct {
 	Concurrency         int             `json:"concurrency"`
 	Variables           []Variable      `json:"variables"`
 	VisualElements      []VisualElement `json:"visualElements,omitempty"`
+
+	// Protecao da origem (0 = sem limite)
+	MaxRowsPerSecond    int `json:"maxRowsPerSecond,omitempty"`
+	MaxSourceQueries    int `json:"maxSourceQueries,omitempty"`
+	MaxConcurrentCounts int `json:"maxConcurrentCounts,omitempty"`
+
+	// Quantidade maxima de jobs pesados (insert) rodando ao mesmo tempo (0 = sem limite)
+	MaxParallelJobs int `json:"maxParallelJobs,omitempty"`
 }